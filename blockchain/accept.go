@@ -22,10 +22,11 @@ import (
 // reorganize, the fork length will be 0.
 //
 // The flags are also passed to checkBlockContext and connectBestChain.  See
-// their documentation for how the flags modify their behavior.
+// their documentation for how the flags modify their behavior.  The provided
+// utxo view, which may be nil, is passed to connectBestChain.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) maybeAcceptBlock(block *dcrutil.Block, flags BehaviorFlags) (int64, error) {
+func (b *BlockChain) maybeAcceptBlock(block *dcrutil.Block, providedView *UtxoViewpoint, flags BehaviorFlags) (int64, error) {
 	// This function should never be called with orphan blocks or the
 	// genesis block.
 	prevHash := &block.MsgBlock().Header.PrevBlock
@@ -70,19 +71,31 @@ func (b *BlockChain) maybeAcceptBlock(block *dcrutil.Block, flags BehaviorFlags)
 		return 0, err
 	}
 
-	// Create a new block node for the block and add it to the block index.
-	// The block could either be on a side chain or the main chain, but it
-	// starts off as a side chain regardless.
+	// Create a new block node for the block and add it to the block index
+	// unless its header was already added via ProcessBlockHeaders, in which
+	// case the existing header-only node is updated to reflect that the block
+	// data is now available.  The block could either be on a side chain or
+	// the main chain, but it starts off as a side chain regardless.
 	blockHeader := &block.MsgBlock().Header
-	newNode := newBlockNode(blockHeader, prevNode)
-	newNode.populateTicketInfo(stake.FindSpentTicketsInBlock(block.MsgBlock()))
-	newNode.status = statusDataStored
-	b.index.AddNode(newNode)
+	spentTickets := stake.FindSpentTicketsInBlock(block.MsgBlock())
+	newNode := b.index.LookupNode(block.Hash())
+	if newNode == nil {
+		newNode = newBlockNode(blockHeader, prevNode)
+		newNode.populateTicketInfo(spentTickets)
+		newNode.status = statusDataStored
+		b.index.AddNode(newNode)
+	} else {
+		newNode.populateTicketInfo(spentTickets)
+		b.index.SetStatusFlags(newNode, statusDataStored)
+	}
 
-	// Ensure the new block index entry is written to the database.
-	err = b.flushBlockIndex()
-	if err != nil {
-		return 0, err
+	// Ensure the new block index entry is written to the database unless
+	// flushing is deferred to the background.
+	if b.indexFlushInterval == 0 {
+		err = b.flushBlockIndex()
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	// Notify the caller when the block intends to extend the main chain,
@@ -123,7 +136,8 @@ func (b *BlockChain) maybeAcceptBlock(block *dcrutil.Block, flags BehaviorFlags)
 	// Connect the passed block to the chain while respecting proper chain
 	// selection according to the chain with the most proof of work.  This
 	// also handles validation of the transaction scripts.
-	forkLen, err := b.connectBestChain(newNode, block, parent, flags)
+	forkLen, err := b.connectBestChain(newNode, block, parent, providedView,
+		flags)
 	if err != nil {
 		return 0, err
 	}
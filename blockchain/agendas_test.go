@@ -181,3 +181,191 @@ func TestLNFeaturesDeployment(t *testing.T) {
 	testLNFeaturesDeployment(t, &chaincfg.MainNetParams, 5)
 	testLNFeaturesDeployment(t, &chaincfg.RegNetParams, 6)
 }
+
+// TestMaxBlockSizeForHeight ensures the maximum block size reported for the
+// block after a given main chain height honors the state of the max block size
+// agenda around its activation boundary.
+func TestMaxBlockSizeForHeight(t *testing.T) {
+	// Find the deployment for the max block size agenda and ensure it
+	// never expires to prevent test failures when the real expiration time
+	// passes.  Also, clone the parameters first to avoid mutating them.
+	const deploymentVer = 4
+	params := cloneParams(&chaincfg.RegNetParams)
+	var deployment *chaincfg.ConsensusDeployment
+	deployments := params.Deployments[deploymentVer]
+	for deploymentID, depl := range deployments {
+		if depl.Vote.Id == chaincfg.VoteIDMaxBlockSize {
+			deployment = &deployments[deploymentID]
+			break
+		}
+	}
+	if deployment == nil {
+		t.Fatalf("Unable to find consensus deployement for %s",
+			chaincfg.VoteIDMaxBlockSize)
+	}
+	deployment.ExpireTime = math.MaxUint64 // Never expires.
+
+	// Find the correct choice for the yes vote.
+	const yesVoteID = "yes"
+	var yesChoice chaincfg.Choice
+	for _, choice := range deployment.Vote.Choices {
+		if choice.Id == yesVoteID {
+			yesChoice = choice
+		}
+	}
+	if yesChoice.Id != yesVoteID {
+		t.Fatalf("Unable to find vote choice for id %q", yesVoteID)
+	}
+
+	// Create a fake chain that votes yes on the agenda through the point it
+	// becomes active.  The agenda starts at the first rule change interval
+	// after stake validation height, locks in one interval later, and
+	// becomes active one interval after that.
+	stakeValidationHeight := params.StakeValidationHeight
+	interval := int64(params.RuleChangeActivationInterval)
+	activeHeight := stakeValidationHeight + interval*3
+	curTimestamp := time.Now()
+	bc := newFakeChain(params)
+	node := bc.bestChain.Tip()
+	for node.height < activeHeight+1 {
+		node = newFakeNode(node, deploymentVer, deploymentVer, 0,
+			curTimestamp)
+		for j := uint16(0); j < params.TicketsPerBlock; j++ {
+			node.votes = append(node.votes, stake.VoteVersionTuple{
+				Version: deploymentVer,
+				Bits:    yesChoice.Bits | 0x01,
+			})
+		}
+		bc.bestChain.SetTip(node)
+		curTimestamp = curTimestamp.Add(time.Second)
+	}
+
+	oldSize := int64(params.MaximumBlockSizes[0])
+	newSize := int64(params.MaximumBlockSizes[1])
+	tests := []struct {
+		name   string
+		height int64
+		want   int64
+	}{
+		{"genesis", 0, oldSize},
+		{"stake validation height", stakeValidationHeight, oldSize},
+		{"two before active", activeHeight - 2, oldSize},
+		{"one before active", activeHeight - 1, newSize},
+		{"exactly active", activeHeight, newSize},
+		{"one after active", activeHeight + 1, newSize},
+	}
+	for _, test := range tests {
+		got, err := bc.MaxBlockSizeForHeight(test.height)
+		if err != nil {
+			t.Errorf("%s: unexpected err: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: mismatched max block size - got %d, want %d",
+				test.name, got, test.want)
+		}
+	}
+
+	// Ensure requesting a height beyond the main chain returns an error.
+	if _, err := bc.MaxBlockSizeForHeight(node.height + 1); err == nil {
+		t.Fatal("MaxBlockSizeForHeight did not fail for unknown height")
+	}
+}
+
+// TestAgendaActivationHeight ensures the activation height of an agenda is
+// reported once it becomes active and not before.
+func TestAgendaActivationHeight(t *testing.T) {
+	// Find the deployment for the max block size agenda and ensure it
+	// never expires to prevent test failures when the real expiration time
+	// passes.  Also, clone the parameters first to avoid mutating them.
+	const deploymentVer = 4
+	params := cloneParams(&chaincfg.RegNetParams)
+	var deployment *chaincfg.ConsensusDeployment
+	deployments := params.Deployments[deploymentVer]
+	for deploymentID, depl := range deployments {
+		if depl.Vote.Id == chaincfg.VoteIDMaxBlockSize {
+			deployment = &deployments[deploymentID]
+			break
+		}
+	}
+	if deployment == nil {
+		t.Fatalf("Unable to find consensus deployement for %s",
+			chaincfg.VoteIDMaxBlockSize)
+	}
+	deployment.ExpireTime = math.MaxUint64 // Never expires.
+
+	// Find the correct choice for the yes vote.
+	const yesVoteID = "yes"
+	var yesChoice chaincfg.Choice
+	for _, choice := range deployment.Vote.Choices {
+		if choice.Id == yesVoteID {
+			yesChoice = choice
+		}
+	}
+	if yesChoice.Id != yesVoteID {
+		t.Fatalf("Unable to find vote choice for id %q", yesVoteID)
+	}
+
+	// The agenda starts at the first rule change interval after stake
+	// validation height, locks in one interval later, and becomes active
+	// one interval after that.
+	stakeValidationHeight := params.StakeValidationHeight
+	interval := int64(params.RuleChangeActivationInterval)
+	activeHeight := stakeValidationHeight + interval*3
+	tests := []struct {
+		name       string
+		tipHeight  int64
+		wantActive bool
+	}{
+		{"genesis", 0, false},
+		{"stake validation height", stakeValidationHeight, false},
+		{"lockedin", stakeValidationHeight + interval*2, false},
+		{"one before active", activeHeight - 1, false},
+		{"exactly active", activeHeight, true},
+		{"one after active", activeHeight + 1, true},
+		{"next interval", activeHeight + interval + 1, true},
+	}
+
+	// Create a fake chain that votes yes on the agenda and ensure the
+	// activation height is reported as expected as it is extended.
+	curTimestamp := time.Now()
+	bc := newFakeChain(params)
+	node := bc.bestChain.Tip()
+	for _, test := range tests {
+		for node.height < test.tipHeight {
+			node = newFakeNode(node, deploymentVer, deploymentVer, 0,
+				curTimestamp)
+			for j := uint16(0); j < params.TicketsPerBlock; j++ {
+				node.votes = append(node.votes, stake.VoteVersionTuple{
+					Version: deploymentVer,
+					Bits:    yesChoice.Bits | 0x01,
+				})
+			}
+			bc.bestChain.SetTip(node)
+			curTimestamp = curTimestamp.Add(time.Second)
+		}
+
+		height, active, err := bc.AgendaActivationHeight(deploymentVer,
+			chaincfg.VoteIDMaxBlockSize)
+		if err != nil {
+			t.Errorf("%s: unexpected err: %v", test.name, err)
+			continue
+		}
+		wantHeight := int64(0)
+		if test.wantActive {
+			wantHeight = activeHeight
+		}
+		if active != test.wantActive || height != wantHeight {
+			t.Errorf("%s: mismatched activation - got (%d, %v), want "+
+				"(%d, %v)", test.name, height, active, wantHeight,
+				test.wantActive)
+		}
+	}
+
+	// Ensure requesting an unknown agenda returns an error.
+	_, _, err := bc.AgendaActivationHeight(deploymentVer, "unknown")
+	if _, ok := err.(DeploymentError); !ok {
+		t.Fatalf("unexpected error for unknown agenda - got %v (%T), want "+
+			"%T", err, err, DeploymentError(""))
+	}
+}
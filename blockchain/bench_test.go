@@ -5,5 +5,38 @@
 
 package blockchain
 
+import (
+	"testing"
+
+	"github.com/decred/dcrd/chaincfg"
+)
+
 // TODO Make benchmarking tests for various functions, such as sidechain
 // evaluation.
+
+// BenchmarkLatestBlockLocator benchmarks obtaining the block locator for the
+// tip of the main chain both when it is cached and when it has to be
+// recalculated due to the tip changing.
+func BenchmarkLatestBlockLocator(b *testing.B) {
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branchNodes := chainedFakeNodes(chain.bestChain.Genesis(), 100000)
+	for _, node := range branchNodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(branchTip(branchNodes))
+
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			chain.LatestBlockLocator()
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			chain.invalidateLatestLocator()
+			chain.LatestBlockLocator()
+		}
+	})
+}
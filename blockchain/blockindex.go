@@ -43,6 +43,10 @@ const (
 	// statusInvalidAncestor indicates that one of the ancestors of the block
 	// has failed validation, thus the block is also invalid.
 	statusInvalidAncestor blockStatus = 1 << 3
+
+	// statusTrusted indicates that the block was marked valid because it
+	// was trusted to be valid as opposed to being fully validated.
+	statusTrusted blockStatus = 1 << 4
 )
 
 // HaveData returns whether the full block data is stored in the database.  This
@@ -58,6 +62,12 @@ func (status blockStatus) KnownValid() bool {
 	return status&statusValid != 0
 }
 
+// Trusted returns whether the block was trusted to be valid when it was
+// connected as opposed to being fully validated.
+func (status blockStatus) Trusted() bool {
+	return status&statusTrusted != 0
+}
+
 // KnownInvalid returns whether the block is known to be invalid.  This will
 // return false for invalid blocks that have not been proven invalid yet.
 func (status blockStatus) KnownInvalid() bool {
@@ -321,10 +331,17 @@ type blockIndex struct {
 	// since the last time the index was flushed to disk.
 	//
 	// chainTips contains an entry with the tip of all known side chains.
+	//
+	// prunedInvalid contains an entry for every node that was pruned from
+	// the index due to having an invalid ancestor.  Note that it is not
+	// bounded since the hashes are needed to keep rejecting the blocks and
+	// it is only kept in memory, so the blocks are no longer known to be
+	// pruned after a restart.
 	sync.RWMutex
-	index     map[chainhash.Hash]*blockNode
-	modified  map[*blockNode]struct{}
-	chainTips map[int64][]*blockNode
+	index         map[chainhash.Hash]*blockNode
+	modified      map[*blockNode]struct{}
+	chainTips     map[int64][]*blockNode
+	prunedInvalid map[chainhash.Hash]struct{}
 }
 
 // newBlockIndex returns a new empty instance of a block index.  The index will
@@ -332,22 +349,27 @@ type blockIndex struct {
 // manually added.
 func newBlockIndex(db database.DB, chainParams *chaincfg.Params) *blockIndex {
 	return &blockIndex{
-		db:          db,
-		chainParams: chainParams,
-		index:       make(map[chainhash.Hash]*blockNode),
-		modified:    make(map[*blockNode]struct{}),
-		chainTips:   make(map[int64][]*blockNode),
+		db:            db,
+		chainParams:   chainParams,
+		index:         make(map[chainhash.Hash]*blockNode),
+		modified:      make(map[*blockNode]struct{}),
+		chainTips:     make(map[int64][]*blockNode),
+		prunedInvalid: make(map[chainhash.Hash]struct{}),
 	}
 }
 
 // HaveBlock returns whether or not the block index contains the provided hash
-// and the block data is available.
+// and the block data is available or the block was pruned from the index due
+// to having an invalid ancestor.
 //
 // This function is safe for concurrent access.
 func (bi *blockIndex) HaveBlock(hash *chainhash.Hash) bool {
 	bi.RLock()
 	node := bi.index[*hash]
 	hasBlock := node != nil && node.status.HaveData()
+	if !hasBlock {
+		_, hasBlock = bi.prunedInvalid[*hash]
+	}
 	bi.RUnlock()
 	return hasBlock
 }
@@ -419,6 +441,77 @@ func (bi *blockIndex) lookupNode(hash *chainhash.Hash) *blockNode {
 	return bi.index[*hash]
 }
 
+// pruneInvalidDescendants removes all descendants of the provided node, which
+// must have failed validation, from the index map and returns the number of
+// nodes that were removed.  The removed nodes are marked as having an invalid
+// ancestor so the status is written to the database on the next flush and
+// their hashes are recorded so they can still be identified as invalid.  The
+// provided node becomes a chain tip since it no longer has any descendants.
+//
+// The descendants are found by walking back from the chain tips since the
+// index does not track the children of nodes.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) pruneInvalidDescendants(invalid *blockNode) int {
+	bi.Lock()
+	defer bi.Unlock()
+
+	var tips []*blockNode
+	for height, nodes := range bi.chainTips {
+		if height > invalid.height {
+			tips = append(tips, nodes...)
+		}
+	}
+
+	var numPruned int
+	for _, tip := range tips {
+		ancestor := tip
+		for ancestor.height > invalid.height {
+			ancestor = ancestor.parent
+		}
+		if ancestor != invalid {
+			continue
+		}
+
+		bi.removeChainTip(tip)
+		for n := tip; n != invalid; n = n.parent {
+			if _, ok := bi.prunedInvalid[n.hash]; ok {
+				break
+			}
+			if n.status&statusInvalidAncestor == 0 {
+				n.status |= statusInvalidAncestor
+				bi.modified[n] = struct{}{}
+			}
+			delete(bi.index, n.hash)
+			bi.prunedInvalid[n.hash] = struct{}{}
+			numPruned++
+		}
+	}
+	if numPruned == 0 {
+		return 0
+	}
+
+	// Make the invalid node a chain tip when it is not already one.
+	for _, n := range bi.chainTips[invalid.height] {
+		if n == invalid {
+			return numPruned
+		}
+	}
+	bi.addChainTip(invalid)
+	return numPruned
+}
+
+// IsPrunedInvalid returns whether or not the block identified by the provided
+// hash was pruned from the index due to having an invalid ancestor.
+//
+// This function is safe for concurrent access.
+func (bi *blockIndex) IsPrunedInvalid(hash *chainhash.Hash) bool {
+	bi.RLock()
+	_, ok := bi.prunedInvalid[*hash]
+	bi.RUnlock()
+	return ok
+}
+
 // LookupNode returns the block node identified by the provided hash.  It will
 // return nil if there is no entry for the hash.
 //
@@ -7,11 +7,15 @@ package blockchain
 
 import (
 	"container/list"
+	"encoding/binary"
 	"fmt"
 	"math/big"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/decred/dcrd/blockchain/internal/dbnamespace"
 	"github.com/decred/dcrd/blockchain/stake"
 	"github.com/decred/dcrd/chaincfg"
 	"github.com/decred/dcrd/chaincfg/chainhash"
@@ -42,6 +46,17 @@ const (
 	// mainchainBlockCacheSize is the number of mainchain blocks to
 	// keep in memory, by height from the tip of the mainchain.
 	mainchainBlockCacheSize = 12
+
+	// defaultBestStateHistorySize is the default number of recent best
+	// chain states to keep in memory when no size is specified in the
+	// config.
+	defaultBestStateHistorySize = 10
+
+	// defaultTimeAnomalyFactor is the default multiple of the target time
+	// per block the spacing between the median times of consecutive main
+	// chain blocks must exceed before the time anomaly callback is invoked
+	// when no factor is specified in the config.
+	defaultTimeAnomalyFactor = 10
 )
 
 // panicf is a convenience function that formats according to the given format
@@ -74,6 +89,7 @@ type BlockLocator []*chainhash.Hash
 // forever.
 type orphanBlock struct {
 	block      *dcrutil.Block
+	received   time.Time
 	expiration time.Time
 }
 
@@ -101,6 +117,8 @@ type BestState struct {
 	NextWinningTickets []chainhash.Hash // The eligible tickets to vote on the next block.
 	MissedTickets      []chainhash.Hash // The missed tickets set to be revoked.
 	NextFinalState     [6]byte          // The calculated state of the lottery for the next block.
+	NumUtxos           int64            // The number of unspent outputs in the utxo set.
+	UtxoAmount         int64            // The total amount of all unspent outputs.
 }
 
 // newBestState returns a new best stats instance for the given parameters.
@@ -130,6 +148,311 @@ func newBestState(node *blockNode, blockSize, numTxns, totalTxns uint64,
 	}
 }
 
+const (
+	// bestStateSerializeVersion is the current version of the serialized
+	// format produced by BestState.MarshalBinary.
+	bestStateSerializeVersion = 1
+
+	// bestStateFixedSize is the size of the fields of a serialized best
+	// state that do not vary in length.  It is the version, hash, previous
+	// hash, height, bits, next pool size, next stake difficulty, block size,
+	// number of transactions, total transactions, median time, total
+	// subsidy, next final state, number of utxos, utxo amount and the
+	// number of next winning and missed tickets.
+	bestStateFixedSize = 1 + chainhash.HashSize*2 + 8 + 4 + 4 + 8 + 8 + 8 +
+		8 + 8 + 8 + 6 + 8 + 8 + 4 + 4
+)
+
+// MarshalBinary returns the best state serialized in a stable format suitable
+// for sending it across process boundaries.  It implements the
+// encoding.BinaryMarshaler interface.
+//
+// The serialized format is:
+//
+//   <version><hash><prev hash><height><bits><next pool size><next stake diff>
+//   <block size><num txns><total txns><median time><total subsidy>
+//   <next final state><num utxos><utxo amount>
+//   <num next winners><next winners><num missed><missed>
+//
+//   Field              Type              Size
+//   version            uint8             1
+//   hash               chainhash.Hash    chainhash.HashSize
+//   prev hash          chainhash.Hash    chainhash.HashSize
+//   height             int64             8
+//   bits               uint32            4
+//   next pool size     uint32            4
+//   next stake diff    int64             8
+//   block size         uint64            8
+//   num txns           uint64            8
+//   total txns         uint64            8
+//   median time        int64             8 (seconds since the unix epoch)
+//   total subsidy      int64             8
+//   next final state   [6]byte           6
+//   num utxos          int64             8
+//   utxo amount        int64             8
+//   num next winners   uint32            4
+//   next winners       []chainhash.Hash  chainhash.HashSize * num next winners
+//   num missed         uint32            4
+//   missed             []chainhash.Hash  chainhash.HashSize * num missed
+//
+// All integers are encoded in little endian.
+func (s *BestState) MarshalBinary() ([]byte, error) {
+	serializedLen := bestStateFixedSize + chainhash.HashSize*
+		(len(s.NextWinningTickets)+len(s.MissedTickets))
+	serialized := make([]byte, serializedLen)
+	byteOrder := binary.LittleEndian
+	serialized[0] = bestStateSerializeVersion
+	offset := 1
+	putHash := func(hash *chainhash.Hash) {
+		copy(serialized[offset:], hash[:])
+		offset += chainhash.HashSize
+	}
+	putUint32 := func(v uint32) {
+		byteOrder.PutUint32(serialized[offset:], v)
+		offset += 4
+	}
+	putUint64 := func(v uint64) {
+		byteOrder.PutUint64(serialized[offset:], v)
+		offset += 8
+	}
+	putHash(&s.Hash)
+	putHash(&s.PrevHash)
+	putUint64(uint64(s.Height))
+	putUint32(s.Bits)
+	putUint32(s.NextPoolSize)
+	putUint64(uint64(s.NextStakeDiff))
+	putUint64(s.BlockSize)
+	putUint64(s.NumTxns)
+	putUint64(s.TotalTxns)
+	putUint64(uint64(s.MedianTime.Unix()))
+	putUint64(uint64(s.TotalSubsidy))
+	offset += copy(serialized[offset:], s.NextFinalState[:])
+	putUint64(uint64(s.NumUtxos))
+	putUint64(uint64(s.UtxoAmount))
+	putUint32(uint32(len(s.NextWinningTickets)))
+	for i := range s.NextWinningTickets {
+		putHash(&s.NextWinningTickets[i])
+	}
+	putUint32(uint32(len(s.MissedTickets)))
+	for i := range s.MissedTickets {
+		putHash(&s.MissedTickets[i])
+	}
+	return serialized, nil
+}
+
+// UnmarshalBinary decodes the best state from the format produced by
+// MarshalBinary.  It implements the encoding.BinaryUnmarshaler interface.
+//
+// The median time is decoded with a precision of one second and the ticket
+// slices are nil when they are empty.
+func (s *BestState) UnmarshalBinary(serialized []byte) error {
+	if len(serialized) < bestStateFixedSize {
+		return errDeserialize(fmt.Sprintf("unexpected end of data for "+
+			"best state -- got %d bytes, want at least %d",
+			len(serialized), bestStateFixedSize))
+	}
+	if serialized[0] != bestStateSerializeVersion {
+		return errDeserialize(fmt.Sprintf("unsupported best state "+
+			"version %d", serialized[0]))
+	}
+
+	var state BestState
+	byteOrder := binary.LittleEndian
+	offset := 1
+	getHash := func(hash *chainhash.Hash) {
+		copy(hash[:], serialized[offset:])
+		offset += chainhash.HashSize
+	}
+	getUint32 := func() uint32 {
+		v := byteOrder.Uint32(serialized[offset:])
+		offset += 4
+		return v
+	}
+	getUint64 := func() uint64 {
+		v := byteOrder.Uint64(serialized[offset:])
+		offset += 8
+		return v
+	}
+	getHashes := func(fieldName string) ([]chainhash.Hash, error) {
+		if len(serialized[offset:]) < 4 {
+			return nil, errDeserialize(fmt.Sprintf("unexpected end of "+
+				"data for best state %s count", fieldName))
+		}
+		count := getUint32()
+		if count == 0 {
+			return nil, nil
+		}
+		if uint64(len(serialized[offset:])) < uint64(count)*chainhash.HashSize {
+			return nil, errDeserialize(fmt.Sprintf("unexpected end of "+
+				"data for best state %s -- got %d bytes, want %d",
+				fieldName, len(serialized[offset:]),
+				uint64(count)*chainhash.HashSize))
+		}
+		hashes := make([]chainhash.Hash, count)
+		for i := range hashes {
+			getHash(&hashes[i])
+		}
+		return hashes, nil
+	}
+	getHash(&state.Hash)
+	getHash(&state.PrevHash)
+	state.Height = int64(getUint64())
+	state.Bits = getUint32()
+	state.NextPoolSize = getUint32()
+	state.NextStakeDiff = int64(getUint64())
+	state.BlockSize = getUint64()
+	state.NumTxns = getUint64()
+	state.TotalTxns = getUint64()
+	state.MedianTime = time.Unix(int64(getUint64()), 0)
+	state.TotalSubsidy = int64(getUint64())
+	offset += copy(state.NextFinalState[:], serialized[offset:])
+	state.NumUtxos = int64(getUint64())
+	state.UtxoAmount = int64(getUint64())
+	var err error
+	state.NextWinningTickets, err = getHashes("next winning tickets")
+	if err != nil {
+		return err
+	}
+	state.MissedTickets, err = getHashes("missed tickets")
+	if err != nil {
+		return err
+	}
+	if offset != len(serialized) {
+		return errDeserialize(fmt.Sprintf("unexpected %d trailing bytes "+
+			"in best state", len(serialized)-offset))
+	}
+
+	*s = state
+	return nil
+}
+
+// NextBlockInfo houses the values the header of a block that extends the
+// current best chain is required to carry.
+type NextBlockInfo struct {
+	PrevHash     chainhash.Hash // The hash of the current best block.
+	Height       int64          // The height of the next block.
+	Bits         uint32         // The required proof-of-work difficulty bits.
+	SBits        int64          // The required stake difficulty.
+	StakeVersion uint32         // The required stake version.
+	MedianTime   time.Time      // The timestamp must be after this time.
+	Timestamp    time.Time      // The timestamp used to calculate the bits.
+}
+
+// ReorgStats houses cumulative statistics about the chain reorganizations that
+// have taken place since the chain instance was created.
+//
+// The statistics are only tracked in memory, so they are reset on restart.
+type ReorgStats struct {
+	TotalReorgs    uint64 // The total number of reorganizations.
+	BlocksDetached uint64 // The total number of blocks detached.
+	BlocksAttached uint64 // The total number of blocks attached.
+	DeepestReorg   int64  // The most blocks detached by a single reorg.
+}
+
+// ReorgLogStage identifies a milestone of a chain reorganization reported via
+// a ReorgLogEvent.
+type ReorgLogStage int
+
+// These constants define the milestones of a chain reorganization that are
+// reported to the structured reorg logger.
+const (
+	// ReorgForkFound indicates the new best chain was fully validated and
+	// the reorganization is commencing from the fork point.
+	ReorgForkFound ReorgLogStage = iota
+
+	// ReorgDetachDone indicates all blocks of the old best chain back to
+	// the fork point have been disconnected.
+	ReorgDetachDone
+
+	// ReorgAttachDone indicates all blocks of the new best chain have been
+	// connected and the reorganization is complete.
+	ReorgAttachDone
+)
+
+// reorgLogStageStrings is a map of reorg log stages back to their constant
+// names for pretty printing.
+var reorgLogStageStrings = map[ReorgLogStage]string{
+	ReorgForkFound:  "ReorgForkFound",
+	ReorgDetachDone: "ReorgDetachDone",
+	ReorgAttachDone: "ReorgAttachDone",
+}
+
+// String returns the ReorgLogStage as a human-readable name.
+func (s ReorgLogStage) String() string {
+	if str, ok := reorgLogStageStrings[s]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown ReorgLogStage (%d)", int(s))
+}
+
+// ReorgLogEvent houses the details of a chain reorganization milestone in a
+// form that is suitable for feeding into structured log pipelines.
+type ReorgLogEvent struct {
+	Stage       ReorgLogStage  // The reorganization milestone reached.
+	ForkHash    chainhash.Hash // The hash of the fork point.
+	ForkHeight  int64          // The height of the fork point.
+	OldHash     chainhash.Hash // The hash of the old best chain head.
+	OldHeight   int64          // The height of the old best chain head.
+	NewHash     chainhash.Hash // The hash of the new best chain head.
+	NewHeight   int64          // The height of the new best chain head.
+	NumDetached int            // The number of blocks to detach.
+	NumAttached int            // The number of blocks to attach.
+}
+
+// ConnectTimings houses cumulative statistics about how long it has taken to
+// commit blocks connected to and disconnected from the main chain to the
+// database since the chain instance was created.  Unlike the timings reported
+// via the OnBlockValidated callback, these only cover the database updates, so
+// they are useful for distinguishing database bound slowness from validation
+// slowness.
+//
+// The statistics are only tracked in memory, so they are reset on restart.
+type ConnectTimings struct {
+	NumConnected        uint64        // The number of blocks connected.
+	TotalConnectTime    time.Duration // Total time to commit connected blocks.
+	NumDisconnected     uint64        // The number of blocks disconnected.
+	TotalDisconnectTime time.Duration // Total time to commit disconnected blocks.
+}
+
+// AvgConnectTime returns the average time it took to commit a connected block
+// to the database or zero when no blocks have been connected.
+func (t *ConnectTimings) AvgConnectTime() time.Duration {
+	if t.NumConnected == 0 {
+		return 0
+	}
+	return t.TotalConnectTime / time.Duration(t.NumConnected)
+}
+
+// AvgDisconnectTime returns the average time it took to commit a disconnected
+// block to the database or zero when no blocks have been disconnected.
+func (t *ConnectTimings) AvgDisconnectTime() time.Duration {
+	if t.NumDisconnected == 0 {
+		return 0
+	}
+	return t.TotalDisconnectTime / time.Duration(t.NumDisconnected)
+}
+
+// MaxChainHeightError identifies an attempt to connect a block above the
+// maximum height configured via Config.MaxChainHeight.  It is not a rule
+// violation, so the block remains known to the chain and is not marked invalid.
+type MaxChainHeightError struct {
+	Height    int64 // The height of the block.
+	MaxHeight int64 // The configured maximum height.
+}
+
+// Error implements the error interface.
+func (e MaxChainHeightError) Error() string {
+	return fmt.Sprintf("block height %d exceeds the configured maximum "+
+		"chain height of %d", e.Height, e.MaxHeight)
+}
+
+// invalidBlock houses a block that failed validation along with the rule error
+// that caused it to fail.
+type invalidBlock struct {
+	hash chainhash.Hash
+	err  RuleError
+}
+
 // BlockChain provides functions for working with the Decred block chain.
 // It includes functionality such as rejecting duplicate blocks, ensuring blocks
 // follow all rules, orphan handling, checkpoint handling, and best chain
@@ -140,6 +463,7 @@ type BlockChain struct {
 	// separate mutex.
 	checkpointsByHeight map[int64]*chaincfg.Checkpoint
 	db                  database.DB
+	readDB              database.DB
 	dbInfo              *databaseInfo
 	chainParams         *chaincfg.Params
 	timeSource          MedianTimeSource
@@ -147,6 +471,84 @@ type BlockChain struct {
 	sigCache            *txscript.SigCache
 	indexManager        IndexManager
 	interrupt           <-chan struct{}
+	onBlockValidated    func(*chainhash.Hash, int64, time.Duration)
+	onSpendJournal      func(*chainhash.Hash, []SpentTxOut)
+	onBlockInvalid      func(*chainhash.Hash, RuleError)
+	reorgLogger         func(ReorgLogEvent)
+	onTimeAnomaly       func(int64, time.Duration, time.Duration)
+	timeAnomalyFactor   float64
+	onGenesisLoaded     func(*dcrutil.Block) error
+
+	// eagerSideChainValidation indicates whether side chain blocks are
+	// fully validated when they are first connected rather than only when
+	// a reorganize to them occurs.
+	eagerSideChainValidation bool
+
+	// disableOrphans indicates whether blocks with an unknown parent are
+	// rejected rather than added to the orphan pool.
+	disableOrphans bool
+
+	// recoverNtfnPanics indicates whether panics in the notification
+	// callback are recovered and logged rather than propagated.
+	recoverNtfnPanics bool
+
+	// fastAddStillChecksMerkle indicates whether the header commitments to
+	// the ticket lottery are still checked for blocks processed with the
+	// BFFastAdd flag.
+	fastAddStillChecksMerkle bool
+
+	// pruneInvalidSubtrees indicates whether the descendants of blocks that
+	// failed validation are pruned from the block index once they are
+	// marked as having an invalid ancestor.
+	pruneInvalidSubtrees bool
+
+	// maxFutureBlockTime is the maximum amount of time a block timestamp
+	// is allowed to be ahead of the adjusted time.
+	maxFutureBlockTime time.Duration
+
+	// interruptCheckInterval is the number of blocks processed between
+	// checks of the interrupt channel while validating a reorganization.
+	interruptCheckInterval int
+
+	// maxChainHeight is the maximum height of blocks that are connected to
+	// the main chain.  It is zero when the height is unlimited.
+	maxChainHeight int64
+
+	// indexErrorsFatal indicates whether errors from the index manager
+	// prevent blocks from being connected and disconnected instead of
+	// disabling the indexes.
+	indexErrorsFatal bool
+
+	// retainAllStakeNodes indicates whether the stake nodes of all blocks
+	// are kept in memory instead of being pruned.
+	retainAllStakeNodes bool
+
+	// splitWarnThreshold is the number of blocks worth of work within
+	// which a side chain must come of overtaking the main chain in order
+	// to send a NTDeepForkDetected notification.  It is zero when the
+	// notifications are disabled.
+	splitWarnThreshold int64
+
+	// reorgStickinessWork is the amount of work by which a side chain must
+	// exceed the current best chain in order to cause a reorganize.  It is
+	// nil when a side chain only needs to have more work.
+	reorgStickinessWork *big.Int
+
+	// minimumChainWork is the minimum cumulative work the main chain tip
+	// must exceed before the chain considers itself current.  It is nil
+	// when there is no minimum.
+	minimumChainWork *big.Int
+
+	// indexFlushInterval is the interval at which modified block index
+	// entries are flushed to the database in the background.  It is zero
+	// when they are flushed as part of connecting and disconnecting blocks.
+	//
+	// indexFlushQuit and indexFlushWg are used to stop the background
+	// flushing and closeOnce ensures it is only stopped once.
+	indexFlushInterval time.Duration
+	indexFlushQuit     chan struct{}
+	indexFlushWg       sync.WaitGroup
+	closeOnce          sync.Once
 
 	// subsidyCache is the cache that provides quick lookup of subsidy
 	// values.
@@ -161,6 +563,48 @@ type BlockChain struct {
 	noVerify      bool
 	noCheckpoints bool
 
+	// assumeValid is the hash of the block set via SetAssumeValid.  The
+	// scripts of the block and all of its ancestors are assumed to be valid.
+	// It is nil when no block is assumed valid.
+	//
+	// assumeValidChain is a view of the chain that ends with the assumed
+	// valid block which provides efficient ancestor checks.  It is nil until
+	// the block is in the block index.
+	//
+	// They are protected by the chain lock.
+	assumeValid      *chainhash.Hash
+	assumeValidChain *chainView
+
+	// indexManagerDisabled indicates the index manager is no longer
+	// invoked because it returned an error while index errors are not
+	// fatal.  It is protected by the chain lock.
+	indexManagerDisabled bool
+
+	// lastTipChange is the wall clock time the tip of the main chain last
+	// changed, or the chain instance was created when it has not changed
+	// since then.  It is protected by the chain lock.
+	lastTipChange time.Time
+
+	// tipCaptures houses the best state produced by connecting blocks that
+	// are being processed via ProcessBlockWithTip, keyed by block hash.
+	// An entry is added for a block before it is processed and its value
+	// is set when the block is connected to the main chain.  It is
+	// protected by the chain lock.
+	tipCaptures map[chainhash.Hash]*BestState
+
+	// paused indicates block processing has been paused via Pause and
+	// pauseCond is used to wake up callers waiting for it to be resumed.
+	// The condition variable uses the chain lock as its locker, so both
+	// are protected by the chain lock.
+	paused    bool
+	pauseCond *sync.Cond
+
+	// processSem limits the number of callers that may be processing a
+	// block concurrently.  Each caller sends to the channel before it
+	// starts and receives from it once it is done.  It is nil when the
+	// number of callers is not limited.
+	processSem chan struct{}
+
 	// These fields are related to the memory block index.  They both have
 	// their own locks, however they are often also protected by the chain
 	// lock to help prevent logic races when blocks are being processed.
@@ -170,8 +614,13 @@ type BlockChain struct {
 	//
 	// bestChain tracks the current active chain by making use of an
 	// efficient chain view into the block index.
-	index     *blockIndex
-	bestChain *chainView
+	//
+	// bestValidated is the most recent block in the best chain that was
+	// fully validated as opposed to trusted to be valid.  It is protected
+	// by the chain lock.
+	index         *blockIndex
+	bestChain     *chainView
+	bestValidated *blockNode
 
 	// These fields are related to handling of orphan blocks.  They are
 	// protected by a combination of the chain lock and the orphan lock.
@@ -181,10 +630,11 @@ type BlockChain struct {
 	oldestOrphan *orphanBlock
 
 	// The block cache for mainchain blocks, to facilitate faster
-	// reorganizations.
+	// reorganizations.  It is not populated when disableBlockCache is set.
 	mainchainBlockCacheLock sync.RWMutex
 	mainchainBlockCache     map[chainhash.Hash]*dcrutil.Block
 	mainchainBlockCacheSize int
+	disableBlockCache       bool
 
 	// These fields are related to checkpoint handling.  They are protected
 	// by the chain lock.
@@ -205,6 +655,56 @@ type BlockChain struct {
 	stateLock     sync.RWMutex
 	stateSnapshot *BestState
 
+	// bestStateHistory is a ring buffer that houses the most recent best
+	// chain states in the order the tip changed.  bestStateHistoryNext is
+	// the index the next state will be written to and bestStateHistoryLen
+	// is the number of states in the buffer.  They are protected by the
+	// state lock.
+	bestStateHistory     []*BestState
+	bestStateHistoryNext int
+	bestStateHistoryLen  int
+
+	// reorgStats tracks cumulative statistics about the reorganizations
+	// that have taken place since the chain instance was created.  It is
+	// protected by the reorg stats lock.
+	reorgStatsLock sync.Mutex
+	reorgStats     ReorgStats
+
+	// reorgInProgress is set to a non-zero value while the chain is being
+	// reorganized.  It must only be accessed atomically.
+	reorgInProgress int32
+
+	// connectTimings tracks cumulative statistics about how long it has
+	// taken to commit connected and disconnected blocks to the database.
+	// It is protected by the connect timings lock.
+	connectTimingsLock sync.Mutex
+	connectTimings     ConnectTimings
+
+	// tipChangeChans houses the channels returned by
+	// TipChangeNotifications that are delivered the best state each time
+	// the tip changes.  It is protected by the tip change lock.
+	tipChangeLock  sync.Mutex
+	tipChangeChans []chan *BestState
+
+	// subscribers houses the callbacks registered via Subscribe along with
+	// the types of notifications each of them is interested in.  It is
+	// protected by the subscribers lock.
+	subscribersLock sync.RWMutex
+	subscribers     []notificationSubscriber
+
+	// latestLocator caches the block locator for the current tip of the
+	// main chain.  It is invalidated whenever the tip changes and is
+	// protected by the latest locator lock.
+	latestLocatorLock sync.Mutex
+	latestLocator     BlockLocator
+
+	// pendingInvalidBlocks houses the blocks that have been marked as
+	// having failed validation and are awaiting delivery to the invalid
+	// block callback once the chain lock is released.  It is protected by
+	// the invalid blocks lock.
+	invalidBlocksLock    sync.Mutex
+	pendingInvalidBlocks []invalidBlock
+
 	// The following caches are used to efficiently keep track of the
 	// current deployment threshold state of each rule change deployment.
 	//
@@ -280,22 +780,57 @@ func (b *BlockChain) GetStakeVersions(hash *chainhash.Hash, count int32) ([]Stak
 	result := make([]StakeVersions, 0, count)
 	prevNode := startNode
 	for i := int32(0); prevNode != nil && i < count; i++ {
-		sv := StakeVersions{
-			Hash:         prevNode.hash,
-			Height:       prevNode.height,
-			BlockVersion: prevNode.blockVersion,
-			StakeVersion: prevNode.stakeVersion,
-			Votes:        prevNode.votes,
-		}
+		result = append(result, newStakeVersions(prevNode))
+		prevNode = prevNode.parent
+	}
 
-		result = append(result, sv)
+	return result, nil
+}
 
-		prevNode = prevNode.parent
+// StakeVersionsInRange returns a cooked array of StakeVersions for the main
+// chain blocks in the given start and end heights in forward order.  It is
+// inclusive of the start height and exclusive of the end height.  In other
+// words, it is the half open range [startHeight, endHeight).
+//
+// The end height will be limited to the current main chain height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) StakeVersionsInRange(startHeight, endHeight int64) ([]StakeVersions, error) {
+	startHeight, endHeight, err := b.clampHeightRange(startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// There is nothing to do when the start and end heights are the same,
+	// so return now to avoid extra work.
+	if startHeight == endHeight {
+		return nil, nil
 	}
 
+	// Since the desired result is from the starting node to the ending node
+	// in forward order, but they are iterated in reverse, add them in
+	// reverse order.
+	result := make([]StakeVersions, endHeight-startHeight)
+	iterNode := b.bestChain.NodeByHeight(endHeight - 1)
+	for i := startHeight; i < endHeight; i++ {
+		result[endHeight-i-1] = newStakeVersions(iterNode)
+		iterNode = iterNode.parent
+	}
 	return result, nil
 }
 
+// newStakeVersions returns the condensed stake version information for the
+// passed node.
+func newStakeVersions(node *blockNode) StakeVersions {
+	return StakeVersions{
+		Hash:         node.hash,
+		Height:       node.height,
+		BlockVersion: node.blockVersion,
+		StakeVersion: node.stakeVersion,
+		Votes:        node.votes,
+	}
+}
+
 // VoteInfo represents information on agendas and their respective states for
 // a consensus deployment.
 type VoteInfo struct {
@@ -333,6 +868,40 @@ func (b *BlockChain) GetVoteInfo(hash *chainhash.Hash, version uint32) (*VoteInf
 	return &vi, nil
 }
 
+// AllAgendas returns all of the consensus deployments defined by the active
+// network keyed by their stake version.  This allows callers to discover the
+// available agendas and versions before querying their status via
+// GetVoteInfo.
+//
+// The returned map and slices are copies, so the caller is free to modify
+// them.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AllAgendas() map[uint32][]chaincfg.ConsensusDeployment {
+	agendas := make(map[uint32][]chaincfg.ConsensusDeployment,
+		len(b.chainParams.Deployments))
+	for version, deployments := range b.chainParams.Deployments {
+		agendas[version] = append([]chaincfg.ConsensusDeployment(nil),
+			deployments...)
+	}
+	return agendas
+}
+
+// AgendaVersions returns the stake versions that have consensus deployments
+// defined by the active network in ascending order.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AgendaVersions() []uint32 {
+	versions := make([]uint32, 0, len(b.chainParams.Deployments))
+	for version := range b.chainParams.Deployments {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i] < versions[j]
+	})
+	return versions
+}
+
 // DisableVerify provides a mechanism to disable transaction script validation
 // which you DO NOT want to do in production as it could allow double spends
 // and other undesirable things.  It is provided only for debug purposes since
@@ -346,6 +915,58 @@ func (b *BlockChain) DisableVerify(disable bool) {
 	b.chainLock.Unlock()
 }
 
+// SetAssumeValid sets the hash of the block whose ancestors, including the
+// block itself, are assumed to have valid scripts.  Script validation is
+// skipped for those blocks when they are connected to the main chain, while all
+// other validation is still performed.  Descendants of the block, along with
+// blocks on side chains that do not lead to it, are fully validated.  Passing a
+// nil hash removes the assumption so all blocks are fully validated.
+//
+// The assumption only takes effect once the block is in the block index, such
+// as after its header has been processed via ProcessBlockHeaders, since its
+// ancestors are not known until then.
+//
+// Blocks whose scripts were skipped are marked as trusted rather than fully
+// validated.  See BestValidatedTip.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetAssumeValid(hash *chainhash.Hash) {
+	var assumeValid *chainhash.Hash
+	if hash != nil {
+		h := *hash
+		assumeValid = &h
+	}
+
+	b.chainLock.Lock()
+	b.assumeValid = assumeValid
+	b.assumeValidChain = nil
+	b.chainLock.Unlock()
+}
+
+// assumedValid returns whether the scripts of the passed block node, which
+// must be in the process of being connected to the main chain, are assumed to
+// be valid due to it being an ancestor of the block set via SetAssumeValid or
+// that block itself.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) assumedValid(node *blockNode) bool {
+	if b.assumeValid == nil {
+		return false
+	}
+
+	// Create a view of the chain that ends with the assumed valid block
+	// once it is known so the ancestor check does not need to walk back
+	// through all of its ancestors for every block.
+	if b.assumeValidChain == nil {
+		avNode := b.index.LookupNode(b.assumeValid)
+		if avNode == nil {
+			return false
+		}
+		b.assumeValidChain = newChainView(avNode)
+	}
+	return b.assumeValidChain.Contains(node)
+}
+
 // TotalSubsidy returns the total subsidy mined so far in the best chain.
 //
 // This function is safe for concurrent access.
@@ -357,22 +978,91 @@ func (b *BlockChain) TotalSubsidy() int64 {
 	return ts
 }
 
-// FetchSubsidyCache returns the current subsidy cache from the blockchain.
+// FetchSubsidyCache returns the current subsidy cache from the blockchain.  This
+// is the cache provided via the SubsidyCache config option when one was
+// specified.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) FetchSubsidyCache() *SubsidyCache {
 	return b.subsidyCache
 }
 
+// ChainParams returns the chain parameters the chain instance was created
+// with.  The returned parameters are shared with the chain instance, so they
+// MUST be treated as immutable.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainParams() *chaincfg.Params {
+	return b.chainParams
+}
+
 // HaveBlock returns whether or not the chain instance has the block represented
 // by the passed hash.  This includes checking the various places a block can
 // be like part of the main chain, on a side chain, or in the orphan pool.
+// Blocks that were pruned from the block index due to having an invalid
+// ancestor are also considered known so they are not requested again.
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) HaveBlock(hash *chainhash.Hash) (bool, error) {
 	return b.index.HaveBlock(hash) || b.IsKnownOrphan(hash), nil
 }
 
+// BlockLocationKind identifies where a block is located from the point of view
+// of the chain.
+type BlockLocationKind int
+
+// These constants are used to identify where a block is located.
+const (
+	// BlockLocationUnknown indicates the block is not known to the chain.
+	BlockLocationUnknown BlockLocationKind = iota
+
+	// BlockLocationMainChain indicates the block is part of the main
+	// chain.
+	BlockLocationMainChain
+
+	// BlockLocationSideChain indicates the block is in the block index but
+	// is not part of the main chain.
+	BlockLocationSideChain
+
+	// BlockLocationOrphan indicates the block is in the orphan pool.
+	BlockLocationOrphan
+)
+
+// blockLocationKindStrings is a map of BlockLocationKind values back to their
+// constant names for pretty printing.
+var blockLocationKindStrings = map[BlockLocationKind]string{
+	BlockLocationUnknown:   "BlockLocationUnknown",
+	BlockLocationMainChain: "BlockLocationMainChain",
+	BlockLocationSideChain: "BlockLocationSideChain",
+	BlockLocationOrphan:    "BlockLocationOrphan",
+}
+
+// String returns the BlockLocationKind as a human-readable name.
+func (k BlockLocationKind) String() string {
+	if s := blockLocationKindStrings[k]; s != "" {
+		return s
+	}
+	return fmt.Sprintf("Unknown BlockLocationKind (%d)", int(k))
+}
+
+// BlockLocation returns where the block represented by the passed hash is
+// located, which is one of the main chain, a side chain, or the orphan pool.
+// BlockLocationUnknown is returned when the block is not known at all.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockLocation(hash *chainhash.Hash) BlockLocationKind {
+	if node := b.index.LookupNode(hash); node != nil {
+		if b.bestChain.Contains(node) {
+			return BlockLocationMainChain
+		}
+		return BlockLocationSideChain
+	}
+	if b.IsKnownOrphan(hash) {
+		return BlockLocationOrphan
+	}
+	return BlockLocationUnknown
+}
+
 // ChainWork returns the total work up to and including the block of the
 // provided block hash.
 func (b *BlockChain) ChainWork(hash *chainhash.Hash) (*big.Int, error) {
@@ -384,6 +1074,68 @@ func (b *BlockChain) ChainWork(hash *chainhash.Hash) (*big.Int, error) {
 	return node.workSum, nil
 }
 
+// WorkBetween returns the cumulative work of the blocks after the provided
+// ancestor block up to and including the provided descendant block.  An error
+// is returned when either block is not known or the first block is not an
+// ancestor of the second.  Passing the same block for both returns zero.
+//
+// The returned value is a new big integer that may be freely modified by the
+// caller.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) WorkBetween(ancestor, descendant *chainhash.Hash) (*big.Int, error) {
+	ancestorNode := b.index.LookupNode(ancestor)
+	if ancestorNode == nil {
+		return nil, fmt.Errorf("block %s is not known", ancestor)
+	}
+	descendantNode := b.index.LookupNode(descendant)
+	if descendantNode == nil {
+		return nil, fmt.Errorf("block %s is not known", descendant)
+	}
+	if descendantNode.Ancestor(ancestorNode.height) != ancestorNode {
+		return nil, fmt.Errorf("block %s is not an ancestor of block %s",
+			ancestor, descendant)
+	}
+
+	return new(big.Int).Sub(descendantNode.workSum, ancestorNode.workSum), nil
+}
+
+// WorkToOvertake returns the additional work the side chain with the provided
+// tip requires in order to cause a reorganize to it, which includes the
+// configured reorganize stickiness work, if any.  Zero is returned when the
+// side chain already has enough work.  An error is returned when the block is
+// not known or is part of the main chain.
+//
+// The returned value is a new big integer that may be freely modified by the
+// caller.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) WorkToOvertake(sideTip *chainhash.Hash) (*big.Int, error) {
+	node := b.index.LookupNode(sideTip)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", sideTip)
+	}
+
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+	if b.bestChain.Contains(node) {
+		return nil, fmt.Errorf("block %s is part of the main chain", sideTip)
+	}
+
+	// The side chain must exceed the work of the main chain by more than
+	// the stickiness work, so the deficit is one more than the difference.
+	requiredWork := new(big.Int).Set(b.bestChain.Tip().workSum)
+	if b.reorgStickinessWork != nil {
+		requiredWork.Add(requiredWork, b.reorgStickinessWork)
+	}
+	deficit := requiredWork.Sub(requiredWork, node.workSum)
+	deficit.Add(deficit, bigOne)
+	if deficit.Sign() < 0 {
+		deficit.SetInt64(0)
+	}
+	return deficit, nil
+}
+
 // IsKnownOrphan returns whether the passed hash is currently a known orphan.
 // Keep in mind that only a limited number of orphans are held onto for a
 // limited amount of time, so this function must not be used as an absolute
@@ -430,6 +1182,26 @@ func (b *BlockChain) GetOrphanRoot(hash *chainhash.Hash) *chainhash.Hash {
 	return orphanRoot
 }
 
+// OrphansAwaiting returns the hashes of all orphan blocks that are waiting on
+// the provided parent block.  This can be used to determine whether or not
+// obtaining the parent block will allow any orphans to be processed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OrphansAwaiting(parent *chainhash.Hash) []chainhash.Hash {
+	b.orphanLock.RLock()
+	defer b.orphanLock.RUnlock()
+
+	orphans := b.prevOrphans[*parent]
+	if len(orphans) == 0 {
+		return nil
+	}
+	hashes := make([]chainhash.Hash, 0, len(orphans))
+	for _, orphan := range orphans {
+		hashes = append(hashes, *orphan.block.Hash())
+	}
+	return hashes
+}
+
 // removeOrphanBlock removes the passed orphan block from the orphan pool and
 // previous orphan index.
 func (b *BlockChain) removeOrphanBlock(orphan *orphanBlock) {
@@ -502,10 +1274,11 @@ func (b *BlockChain) addOrphanBlock(block *dcrutil.Block) {
 
 	// Insert the block into the orphan map with an expiration time
 	// 1 hour from now.
-	expiration := time.Now().Add(time.Hour)
+	now := time.Now()
 	oBlock := &orphanBlock{
 		block:      block,
-		expiration: expiration,
+		received:   now,
+		expiration: now.Add(time.Hour),
 	}
 	b.orphans[*block.Hash()] = oBlock
 
@@ -546,14 +1319,18 @@ func (b *BlockChain) fetchMainChainBlockByNode(node *blockNode) (*dcrutil.Block,
 		return nil, errNotInMainChain(str)
 	}
 
-	b.mainchainBlockCacheLock.RLock()
-	block, ok := b.mainchainBlockCache[node.hash]
-	b.mainchainBlockCacheLock.RUnlock()
-	if ok {
-		return block, nil
+	// Check the main chain cache when it is enabled.
+	if !b.disableBlockCache {
+		b.mainchainBlockCacheLock.RLock()
+		block, ok := b.mainchainBlockCache[node.hash]
+		b.mainchainBlockCacheLock.RUnlock()
+		if ok {
+			return block, nil
+		}
 	}
 
 	// Load the block from the database.
+	var block *dcrutil.Block
 	err := b.db.View(func(dbTx database.Tx) error {
 		var err error
 		block, err = dbFetchBlockByNode(dbTx, node)
@@ -568,6 +1345,15 @@ func (b *BlockChain) fetchMainChainBlockByNode(node *blockNode) (*dcrutil.Block,
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) fetchBlockByNode(node *blockNode) (*dcrutil.Block, error) {
+	return b.fetchBlockByNodeFromDB(b.db, node)
+}
+
+// fetchBlockByNodeFromDB is identical to fetchBlockByNode except it loads the
+// block from the provided database when it is not in any of the internal
+// caches.  This allows queries to be serviced from the read database.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) fetchBlockByNodeFromDB(db database.DB, node *blockNode) (*dcrutil.Block, error) {
 	// Check main chain cache.
 	b.mainchainBlockCacheLock.RLock()
 	block, ok := b.mainchainBlockCache[node.hash]
@@ -585,7 +1371,7 @@ func (b *BlockChain) fetchBlockByNode(node *blockNode) (*dcrutil.Block, error) {
 	}
 
 	// Load the block from the database.
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := db.View(func(dbTx database.Tx) error {
 		var err error
 		block, err = dbFetchBlockByNode(dbTx, node)
 		return err
@@ -599,8 +1385,14 @@ func (b *BlockChain) fetchBlockByNode(node *blockNode) (*dcrutil.Block, error) {
 // finds all the relevant children, and then drops the the stake nodes from
 // them by assigning nil and allowing the memory to be recovered by GC.
 //
+// Nothing is pruned when the chain is configured to retain all stake nodes.
+//
 // This function MUST be called with the chain state lock held (for writes).
 func (b *BlockChain) pruneStakeNodes() {
+	if b.retainAllStakeNodes {
+		return
+	}
+
 	// Find the height to prune to.
 	pruneToNode := b.bestChain.Tip()
 	for i := int64(0); i < minMemoryStakeNodes-1 && pruneToNode != nil; i++ {
@@ -638,6 +1430,30 @@ func (b *BlockChain) pruneStakeNodes() {
 	}
 }
 
+// maybePruneInvalidSubtree prunes all descendants of the block that failed
+// validation from the block index when pruning of invalid subtrees is enabled.
+// The provided node must either be the block that failed validation or one of
+// its descendants.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) maybePruneInvalidSubtree(node *blockNode) {
+	if !b.pruneInvalidSubtrees {
+		return
+	}
+
+	for node != nil && b.index.NodeStatus(node)&statusValidateFailed == 0 {
+		node = node.parent
+	}
+	if node == nil {
+		return
+	}
+	numPruned := b.index.pruneInvalidDescendants(node)
+	if numPruned > 0 {
+		log.Debugf("Pruned %d blocks descending from invalid block %v "+
+			"from the block index", numPruned, node.hash)
+	}
+}
+
 // BestPrevHash returns the hash of the previous block of the block at HEAD.
 //
 // This function is safe for concurrent access.
@@ -702,6 +1518,7 @@ func (b *BlockChain) getReorganizeNodes(node *blockNode) (*list.List, *list.List
 	// not very common.
 	if b.index.NodeStatus(node.parent).KnownInvalid() {
 		b.index.SetStatusFlags(node, statusInvalidAncestor)
+		b.maybePruneInvalidSubtree(node.parent)
 		return detachNodes, attachNodes
 	}
 
@@ -720,6 +1537,7 @@ func (b *BlockChain) getReorganizeNodes(node *blockNode) (*list.List, *list.List
 				dn := e.Value.(*blockNode)
 				b.index.SetStatusFlags(dn, statusInvalidAncestor)
 			}
+			b.maybePruneInvalidSubtree(n)
 
 			attachNodes.Init()
 			return detachNodes, attachNodes
@@ -739,8 +1557,13 @@ func (b *BlockChain) getReorganizeNodes(node *blockNode) (*list.List, *list.List
 }
 
 // pushMainChainBlockCache pushes a block onto the main chain block cache,
-// and removes any old blocks from the cache that might be present.
+// and removes any old blocks from the cache that might be present.  Nothing is
+// cached when the cache is disabled.
 func (b *BlockChain) pushMainChainBlockCache(block *dcrutil.Block) {
+	if b.disableBlockCache {
+		return
+	}
+
 	curHeight := block.Height()
 	curHash := block.Hash()
 	b.mainchainBlockCacheLock.Lock()
@@ -753,6 +1576,48 @@ func (b *BlockChain) pushMainChainBlockCache(block *dcrutil.Block) {
 	b.mainchainBlockCacheLock.Unlock()
 }
 
+// SetBlockCacheSize sets the number of most recent main chain blocks that are
+// kept in the main chain block cache.  Any blocks that no longer fit in the
+// cache due to a reduced size are evicted immediately.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SetBlockCacheSize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("main chain block cache size %d is negative", n)
+	}
+
+	b.mainchainBlockCacheLock.Lock()
+	b.mainchainBlockCacheSize = n
+
+	// Evict all blocks that are not within the new number of most recent
+	// cached blocks.
+	var maxHeight int64 = -1
+	for _, bl := range b.mainchainBlockCache {
+		if bl.Height() > maxHeight {
+			maxHeight = bl.Height()
+		}
+	}
+	for hash, bl := range b.mainchainBlockCache {
+		if bl.Height() <= maxHeight-int64(n) {
+			delete(b.mainchainBlockCache, hash)
+		}
+	}
+	b.mainchainBlockCacheLock.Unlock()
+	return nil
+}
+
+// PurgeBlockCache removes all blocks from the main chain block cache in order
+// to immediately reclaim the memory they use.  Blocks that were in the cache
+// are simply loaded from the database when they are requested again.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) PurgeBlockCache() {
+	b.mainchainBlockCacheLock.Lock()
+	b.mainchainBlockCache = make(map[chainhash.Hash]*dcrutil.Block,
+		b.mainchainBlockCacheSize)
+	b.mainchainBlockCacheLock.Unlock()
+}
+
 // connectBlock handles connecting the passed node/block to the end of the main
 // (best) chain.
 //
@@ -763,8 +1628,11 @@ func (b *BlockChain) pushMainChainBlockCache(block *dcrutil.Block) {
 // must happen prior to calling this function requires the same details, so
 // it would be inefficient to repeat it.
 //
+// The flags modify the behavior of this function as follows:
+//  - BFSilent: The notifications about the connected block are not sent.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block, view *UtxoViewpoint, stxos []spentTxOut) error {
+func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block, view *UtxoViewpoint, stxos []spentTxOut, flags BehaviorFlags) error {
 	// Make sure it's extending the end of the best chain.
 	prevHash := block.MsgBlock().Header.PrevBlock
 	tip := b.bestChain.Tip()
@@ -782,9 +1650,11 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	}
 
 	// Write any modified block index entries to the database before
-	// updating the best state.
-	if err := b.flushBlockIndex(); err != nil {
-		return err
+	// updating the best state unless flushing is deferred to the background.
+	if b.indexFlushInterval == 0 {
+		if err := b.flushBlockIndex(); err != nil {
+			return err
+		}
 	}
 
 	// Get the stake node for this node, filling in any data that
@@ -801,6 +1671,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	b.stateLock.RLock()
 	curTotalTxns := b.stateSnapshot.TotalTxns
 	curTotalSubsidy := b.stateSnapshot.TotalSubsidy
+	curNumUtxos := b.stateSnapshot.NumUtxos
+	curUtxoAmount := b.stateSnapshot.UtxoAmount
+	curStakeDiff := b.stateSnapshot.NextStakeDiff
 	b.stateLock.RUnlock()
 
 	// Calculate the number of transactions that would be added by adding
@@ -823,7 +1696,14 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 		node.stakeNode.Winners(), node.stakeNode.MissedTickets(),
 		node.stakeNode.FinalState())
 
+	// Update the utxo set stats with the changes connecting the block makes
+	// to the utxo set.
+	numUtxos, utxoAmount := blockUtxoStatsDelta(block, parent, stxos)
+	state.NumUtxos = curNumUtxos + numUtxos
+	state.UtxoAmount = curUtxoAmount + utxoAmount
+
 	// Atomically insert info into the database.
+	updateStart := time.Now()
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -831,6 +1711,17 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 			return err
 		}
 
+		// Write the block index entry for the block along with the best
+		// state when flushing the block index is deferred to the
+		// background so the best state never refers to a block that is
+		// not in the block index.
+		if b.indexFlushInterval != 0 {
+			err = dbPutBlockNode(dbTx, node)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Update the utxo set using the state of the utxo view.  This
 		// entails removing all of the utxos spent and adding the new
 		// ones created by the block.
@@ -854,8 +1745,9 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being connected so they can
-		// update themselves accordingly.
-		if b.indexManager != nil {
+		// update themselves accordingly.  This is done separately below
+		// when index errors are not fatal.
+		if b.indexManager != nil && b.indexErrorsFatal {
 			err := b.indexManager.ConnectBlock(dbTx, block, parent, view)
 			if err != nil {
 				return err
@@ -867,13 +1759,40 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	if err != nil {
 		return err
 	}
+	updateDuration := time.Since(updateStart)
+	b.connectTimingsLock.Lock()
+	b.connectTimings.NumConnected++
+	b.connectTimings.TotalConnectTime += updateDuration
+	b.connectTimingsLock.Unlock()
+	b.updateIndexesNonFatal(func(dbTx database.Tx) error {
+		return b.indexManager.ConnectBlock(dbTx, block, parent, view)
+	})
+
+	// Allow the caller to observe the spend journal entry for the block now
+	// that it has been committed to the database.
+	if b.onSpendJournal != nil {
+		entries := make([]SpentTxOut, 0, len(stxos))
+		for i := range stxos {
+			entries = append(entries, newSpentTxOut(&stxos[i]))
+		}
+		b.onSpendJournal(block.Hash(), entries)
+	}
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
 	view.commit()
 
+	// Allow the caller to monitor for unusual spacing between the median
+	// times of the block and its parent.
+	b.checkTimeAnomaly(node, state.MedianTime)
+
 	// This node is now the end of the best chain.
 	b.bestChain.SetTip(node)
+	b.invalidateLatestLocator()
+	b.lastTipChange = time.Now()
+	if !b.index.NodeStatus(node).Trusted() {
+		b.bestValidated = node
+	}
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -882,7 +1801,14 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	// comments on the state variable for more details.
 	b.stateLock.Lock()
 	b.stateSnapshot = state
+	b.addBestStateHistory(state)
 	b.stateLock.Unlock()
+	if _, ok := b.tipCaptures[node.hash]; ok {
+		b.tipCaptures[node.hash] = state
+	}
+
+	// Deliver the new state to any channel-based tip change consumers.
+	b.sendTipChange(state)
 
 	// Assemble the current block and the parent into a slice.
 	blockAndParent := []*dcrutil.Block{block, parent}
@@ -890,12 +1816,29 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	// Notify the caller that the block was connected to the main chain.
 	// The caller would typically want to react with actions such as
 	// updating wallets.
-	b.chainLock.Unlock()
-	b.sendNotification(NTBlockConnected, blockAndParent)
-	b.chainLock.Lock()
+	silent := flags&BFSilent == BFSilent
+	if !silent {
+		b.chainLock.Unlock()
+		b.sendNotification(NTBlockConnected, blockAndParent)
+		b.chainLock.Lock()
+	}
+
+	// Notify the caller when the stake difficulty required for the next
+	// block changed as a result of connecting this one.
+	if !silent && nextStakeDiff != curStakeDiff {
+		b.chainLock.Unlock()
+		b.sendNotification(NTStakeDifficultyChanged,
+			&StakeDifficultyChangedNtfnsData{
+				Hash:         node.hash,
+				Height:       node.height,
+				OldStakeDiff: curStakeDiff,
+				NewStakeDiff: nextStakeDiff,
+			})
+		b.chainLock.Lock()
+	}
 
 	// Send stake notifications about the new block.
-	if node.height >= b.chainParams.StakeEnabledHeight {
+	if !silent && node.height >= b.chainParams.StakeEnabledHeight {
 		nextStakeDiff, err := b.calcNextRequiredStakeDifficulty(node)
 		if err != nil {
 			return err
@@ -912,6 +1855,10 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 				TicketsNew:      []chainhash.Hash{},
 			})
 		// Notify of new tickets
+		newTicketsInfo, err := b.fetchNewTicketsInfo(node)
+		if err != nil {
+			return err
+		}
 		b.sendNotification(NTNewTickets,
 			&TicketNotificationsData{
 				Hash:            node.hash,
@@ -920,12 +1867,15 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 				TicketsSpent:    []chainhash.Hash{},
 				TicketsMissed:   []chainhash.Hash{},
 				TicketsNew:      node.stakeNode.NewTickets(),
+				NewTicketsInfo:  newTicketsInfo,
 			})
 	}
 
 	// Optimization: Before checkpoints, immediately dump the parent's stake
-	// node because we no longer need it.
-	if node.height < b.chainParams.LatestCheckpointHeight() {
+	// node because we no longer need it unless all stake nodes are to be
+	// retained.
+	if node.height < b.chainParams.LatestCheckpointHeight() &&
+		!b.retainAllStakeNodes {
 		parent := b.bestChain.Tip().parent
 		parent.stakeNode = nil
 		parent.newTickets = nil
@@ -938,6 +1888,28 @@ func (b *BlockChain) connectBlock(node *blockNode, block, parent *dcrutil.Block,
 	return nil
 }
 
+// updateIndexesNonFatal invokes the provided function, which is expected to
+// update the optional indexes via the index manager, in its own database
+// transaction when index errors are not fatal.  Since the transaction is
+// separate from the one that updates the chain state, any error only results
+// in the index manager being disabled and logged instead of preventing the
+// chain state from being updated.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) updateIndexesNonFatal(fn func(dbTx database.Tx) error) {
+	if b.indexManager == nil || b.indexErrorsFatal ||
+		b.indexManagerDisabled {
+
+		return
+	}
+
+	if err := b.db.Update(fn); err != nil {
+		log.Errorf("Disabling optional indexes due to index manager "+
+			"error: %v", err)
+		b.indexManagerDisabled = true
+	}
+}
+
 // dropMainChainBlockCache drops a block from the main chain block cache.
 func (b *BlockChain) dropMainChainBlockCache(block *dcrutil.Block) {
 	curHash := block.Hash()
@@ -949,8 +1921,11 @@ func (b *BlockChain) dropMainChainBlockCache(block *dcrutil.Block) {
 // disconnectBlock handles disconnecting the passed node/block from the end of
 // the main (best) chain.
 //
+// The flags modify the behavior of this function as follows:
+//  - BFSilent: The notification about the disconnected block is not sent.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Block, view *UtxoViewpoint, stxos []spentTxOut, flags BehaviorFlags) error {
 	// Make sure the node being disconnected is the end of the best chain.
 	tip := b.bestChain.Tip()
 	if node.hash != tip.hash {
@@ -960,9 +1935,11 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 	}
 
 	// Write any modified block index entries to the database before
-	// updating the best state.
-	if err := b.flushBlockIndex(); err != nil {
-		return err
+	// updating the best state unless flushing is deferred to the background.
+	if b.indexFlushInterval == 0 {
+		if err := b.flushBlockIndex(); err != nil {
+			return err
+		}
 	}
 
 	// Prepare the information required to update the stake database
@@ -981,6 +1958,8 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 	b.stateLock.RLock()
 	curTotalTxns := b.stateSnapshot.TotalTxns
 	curTotalSubsidy := b.stateSnapshot.TotalSubsidy
+	curNumUtxos := b.stateSnapshot.NumUtxos
+	curUtxoAmount := b.stateSnapshot.UtxoAmount
 	b.stateLock.RUnlock()
 	parentBlockSize := uint64(parent.MsgBlock().Header.Size)
 
@@ -1000,6 +1979,13 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 		prevNode.stakeNode.Winners(), prevNode.stakeNode.MissedTickets(),
 		prevNode.stakeNode.FinalState())
 
+	// Update the utxo set stats with the changes disconnecting the block
+	// makes to the utxo set.
+	numUtxos, utxoAmount := blockUtxoStatsDelta(block, parent, stxos)
+	state.NumUtxos = curNumUtxos - numUtxos
+	state.UtxoAmount = curUtxoAmount - utxoAmount
+
+	updateStart := time.Now()
 	err = b.db.Update(func(dbTx database.Tx) error {
 		// Update best block state.
 		err := dbPutBestState(dbTx, state, node.workSum)
@@ -1030,8 +2016,9 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 
 		// Allow the index manager to call each of the currently active
 		// optional indexes with the block being disconnected so they
-		// can update themselves accordingly.
-		if b.indexManager != nil {
+		// can update themselves accordingly.  This is done separately
+		// below when index errors are not fatal.
+		if b.indexManager != nil && b.indexErrorsFatal {
 			err := b.indexManager.DisconnectBlock(dbTx, block, parent, view)
 			if err != nil {
 				return err
@@ -1043,6 +2030,14 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 	if err != nil {
 		return err
 	}
+	updateDuration := time.Since(updateStart)
+	b.connectTimingsLock.Lock()
+	b.connectTimings.NumDisconnected++
+	b.connectTimings.TotalDisconnectTime += updateDuration
+	b.connectTimingsLock.Unlock()
+	b.updateIndexesNonFatal(func(dbTx database.Tx) error {
+		return b.indexManager.DisconnectBlock(dbTx, block, parent, view)
+	})
 
 	// Prune fully spent entries and mark all entries in the view unmodified
 	// now that the modifications have been committed to the database.
@@ -1050,6 +2045,11 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 
 	// This node's parent is now the end of the best chain.
 	b.bestChain.SetTip(node.parent)
+	b.invalidateLatestLocator()
+	b.lastTipChange = time.Now()
+	if b.bestValidated == node {
+		b.bestValidated = b.validatedAncestor(node.parent)
+	}
 
 	// Update the state for the best block.  Notice how this replaces the
 	// entire struct instead of updating the existing one.  This effectively
@@ -1058,25 +2058,46 @@ func (b *BlockChain) disconnectBlock(node *blockNode, block, parent *dcrutil.Blo
 	// comments on the state variable for more details.
 	b.stateLock.Lock()
 	b.stateSnapshot = state
+	b.addBestStateHistory(state)
 	b.stateLock.Unlock()
 
+	// Deliver the new state to any channel-based tip change consumers.
+	b.sendTipChange(state)
+
 	// Assemble the current block and the parent into a slice.
 	blockAndParent := []*dcrutil.Block{block, parent}
 
 	// Notify the caller that the block was disconnected from the main
 	// chain.  The caller would typically want to react with actions such as
 	// updating wallets.
-	b.chainLock.Unlock()
-	b.sendNotification(NTBlockDisconnected, blockAndParent)
-	b.chainLock.Lock()
+	if flags&BFSilent != BFSilent {
+		b.chainLock.Unlock()
+		b.sendNotification(NTBlockDisconnected, blockAndParent)
+		b.chainLock.Lock()
+	}
 
 	b.dropMainChainBlockCache(block)
 
 	return nil
 }
 
-// countSpentOutputs returns the number of utxos the passed block spends.
+// countSpentOutputs returns the number of utxos the passed block spends.  See
+// CountSpentOutputs for details.
 func countSpentOutputs(block *dcrutil.Block, parent *dcrutil.Block) int {
+	return CountSpentOutputs(block, parent)
+}
+
+// CountSpentOutputs returns the number of utxos the passed block spends when
+// it is connected, which is the number of entries in its spend journal entry.
+// This includes the outputs spent by the regular transaction tree of the
+// parent block when the block approves it and the outputs spent by the stake
+// transaction tree of the block itself.
+//
+// Note that votes (ssgen) and revocations (ssrtx) are counted as spending a
+// single output, the ticket, since the stakebase input of votes does not spend
+// an output.  The coinbase of the parent is also excluded since it can't spend
+// anything.
+func CountSpentOutputs(block *dcrutil.Block, parent *dcrutil.Block) int {
 	// We need to skip the regular tx tree if it's not valid.
 	// We also exclude the coinbase transaction since it can't
 	// spend anything.
@@ -1110,6 +2131,46 @@ func countNumberOfTransactions(block, parent *dcrutil.Block) uint64 {
 	return numTxns
 }
 
+// reorgInterruptRequested returns whether the interrupt channel has been closed
+// when the passed number of blocks processed by the current phase of a
+// reorganize is a multiple of the configured interrupt check interval.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) reorgInterruptRequested(numProcessed int) bool {
+	return numProcessed%b.interruptCheckInterval == 0 &&
+		interruptRequested(b.interrupt)
+}
+
+// checkTimeAnomaly invokes the time anomaly callback, if any, when the spacing
+// between the provided median time of the passed node and the median time of
+// its parent exceeds the configured multiple of the target time per block.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkTimeAnomaly(node *blockNode, medianTime time.Time) {
+	if b.onTimeAnomaly == nil || node.parent == nil {
+		return
+	}
+
+	target := b.chainParams.TargetTimePerBlock
+	threshold := time.Duration(b.timeAnomalyFactor * float64(target))
+	spacing := medianTime.Sub(node.parent.CalcPastMedianTime())
+	if spacing > threshold {
+		b.onTimeAnomaly(node.height, spacing, target)
+	}
+}
+
+// logReorgEvent invokes the structured reorg logger, if any, with the provided
+// event updated to the given stage.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) logReorgEvent(stage ReorgLogStage, event ReorgLogEvent) {
+	if b.reorgLogger == nil {
+		return
+	}
+	event.Stage = stage
+	b.reorgLogger(event)
+}
+
 // reorganizeChain reorganizes the block chain by disconnecting the nodes in the
 // detachNodes list and connecting the nodes in the attach list.  It expects
 // that the lists are already in the correct order and are in sync with the
@@ -1122,13 +2183,19 @@ func countNumberOfTransactions(block, parent *dcrutil.Block) uint64 {
 // without flushing in the case the chain is not able to reorganize due to a
 // block failing to connect.
 //
+// The flags are passed along to connectBlock and disconnectBlock.
+//
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error {
+func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List, flags BehaviorFlags) error {
 	// Nothing to do if no reorganize nodes were provided.
 	if detachNodes.Len() == 0 && attachNodes.Len() == 0 {
 		return nil
 	}
 
+	// Mark the reorganize as in progress until it returns.
+	atomic.StoreInt32(&b.reorgInProgress, 1)
+	defer atomic.StoreInt32(&b.reorgInProgress, 0)
+
 	// Ensure the provided nodes match the current best chain.
 	tip := b.bestChain.Tip()
 	if detachNodes.Len() != 0 {
@@ -1172,7 +2239,13 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	view.SetBestHash(&oldBest.hash)
 	view.SetStakeViewpoint(ViewpointPrevValidInitial)
 	var nextBlockToDetach *dcrutil.Block
-	for e := detachNodes.Front(); e != nil; e = e.Next() {
+	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
+		// Stop early without having modified the chain state when an
+		// interrupt is requested.
+		if b.reorgInterruptRequested(i) {
+			return errInterruptRequested
+		}
+
 		// Grab the block to detach based on the node.  Use the fact that the
 		// blocks are being detached in reverse order, so the parent of the
 		// current block being detached is the next one being detached.
@@ -1258,6 +2331,12 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	// tweaking the chain and/or database.  This approach catches these
 	// issues before ever modifying the chain.
 	for i, e := 0, attachNodes.Front(); e != nil; i, e = i+1, e.Next() {
+		// Stop early without having modified the chain state when an
+		// interrupt is requested.
+		if b.reorgInterruptRequested(i) {
+			return errInterruptRequested
+		}
+
 		// Grab the block to attach based on the node.  Use the fact that the
 		// parent of the block is either the fork point for the first node being
 		// attached or the previous one that was attached for subsequent blocks
@@ -1300,18 +2379,24 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		// In the case the block is determined to be invalid due to a
 		// rule violation, mark it as invalid and mark all of its
 		// descendants as having an invalid ancestor.
-		err = b.checkConnectBlock(n, block, parent, view, nil)
+		assumeValid := b.assumedValid(n)
+		err = b.checkConnectBlock(n, block, parent, view, nil, assumeValid)
 		if err != nil {
-			if _, ok := err.(RuleError); ok {
-				b.index.SetStatusFlags(n, statusValidateFailed)
+			if rErr, ok := err.(RuleError); ok {
+				b.markBlockInvalid(n, rErr)
 				for de := e.Next(); de != nil; de = de.Next() {
 					dn := de.Value.(*blockNode)
 					b.index.SetStatusFlags(dn, statusInvalidAncestor)
 				}
+				b.maybePruneInvalidSubtree(n)
 			}
 			return err
 		}
-		b.index.SetStatusFlags(n, statusValid)
+		status := statusValid
+		if assumeValid {
+			status |= statusTrusted
+		}
+		b.index.SetStatusFlags(n, status)
 
 		newBest = n
 	}
@@ -1341,6 +2426,32 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		b.chainLock.Lock()
 	}()
 
+	// Let the index manager know the reorganization is starting and when it
+	// is finished when it supports it.
+	reorgIndexManager, ok := b.indexManager.(ReorgIndexManager)
+	if ok && !b.indexManagerDisabled {
+		reorgIndexManager.ReorgStarted(&oldBest.hash, &newBest.hash)
+		defer reorgIndexManager.ReorgFinished()
+	}
+
+	// Report the fork point to the structured reorg logger when one is set.
+	reorgEvent := ReorgLogEvent{
+		ForkHash:    oldBest.hash,
+		ForkHeight:  oldBest.height,
+		OldHash:     oldBest.hash,
+		OldHeight:   oldBest.height,
+		NewHash:     newBest.hash,
+		NewHeight:   newBest.height,
+		NumDetached: detachNodes.Len(),
+		NumAttached: attachNodes.Len(),
+	}
+	if detachNodes.Len() != 0 {
+		fork := detachNodes.Back().Value.(*blockNode).parent
+		reorgEvent.ForkHash = fork.hash
+		reorgEvent.ForkHeight = fork.height
+	}
+	b.logReorgEvent(ReorgForkFound, reorgEvent)
+
 	// Reset the view for the actual connection code below.  This is
 	// required because the view was previously modified when checking if
 	// the reorg would be successful and the connection code requires the
@@ -1351,6 +2462,12 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	view.SetStakeViewpoint(ViewpointPrevValidInitial)
 
 	// Disconnect blocks from the main chain.
+	//
+	// Note that interrupts are intentionally not honored from this point
+	// on since each block is committed to the database individually, so
+	// stopping part way through would leave the main chain on a partially
+	// reorganized branch that might have less work than both the old and
+	// the new best chains.
 	for i, e := 0, detachNodes.Front(); e != nil; i, e = i+1, e.Next() {
 		// Since the blocks are being detached in reverse order, the parent of
 		// current block being detached is the next one being detached up to
@@ -1384,11 +2501,13 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 
 		// Update the database and chain state.
-		err = b.disconnectBlock(n, block, parent, view)
+		err = b.disconnectBlock(n, block, parent, view,
+			detachSpentTxOuts[i], flags)
 		if err != nil {
 			return err
 		}
 	}
+	b.logReorgEvent(ReorgDetachDone, reorgEvent)
 
 	// Connect the new best chain blocks.
 	for i, e := 0, attachNodes.Front(); e != nil; i, e = i+1, e.Next() {
@@ -1419,11 +2538,24 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 		}
 
 		// Update the database and chain state.
-		err = b.connectBlock(n, block, parent, view, stxos)
+		err = b.connectBlock(n, block, parent, view, stxos, flags)
 		if err != nil {
 			return err
 		}
 	}
+	b.logReorgEvent(ReorgAttachDone, reorgEvent)
+
+	// Update the cumulative reorganization statistics now that the chain
+	// has been successfully reorganized.
+	numDetached := int64(detachNodes.Len())
+	b.reorgStatsLock.Lock()
+	b.reorgStats.TotalReorgs++
+	b.reorgStats.BlocksDetached += uint64(numDetached)
+	b.reorgStats.BlocksAttached += uint64(attachNodes.Len())
+	if numDetached > b.reorgStats.DeepestReorg {
+		b.reorgStats.DeepestReorg = numDetached
+	}
+	b.reorgStatsLock.Unlock()
 
 	// Log the point where the chain forked and old and new best chain
 	// heads.
@@ -1439,6 +2571,40 @@ func (b *BlockChain) reorganizeChain(detachNodes, attachNodes *list.List) error
 	return nil
 }
 
+// ReorgStats returns cumulative statistics about the chain reorganizations that
+// have taken place since the chain instance was created.  The statistics are
+// not persisted, so they are reset on restart.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReorgStats() ReorgStats {
+	b.reorgStatsLock.Lock()
+	stats := b.reorgStats
+	b.reorgStatsLock.Unlock()
+	return stats
+}
+
+// IsReorganizing returns whether or not the chain is currently being
+// reorganized.  This allows a node that is busy performing a long reorganize to
+// be distinguished from one that has stalled.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsReorganizing() bool {
+	return atomic.LoadInt32(&b.reorgInProgress) != 0
+}
+
+// ConnectTimings returns cumulative statistics about how long it has taken to
+// commit blocks connected to and disconnected from the main chain to the
+// database since the chain instance was created.  The statistics are not
+// persisted, so they are reset on restart.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ConnectTimings() ConnectTimings {
+	b.connectTimingsLock.Lock()
+	timings := b.connectTimings
+	b.connectTimingsLock.Unlock()
+	return timings
+}
+
 // forceReorganizationToBlock forces a reorganization of the block chain to the
 // block hash requested, so long as it matches up with the current organization
 // of the best chain.
@@ -1518,7 +2684,8 @@ func (b *BlockChain) forceHeadReorganization(formerBest chainhash.Hash, newBest
 			return err
 		}
 
-		err = checkBlockSanity(newBestBlock, b.timeSource, BFNone, b.chainParams)
+		err = checkBlockSanity(newBestBlock, b.timeSource,
+			b.maxFutureBlockTime, BFNone, b.chainParams)
 		if err != nil {
 			return err
 		}
@@ -1529,10 +2696,10 @@ func (b *BlockChain) forceHeadReorganization(formerBest chainhash.Hash, newBest
 		}
 
 		err = b.checkConnectBlock(newBestNode, newBestBlock, commonParentBlock,
-			view, nil)
+			view, nil, false)
 		if err != nil {
-			if _, ok := err.(RuleError); ok {
-				b.index.SetStatusFlags(newBestNode, statusValidateFailed)
+			if rErr, ok := err.(RuleError); ok {
+				b.markBlockInvalid(newBestNode, rErr)
 			}
 			return err
 		}
@@ -1544,7 +2711,7 @@ func (b *BlockChain) forceHeadReorganization(formerBest chainhash.Hash, newBest
 	// errors here as the only time the index will be modified is if the
 	// block failed to connect.
 	attach, detach := b.getReorganizeNodes(newBestNode)
-	err := b.reorganizeChain(attach, detach)
+	err := b.reorganizeChain(attach, detach, BFNone)
 	b.flushBlockIndexWarnOnly()
 	return err
 }
@@ -1554,15 +2721,369 @@ func (b *BlockChain) ForceHeadReorganization(formerBest chainhash.Hash, newBest
 	b.chainLock.Lock()
 	err := b.forceHeadReorganization(formerBest, newBest)
 	b.chainLock.Unlock()
+	b.deliverInvalidBlocks()
+	return err
+}
+
+// markBlockInvalid marks the passed block node as having failed validation due
+// to the provided rule error and queues it for delivery to the invalid block
+// callback, if any, once the chain lock is released.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) markBlockInvalid(node *blockNode, err RuleError) {
+	b.index.SetStatusFlags(node, statusValidateFailed)
+	if b.onBlockInvalid == nil {
+		return
+	}
+
+	b.invalidBlocksLock.Lock()
+	b.pendingInvalidBlocks = append(b.pendingInvalidBlocks,
+		invalidBlock{hash: node.hash, err: err})
+	b.invalidBlocksLock.Unlock()
+}
+
+// deliverInvalidBlocks invokes the invalid block callback for all blocks that
+// have been marked as having failed validation since the last time it was
+// called.
+//
+// This function MUST NOT be called with the chain state lock held since the
+// callback is allowed to call back into the chain instance.
+func (b *BlockChain) deliverInvalidBlocks() {
+	b.invalidBlocksLock.Lock()
+	pending := b.pendingInvalidBlocks
+	b.pendingInvalidBlocks = nil
+	b.invalidBlocksLock.Unlock()
+
+	for i := range pending {
+		b.onBlockInvalid(&pending[i].hash, pending[i].err)
+	}
+}
+
+// disconnectTip disconnects the current tip of the main chain, leaving its
+// parent as the new tip.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) disconnectTip() error {
+	// The genesis block can't be disconnected since there is nothing to
+	// take its place.
+	tip := b.bestChain.Tip()
+	if tip.parent == nil {
+		return fmt.Errorf("unable to disconnect the genesis block")
+	}
+
+	// Load the tip block and its parent along with the spent txos for the
+	// block from the spend journal.
+	block, err := b.fetchMainChainBlockByNode(tip)
+	if err != nil {
+		return err
+	}
+	parent, err := b.fetchMainChainBlockByNode(tip.parent)
+	if err != nil {
+		return err
+	}
+	var stxos []spentTxOut
+	err = b.db.View(func(dbTx database.Tx) error {
+		stxos, err = dbFetchSpendJournalEntry(dbTx, block, parent)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Quick sanity test.
+	if len(stxos) != countSpentOutputs(block, parent) {
+		panicf("retrieved %v stxos when trying to disconnect block %v "+
+			"(height %v), yet counted %v many spent utxos", len(stxos),
+			block.Hash(), block.Height(), countSpentOutputs(block, parent))
+	}
+
+	// Load all of the utxos referenced by the block and update the view to
+	// unspend all of the spent txos and remove the utxos created by the
+	// block.
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	view.SetStakeViewpoint(ViewpointPrevValidInitial)
+	err = view.fetchInputUtxos(b.db, block, parent)
+	if err != nil {
+		return err
+	}
+	err = b.disconnectTransactions(view, block, parent, stxos)
+	if err != nil {
+		return err
+	}
+
+	// Update the database and chain state.
+	return b.disconnectBlock(tip, block, parent, view, stxos, BFNone)
+}
+
+// DisconnectTip disconnects the current tip of the main chain, leaving its
+// parent as the new tip.  This is primarily useful for testing harnesses and
+// recovery tools that need to roll back the main chain by exactly one block.
+//
+// Note that the disconnected block remains in the block index, so it may be
+// connected again in the future should it become part of the best chain.
+//
+// An error is returned if the current tip is the genesis block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DisconnectTip() error {
+	b.chainLock.Lock()
+	err := b.disconnectTip()
+	b.chainLock.Unlock()
 	return err
 }
 
+// replayMainChainBlock loads the main chain block at the provided height along
+// with its parent and reconstructs the utxo view the block was connected with.
+// An error is returned when there is no longer a main chain block at the height
+// or, when the provided previous hash is not nil, the block does not build on
+// the block with that hash, which both indicate the main chain was reorganized.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) replayMainChainBlock(height int64, prevHash *chainhash.Hash) (*dcrutil.Block, *dcrutil.Block, *UtxoViewpoint, error) {
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		str := fmt.Sprintf("no main chain block at height %d exists "+
+			"after the main chain was reorganized", height)
+		return nil, nil, nil, errNotInMainChain(str)
+	}
+	if prevHash != nil && node.parent.hash != *prevHash {
+		str := fmt.Sprintf("main chain block %s (height %d) does not "+
+			"build on previously replayed block %s since the main "+
+			"chain was reorganized", node.hash, height, prevHash)
+		return nil, nil, nil, errNotInMainChain(str)
+	}
+
+	// Load the block and its parent and reconstruct the view the block
+	// was connected with.
+	block, err := b.fetchMainChainBlockByNode(node)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var parent *dcrutil.Block
+	if node.parent != nil {
+		parent, err = b.fetchMainChainBlockByNode(node.parent)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	var view *UtxoViewpoint
+	err = b.db.View(func(dbTx database.Tx) error {
+		var err error
+		view, err = replayUtxoView(dbTx, block, parent)
+		return err
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return block, parent, view, nil
+}
+
+// ReplayBlocks invokes the provided callback, in order, for each main chain
+// block in the given range along with its parent and the utxo view it was
+// connected with.  The view is reconstructed from the spend journal and
+// mirrors the one provided to IndexManager.ConnectBlock when the block was
+// connected, which allows new indexes to be built from historical blocks
+// without restarting.  It is inclusive of the start height and exclusive of the
+// end height.  In other words, it is the half open range [start, end).
+//
+// The end height will be limited to the main chain height at the time of the
+// call.  Since the chain state lock is not held while the callback is invoked,
+// an error is returned if the main chain is reorganized such that a block in
+// the range is no longer available or no longer builds on the previously
+// replayed block, so the callback is never invoked with blocks from more than
+// one chain.
+//
+// No persistent state is modified.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReplayBlocks(start, end int64, fn func(block, parent *dcrutil.Block, view *UtxoViewpoint) error) error {
+	b.chainLock.RLock()
+	start, end, err := b.clampHeightRange(start, end)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var prevHash *chainhash.Hash
+	for height := start; height < end; height++ {
+		b.chainLock.RLock()
+		block, parent, view, err := b.replayMainChainBlock(height, prevHash)
+		b.chainLock.RUnlock()
+		if err != nil {
+			return err
+		}
+
+		if err := fn(block, parent, view); err != nil {
+			return err
+		}
+		prevHash = block.Hash()
+	}
+	return nil
+}
+
+// IndexRebuildFunc defines the signature of the callback ReindexRange invokes
+// for each main chain block in order to rebuild the entries of an index for it.
+// It is provided a database transaction that may be used to update the index
+// along with the block, its parent, and the utxo view the block was connected
+// with, which mirrors the parameters of IndexManager.ConnectBlock.
+type IndexRebuildFunc func(dbTx database.Tx, block, parent *dcrutil.Block, view *UtxoViewpoint) error
+
+// ReindexRange invokes the provided rebuild callback, in order, for each main
+// chain block in the given range so that an index may repair the entries for
+// just the affected range instead of being dropped and rebuilt from scratch.
+// The range is the half open range [start, end) as in ReplayBlocks.
+//
+// The callback for each block is invoked within its own database update
+// transaction, so the entries rebuilt for the blocks prior to one for which
+// the callback returns an error are retained.  The chain state lock is held
+// while each block is replayed and its entries are written so they can't be
+// written for a block that is concurrently disconnected from the main chain.
+// An error is returned without invoking the callback for any further blocks if
+// the main chain is reorganized such that a block in the range is no longer
+// available or no longer builds on the previously rebuilt block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ReindexRange(start, end int64, fn IndexRebuildFunc) error {
+	b.chainLock.RLock()
+	start, end, err := b.clampHeightRange(start, end)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	var prevHash *chainhash.Hash
+	for height := start; height < end; height++ {
+		b.chainLock.RLock()
+		block, parent, view, err := b.replayMainChainBlock(height, prevHash)
+		if err == nil {
+			err = b.db.Update(func(dbTx database.Tx) error {
+				return fn(dbTx, block, parent, view)
+			})
+		}
+		b.chainLock.RUnlock()
+		if err != nil {
+			return err
+		}
+		prevHash = block.Hash()
+	}
+	return nil
+}
+
+// spenderOfOutpoint returns the hash of the first transaction in the passed
+// slice with an input that spends the provided outpoint or nil when none of
+// them do.
+func spenderOfOutpoint(txns []*dcrutil.Tx, op *wire.OutPoint) *chainhash.Hash {
+	for _, tx := range txns {
+		for _, txIn := range tx.MsgTx().TxIn {
+			prevOut := &txIn.PreviousOutPoint
+			if prevOut.Index == op.Index && prevOut.Hash == op.Hash {
+				return tx.Hash()
+			}
+		}
+	}
+	return nil
+}
+
+// OutpointSpentAt returns whether or not the provided outpoint was spent by a
+// transaction in a main chain block at or before the provided height along
+// with the hash of the spending transaction when it was.
+//
+// Spends by transactions in the regular transaction tree of a block that was
+// disapproved by stakeholders in the next main chain block are not considered
+// since the disapproval undoes them.
+//
+// NOTE: This is an expensive operation since it potentially loads every main
+// chain block up to the provided height.  The scan starts at the block that
+// created the outpoint when the creating transaction still has unspent outputs
+// in the utxo set.  Otherwise, it has to start at the genesis block.  The chain
+// state lock is only held while each individual block is scanned, so an error
+// is returned if the main chain is reorganized such that the block at the
+// provided height changes during the scan.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) OutpointSpentAt(op wire.OutPoint, height int64) (bool, *chainhash.Hash, error) {
+	b.chainLock.RLock()
+	endNode := b.bestChain.NodeByHeight(height)
+	b.chainLock.RUnlock()
+	if endNode == nil {
+		str := fmt.Sprintf("no block at height %d exists", height)
+		return false, nil, errNotInMainChain(str)
+	}
+
+	// Start the scan at the block that created the outpoint when it is
+	// known since it can't have been spent prior to that.
+	startHeight := int64(1)
+	err := b.db.View(func(dbTx database.Tx) error {
+		entry, err := dbFetchUtxoEntry(dbTx, &op.Hash)
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			startHeight = entry.BlockHeight()
+		}
+		return nil
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	// scanBlock returns the hash of the transaction in the main chain block
+	// at the provided height that spends the outpoint, if any.  It ensures
+	// the block is still an ancestor of the block at the requested height.
+	//
+	// This function MUST be called with the chain state lock held (for
+	// reads).
+	scanBlock := func(h int64) (*chainhash.Hash, error) {
+		if !b.bestChain.Contains(endNode) {
+			str := fmt.Sprintf("block %s (height %d) is no longer in the "+
+				"main chain after the main chain was reorganized",
+				endNode.hash, height)
+			return nil, errNotInMainChain(str)
+		}
+		block, err := b.fetchMainChainBlockByNode(endNode.Ancestor(h))
+		if err != nil {
+			return nil, err
+		}
+		if hash := spenderOfOutpoint(block.STransactions(), &op); hash != nil {
+			return hash, nil
+		}
+
+		// Skip the regular transaction tree when the next block disapproves
+		// it.
+		next := b.bestChain.NodeByHeight(h + 1)
+		if next != nil && !voteBitsApproveParent(next.voteBits) {
+			return nil, nil
+		}
+		return spenderOfOutpoint(block.Transactions(), &op), nil
+	}
+
+	for h := startHeight; h <= height; h++ {
+		b.chainLock.RLock()
+		hash, err := scanBlock(h)
+		b.chainLock.RUnlock()
+		if err != nil {
+			return false, nil, err
+		}
+		if hash != nil {
+			return true, hash, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
 // flushBlockIndex populates any ticket data that has been pruned from modified
 // block nodes, writes those nodes to the database and clears the set of
 // modified nodes if it succeeds.
 func (b *BlockChain) flushBlockIndex() error {
 	b.index.RLock()
 	for node := range b.index.modified {
+		// The ticket information is not available for header-only nodes
+		// since it is derived from the block data.
+		if !node.status.HaveData() {
+			continue
+		}
 		if err := b.maybeFetchTicketInfo(node); err != nil {
 			b.index.RUnlock()
 			return err
@@ -1580,30 +3101,193 @@ func (b *BlockChain) flushBlockIndex() error {
 // flush only results in a worst case scenario of requiring one or more blocks
 // to be validated again.  All other cases must directly call the function on
 // the block index and check the error return accordingly.
+//
+// Nothing is flushed when flushing the block index is deferred to the
+// background.
 func (b *BlockChain) flushBlockIndexWarnOnly() {
+	if b.indexFlushInterval != 0 {
+		return
+	}
 	if err := b.flushBlockIndex(); err != nil {
 		log.Warnf("Unable to flush block index changes to db: %v", err)
 	}
 }
 
-// connectBestChain handles connecting the passed block to the chain while
-// respecting proper chain selection according to the chain with the most
-// proof of work.  In the typical case, the new block simply extends the main
-// chain.  However, it may also be extending (or creating) a side chain (fork)
-// which may or may not end up becoming the main chain depending on which fork
-// cumulatively has the most proof of work.  It returns the resulting fork
+// indexFlushHandler periodically flushes any modified block index entries to
+// the database until the chain instance is closed.  It must be run as a
+// goroutine.
+func (b *BlockChain) indexFlushHandler() {
+	ticker := time.NewTicker(b.indexFlushInterval)
+	defer ticker.Stop()
+
+out:
+	for {
+		select {
+		case <-ticker.C:
+			b.chainLock.Lock()
+			if err := b.flushBlockIndex(); err != nil {
+				log.Warnf("Unable to flush block index changes to db: %v",
+					err)
+			}
+			b.chainLock.Unlock()
+
+		case <-b.indexFlushQuit:
+			break out
+		}
+	}
+
+	b.indexFlushWg.Done()
+}
+
+// Close stops any background processing done by the chain instance and writes
+// any pending block index changes to the database.  It must be called prior to
+// closing the database when the chain was created with a nonzero
+// IndexFlushInterval to avoid needing to validate blocks again.  The chain
+// instance must not be used after it is closed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Close() error {
+	b.closeOnce.Do(func() {
+		if b.indexFlushQuit != nil {
+			close(b.indexFlushQuit)
+			b.indexFlushWg.Wait()
+		}
+	})
+
+	b.chainLock.Lock()
+	err := b.flushBlockIndex()
+	b.chainLock.Unlock()
+	return err
+}
+
+// validateSideChainBlock performs the full set of connection checks on the
+// passed side chain block against the state of the chain as of its parent and
+// caches the result in the block index so that a later reorganize to the side
+// chain does not need to validate it again.
+//
+// The block is only validated when its parent is already known to be valid
+// since the validity of a block depends on all of its ancestors.  Failure to
+// validate the block for any reason other than a rule violation is not
+// considered fatal because the block will simply be validated again should it
+// ever become part of the main chain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) validateSideChainBlock(node *blockNode, block, parent *dcrutil.Block) error {
+	if !b.index.NodeStatus(node.parent).KnownValid() {
+		return nil
+	}
+
+	// Disconnect all of the main chain blocks back to the point of the
+	// fork using the spend journal to unspend the transaction outputs they
+	// spent.
+	tip := b.bestChain.Tip()
+	fork := b.bestChain.FindFork(node)
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	view.SetStakeViewpoint(ViewpointPrevValidInitial)
+	for n := tip; n != nil && n != fork; n = n.parent {
+		detachBlock, err := b.fetchMainChainBlockByNode(n)
+		if err != nil {
+			return err
+		}
+		detachParent, err := b.fetchMainChainBlockByNode(n.parent)
+		if err != nil {
+			return err
+		}
+
+		var stxos []spentTxOut
+		err = b.db.View(func(dbTx database.Tx) error {
+			stxos, err = dbFetchSpendJournalEntry(dbTx, detachBlock,
+				detachParent)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		err = b.disconnectTransactions(view, detachBlock, detachParent,
+			stxos)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Connect all of the side chain ancestors of the block from the fork
+	// point up to its parent.  They are all known to be valid at this point
+	// since the parent is.
+	attachNodes := make([]*blockNode, 0, parent.Height()-fork.height)
+	for n := node.parent; n != nil && n != fork; n = n.parent {
+		attachNodes = append(attachNodes, n)
+	}
+	for i := len(attachNodes) - 1; i >= 0; i-- {
+		n := attachNodes[i]
+		attachBlock, err := b.fetchBlockByNode(n)
+		if err != nil {
+			return err
+		}
+		attachParent, err := b.fetchBlockByNode(n.parent)
+		if err != nil {
+			return err
+		}
+		err = view.fetchInputUtxos(b.db, attachBlock, attachParent)
+		if err != nil {
+			return err
+		}
+		err = b.connectTransactions(view, attachBlock, attachParent, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Validate the block and cache the result in the block index.  It is
+	// safe to ignore any errors when flushing here for the same reasons as
+	// in the main chain case.
+	err := b.checkConnectBlock(node, block, parent, view, nil, false)
+	if err != nil {
+		if rErr, ok := err.(RuleError); ok {
+			b.markBlockInvalid(node, rErr)
+			b.flushBlockIndexWarnOnly()
+		}
+		return err
+	}
+	b.index.SetStatusFlags(node, statusValid)
+	b.flushBlockIndexWarnOnly()
+	return nil
+}
+
+// exceedsMaxChainHeight returns whether or not the provided node is above the
+// maximum height of blocks that are connected to the main chain configured via
+// Config.MaxChainHeight.
+func (b *BlockChain) exceedsMaxChainHeight(node *blockNode) bool {
+	return b.maxChainHeight > 0 && node.height > b.maxChainHeight
+}
+
+// connectBestChain handles connecting the passed block to the chain while
+// respecting proper chain selection according to the chain with the most
+// proof of work.  In the typical case, the new block simply extends the main
+// chain.  However, it may also be extending (or creating) a side chain (fork)
+// which may or may not end up becoming the main chain depending on which fork
+// cumulatively has the most proof of work.  It returns the resulting fork
 // length, that is to say the number of blocks to the fork point from the main
 // chain, which will be zero if the block ends up on the main chain (either
 // due to extending the main chain or causing a reorganization to become the
 // main chain).
 //
 // The flags modify the behavior of this function as follows:
-//  - BFFastAdd: Avoids several expensive transaction validation operations.
-//    This is useful when using checkpoints.
+//  - BFFastAdd: Avoids several expensive transaction validation operations
+//    and marks the block as trusted in the block index.  This is useful when
+//    using checkpoints.
+//  - BFTrusted: Avoids the same validation operations as BFFastAdd.
+//  - BFSilent: Suppresses the notifications about blocks that are connected
+//    to or disconnected from the main chain.
+//
+// The provided utxo view, which may be nil, is used to seed the view used to
+// connect the block when it extends the main chain.  See ProcessBlockWithView
+// for details.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Block, flags BehaviorFlags) (int64, error) {
-	fastAdd := flags&BFFastAdd == BFFastAdd
+func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Block, providedView *UtxoViewpoint, flags BehaviorFlags) (int64, error) {
+	trusted := flags&BFTrusted == BFTrusted
+	fastAdd := flags&BFFastAdd == BFFastAdd || trusted
 
 	// Ensure the passed parent is actually the parent of the block.
 	if *parent.Hash() != node.parent.hash {
@@ -1617,6 +3301,13 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 	parentHash := &block.MsgBlock().Header.PrevBlock
 	tip := b.bestChain.Tip()
 	if *parentHash == tip.hash {
+		// Do not connect blocks above the configured maximum height.
+		// The block has already been added to the block index at this
+		// point, so it remains known.
+		if b.exceedsMaxChainHeight(node) {
+			return 0, MaxChainHeightError{node.height, b.maxChainHeight}
+		}
+
 		// Skip expensive checks if the block has already been fully
 		// validated.
 		isKnownValid := b.index.NodeStatus(node).KnownValid()
@@ -1635,20 +3326,51 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 		view := NewUtxoViewpoint()
 		view.SetBestHash(parentHash)
 		view.SetStakeViewpoint(ViewpointPrevValidInitial)
+		if providedView != nil {
+			// Fall back to loading all of the referenced utxos from
+			// the database when the provided view is not for the
+			// current tip.
+			if *providedView.BestHash() == *parentHash {
+				view.addUnmodifiedEntries(providedView)
+			} else {
+				log.Debugf("Ignoring provided utxo view for block %v "+
+					"since it is for block %v instead of %v",
+					node.hash, providedView.BestHash(), parentHash)
+			}
+		}
 		var stxos []spentTxOut
+		var assumeValid bool
 		if !fastAdd {
+			assumeValid = b.assumedValid(node)
+
+			validateStart := time.Now()
 			err := b.checkConnectBlock(node, block, parent, view,
-				&stxos)
+				&stxos, assumeValid)
 			if err != nil {
-				if _, ok := err.(RuleError); ok {
-					b.index.SetStatusFlags(node, statusValidateFailed)
+				if rErr, ok := err.(RuleError); ok {
+					b.markBlockInvalid(node, rErr)
 					b.flushBlockIndexWarnOnly()
 				}
 				return 0, err
 			}
+
+			// Report how long the validation took when the caller
+			// requested it.
+			if b.onBlockValidated != nil {
+				b.onBlockValidated(&node.hash, node.height,
+					time.Since(validateStart))
+			}
 		}
 		if !isKnownValid {
-			b.index.SetStatusFlags(node, statusValid)
+			// Blocks that were not fully validated are marked
+			// trusted, which includes blocks that were fast added,
+			// such as those before the latest checkpoint, since
+			// fastAdd only remains set here due to the flags.
+			status := statusValid
+			if fastAdd || assumeValid {
+				status |= statusTrusted
+			}
+			b.index.SetStatusFlags(node, status)
 			b.flushBlockIndexWarnOnly()
 		}
 
@@ -1668,7 +3390,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 		}
 
 		// Connect the block to the main chain.
-		err := b.connectBlock(node, block, parent, view, stxos)
+		err := b.connectBlock(node, block, parent, view, stxos, flags)
 		if err != nil {
 			return 0, err
 		}
@@ -1693,7 +3415,13 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 
 	// We're extending (or creating) a side chain, but the cumulative
 	// work for this new side chain is not enough to make it the new chain.
-	if node.workSum.Cmp(tip.workSum) <= 0 {
+	// Note that the side chain must exceed the work of the current best
+	// chain by more than the configured stickiness work, if any.
+	requiredWork := tip.workSum
+	if b.reorgStickinessWork != nil {
+		requiredWork = new(big.Int).Add(tip.workSum, b.reorgStickinessWork)
+	}
+	if node.workSum.Cmp(requiredWork) <= 0 {
 		// Log information about how the block is forking the chain.
 		fork := b.bestChain.FindFork(node)
 		if fork.hash == *parentHash {
@@ -1706,6 +3434,49 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 				node.height, fork.height, fork.hash)
 		}
 
+		// Validate the side chain block now when eager side chain
+		// validation is enabled so a later reorganize to it is faster.
+		// Only rule violations are returned since any other failure
+		// just means the block will be validated during a reorganize.
+		if b.eagerSideChainValidation {
+			err := b.validateSideChainBlock(node, block, parent)
+			if err != nil {
+				if _, ok := err.(RuleError); ok {
+					return 0, err
+				}
+				log.Warnf("Unable to validate side chain block %v: %v",
+					node.hash, err)
+			}
+		}
+
+		// Warn when the side chain is close to overtaking the main
+		// chain.
+		if b.splitWarnThreshold > 0 {
+			deficit := new(big.Int).Sub(requiredWork, node.workSum)
+			maxDeficit := new(big.Int).Mul(CalcWork(tip.bits),
+				big.NewInt(b.splitWarnThreshold))
+			if deficit.Cmp(maxDeficit) <= 0 {
+				log.Warnf("Side chain tip %v (height %d) forked at height "+
+					"%d is within %d blocks of overtaking the main "+
+					"chain tip %v (height %d)", node.hash, node.height,
+					fork.height, b.splitWarnThreshold, tip.hash,
+					tip.height)
+
+				// This notification is sent with the chain lock
+				// released for the same reasons as NTBlockAccepted.
+				b.chainLock.Unlock()
+				b.sendNotification(NTDeepForkDetected,
+					&DeepForkDetectedNtfnsData{
+						MainTip:       tip.hash,
+						MainTipHeight: tip.height,
+						SideTip:       node.hash,
+						SideTipHeight: node.height,
+						ForkHeight:    fork.height,
+					})
+				b.chainLock.Lock()
+			}
+		}
+
 		forkLen := node.height - fork.height
 		return forkLen, nil
 	}
@@ -1717,6 +3488,12 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 	// blocks that form the (now) old fork from the main chain, and attach
 	// the blocks that form the new chain to the main chain starting at the
 	// common ancenstor (the point where the chain forked).
+	//
+	// Do not reorganize to side chains with a tip above the configured
+	// maximum height for the same reasons as the main chain case.
+	if b.exceedsMaxChainHeight(node) {
+		return 0, MaxChainHeightError{node.height, b.maxChainHeight}
+	}
 	detachNodes, attachNodes := b.getReorganizeNodes(node)
 
 	// Reorganize the chain and flush any potential unsaved changes to the
@@ -1724,7 +3501,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 	// errors here as the only time the index will be modified is if the
 	// block failed to connect.
 	log.Infof("REORGANIZE: Block %v is causing a reorganize.", node.hash)
-	err := b.reorganizeChain(detachNodes, attachNodes)
+	err := b.reorganizeChain(detachNodes, attachNodes, flags)
 	b.flushBlockIndexWarnOnly()
 	if err != nil {
 		return 0, err
@@ -1739,6 +3516,7 @@ func (b *BlockChain) connectBestChain(node *blockNode, block, parent *dcrutil.Bl
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has more cumulative work than the minimum (if configured)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function MUST be called with the chain state lock held (for reads).
@@ -1751,6 +3529,12 @@ func (b *BlockChain) isCurrent() bool {
 		return false
 	}
 
+	// Not current if the cumulative work of the latest main (best) chain
+	// block does not exceed the minimum chain work (when configured).
+	if b.minimumChainWork != nil && tip.workSum.Cmp(b.minimumChainWork) <= 0 {
+		return false
+	}
+
 	// Not current if the latest best block has a timestamp before 24 hours
 	// ago.
 	//
@@ -1764,6 +3548,7 @@ func (b *BlockChain) isCurrent() bool {
 // factors are used to guess, but the key factors that allow the chain to
 // believe it is current are:
 //  - Latest block height is after the latest checkpoint (if enabled)
+//  - Latest block has more cumulative work than the minimum (if configured)
 //  - Latest block has a timestamp newer than 24 hours ago
 //
 // This function is safe for concurrent access.
@@ -1774,6 +3559,31 @@ func (b *BlockChain) IsCurrent() bool {
 	return b.isCurrent()
 }
 
+// TimeSinceLastBlock returns the wall clock time that has elapsed since the tip
+// of the main chain last changed due to a block being connected or
+// disconnected, or since the chain instance was created when the tip has not
+// changed since then.  Combined with IsCurrent, this allows callers to detect
+// when syncing the chain has stalled.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) TimeSinceLastBlock() time.Duration {
+	b.chainLock.RLock()
+	lastTipChange := b.lastTipChange
+	b.chainLock.RUnlock()
+	return time.Since(lastTipChange)
+}
+
+// AddTimeSample adds a time sample from the provided source to the median time
+// source the chain was configured with.  This allows callers to feed samples,
+// such as peer timestamps, without having to keep a separate reference to the
+// time source.  The adjusted time influences whether or not the chain believes
+// it is current.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AddTimeSample(id string, t time.Time) {
+	b.timeSource.AddTimeSample(id, t)
+}
+
 // BestSnapshot returns information about the current best chain block and
 // related state as of the current point in time.  The returned instance must be
 // treated as immutable since it is shared by all callers.
@@ -1786,6 +3596,221 @@ func (b *BlockChain) BestSnapshot() *BestState {
 	return snapshot
 }
 
+// BestValidatedTip returns the hash and height of the most recent block in the
+// main chain that was fully validated.  Unlike the block reported by
+// BestSnapshot, this never refers to a block that was only trusted to be valid,
+// such as those fast added before the latest checkpoint, those with scripts
+// assumed valid per SetAssumeValid, or those connected with a loaded utxo
+// snapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BestValidatedTip() (*chainhash.Hash, int64) {
+	b.chainLock.RLock()
+	node := b.bestValidated
+	b.chainLock.RUnlock()
+	return &node.hash, node.height
+}
+
+// validatedAncestor returns the most recent block, starting with the passed
+// node and moving towards the genesis block, that was fully validated as
+// opposed to trusted to be valid.  The genesis block is always considered fully
+// validated.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) validatedAncestor(node *blockNode) *blockNode {
+	for node.parent != nil && b.index.NodeStatus(node).Trusted() {
+		node = node.parent
+	}
+	return node
+}
+
+// UtxoSetStats returns the number of unspent transaction outputs in the utxo
+// set as of the current best chain block along with their total amount.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetStats() (count int64, totalAmount int64) {
+	snapshot := b.BestSnapshot()
+	return snapshot.NumUtxos, snapshot.UtxoAmount
+}
+
+// NextBlockTemplate returns the values the header of a block that extends the
+// current best chain is required to carry.  The timestamp used to calculate the
+// required proof-of-work difficulty is the current adjusted time, or one second
+// after the median time of the current best chain should the adjusted time
+// not be after it.
+//
+// Note that the required difficulty depends on the timestamp of the block on
+// networks that allow reduced difficulty blocks, so CalcNextRequiredDifficulty
+// must be used to calculate the difficulty when a different timestamp is used.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NextBlockTemplate() (*NextBlockInfo, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	tip := b.bestChain.Tip()
+	medianTime := tip.CalcPastMedianTime()
+	timestamp := b.timeSource.AdjustedTime()
+	if !timestamp.After(medianTime) {
+		timestamp = medianTime.Add(time.Second)
+	}
+
+	bits, err := b.calcNextRequiredDifficulty(tip, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	sbits, err := b.calcNextRequiredStakeDifficulty(tip)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NextBlockInfo{
+		PrevHash:     tip.hash,
+		Height:       tip.height + 1,
+		Bits:         bits,
+		SBits:        sbits,
+		StakeVersion: b.calcStakeVersion(tip),
+		MedianTime:   medianTime,
+		Timestamp:    timestamp,
+	}, nil
+}
+
+// CheckUtxoConsistency performs a read-only sanity check that the utxo set and
+// best chain state persisted in the database correspond to the current best
+// chain state.  In particular, it ensures the stored best block hash matches
+// the current best block and that both the stored utxo set stats and the stats
+// calculated by scanning the entire utxo set match the tracked counters.
+//
+// The scan is performed against a database snapshot taken while the chain
+// state lock was held, so it does not block the chain from processing blocks in
+// the mean time.  It is much cheaper than VerifyChain since no blocks are loaded
+// or validated.
+//
+// A CorruptDatabaseError is returned when any inconsistency is detected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckUtxoConsistency() error {
+	b.chainLock.RLock()
+	snapshot := b.BestSnapshot()
+	dbTx, err := b.db.Begin(false)
+	if err != nil {
+		b.chainLock.RUnlock()
+		return err
+	}
+	defer dbTx.Rollback()
+
+	err = checkStoredChainState(dbTx, snapshot)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	numUtxos, utxoAmount, err := dbCalcUtxoSetStats(dbTx)
+	if err != nil {
+		return CorruptDatabaseError(err.Error())
+	}
+	if numUtxos != snapshot.NumUtxos || utxoAmount != snapshot.UtxoAmount {
+		str := fmt.Sprintf("utxo set (%d outputs, amount %d) does not "+
+			"match the tracked stats (%d outputs, amount %d)", numUtxos,
+			utxoAmount, snapshot.NumUtxos, snapshot.UtxoAmount)
+		return CorruptDatabaseError(str)
+	}
+
+	return nil
+}
+
+// checkStoredChainState ensures the best chain state stored in the database
+// has a best block hash and, when present, utxo set stats that match the
+// provided best chain state.  A CorruptDatabaseError is returned when they do
+// not match.
+func checkStoredChainState(dbTx database.Tx, snapshot *BestState) error {
+	serializedData := dbTx.Metadata().Get(dbnamespace.ChainStateKeyName)
+	if serializedData == nil {
+		return CorruptDatabaseError("best chain state is missing")
+	}
+	state, err := deserializeBestChainState(serializedData)
+	if err != nil {
+		return CorruptDatabaseError(err.Error())
+	}
+	if state.hash != snapshot.Hash {
+		str := fmt.Sprintf("stored best block %v does not match the "+
+			"current best block %v", state.hash, snapshot.Hash)
+		return CorruptDatabaseError(str)
+	}
+	if state.hasUtxoStats && (int64(state.numUtxos) != snapshot.NumUtxos ||
+		state.utxoAmount != snapshot.UtxoAmount) {
+
+		str := fmt.Sprintf("stored utxo set stats (%d outputs, amount "+
+			"%d) do not match the tracked stats (%d outputs, amount %d)",
+			state.numUtxos, state.utxoAmount, snapshot.NumUtxos,
+			snapshot.UtxoAmount)
+		return CorruptDatabaseError(str)
+	}
+	return nil
+}
+
+// UtxoSetHash returns a deterministic commitment to the entire utxo set as of
+// the current best chain tip.  The utxo set is iterated in the order of the
+// transaction hashes and each entry is rolled into the commitment using a
+// canonical serialization, so the result only depends on the contents of the
+// utxo set.  This makes it suitable for verifying utxo set snapshots.
+//
+// Note that the entire utxo set is scanned, so this can take a long time on
+// large chains.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoSetHash() (chainhash.Hash, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	var commitment chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		var err error
+		commitment, err = dbCalcUtxoSetHash(dbTx)
+		return err
+	})
+	return commitment, err
+}
+
+// addBestStateHistory adds the passed best chain state to the ring buffer of
+// recent best states, replacing the oldest one when the buffer is full.
+//
+// This function MUST be called with the state lock held (for writes).
+func (b *BlockChain) addBestStateHistory(state *BestState) {
+	size := len(b.bestStateHistory)
+	if size == 0 {
+		return
+	}
+	b.bestStateHistory[b.bestStateHistoryNext] = state
+	b.bestStateHistoryNext = (b.bestStateHistoryNext + 1) % size
+	if b.bestStateHistoryLen < size {
+		b.bestStateHistoryLen++
+	}
+}
+
+// RecentBestStates returns the most recent best chain states ordered from the
+// oldest to the newest.  A new state is added each time the tip of the main
+// chain changes, whether due to a block being connected or disconnected, and
+// only a limited number of them, as specified by the BestStateHistorySize
+// config option, are retained.
+//
+// The returned states must be treated as immutable since they are shared by
+// all callers.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) RecentBestStates() []*BestState {
+	b.stateLock.RLock()
+	defer b.stateLock.RUnlock()
+
+	size := len(b.bestStateHistory)
+	states := make([]*BestState, 0, b.bestStateHistoryLen)
+	start := b.bestStateHistoryNext - b.bestStateHistoryLen + size
+	for i := 0; i < b.bestStateHistoryLen; i++ {
+		states = append(states, b.bestStateHistory[(start+i)%size])
+	}
+	return states
+}
+
 // MaximumBlockSize returns the maximum permitted block size for the block
 // AFTER the given node.
 //
@@ -1827,6 +3852,74 @@ func (b *BlockChain) MaxBlockSize() (int64, error) {
 	return maxSize, err
 }
 
+// MaxBlockSizeForHeight returns the maximum permitted block size for the block
+// AFTER the main chain block at the given height.  This takes the state of the
+// max block size agenda as of that block into account.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) MaxBlockSizeForHeight(height int64) (int64, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		str := fmt.Sprintf("no block at height %d exists", height)
+		return 0, errNotInMainChain(str)
+	}
+	return b.maxBlockSize(node)
+}
+
+// BlocksUntil returns the number of blocks from the current tip of the main
+// chain to the given target height along with an estimate of how long it will
+// take for them to be mined based on the target time per block of the active
+// network.
+//
+// The returned number of blocks and duration are zero when the target height
+// is the current tip and negative when it is below the tip, in which case they
+// indicate how many blocks ago and roughly how long ago the target height was
+// reached.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlocksUntil(targetHeight int64) (int64, time.Duration, error) {
+	if targetHeight < 0 {
+		return 0, 0, fmt.Errorf("target height must not be less than "+
+			"zero - got %d", targetHeight)
+	}
+
+	b.chainLock.RLock()
+	tipHeight := b.bestChain.Tip().height
+	b.chainLock.RUnlock()
+
+	numBlocks := targetHeight - tipHeight
+	return numBlocks, time.Duration(numBlocks) *
+		b.chainParams.TargetTimePerBlock, nil
+}
+
+// ExpectedTipWork returns the cumulative work the main chain is expected to
+// have as of the current adjusted time.  It is calculated as the work of the
+// number of blocks that should have been produced since the genesis block at
+// the target time per block of the active network, including the genesis block
+// itself, at the difficulty of the current tip.  Comparing it to the actual
+// work of the tip provides a rough gauge of the health of the hash rate.
+//
+// A new big integer is returned on each call, so the caller is free to modify
+// it.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ExpectedTipWork() *big.Int {
+	b.chainLock.RLock()
+	tipBits := b.bestChain.Tip().bits
+	b.chainLock.RUnlock()
+
+	genesisTime := b.chainParams.GenesisBlock.Header.Timestamp
+	elapsed := b.timeSource.AdjustedTime().Sub(genesisTime)
+	numBlocks := int64(1)
+	if elapsed > 0 {
+		numBlocks += int64(elapsed / b.chainParams.TargetTimePerBlock)
+	}
+	return new(big.Int).Mul(CalcWork(tipBits), big.NewInt(numBlocks))
+}
+
 // HeaderByHash returns the block header identified by the given hash or an
 // error if it doesn't exist.  Note that this will return headers from both the
 // main chain and any side chains.
@@ -1841,6 +3934,27 @@ func (b *BlockChain) HeaderByHash(hash *chainhash.Hash) (wire.BlockHeader, error
 	return node.Header(), nil
 }
 
+// HeadersByHashes returns the block headers identified by the given hashes in
+// the same order.  An error identifying the first hash that is not known is
+// returned when any of the blocks do not exist.  Note that this will return
+// headers from both the main chain and any side chains.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeadersByHashes(hashes []*chainhash.Hash) ([]wire.BlockHeader, error) {
+	headers := make([]wire.BlockHeader, 0, len(hashes))
+	b.index.RLock()
+	defer b.index.RUnlock()
+	for _, hash := range hashes {
+		node := b.index.lookupNode(hash)
+		if node == nil {
+			return nil, fmt.Errorf("block %s is not known", hash)
+		}
+		headers = append(headers, node.Header())
+	}
+
+	return headers, nil
+}
+
 // HeaderByHeight returns the block header at the given height in the main
 // chain.
 //
@@ -1867,7 +3981,47 @@ func (b *BlockChain) BlockByHash(hash *chainhash.Hash) (*dcrutil.Block, error) {
 	}
 
 	// Return the block from either cache or the database.
-	return b.fetchBlockByNode(node)
+	return b.fetchBlockByNodeFromDB(b.readDB, node)
+}
+
+// ParentBlock returns the parent of the block with the provided hash without
+// requiring the caller to look up the hash of the parent first.  Much like
+// BlockByHash, this works for blocks regardless of whether or not they are part
+// of the main chain.  An error is returned when the block is not known or it is
+// the genesis block since it does not have a parent.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ParentBlock(hash *chainhash.Hash) (*dcrutil.Block, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+	parent := node.parent
+	if parent == nil {
+		return nil, fmt.Errorf("block %s is the genesis block and has no "+
+			"parent", hash)
+	}
+	if !b.index.NodeStatus(parent).HaveData() {
+		return nil, fmt.Errorf("block %s is not known", parent.hash)
+	}
+
+	// Return the block from either cache or the database.
+	return b.fetchBlockByNodeFromDB(b.readDB, parent)
+}
+
+// Genesis returns the hash of the genesis block of the chain along with the
+// block itself as loaded from the database.  The returned block will be nil in
+// the unexpected case it can't be loaded.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Genesis() (*chainhash.Hash, *dcrutil.Block) {
+	node := b.bestChain.Genesis()
+	block, err := b.fetchBlockByNodeFromDB(b.readDB, node)
+	if err != nil {
+		log.Errorf("Unable to load genesis block %v: %v", node.hash, err)
+		return &node.hash, nil
+	}
+	return &node.hash, block
 }
 
 // BlockByHeight returns the block at the given height in the main chain.
@@ -1881,10 +4035,90 @@ func (b *BlockChain) BlockByHeight(height int64) (*dcrutil.Block, error) {
 		return nil, errNotInMainChain(str)
 	}
 
-	// Return the block from either cache or the database.  Note that this is
-	// not using fetchMainChainBlockByNode since the main chain check has
-	// already been done.
-	return b.fetchBlockByNode(node)
+	// Return the block from either cache or the database.  Note that this is
+	// not using fetchMainChainBlockByNode since the main chain check has
+	// already been done.
+	return b.fetchBlockByNodeFromDB(b.readDB, node)
+}
+
+// BlockRefKind identifies how a BlockRef refers to a block.
+type BlockRefKind uint8
+
+const (
+	// BlockRefHash indicates a block is referred to by its hash.
+	BlockRefHash BlockRefKind = iota
+
+	// BlockRefHeight indicates a block is referred to by its height in the
+	// main chain.
+	BlockRefHeight
+)
+
+// BlockRef refers to a block by either its hash or its height in the main
+// chain as indicated by its kind.  The NewBlockRefFromHash and
+// NewBlockRefFromHeight functions provide convenient ways to create one.
+type BlockRef struct {
+	Kind   BlockRefKind
+	Hash   chainhash.Hash
+	Height int64
+}
+
+// NewBlockRefFromHash returns a block reference that refers to the block with
+// the given hash.
+func NewBlockRefFromHash(hash *chainhash.Hash) BlockRef {
+	return BlockRef{Kind: BlockRefHash, Hash: *hash}
+}
+
+// NewBlockRefFromHeight returns a block reference that refers to the block at
+// the given height in the main chain.
+func NewBlockRefFromHeight(height int64) BlockRef {
+	return BlockRef{Kind: BlockRefHeight, Height: height}
+}
+
+// Block returns the block identified by the given reference.  It is a
+// convenience function that dispatches to BlockByHash or BlockByHeight
+// depending on the kind of reference, so the same semantics apply.  Namely,
+// blocks referred to by hash are returned regardless of whether or not they
+// are part of the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Block(ref BlockRef) (*dcrutil.Block, error) {
+	switch ref.Kind {
+	case BlockRefHash:
+		return b.BlockByHash(&ref.Hash)
+	case BlockRefHeight:
+		return b.BlockByHeight(ref.Height)
+	}
+
+	return nil, fmt.Errorf("unknown block reference kind %d", ref.Kind)
+}
+
+// BlockWithAncestors returns the block identified by the given hash followed by
+// up to the given number of its ancestors in order from child to parent.  Fewer
+// ancestors are returned when the genesis block is reached first.  This
+// function returns blocks regardless of whether or not they are part of the
+// main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockWithAncestors(hash *chainhash.Hash, n int) ([]*dcrutil.Block, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("number of ancestors must not be less than "+
+			"zero - got %d", n)
+	}
+
+	node := b.index.LookupNode(hash)
+	if node == nil || !b.index.NodeStatus(node).HaveData() {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+
+	blocks := make([]*dcrutil.Block, 0, n+1)
+	for ; node != nil && len(blocks) <= n; node = node.parent {
+		block, err := b.fetchBlockByNodeFromDB(b.readDB, node)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
 }
 
 // MainChainHasBlock returns whether or not the block with the given hash is in
@@ -1896,6 +4130,17 @@ func (b *BlockChain) MainChainHasBlock(hash *chainhash.Hash) bool {
 	return node != nil && b.bestChain.Contains(node)
 }
 
+// IsMainChainAt returns whether or not the block with the given hash is the
+// block at the provided height in the main chain.  This is cheaper than
+// looking up the hash of the block at the height and comparing it.  False is
+// returned when the height is outside of the range of the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IsMainChainAt(height int64, hash *chainhash.Hash) bool {
+	node := b.bestChain.NodeByHeight(height)
+	return node != nil && node.hash == *hash
+}
+
 // BlockHeightByHash returns the height of the block with the given hash in the
 // main chain.
 //
@@ -1924,42 +4169,56 @@ func (b *BlockChain) BlockHashByHeight(height int64) (*chainhash.Hash, error) {
 	return &node.hash, nil
 }
 
-// HeightRange returns a range of block hashes for the given start and end
-// heights.  It is inclusive of the start height and exclusive of the end
-// height.  In other words, it is the half open range [startHeight, endHeight).
-//
-// The end height will be limited to the current main chain height.
+// clampHeightRange ensures the provided half open range of heights
+// [startHeight, endHeight) is sane and returns it with the end height limited
+// to the current main chain height.  The returned range is empty when there
+// are no main chain blocks within the requested range.
 //
 // This function is safe for concurrent access.
-func (b *BlockChain) HeightRange(startHeight, endHeight int64) ([]chainhash.Hash, error) {
+func (b *BlockChain) clampHeightRange(startHeight, endHeight int64) (int64, int64, error) {
 	// Ensure requested heights are sane.
 	if startHeight < 0 {
-		return nil, fmt.Errorf("start height of fetch range must not "+
+		return 0, 0, fmt.Errorf("start height of fetch range must not "+
 			"be less than zero - got %d", startHeight)
 	}
 	if endHeight < startHeight {
-		return nil, fmt.Errorf("end height of fetch range must not "+
+		return 0, 0, fmt.Errorf("end height of fetch range must not "+
 			"be less than the start height - got start %d, end %d",
 			startHeight, endHeight)
 	}
 
-	// There is nothing to do when the start and end heights are the same,
-	// so return now to avoid extra work.
-	if startHeight == endHeight {
-		return nil, nil
-	}
-
 	// When the requested start height is after the most recent best chain
 	// height, there is nothing to do.
 	latestHeight := b.bestChain.Tip().height
 	if startHeight > latestHeight {
-		return nil, nil
+		return startHeight, startHeight, nil
 	}
 
 	// Limit the ending height to the latest height of the chain.
 	if endHeight > latestHeight+1 {
 		endHeight = latestHeight + 1
 	}
+	return startHeight, endHeight, nil
+}
+
+// HeightRange returns a range of block hashes for the given start and end
+// heights.  It is inclusive of the start height and exclusive of the end
+// height.  In other words, it is the half open range [startHeight, endHeight).
+//
+// The end height will be limited to the current main chain height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) HeightRange(startHeight, endHeight int64) ([]chainhash.Hash, error) {
+	startHeight, endHeight, err := b.clampHeightRange(startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// There is nothing to do when the start and end heights are the same,
+	// so return now to avoid extra work.
+	if startHeight == endHeight {
+		return nil, nil
+	}
 
 	// Fetch as many as are available within the specified range.
 	hashes := make([]chainhash.Hash, endHeight-startHeight)
@@ -1974,6 +4233,121 @@ func (b *BlockChain) HeightRange(startHeight, endHeight int64) ([]chainhash.Hash
 	return hashes, nil
 }
 
+// BlockHashHeight houses the hash and height of a block.
+type BlockHashHeight struct {
+	Hash   chainhash.Hash
+	Height int64
+}
+
+// BlockHashRange returns a range of block hashes paired with their heights for
+// the given start and end heights.  It is inclusive of the start height and
+// exclusive of the end height.  In other words, it is the half open range
+// [startHeight, endHeight).
+//
+// The end height will be limited to the current main chain height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlockHashRange(startHeight, endHeight int64) ([]BlockHashHeight, error) {
+	startHeight, endHeight, err := b.clampHeightRange(startHeight, endHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	// There is nothing to do when the start and end heights are the same,
+	// so return now to avoid extra work.
+	if startHeight == endHeight {
+		return nil, nil
+	}
+
+	// Fetch as many as are available within the specified range.
+	results := make([]BlockHashHeight, endHeight-startHeight)
+	iterNode := b.bestChain.NodeByHeight(endHeight - 1)
+	for i := startHeight; i < endHeight; i++ {
+		// Since the desired result is from the starting node to the
+		// ending node in forward order, but they are iterated in
+		// reverse, add them in reverse order.
+		results[endHeight-i-1] = BlockHashHeight{
+			Hash:   iterNode.hash,
+			Height: iterNode.height,
+		}
+		iterNode = iterNode.parent
+	}
+	return results, nil
+}
+
+// ForEachBlockHashInRange invokes the provided callback with the height and
+// hash of each block in the main chain for the given start and end heights in
+// forward order.  It is inclusive of the start height and exclusive of the end
+// height.  In other words, it is the half open range [startHeight, endHeight).
+// This is useful for callers that stream the hashes since, unlike HeightRange,
+// it does not allocate a slice for the entire range.
+//
+// The end height will be limited to the current main chain height.  Iteration
+// stops early and the error is returned when the callback returns an error.
+//
+// The callback is not invoked with the chain lock held, so it may call back
+// into the chain instance.  However, this also means that iteration stops
+// early without error if the main chain is reorganized to a lower height than
+// the end height during iteration.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ForEachBlockHashInRange(startHeight, endHeight int64, fn func(height int64, hash chainhash.Hash) error) error {
+	startHeight, endHeight, err := b.clampHeightRange(startHeight, endHeight)
+	if err != nil {
+		return err
+	}
+
+	for height := startHeight; height < endHeight; height++ {
+		node := b.bestChain.NodeByHeight(height)
+		if node == nil {
+			break
+		}
+		if err := fn(height, node.hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindCommonAncestor returns the hash and height of the most recent common
+// ancestor of the two provided blocks.  The blocks do not need to be part of
+// the main chain, so this can be used to find the point at which any two
+// known branches forked.  Note that when one of the blocks is an ancestor of
+// the other, that block is the common ancestor.
+//
+// An error is returned if either block is unknown or the blocks do not share
+// a common ancestor.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) FindCommonAncestor(hash1, hash2 *chainhash.Hash) (*chainhash.Hash, int64, error) {
+	node1 := b.index.LookupNode(hash1)
+	if node1 == nil {
+		return nil, 0, fmt.Errorf("block %s is not known", hash1)
+	}
+	node2 := b.index.LookupNode(hash2)
+	if node2 == nil {
+		return nil, 0, fmt.Errorf("block %s is not known", hash2)
+	}
+
+	// Walk the higher of the two nodes back to the height of the lower one
+	// and then walk both nodes backwards in lockstep until they converge.
+	if node1.height > node2.height {
+		node1 = node1.Ancestor(node2.height)
+	} else if node2.height > node1.height {
+		node2 = node2.Ancestor(node1.height)
+	}
+	for node1 != node2 && node1 != nil && node2 != nil {
+		node1 = node1.parent
+		node2 = node2.parent
+	}
+	if node1 == nil || node2 == nil {
+		return nil, 0, fmt.Errorf("blocks %s and %s do not share a common "+
+			"ancestor", hash1, hash2)
+	}
+
+	return &node1.hash, node1.height, nil
+}
+
 // locateInventory returns the node of the block after the first known block in
 // the locator along with the number of subsequent nodes needed to either reach
 // the provided stop hash or the provided max number of entries.
@@ -2082,6 +4456,47 @@ func (b *BlockChain) LocateBlocks(locator BlockLocator, hashStop *chainhash.Hash
 	return hashes
 }
 
+// BlocksFromLocator locates the blocks after the first known block in the
+// locator until the provided stop hash is reached, or up to the provided max
+// number of blocks, and invokes the provided callback with each of them in
+// order.  The blocks are loaded from the internal caches when possible and the
+// database otherwise.  Iteration stops as soon as the callback returns an
+// error, which is then returned.
+//
+// The same special cases described by LocateBlocks apply.
+//
+// Note that the chain state lock is only held while locating the blocks, so
+// the callback may safely call back into the chain instance.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlocksFromLocator(locator BlockLocator, hashStop *chainhash.Hash, maxBlocks uint32, fn func(*dcrutil.Block) error) error {
+	// Find the node after the first known block in the locator and the
+	// total number of nodes after it needed while respecting the stop hash
+	// and max entries.
+	b.chainLock.RLock()
+	node, total := b.locateInventory(locator, hashStop, maxBlocks)
+	nodes := make([]*blockNode, 0, total)
+	for i := uint32(0); i < total; i++ {
+		nodes = append(nodes, node)
+		node = b.bestChain.Next(node)
+	}
+	b.chainLock.RUnlock()
+
+	for _, node := range nodes {
+		if !b.index.NodeStatus(node).HaveData() {
+			return fmt.Errorf("block %s is not known", node.hash)
+		}
+		block, err := b.fetchBlockByNodeFromDB(b.readDB, node)
+		if err != nil {
+			return err
+		}
+		if err := fn(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // locateHeaders returns the headers of the blocks after the first known block
 // in the locator until the provided stop hash is reached, or up to the provided
 // max number of block headers.
@@ -2146,14 +4561,32 @@ func (b *BlockChain) BlockLocatorFromHash(hash *chainhash.Hash) BlockLocator {
 // LatestBlockLocator returns a block locator for the latest known tip of the
 // main (best) chain.
 //
+// The locator is cached until the tip changes, so the returned locator is
+// shared by all callers and must not be modified.
+//
 // This function is safe for concurrent access.
 func (b *BlockChain) LatestBlockLocator() (BlockLocator, error) {
 	b.chainLock.RLock()
-	locator := b.bestChain.BlockLocator(nil)
+	b.latestLocatorLock.Lock()
+	if b.latestLocator == nil {
+		b.latestLocator = b.bestChain.BlockLocator(nil)
+	}
+	locator := b.latestLocator
+	b.latestLocatorLock.Unlock()
 	b.chainLock.RUnlock()
 	return locator, nil
 }
 
+// invalidateLatestLocator removes the cached block locator for the tip of the
+// main chain so it is recalculated the next time it is requested.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) invalidateLatestLocator() {
+	b.latestLocatorLock.Lock()
+	b.latestLocator = nil
+	b.latestLocatorLock.Unlock()
+}
+
 // IndexManager provides a generic interface that the is called when blocks are
 // connected and disconnected to and from the tip of the main chain for the
 // purpose of supporting optional indexes.
@@ -2174,6 +4607,27 @@ type IndexManager interface {
 	DisconnectBlock(database.Tx, *dcrutil.Block, *dcrutil.Block, *UtxoViewpoint) error
 }
 
+// ReorgIndexManager is an optional interface an IndexManager may implement in
+// order to be notified when a chain reorganization starts and finishes.  This
+// allows indexes to batch or defer expensive work across all of the blocks that
+// are disconnected and connected during the reorganization.
+//
+// The methods are invoked while the chain lock is held, so they must not call
+// back into the chain instance.
+type ReorgIndexManager interface {
+	IndexManager
+
+	// ReorgStarted is invoked prior to disconnecting any blocks from the
+	// main chain during a reorganization from the provided old best block
+	// to the provided new best block.
+	ReorgStarted(oldBest, newBest *chainhash.Hash)
+
+	// ReorgFinished is invoked after all blocks have been disconnected
+	// and connected during a reorganization.  It is invoked even when the
+	// reorganization fails after it started.
+	ReorgFinished()
+}
+
 // Config is a descriptor which specifies the blockchain instance configuration.
 type Config struct {
 	// DB defines the database which houses the blocks and will be used to
@@ -2182,13 +4636,38 @@ type Config struct {
 	// This field is required.
 	DB database.DB
 
+	// ReadDB defines an optional read-only replica of the database that is
+	// used to service queries such as fetching blocks by hash or height and
+	// fetching utxo entries.  This allows heavy query traffic to avoid
+	// contending with block processing, which always uses DB.
+	//
+	// The replica must contain all data committed to DB by the time it is
+	// queried since the chain does not account for replication lag.
+	//
+	// This field can be nil in which case DB is used for all queries.
+	ReadDB database.DB
+
 	// Interrupt specifies a channel the caller can close to signal that
-	// long running operations, such as catching up indexes or performing
-	// database migrations, should be interrupted.
+	// long running operations, such as catching up indexes, performing
+	// database migrations, or reorganizing the chain, should be
+	// interrupted.
 	//
 	// This field can be nil if the caller does not desire the behavior.
 	Interrupt <-chan struct{}
 
+	// InterruptCheckInterval specifies the number of blocks processed
+	// between checks of the interrupt channel while validating a
+	// reorganization of the chain.  Larger values reduce the overhead of
+	// the checks at the cost of responding to interrupts more slowly.
+	//
+	// Note that interrupts are only honored before any blocks are
+	// disconnected, so once the validated reorganization starts modifying
+	// the chain state it always runs to completion.
+	//
+	// The interrupt channel is checked before every block when this is
+	// zero.
+	InterruptCheckInterval int
+
 	// ChainParams identifies which chain parameters the chain is associated
 	// with.
 	//
@@ -2212,6 +4691,48 @@ type Config struct {
 	// notifications.
 	Notifications NotificationCallback
 
+	// RecoverNotificationPanics specifies whether panics in the notification
+	// callbacks are recovered and logged instead of being propagated to the
+	// caller that caused the notification.  This prevents a buggy subscriber
+	// from crashing the node since the chain continues processing as if the
+	// notification was delivered.
+	//
+	// By default, the panics are propagated.
+	RecoverNotificationPanics bool
+
+	// PruneInvalidSubtrees specifies whether the blocks that descend from a
+	// block which failed validation are pruned from the block index once
+	// they are marked as having an invalid ancestor.  This prevents forks
+	// that build on invalid blocks from consuming memory indefinitely.  The
+	// hashes of the pruned blocks are still retained so that they are
+	// reported as known by HaveBlock and resubmitting them, or blocks that
+	// build on them, is rejected.  Note that the retained hashes are not
+	// bounded and are only kept in memory, so they are lost on restart.
+	PruneInvalidSubtrees bool
+
+	// MaxConcurrentBlocks specifies the maximum number of blocks that may be
+	// processed concurrently, including those that are waiting for other
+	// blocks to finish processing.  Attempts to process additional blocks
+	// once the limit is reached fail with ProcessingBusyError instead of
+	// waiting.  This bounds the resources consumed when blocks are submitted
+	// faster than they can be processed, such as during a flood of blocks
+	// from the network.
+	//
+	// The number of blocks is not limited when this is zero.
+	MaxConcurrentBlocks int
+
+	// FastAddStillChecksMerkle specifies whether the header commitments to
+	// the ticket pool size and the final state of the ticket lottery are
+	// still checked for blocks processed with the BFFastAdd flag.  This
+	// trades some performance for additional safety when syncing up to the
+	// checkpoints.
+	//
+	// Note that the merkle roots of the regular and stake transaction
+	// trees committed to by the header are always checked, regardless of
+	// this setting, since they are part of the context-free sanity checks
+	// which are never skipped.
+	FastAddStillChecksMerkle bool
+
 	// SigCache defines a signature cache to use when when validating
 	// signatures.  This is typically most useful when individual
 	// transactions are already being validated prior to their inclusion in
@@ -2221,12 +4742,253 @@ type Config struct {
 	// signature cache.
 	SigCache *txscript.SigCache
 
+	// SubsidyCache defines a subsidy cache to use instead of creating a new
+	// one.  This allows multiple chain instances, such as those used in test
+	// harnesses, to share a single pre-warmed cache.  It must have been
+	// created with the same chain parameters specified by ChainParams.
+	//
+	// This field can be nil in which case a new subsidy cache is created.
+	SubsidyCache *SubsidyCache
+
 	// IndexManager defines an index manager to use when initializing the
 	// chain and connecting and disconnecting blocks.
 	//
 	// This field can be nil if the caller does not wish to make use of an
 	// index manager.
 	IndexManager IndexManager
+
+	// IndexErrorsFatal specifies whether errors returned by the index
+	// manager when connecting and disconnecting blocks prevent the block
+	// from being connected or disconnected.  When it is set to false, the
+	// errors are instead logged and cause the index manager to be disabled,
+	// which is useful when the indexes are not critical to the operation of
+	// the caller.
+	//
+	// Note that the indexes are updated in a separate database transaction
+	// from the chain state when index errors are not fatal, so the indexes
+	// will need to be rebuilt should they be disabled.
+	//
+	// This field can be nil in which case index errors are fatal.
+	IndexErrorsFatal *bool
+
+	// RetainAllStakeNodes specifies whether the stake nodes, which include
+	// the full live ticket pool, of all main chain blocks are kept in memory
+	// once they have been loaded instead of being pruned.  This allows
+	// historical stake queries to be answered without reloading the stake
+	// nodes from the database, which is useful for archival and analytics
+	// nodes.
+	//
+	// Note that this comes at a significant memory cost which grows with the
+	// height of the chain since every block keeps its own stake node.
+	// Although the nodes share the bulk of their ticket data, each one
+	// also retains the tickets that were added, voted, revoked and missed
+	// along with its lottery state.
+	RetainAllStakeNodes bool
+
+	// OnBlockValidated defines a callback that is invoked with the hash,
+	// height, and wall-clock duration of the validation of each block that
+	// is fully validated while extending the main chain.  This is useful
+	// for identifying blocks that are slow to validate.
+	//
+	// The callback is invoked while the chain lock is held, so it must not
+	// call back into the chain instance.
+	//
+	// This field can be nil if the caller is not interested in validation
+	// timings.
+	OnBlockValidated func(hash *chainhash.Hash, height int64, dur time.Duration)
+
+	// OnSpendJournal defines a callback that is invoked with the hash of
+	// each block connected to the main chain along with the outputs it
+	// spent as recorded in the spend journal.  This is useful for mirroring
+	// the spend journal to an external store.  It is only invoked after the
+	// entry has been committed to the database and is not invoked when
+	// blocks are disconnected.
+	//
+	// The callback is invoked while the chain lock is held, so it must not
+	// call back into the chain instance.
+	//
+	// This field can be nil if the caller is not interested in spend
+	// journal entries.
+	OnSpendJournal func(blockHash *chainhash.Hash, stxos []SpentTxOut)
+
+	// OnBlockInvalid defines a callback that is invoked with the hash of
+	// each block that is marked as having failed validation along with the
+	// rule error that caused it to fail.  This is useful for penalizing the
+	// peer that provided the block.
+	//
+	// The callback is invoked after the chain lock has been released, so
+	// it may safely call back into the chain instance.
+	//
+	// This field can be nil if the caller is not interested in invalid
+	// blocks.
+	OnBlockInvalid func(hash *chainhash.Hash, err RuleError)
+
+	// StructuredReorgLogger defines a callback that is invoked at each
+	// milestone of a chain reorganization with the relevant heights,
+	// hashes, and block counts.  This is useful for feeding reorganization
+	// events into log pipelines since the regular reorganization log
+	// messages are intended for humans.  The regular log messages are
+	// unaffected by this option.
+	//
+	// The callback is invoked while the chain lock is held, so it must not
+	// call back into the chain instance.
+	//
+	// This field can be nil if the caller is not interested in structured
+	// reorganization events.
+	StructuredReorgLogger func(event ReorgLogEvent)
+
+	// OnTimeAnomaly defines a callback that is invoked when the spacing
+	// between the median time of a block connected to the main chain and
+	// the median time of its parent exceeds TimeAnomalyFactor times the
+	// target time per block.  It is provided with the height of the block,
+	// the actual spacing, and the target time per block.  This is useful
+	// for monitoring for timestamp manipulation.  It is purely
+	// informational and has no effect on the validity of the block.
+	//
+	// The callback is invoked while the chain lock is held, so it must not
+	// call back into the chain instance.
+	//
+	// This field can be nil if the caller is not interested in time
+	// anomalies.
+	OnTimeAnomaly func(height int64, actualSpacing, expected time.Duration)
+
+	// TimeAnomalyFactor specifies the multiple of the target time per block
+	// the median time spacing between consecutive main chain blocks must
+	// exceed for OnTimeAnomaly to be invoked.
+	//
+	// The default factor is used when this is zero or negative.
+	TimeAnomalyFactor float64
+
+	// OnGenesisLoaded defines a callback that is invoked with the genesis
+	// block exactly once when the database is first initialized with it.
+	// This provides deployments that use custom chain parameters with a
+	// place to assert properties of their genesis block.  Returning an
+	// error aborts the creation of the chain instance and leaves the
+	// database uninitialized.
+	//
+	// This field can be nil if the caller does not need to validate the
+	// genesis block.
+	OnGenesisLoaded func(genesis *dcrutil.Block) error
+
+	// OnCorruption defines a callback that is invoked when the chain state
+	// stored in the database is detected to be corrupt while loading it.
+	// This provides callers with a place to repair or rebuild the database,
+	// such as by offering to reindex it.  Loading the chain state is
+	// attempted again when the callback returns nil, while returning an
+	// error aborts the creation of the chain instance with that error.
+	//
+	// This field can be nil in which case a CorruptDatabaseError is
+	// returned when the database is corrupt.
+	OnCorruption func() error
+
+	// EagerSideChainValidation specifies whether blocks that extend a side
+	// chain without causing a reorganize are fully validated when they are
+	// first connected.  The validation result is cached in the block index
+	// so a later reorganize to the side chain does not need to validate
+	// them again.
+	//
+	// This is disabled by default since it requires extra CPU time to
+	// validate blocks that might never become part of the main chain.
+	EagerSideChainValidation bool
+
+	// BestStateHistorySize specifies the number of recent best chain states
+	// to retain for retrieval via RecentBestStates.
+	//
+	// The default size is used when this is zero or negative.
+	BestStateHistorySize int
+
+	// DisableOrphans specifies whether blocks whose parent is not known are
+	// rejected with ErrMissingParent instead of being added to the orphan
+	// pool.  This is useful for nodes that only ever receive blocks in
+	// order, such as from a trusted feeder, since it avoids the memory and
+	// locking overhead of the orphan pool.  The orphan related query
+	// methods always report that there are no orphans when it is set.
+	DisableOrphans bool
+
+	// MaxFutureBlockTime specifies the maximum amount of time a block
+	// timestamp is allowed to be ahead of the adjusted time provided by the
+	// time source before the block is rejected.
+	//
+	// WARNING: This is a consensus rule, so changing it will cause the
+	// chain instance to diverge from the rest of the network.  It is only
+	// intended for testing and custom networks and therefore it is an
+	// error to set it on the main network.
+	//
+	// The consensus value of MaxTimeOffsetSeconds is used when this is
+	// zero.
+	MaxFutureBlockTime time.Duration
+
+	// ReorgStickinessWork specifies an amount of cumulative work by which a
+	// side chain must exceed the current best chain before it causes a
+	// reorganize.  This reduces rapid back and forth reorganizations
+	// between competing chains with nearly equal work at the cost of
+	// temporarily following a chain that does not have the most work.
+	//
+	// This field can be nil in which case a side chain causes a reorganize
+	// as soon as it has more work than the current best chain.
+	ReorgStickinessWork *big.Int
+
+	// MinimumChainWork specifies the minimum cumulative work the main chain
+	// tip must exceed before the chain considers itself current.  This
+	// helps resist being fooled into believing a low-work chain, such as
+	// one provided by peers that have eclipsed the node, is the current
+	// chain while syncing.
+	//
+	// This field can be nil in which case the cumulative work of the tip is
+	// not considered when determining whether the chain is current.
+	MinimumChainWork *big.Int
+
+	// SplitWarnThreshold specifies the number of blocks worth of work,
+	// based on the difficulty of the current main chain tip, within which
+	// a side chain must come of overtaking the main chain in order to
+	// trigger a NTDeepForkDetected notification.  This is a monitoring aid
+	// that provides operators with an early warning before a reorganize
+	// actually happens.
+	//
+	// The notifications are disabled when this is zero.
+	SplitWarnThreshold int64
+
+	// MaxChainHeight specifies the maximum height of blocks that will be
+	// connected to the main chain.  Blocks above it are still accepted into
+	// the block index, however, attempting to process them returns a
+	// MaxChainHeightError instead of connecting them when they would
+	// otherwise become the tip of the main chain.  Blocks above it that
+	// extend a side chain which does not have enough work to become the
+	// main chain are accepted to the side chain as usual.  This is useful for
+	// test harnesses and controlled environments that need to
+	// deterministically replay the chain up to a fixed height.
+	//
+	// The height is unlimited when this is zero.
+	MaxChainHeight int64
+
+	// DisableBlockCache specifies whether the cache of recent main chain
+	// blocks is disabled so they are always loaded from the database
+	// instead of being kept in memory.  This is useful for memory
+	// constrained nodes.
+	//
+	// Note that disabling the cache hurts the performance of
+	// reorganizations and anything else that repeatedly accesses recent
+	// blocks since they must be loaded from the database each time.
+	DisableBlockCache bool
+
+	// IndexFlushInterval specifies the interval at which modified block
+	// index entries are written to the database in the background instead
+	// of as part of accepting, connecting, and disconnecting each block.
+	// This reduces the database latency of processing blocks which is
+	// useful for high-throughput imports.  Any pending changes are also
+	// written when Close is called.
+	//
+	// Note that the block index entry for a block that is connected to the
+	// main chain is always written along with the best state, so the
+	// database remains consistent.  However, any changes that are pending
+	// when the process crashes are lost.  This means blocks might need to
+	// be validated again and side chain blocks might need to be downloaded
+	// again after a crash.  Close MUST be called prior to closing the
+	// database to avoid that.
+	//
+	// The block index is flushed as part of processing blocks when this is
+	// zero.
+	IndexFlushInterval time.Duration
 }
 
 // New returns a BlockChain instance using the provided configuration details.
@@ -2239,6 +5001,57 @@ func New(config *Config) (*BlockChain, error) {
 		return nil, AssertError("blockchain.New chain parameters nil")
 	}
 
+	// Use the consensus maximum future block time when one is not
+	// specified and prevent it from being overridden on the main network.
+	maxFutureBlockTime := config.MaxFutureBlockTime
+	if maxFutureBlockTime < 0 {
+		return nil, AssertError("blockchain.New maximum future block " +
+			"time is negative")
+	}
+	if maxFutureBlockTime != 0 && config.ChainParams.Net == wire.MainNet {
+		return nil, AssertError("blockchain.New maximum future block " +
+			"time must not be overridden on the main network")
+	}
+	if maxFutureBlockTime == 0 {
+		maxFutureBlockTime = time.Second * MaxTimeOffsetSeconds
+	}
+
+	// Ensure the reorganize stickiness work is not negative and make a copy
+	// of it so later modifications by the caller have no effect.
+	var reorgStickinessWork *big.Int
+	if config.ReorgStickinessWork != nil {
+		if config.ReorgStickinessWork.Sign() < 0 {
+			return nil, AssertError("blockchain.New reorganize " +
+				"stickiness work is negative")
+		}
+		reorgStickinessWork = new(big.Int).Set(config.ReorgStickinessWork)
+	}
+
+	// Ensure the minimum chain work is not negative and make a copy of it
+	// so later modifications by the caller have no effect.
+	var minimumChainWork *big.Int
+	if config.MinimumChainWork != nil {
+		if config.MinimumChainWork.Sign() < 0 {
+			return nil, AssertError("blockchain.New minimum chain " +
+				"work is negative")
+		}
+		minimumChainWork = new(big.Int).Set(config.MinimumChainWork)
+	}
+
+	// Ensure a provided subsidy cache is for the same chain parameters.
+	if config.SubsidyCache != nil &&
+		config.SubsidyCache.params != config.ChainParams {
+
+		return nil, AssertError("blockchain.New subsidy cache is for " +
+			"different chain parameters")
+	}
+
+	// Use the default best state history size when one is not specified.
+	bestStateHistorySize := config.BestStateHistorySize
+	if bestStateHistorySize <= 0 {
+		bestStateHistorySize = defaultBestStateHistorySize
+	}
+
 	// Generate a checkpoint by height map from the provided checkpoints.
 	params := config.ChainParams
 	var checkpointsByHeight map[int64]*chaincfg.Checkpoint
@@ -2250,15 +5063,66 @@ func New(config *Config) (*BlockChain, error) {
 		}
 	}
 
+	readDB := config.ReadDB
+	if readDB == nil {
+		readDB = config.DB
+	}
+
+	// Index errors are fatal unless explicitly configured otherwise.
+	indexErrorsFatal := config.IndexErrorsFatal == nil ||
+		*config.IndexErrorsFatal
+
+	interruptCheckInterval := config.InterruptCheckInterval
+	if interruptCheckInterval <= 0 {
+		interruptCheckInterval = 1
+	}
+
+	// Use the default time anomaly factor when one is not specified.
+	timeAnomalyFactor := config.TimeAnomalyFactor
+	if timeAnomalyFactor <= 0 {
+		timeAnomalyFactor = defaultTimeAnomalyFactor
+	}
+
+	// Flush the block index as part of processing blocks unless a positive
+	// background flush interval is specified.
+	var indexFlushInterval time.Duration
+	if config.IndexFlushInterval > 0 {
+		indexFlushInterval = config.IndexFlushInterval
+	}
+
 	b := BlockChain{
 		checkpointsByHeight:           checkpointsByHeight,
 		db:                            config.DB,
+		readDB:                        readDB,
 		chainParams:                   params,
 		timeSource:                    config.TimeSource,
 		notifications:                 config.Notifications,
 		sigCache:                      config.SigCache,
 		indexManager:                  config.IndexManager,
+		indexErrorsFatal:              indexErrorsFatal,
+		retainAllStakeNodes:           config.RetainAllStakeNodes,
+		splitWarnThreshold:            config.SplitWarnThreshold,
+		maxChainHeight:                config.MaxChainHeight,
+		disableBlockCache:             config.DisableBlockCache,
 		interrupt:                     config.Interrupt,
+		interruptCheckInterval:        interruptCheckInterval,
+		onBlockValidated:              config.OnBlockValidated,
+		onSpendJournal:                config.OnSpendJournal,
+		onBlockInvalid:                config.OnBlockInvalid,
+		reorgLogger:                   config.StructuredReorgLogger,
+		onTimeAnomaly:                 config.OnTimeAnomaly,
+		timeAnomalyFactor:             timeAnomalyFactor,
+		onGenesisLoaded:               config.OnGenesisLoaded,
+		eagerSideChainValidation:      config.EagerSideChainValidation,
+		disableOrphans:                config.DisableOrphans,
+		recoverNtfnPanics:             config.RecoverNotificationPanics,
+		pruneInvalidSubtrees:          config.PruneInvalidSubtrees,
+		fastAddStillChecksMerkle:      config.FastAddStillChecksMerkle,
+		maxFutureBlockTime:            maxFutureBlockTime,
+		reorgStickinessWork:           reorgStickinessWork,
+		minimumChainWork:              minimumChainWork,
+		indexFlushInterval:            indexFlushInterval,
+		bestStateHistory:              make([]*BestState, bestStateHistorySize),
 		index:                         newBlockIndex(config.DB, params),
 		bestChain:                     newChainView(nil),
 		orphans:                       make(map[chainhash.Hash]*orphanBlock),
@@ -2276,7 +5140,23 @@ func New(config *Config) (*BlockChain, error) {
 	// Initialize the chain state from the passed database.  When the db
 	// does not yet contain any chain state, both it and the chain state
 	// will be initialized to contain only the genesis block.
-	if err := b.initChainState(); err != nil {
+	//
+	// Give the caller a chance to repair the database and try again once
+	// when the stored chain state is corrupt.
+	err := b.initChainState()
+	if _, ok := err.(CorruptDatabaseError); ok && config.OnCorruption != nil {
+		log.Errorf("Unable to load chain state: %v", err)
+		if err := config.OnCorruption(); err != nil {
+			return nil, err
+		}
+
+		// Discard any state that was partially loaded.
+		b.index = newBlockIndex(config.DB, params)
+		b.bestChain = newChainView(nil)
+		b.mainchainBlockCache = make(map[chainhash.Hash]*dcrutil.Block)
+		err = b.initChainState()
+	}
+	if err != nil {
 		return nil, err
 	}
 
@@ -2290,8 +5170,23 @@ func New(config *Config) (*BlockChain, error) {
 	}
 
 	tip := b.bestChain.Tip()
-	b.subsidyCache = NewSubsidyCache(tip.height, b.chainParams)
+	b.subsidyCache = config.SubsidyCache
+	if b.subsidyCache == nil {
+		b.subsidyCache = NewSubsidyCache(tip.height, b.chainParams)
+	}
 	b.pruner = newChainPruner(&b)
+	b.pauseCond = sync.NewCond(&b.chainLock)
+	b.lastTipChange = time.Now()
+	if config.MaxConcurrentBlocks > 0 {
+		b.processSem = make(chan struct{}, config.MaxConcurrentBlocks)
+	}
+
+	// Start flushing the block index in the background when requested.
+	if b.indexFlushInterval != 0 {
+		b.indexFlushQuit = make(chan struct{})
+		b.indexFlushWg.Add(1)
+		go b.indexFlushHandler()
+	}
 
 	log.Infof("Blockchain database version info: chain: %d, compression: "+
 		"%d, block index: %d", b.dbInfo.version, b.dbInfo.compVer,
@@ -2303,3 +5198,114 @@ func New(config *Config) (*BlockChain, error) {
 
 	return &b, nil
 }
+
+// ChainStateSnapshot houses the state of a chain instance captured by
+// SnapshotState along with a reference to the database that backs it so the
+// chain can later be rewound to it via RestoreState.
+//
+// Note that it is an in-memory convenience that is primarily intended to allow
+// test suites to quickly return to a known point without repeatedly building
+// the same chain.  It is NOT a backup of the database.
+type ChainStateSnapshot struct {
+	// BestState is the state of the main chain when the snapshot was taken.
+	BestState BestState
+
+	// db is the database the chain instance the snapshot was taken from
+	// uses.
+	db database.DB
+
+	// nodes contains the hashes of all blocks in the block index when the
+	// snapshot was taken.
+	nodes []chainhash.Hash
+}
+
+// SnapshotState captures the current best state of the chain along with the
+// blocks in the block index and the underlying database so the chain can later
+// be rewound to the current point via RestoreState.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SnapshotState() (*ChainStateSnapshot, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	b.index.RLock()
+	nodes := make([]chainhash.Hash, 0, len(b.index.index))
+	for hash := range b.index.index {
+		nodes = append(nodes, hash)
+	}
+	b.index.RUnlock()
+
+	return &ChainStateSnapshot{
+		BestState: *b.BestSnapshot(),
+		db:        b.db,
+		nodes:     nodes,
+	}, nil
+}
+
+// RestoreState returns a new BlockChain instance that uses the database
+// referenced by the provided snapshot, which overrides the database in the
+// provided configuration, and rewinds the main chain to the best block as of
+// the time the snapshot was taken.  Any blocks that were connected after the
+// snapshot was taken are disconnected and remain known as side chain blocks.
+//
+// An error is returned when the database does not contain all of the blocks
+// that were known when the snapshot was taken.
+//
+// Since the database is shared, the chain instance the snapshot was taken from
+// MUST NOT be used after calling this function.
+func RestoreState(config *Config, snap *ChainStateSnapshot) (*BlockChain, error) {
+	if snap == nil {
+		return nil, AssertError("blockchain.RestoreState snapshot is nil")
+	}
+
+	cfg := *config
+	cfg.DB = snap.db
+	b, err := New(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop any background processing, such as flushing the block index, of
+	// the new chain instance when it can't be rewound since it is not
+	// returned to the caller.
+	if err := b.rewindToSnapshot(snap); err != nil {
+		if closeErr := b.Close(); closeErr != nil {
+			log.Warnf("Unable to close chain instance: %v", closeErr)
+		}
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// rewindToSnapshot reorganizes the main chain back to the best block as of the
+// time the provided snapshot was taken.  See RestoreState.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) rewindToSnapshot(snap *ChainStateSnapshot) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Ensure all blocks that were known when the snapshot was taken are
+	// still known.
+	for i := range snap.nodes {
+		if b.index.LookupNode(&snap.nodes[i]) == nil {
+			return fmt.Errorf("block %s from snapshot is not known",
+				&snap.nodes[i])
+		}
+	}
+
+	// Reorganize the main chain back to the snapshot tip as needed.
+	snapTipHash := &snap.BestState.Hash
+	node := b.index.LookupNode(snapTipHash)
+	detachNodes, attachNodes := b.getReorganizeNodes(node)
+	if err := b.reorganizeChain(detachNodes, attachNodes, BFNone); err != nil {
+		return err
+	}
+	if tip := b.bestChain.Tip(); tip.hash != *snapTipHash {
+		return fmt.Errorf("unable to restore chain to snapshot tip %s "+
+			"(current tip %s)", snapTipHash, tip.hash)
+	}
+
+	return nil
+}
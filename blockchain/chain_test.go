@@ -9,17 +9,26 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/decred/dcrd/blockchain/chaingen"
+	"github.com/decred/dcrd/blockchain/internal/dbnamespace"
+	"github.com/decred/dcrd/blockchain/stake"
 	"github.com/decred/dcrd/chaincfg"
 	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/database"
 	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
 	"github.com/decred/dcrd/wire"
 )
 
@@ -624,215 +633,1178 @@ func TestForceHeadReorg(t *testing.T) {
 	expectTip("b3")
 }
 
-// locatorHashes is a convenience function that returns the hashes for all of
-// the passed indexes of the provided nodes.  It is used to construct expected
-// block locators in the tests.
-func locatorHashes(nodes []*blockNode, indexes ...int) BlockLocator {
-	hashes := make(BlockLocator, 0, len(indexes))
-	for _, idx := range indexes {
-		hashes = append(hashes, &nodes[idx].hash)
+// TestReorgStats ensures the cumulative reorganization statistics are updated
+// as expected when the chain reorganizes.
+func TestReorgStats(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reorgstatstest")
+	defer teardownFunc()
+
+	// Ensure there are no reorganizations reported for a new chain.
+	if stats := g.chain.ReorgStats(); stats != (ReorgStats{}) {
+		t.Fatalf("unexpected reorg stats for new chain -- got %+v", stats)
+	}
+
+	// Create a main chain and a side chain that forks from it one block
+	// deeper and has more work to force a two block deep reorganization.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a -> b2a -> b3a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+
+	want := ReorgStats{
+		TotalReorgs:    1,
+		BlocksDetached: 2,
+		BlocksAttached: 3,
+		DeepestReorg:   2,
+	}
+	if stats := g.chain.ReorgStats(); stats != want {
+		t.Fatalf("unexpected reorg stats -- got %+v, want %+v", stats, want)
+	}
+
+	// Create another side chain that forks one block back from the current
+	// tip to force a shallower reorganization and ensure the deepest reorg
+	// remains the previous one.
+	//
+	//   genesis -> bp -> b1a -> b2a -> b3a
+	//                              \-> b3b -> b4b
+	g.SetTip("b2a")
+	g.NextBlock("b3b", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3a")
+	g.NextBlock("b4b", nil, nil)
+	g.AcceptTipBlock()
+
+	want = ReorgStats{
+		TotalReorgs:    2,
+		BlocksDetached: 3,
+		BlocksAttached: 5,
+		DeepestReorg:   2,
+	}
+	if stats := g.chain.ReorgStats(); stats != want {
+		t.Fatalf("unexpected reorg stats -- got %+v, want %+v", stats, want)
 	}
-	return hashes
 }
 
-// nodeHashes is a convenience function that returns the hashes for all of the
-// passed indexes of the provided nodes.  It is used to construct expected hash
-// slices in the tests.
-func nodeHashes(nodes []*blockNode, indexes ...int) []chainhash.Hash {
-	hashes := make([]chainhash.Hash, 0, len(indexes))
-	for _, idx := range indexes {
-		hashes = append(hashes, nodes[idx].hash)
+// TestStructuredReorgLogger ensures the structured reorg logger is invoked with
+// the expected details at each milestone of a chain reorganization.
+func TestStructuredReorgLogger(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "structuredreorglogtest")
+	defer teardownFunc()
+
+	// Record all structured reorg events.
+	var events []ReorgLogEvent
+	g.chain.reorgLogger = func(event ReorgLogEvent) {
+		events = append(events, event)
+	}
+
+	// Create a main chain and a side chain that forks from it one block
+	// deeper and has more work to force a two block deep reorganization.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a -> b2a -> b3a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	if len(events) != 0 {
+		t.Fatalf("unexpected events prior to reorg -- got %d", len(events))
+	}
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure an event was logged for each milestone with the expected
+	// details.
+	hashOf := func(name string) chainhash.Hash {
+		return g.BlockByName(name).BlockHash()
+	}
+	wantEvent := ReorgLogEvent{
+		ForkHash:    hashOf("bp"),
+		ForkHeight:  1,
+		OldHash:     hashOf("b2"),
+		OldHeight:   3,
+		NewHash:     hashOf("b3a"),
+		NewHeight:   4,
+		NumDetached: 2,
+		NumAttached: 3,
+	}
+	stages := []ReorgLogStage{ReorgForkFound, ReorgDetachDone, ReorgAttachDone}
+	if len(events) != len(stages) {
+		t.Fatalf("unexpected number of events -- got %d, want %d",
+			len(events), len(stages))
+	}
+	for i, stage := range stages {
+		wantEvent.Stage = stage
+		if events[i] != wantEvent {
+			t.Fatalf("unexpected %v event -- got %+v, want %+v", stage,
+				events[i], wantEvent)
+		}
 	}
-	return hashes
 }
 
-// nodeHeaders is a convenience function that returns the headers for all of
-// the passed indexes of the provided nodes.  It is used to construct expected
-// located headers in the tests.
-func nodeHeaders(nodes []*blockNode, indexes ...int) []wire.BlockHeader {
-	headers := make([]wire.BlockHeader, 0, len(indexes))
-	for _, idx := range indexes {
-		headers = append(headers, nodes[idx].Header())
+// TestTimeAnomaly ensures the time anomaly callback is invoked when the spacing
+// between the median times of consecutive main chain blocks exceeds the
+// configured multiple of the target time per block.
+func TestTimeAnomaly(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "timeanomalytest")
+	defer teardownFunc()
+
+	// Record all time anomalies.
+	type anomaly struct {
+		height   int64
+		spacing  time.Duration
+		expected time.Duration
+	}
+	var anomalies []anomaly
+	g.chain.onTimeAnomaly = func(height int64, spacing, expected time.Duration) {
+		anomalies = append(anomalies, anomaly{height, spacing, expected})
+	}
+
+	// Create enough blocks with the usual timestamps to fill the median
+	// time window so the median time spacing is stable.
+	//
+	//   genesis -> bp -> b1 -> ... -> b12
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	const numNormal = 12
+	for i := 1; i <= numNormal; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+
+	// Ensure no anomalies are reported for blocks with the usual spacing
+	// once the median time window is full.  Earlier blocks are ignored
+	// since the median time jumps from the genesis block timestamp.
+	for _, a := range anomalies {
+		if a.height > medianTimeBlocks {
+			t.Fatalf("unexpected time anomaly at height %d", a.height)
+		}
+	}
+	anomalies = nil
+
+	// Create blocks with artificially skewed timestamps one minute apart.
+	// The median time only moves by the skewed spacing once the majority
+	// of the blocks in the median time window are skewed.
+	//
+	//   ... -> b12 -> bs1 -> ... -> bs6
+	const skew = time.Minute
+	const numSkewed = medianTimeBlocks/2 + 1
+	for i := 1; i <= numSkewed; i++ {
+		ts := g.Tip().Header.Timestamp.Add(skew)
+		g.NextBlock(fmt.Sprintf("bs%d", i), nil, nil, func(b *wire.MsgBlock) {
+			b.Header.Timestamp = ts
+		})
+		g.AcceptTipBlock()
+	}
+
+	// Ensure the anomaly was reported for the block that moved the median
+	// time by the skewed spacing.
+	wantHeight := int64(numNormal + 1 + numSkewed)
+	if len(anomalies) != 1 {
+		t.Fatalf("unexpected number of time anomalies -- got %d, want 1",
+			len(anomalies))
+	}
+	want := anomaly{wantHeight, skew, params.TargetTimePerBlock}
+	if anomalies[0] != want {
+		t.Fatalf("unexpected time anomaly -- got %+v, want %+v",
+			anomalies[0], want)
 	}
-	return headers
 }
 
-// TestLocateInventory ensures that locating inventory via the LocateHeaders and
-// LocateBlocks functions behaves as expected.
-func TestLocateInventory(t *testing.T) {
-	// Construct a synthetic block chain with a block index consisting of
-	// the following structure.
-	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
-	// 	                              \-> 16a -> 17a
-	tip := branchTip
-	chain := newFakeChain(&chaincfg.MainNetParams)
-	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
-	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
-	for _, node := range branch0Nodes {
-		chain.index.AddNode(node)
+// TestIsReorganizing ensures the chain only reports it is reorganizing while a
+// reorganize is in progress.
+func TestIsReorganizing(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "isreorganizingtest")
+	defer teardownFunc()
+
+	// Create a main chain and a side chain.
+	//
+	//   genesis -> bp -> b1
+	//                \-> b1a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+	if g.chain.IsReorganizing() {
+		t.Fatal("chain reports reorganizing without a reorganize")
 	}
-	for _, node := range branch1Nodes {
-		chain.index.AddNode(node)
+
+	// Observe the flag from within the notifications that are sent while
+	// the reorganize is in progress and extend the side chain to cause a
+	// reorganize.
+	//
+	//   genesis -> bp -> b1
+	//                \-> b1a -> b2a
+	var observed []bool
+	g.chain.notifications = func(n *Notification) {
+		switch n.Type {
+		case NTChainReorgStarted, NTBlockDisconnected, NTBlockConnected:
+			observed = append(observed, g.chain.IsReorganizing())
+		}
 	}
-	chain.bestChain.SetTip(tip(branch0Nodes))
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptTipBlock()
+	want := []bool{true, true, true, true}
+	if !reflect.DeepEqual(observed, want) {
+		t.Fatalf("unexpected reorganizing states -- got %v, want %v",
+			observed, want)
+	}
+	if g.chain.IsReorganizing() {
+		t.Fatal("chain reports reorganizing after the reorganize finished")
+	}
+}
 
-	// Create chain views for different branches of the overall chain to
-	// simulate a local and remote node on different parts of the chain.
-	localView := newChainView(tip(branch0Nodes))
-	remoteView := newChainView(tip(branch1Nodes))
+// TestConnectTimings ensures the cumulative timings for committing connected
+// and disconnected blocks to the database advance as blocks are connected and
+// disconnected.
+func TestConnectTimings(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "connecttimingstest")
+	defer teardownFunc()
 
-	// Create a chain view for a completely unrelated block chain to
-	// simulate a remote node on a totally different chain.
-	unrelatedBranchNodes := chainedFakeNodes(nil, 5)
-	unrelatedView := newChainView(tip(unrelatedBranchNodes))
+	// Ensure there are no timings reported for a new chain.
+	timings := g.chain.ConnectTimings()
+	if timings != (ConnectTimings{}) {
+		t.Fatalf("unexpected timings for new chain -- got %+v", timings)
+	}
+	if avg := timings.AvgConnectTime(); avg != 0 {
+		t.Fatalf("unexpected average connect time for new chain -- got %v",
+			avg)
+	}
 
-	tests := []struct {
-		name       string
-		locator    BlockLocator       // locator for requested inventory
-		hashStop   chainhash.Hash     // stop hash for locator
-		maxAllowed uint32             // max to locate, 0 = wire const
-		headers    []wire.BlockHeader // expected located headers
-		hashes     []chainhash.Hash   // expected located hashes
-	}{
-		{
-			// Empty block locators and unknown stop hash.  No
-			// inventory should be located.
-			name:     "no locators, no stop",
-			locator:  nil,
-			hashStop: chainhash.Hash{},
-			headers:  nil,
-			hashes:   nil,
-		},
-		{
-			// Empty block locators and stop hash in side chain.
-			// The expected result is the requested block.
-			name:     "no locators, stop in side",
-			locator:  nil,
-			hashStop: tip(branch1Nodes).hash,
-			headers:  nodeHeaders(branch1Nodes, 1),
-			hashes:   nodeHashes(branch1Nodes, 1),
-		},
-		{
-			// Empty block locators and stop hash in main chain.
-			// The expected result is the requested block.
-			name:     "no locators, stop in main",
-			locator:  nil,
-			hashStop: branch0Nodes[12].hash,
-			headers:  nodeHeaders(branch0Nodes, 12),
-			hashes:   nodeHashes(branch0Nodes, 12),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash local node doesn't know about.  The
-			// expected result is the blocks after the fork point in
-			// the main chain and the stop hash has no effect.
-			name:     "remote side chain, unknown stop",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: chainhash.Hash{0x01},
-			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash in side chain.  The expected result is the
-			// blocks after the fork point in the main chain and the
-			// stop hash has no effect.
-			name:     "remote side chain, stop in side",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: tip(branch1Nodes).hash,
-			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash in main chain, but before fork point.  The
-			// expected result is the blocks after the fork point in
-			// the main chain and the stop hash has no effect.
-			name:     "remote side chain, stop in main before",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: branch0Nodes[13].hash,
-			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash in main chain, but exactly at the fork
-			// point.  The expected result is the blocks after the
-			// fork point in the main chain and the stop hash has no
-			// effect.
-			name:     "remote side chain, stop in main exact",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: branch0Nodes[14].hash,
-			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash in main chain just after the fork point.
-			// The expected result is the blocks after the fork
-			// point in the main chain up to and including the stop
-			// hash.
-			name:     "remote side chain, stop in main after",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: branch0Nodes[15].hash,
-			headers:  nodeHeaders(branch0Nodes, 15),
-			hashes:   nodeHashes(branch0Nodes, 15),
-		},
-		{
-			// Locators based on remote being on side chain and a
-			// stop hash in main chain some time after the fork
-			// point.  The expected result is the blocks after the
-			// fork point in the main chain up to and including the
-			// stop hash.
-			name:     "remote side chain, stop in main after more",
-			locator:  remoteView.BlockLocator(nil),
-			hashStop: branch0Nodes[16].hash,
-			headers:  nodeHeaders(branch0Nodes, 15, 16),
-			hashes:   nodeHashes(branch0Nodes, 15, 16),
-		},
-		{
-			// Locators based on remote being on main chain in the
-			// past and a stop hash local node doesn't know about.
-			// The expected result is the blocks after the known
-			// point in the main chain and the stop hash has no
-			// effect.
-			name:     "remote main chain past, unknown stop",
-			locator:  localView.BlockLocator(branch0Nodes[12]),
-			hashStop: chainhash.Hash{0x01},
-			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on main chain in the
-			// past and a stop hash in a side chain.  The expected
-			// result is the blocks after the known point in the
-			// main chain and the stop hash has no effect.
-			name:     "remote main chain past, stop in side",
-			locator:  localView.BlockLocator(branch0Nodes[12]),
-			hashStop: tip(branch1Nodes).hash,
-			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on main chain in the
-			// past and a stop hash in the main chain before that
-			// point.  The expected result is the blocks after the
-			// known point in the main chain and the stop hash has
-			// no effect.
-			name:     "remote main chain past, stop in main before",
-			locator:  localView.BlockLocator(branch0Nodes[12]),
-			hashStop: branch0Nodes[11].hash,
-			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
-			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
-		},
-		{
-			// Locators based on remote being on main chain in the
-			// past and a stop hash in the main chain exactly at that
-			// point.  The expected result is the blocks after the
-			// known point in the main chain and the stop hash has
-			// no effect.
-			name:     "remote main chain past, stop in main exact",
-			locator:  localView.BlockLocator(branch0Nodes[12]),
+	// Connect several blocks and ensure the connect counters advance.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	timings = g.chain.ConnectTimings()
+	if timings.NumConnected != 4 || timings.NumDisconnected != 0 {
+		t.Fatalf("unexpected block counts -- got %+v", timings)
+	}
+	if timings.TotalConnectTime <= 0 {
+		t.Fatalf("connect time did not advance -- got %v",
+			timings.TotalConnectTime)
+	}
+	wantAvg := timings.TotalConnectTime / 4
+	if avg := timings.AvgConnectTime(); avg != wantAvg {
+		t.Fatalf("unexpected average connect time -- got %v, want %v",
+			avg, wantAvg)
+	}
+
+	// Disconnect the tip and ensure the disconnect counters advance while
+	// the connect counters remain the same.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	prevTimings := timings
+	timings = g.chain.ConnectTimings()
+	if timings.NumConnected != prevTimings.NumConnected ||
+		timings.TotalConnectTime != prevTimings.TotalConnectTime {
+		t.Fatalf("unexpected connect timings after disconnect -- got "+
+			"%+v, want %+v", timings, prevTimings)
+	}
+	if timings.NumDisconnected != 1 || timings.TotalDisconnectTime <= 0 {
+		t.Fatalf("unexpected disconnect timings -- got %+v", timings)
+	}
+	if avg := timings.AvgDisconnectTime(); avg != timings.TotalDisconnectTime {
+		t.Fatalf("unexpected average disconnect time -- got %v, want %v",
+			avg, timings.TotalDisconnectTime)
+	}
+}
+// TestOnBlockValidated ensures the block validation timing callback is invoked
+// with the expected block details when blocks are fully validated.
+func TestOnBlockValidated(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "onblockvalidatedtest")
+	defer teardownFunc()
+
+	// Record the details reported by the callback.
+	var gotHash chainhash.Hash
+	var gotHeight int64
+	var gotDur time.Duration
+	var numCalls int
+	g.chain.onBlockValidated = func(hash *chainhash.Hash, height int64, dur time.Duration) {
+		gotHash = *hash
+		gotHeight = height
+		gotDur = dur
+		numCalls++
+	}
+
+	// Accept a couple of blocks and ensure the callback fires for each of
+	// them with a plausible duration.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+
+	if numCalls != 2 {
+		t.Fatalf("unexpected number of callbacks -- got %d, want 2", numCalls)
+	}
+	tip := g.Tip()
+	if gotHash != tip.BlockHash() || gotHeight != int64(tip.Header.Height) {
+		t.Fatalf("unexpected validated block -- got (hash %s, height %d), "+
+			"want (hash %s, height %d)", gotHash, gotHeight,
+			tip.BlockHash(), tip.Header.Height)
+	}
+	if gotDur <= 0 || gotDur > time.Minute {
+		t.Fatalf("implausible validation duration %v", gotDur)
+	}
+}
+
+// TestEagerSideChainValidation ensures that side chain blocks are fully
+// validated when they are first connected with eager side chain validation
+// enabled and that a later reorganize to them does not validate them again.
+func TestEagerSideChainValidation(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "eagersidechaintest")
+	defer teardownFunc()
+	g.chain.eagerSideChainValidation = true
+
+	// Create a main chain along with a side chain that forks from it a
+	// couple of blocks back and a sibling of the current tip.
+	//
+	//   genesis -> bp -> b1 -> b2  -> b3
+	//                      \      \-> b3b
+	//                       \-> b2a -> b3a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b3", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b2")
+	g.NextBlock("b3b", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+
+	// Ensure all of the side chain blocks are known to be valid.
+	for _, name := range []string{"b2a", "b3a", "b3b"} {
+		hash := g.BlockByName(name).BlockHash()
+		node := g.chain.index.LookupNode(&hash)
+		if !g.chain.index.NodeStatus(node).KnownValid() {
+			t.Fatalf("side chain block %q is not known to be valid", name)
+		}
+	}
+
+	// Change the required organization script so that any attempt to
+	// validate the side chain blocks again would fail and ensure forcing a
+	// reorganize to one of them still succeeds.
+	origOrgPkScript := g.chain.chainParams.OrganizationPkScript
+	g.chain.chainParams.OrganizationPkScript = []byte{0x00}
+	err := g.chain.ForceHeadReorganization(g.BlockByName("b3").BlockHash(),
+		g.BlockByName("b3b").BlockHash())
+	if err != nil {
+		t.Fatalf("failed to force reorganize to eagerly validated block: %v",
+			err)
+	}
+	g.ExpectTip("b3b")
+	g.chain.chainParams.OrganizationPkScript = origOrgPkScript
+
+	// Extend the side chain to cause a reorganize to it.
+	//
+	//   ... -> b1 -> b2a -> b3a -> b4a
+	g.NextBlock("b4a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure side chain blocks are not validated when the option is
+	// disabled.
+	//
+	//   ... -> b3a -> b4a
+	//            \-> b4b
+	g.chain.eagerSideChainValidation = false
+	g.SetTip("b3a")
+	g.NextBlock("b4b", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b4a")
+	hash := g.Tip().BlockHash()
+	node := g.chain.index.LookupNode(&hash)
+	if g.chain.index.NodeStatus(node).KnownValid() {
+		t.Fatal("side chain block b4b is unexpectedly known to be valid")
+	}
+}
+
+// TestTipChangeNotifications ensures the channels returned by
+// TipChangeNotifications are delivered the best state for each tip change, drop
+// the oldest states when the consumer falls behind, and are no longer delivered
+// states once unsubscribed.
+func TestTipChangeNotifications(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "tipchangentfnstest")
+	defer teardownFunc()
+
+	// Create a couple of independent channels.
+	c1, unsubscribe1 := g.chain.TipChangeNotifications()
+	defer unsubscribe1()
+	c2, unsubscribe2 := g.chain.TipChangeNotifications()
+
+	// Accept several blocks and ensure both channels receive the best state
+	// for each of them in order.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	for _, c := range []<-chan *BestState{c1, c2} {
+		for _, name := range []string{"bp", "b1", "b2"} {
+			block := g.BlockByName(name)
+			select {
+			case state := <-c:
+				if state.Hash != block.BlockHash() ||
+					state.Height != int64(block.Header.Height) {
+
+					t.Fatalf("unexpected best state -- got (%v, %d), "+
+						"want (%v, %d)", state.Hash, state.Height,
+						block.BlockHash(), block.Header.Height)
+				}
+			default:
+				t.Fatalf("no best state received for block %q", name)
+			}
+		}
+	}
+
+	// Unsubscribe the second channel and ensure unsubscribing again has no
+	// effect.
+	unsubscribe2()
+	unsubscribe2()
+
+	// Accept enough blocks to overflow the buffer without reading from the
+	// first channel and ensure the oldest states were dropped while the
+	// most recent ones remain.  Also ensure the unsubscribed channel was
+	// not delivered any states.
+	for i := 0; i < tipChangeNtfnBufferSize+2; i++ {
+		g.NextBlock(fmt.Sprintf("bo%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	if len(c2) != 0 {
+		t.Fatalf("unsubscribed channel was delivered %d states", len(c2))
+	}
+	g.chain.tipChangeLock.Lock()
+	numChans := len(g.chain.tipChangeChans)
+	g.chain.tipChangeLock.Unlock()
+	if numChans != 1 {
+		t.Fatalf("unexpected number of subscribed channels -- got %d, "+
+			"want 1", numChans)
+	}
+	if len(c1) != tipChangeNtfnBufferSize {
+		t.Fatalf("unexpected number of buffered states -- got %d, want %d",
+			len(c1), tipChangeNtfnBufferSize)
+	}
+	tipHeight := int64(g.Tip().Header.Height)
+	wantHeight := tipHeight - tipChangeNtfnBufferSize + 1
+	for ; wantHeight <= tipHeight; wantHeight++ {
+		state := <-c1
+		if state.Height != wantHeight {
+			t.Fatalf("unexpected best state height -- got %d, want %d",
+				state.Height, wantHeight)
+		}
+	}
+}
+
+// TestTimeSinceLastBlock ensures the time since the tip last changed grows
+// while no blocks are connected and is reset when the tip changes.
+func TestTimeSinceLastBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "timesincelastblocktest")
+	defer teardownFunc()
+
+	// Accept a block and ensure the duration grows while no other blocks
+	// are connected.
+	//
+	//   genesis -> bp
+	const delay = 50 * time.Millisecond
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	d1 := g.chain.TimeSinceLastBlock()
+	time.Sleep(delay)
+	d2 := g.chain.TimeSinceLastBlock()
+	if d2 < d1+delay {
+		t.Fatalf("duration did not grow while no blocks were connected "+
+			"-- got %v, then %v", d1, d2)
+	}
+
+	// Ensure connecting a block resets the duration.
+	//
+	//   genesis -> bp -> b1
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	if d := g.chain.TimeSinceLastBlock(); d >= d2 {
+		t.Fatalf("duration was not reset by connecting a block -- got %v, "+
+			"previous %v", d, d2)
+	}
+
+	// Ensure disconnecting a block resets the duration.
+	time.Sleep(delay)
+	d3 := g.chain.TimeSinceLastBlock()
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	if d := g.chain.TimeSinceLastBlock(); d >= d3 {
+		t.Fatalf("duration was not reset by disconnecting a block -- got "+
+			"%v, previous %v", d, d3)
+	}
+}
+
+// TestSubscribe ensures callbacks registered via Subscribe are only delivered
+// the notification types they are interested in.
+func TestSubscribe(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "subscribetest")
+	defer teardownFunc()
+
+	// Subscribe to connected blocks only and to all notifications.
+	var connectedOnly, all []NotificationType
+	g.chain.Subscribe(func(n *Notification) {
+		connectedOnly = append(connectedOnly, n.Type)
+	}, NTBlockConnected.Mask())
+	g.chain.Subscribe(func(n *Notification) {
+		all = append(all, n.Type)
+	}, NTMaskAll)
+
+	// Create a side chain that causes a reorganization once it is extended.
+	//
+	//   genesis -> bp -> b1
+	//                \-> b1a -> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure the subscriber to all notifications was delivered the
+	// reorganization while the subscriber to connected blocks was only
+	// delivered connected blocks.
+	var sawReorg bool
+	for _, typ := range all {
+		if typ == NTReorganization {
+			sawReorg = true
+		}
+	}
+	if !sawReorg {
+		t.Fatal("subscriber to all notifications was not delivered the " +
+			"reorganization")
+	}
+	if len(connectedOnly) == 0 {
+		t.Fatal("subscriber to connected blocks was not delivered any " +
+			"notifications")
+	}
+	for _, typ := range connectedOnly {
+		if typ != NTBlockConnected {
+			t.Fatalf("subscriber to connected blocks was delivered %v",
+				typ)
+		}
+	}
+}
+
+// TestDisconnectTip ensures disconnecting the tip of the main chain reverts
+// the chain state to that of its parent and refuses to disconnect the genesis
+// block.
+func TestDisconnectTip(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "disconnecttiptest")
+	defer teardownFunc()
+
+	// Ensure the genesis block can't be disconnected.
+	if err := g.chain.DisconnectTip(); err == nil {
+		t.Fatal("disconnecting the genesis block did not fail")
+	}
+
+	// Accept a couple of blocks and save the best state prior to the final
+	// one.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	wantState := g.chain.BestSnapshot()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+
+	// Disconnect the tip and ensure the best state reverts to the one prior
+	// to connecting it.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	//
+	// Note that the utxo set stats are excluded from the comparison since
+	// the regular transaction tree of the tip is not removed from the utxo
+	// set when it is disconnected, so the utxo set itself does not
+	// round-trip.  TestUtxoSetStats ensures the stats remain consistent with
+	// the utxo set.
+	gotState := *g.chain.BestSnapshot()
+	gotState.NumUtxos = wantState.NumUtxos
+	gotState.UtxoAmount = wantState.UtxoAmount
+	if !reflect.DeepEqual(&gotState, wantState) {
+		t.Fatalf("unexpected best state -- got %+v, want %+v", gotState,
+			wantState)
+	}
+
+	// Ensure the disconnected block can be connected again by extending
+	// it.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+}
+
+// TestTrustedBlocks ensures blocks processed with the BFTrusted flag skip
+// script validation and are marked as valid and trusted in the block index.
+func TestTrustedBlocks(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "trustedblockstest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+
+	// Create a block with a regular transaction that has an invalid
+	// signature script, which would normally be rejected due to failing
+	// script validation, and ensure it is accepted when trusted.
+	//
+	//   ... -> bm# -> b1
+	invalidP2SHRedeemScript := []byte{0x01, 0x00} // OP_DATA_1 OP_FALSE
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b1", &outs[0], nil, func(b *wire.MsgBlock) {
+		b.Transactions[1].TxIn[0].SignatureScript = invalidP2SHRedeemScript
+	})
+	block := dcrutil.NewBlock(g.Tip())
+	forkLen, isOrphan, err := g.chain.ProcessBlock(block, BFTrusted)
+	if err != nil {
+		t.Fatalf("trusted block was not accepted: %v", err)
+	}
+	if isOrphan || forkLen != 0 {
+		t.Fatalf("trusted block was not connected to the main chain -- "+
+			"fork len %d, orphan %v", forkLen, isOrphan)
+	}
+	g.ExpectTip("b1")
+
+	// Ensure the block is marked as both valid and trusted in the index
+	// while the blocks that were fully validated are not marked trusted.
+	node := g.chain.index.LookupNode(block.Hash())
+	status := g.chain.index.NodeStatus(node)
+	if !status.KnownValid() || !status.Trusted() {
+		t.Fatalf("unexpected trusted block status %v", status)
+	}
+	status = g.chain.index.NodeStatus(node.parent)
+	if !status.KnownValid() || status.Trusted() {
+		t.Fatalf("unexpected validated block status %v", status)
+	}
+}
+
+// TestAssumeValid ensures script validation is skipped for the block set via
+// SetAssumeValid and its ancestors, that those blocks are marked trusted, that
+// its descendants are fully validated, and that side chain blocks which are not
+// its ancestors are fully validated even when they are below its height.
+func TestAssumeValid(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "assumevalidtest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	forkName := g.TipName()
+
+	// Create a block that contains a transaction with an invalid signature
+	// script followed by another block, process their headers so they are
+	// known, and assume the latter is valid.  Ensure both blocks are
+	// connected to the main chain, which means script validation was
+	// skipped, and that they are marked trusted.
+	//
+	//   ... -> bm# -> b1 -> b2
+	invalidP2SHRedeemScript := []byte{0x01, 0x00} // OP_DATA_1 OP_FALSE
+	forkOuts := g.OldestCoinbaseOuts()
+	g.NextBlock("b1", &forkOuts[0], nil, func(b *wire.MsgBlock) {
+		b.Transactions[1].TxIn[0].SignatureScript = invalidP2SHRedeemScript
+	})
+	g.NextBlock("b2", nil, nil)
+	headers := []*wire.BlockHeader{&g.BlockByName("b1").Header,
+		&g.Tip().Header}
+	if _, err := g.chain.ProcessBlockHeaders(headers); err != nil {
+		t.Fatalf("failed to process headers: %v", err)
+	}
+	b2Hash := g.Tip().BlockHash()
+	g.chain.SetAssumeValid(&b2Hash)
+	g.AcceptBlock("b1")
+	g.AcceptTipBlock()
+	for _, blockName := range []string{"b1", "b2"} {
+		hash := g.BlockByName(blockName).BlockHash()
+		node := g.chain.index.LookupNode(&hash)
+		status := g.chain.index.NodeStatus(node)
+		if !status.KnownValid() || !status.Trusted() {
+			t.Fatalf("unexpected status for block %q: %v", blockName,
+				status)
+		}
+	}
+
+	// Ensure a descendant of the assumed valid block with a transaction that
+	// has an invalid signature script is rejected.
+	//
+	//   ... -> b2 -> b3bad
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b3bad", &outs[1], nil, func(b *wire.MsgBlock) {
+		b.Transactions[1].TxIn[0].SignatureScript = invalidP2SHRedeemScript
+	})
+	g.RejectTipBlock(ErrScriptValidation)
+
+	// Remove the assumption and ensure a block that builds on the assumed
+	// valid block is fully validated and connected.
+	//
+	//   ... -> b2 -> b3
+	g.chain.SetAssumeValid(nil)
+	g.SetTip("b2")
+	g.NextBlock("b3", &outs[1], nil)
+	g.AcceptTipBlock()
+	hash := g.Tip().BlockHash()
+	status := g.chain.index.NodeStatus(g.chain.index.LookupNode(&hash))
+	if !status.KnownValid() || status.Trusted() {
+		t.Fatalf("unexpected status for block \"b3\": %v", status)
+	}
+
+	// Assume b2 is valid again and create a side chain that forks before
+	// it and contains a block below its height with a transaction that has
+	// an invalid signature script.  Ensure the reorganize to the side chain
+	// fails since the side chain blocks are not ancestors of the assumed
+	// valid block and are therefore fully validated.
+	//
+	//   ... -> bm# -> b1 -> b2 -> b3
+	//             \-> b1sbad -> b2s -> b3s -> b4s
+	g.chain.SetAssumeValid(&b2Hash)
+	g.SetTip(forkName)
+	g.NextBlock("b1sbad", &forkOuts[1], nil, func(b *wire.MsgBlock) {
+		b.Transactions[1].TxIn[0].SignatureScript = invalidP2SHRedeemScript
+	})
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b2s", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b3s", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b4s", nil, nil)
+	g.RejectTipBlock(ErrScriptValidation)
+	g.ExpectTip("b3")
+}
+
+// TestRecentBestStates ensures the history of recent best chain states holds
+// the most recent states in order.
+func TestRecentBestStates(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// and limit the history to a few states.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "recentbeststatestest")
+	defer teardownFunc()
+	const historySize = 3
+	g.chain.bestStateHistory = make([]*BestState, historySize)
+
+	// assertRecentHeights ensures the recent best states have the provided
+	// heights in order and that the final one is the current best state.
+	assertRecentHeights := func(wantHeights ...int64) {
+		t.Helper()
+
+		states := g.chain.RecentBestStates()
+		if len(states) != len(wantHeights) {
+			t.Fatalf("unexpected number of states -- got %d, want %d",
+				len(states), len(wantHeights))
+		}
+		for i, state := range states {
+			if state.Height != wantHeights[i] {
+				t.Fatalf("unexpected height for state %d -- got %d, "+
+					"want %d", i, state.Height, wantHeights[i])
+			}
+		}
+		if states[len(states)-1] != g.chain.BestSnapshot() {
+			t.Fatal("most recent state is not the current best state")
+		}
+	}
+
+	// Ensure the history holds all states before it is full.
+	//
+	//   genesis -> bp -> b1
+	if states := g.chain.RecentBestStates(); len(states) != 0 {
+		t.Fatalf("unexpected states before any tip changes -- got %d",
+			len(states))
+	}
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	assertRecentHeights(1, 2)
+
+	// Ensure only the most recent states are kept once the history wraps.
+	//
+	//   ... -> b1 -> b2 -> b3 -> b4
+	for i := 2; i <= 4; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	assertRecentHeights(3, 4, 5)
+
+	// Ensure disconnecting a block adds the new state.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	assertRecentHeights(4, 5, 4)
+}
+
+// TestOnSpendJournal ensures the spend journal callback is invoked with the
+// same entries that are recorded in the spend journal.
+func TestOnSpendJournal(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "onspendjournaltest")
+	defer teardownFunc()
+
+	// Record the entries reported by the callback.
+	entries := make(map[chainhash.Hash][]SpentTxOut)
+	g.chain.onSpendJournal = func(hash *chainhash.Hash, stxos []SpentTxOut) {
+		entries[*hash] = stxos
+	}
+
+	// Generate enough blocks to have mature coinbase outputs to work with
+	// and then create a couple of blocks that spend them.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm# -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	for i := 1; i <= 3; i++ {
+		outs := g.OldestCoinbaseOuts()
+		g.NextBlock(fmt.Sprintf("b%d", i), &outs[0], nil)
+		g.AcceptTipBlock()
+	}
+
+	// Ensure the callback was invoked for every connected block with the
+	// entries recorded in the spend journal.  Note that the journal
+	// reconstructs the height and index of the containing transaction from
+	// the spending transaction, so they are only compared when the
+	// containing transaction is fully spent.
+	var numSpends int
+	tip := g.chain.bestChain.Tip()
+	for node := tip; node.parent != nil; node = node.parent {
+		got, ok := entries[node.hash]
+		if !ok {
+			t.Fatalf("callback not invoked for block %v", node.hash)
+		}
+
+		block, err := g.chain.fetchMainChainBlockByNode(node)
+		if err != nil {
+			t.Fatalf("failed to fetch block: %v", err)
+		}
+		parent, err := g.chain.fetchMainChainBlockByNode(node.parent)
+		if err != nil {
+			t.Fatalf("failed to fetch parent block: %v", err)
+		}
+		var stxos []spentTxOut
+		err = g.chain.db.View(func(dbTx database.Tx) error {
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block, parent)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to fetch spend journal entry: %v", err)
+		}
+		if len(got) != len(stxos) {
+			t.Fatalf("unexpected number of entries for block %v -- got "+
+				"%d, want %d", node.hash, len(got), len(stxos))
+		}
+		for i := range stxos {
+			want := newSpentTxOut(&stxos[i])
+			if !want.TxFullySpent {
+				want.Height, want.Index = 0, 0
+			}
+			if !reflect.DeepEqual(got[i], want) {
+				t.Fatalf("mismatched entry %d for block %v -- got %+v, "+
+					"want %+v", i, node.hash, got[i], want)
+			}
+		}
+		numSpends += len(got)
+	}
+	if numSpends == 0 {
+		t.Fatal("no spent outputs were reported")
+	}
+}
+
+// locatorHashes is a convenience function that returns the hashes for all of
+// the passed indexes of the provided nodes.  It is used to construct expected
+// block locators in the tests.
+func locatorHashes(nodes []*blockNode, indexes ...int) BlockLocator {
+	hashes := make(BlockLocator, 0, len(indexes))
+	for _, idx := range indexes {
+		hashes = append(hashes, &nodes[idx].hash)
+	}
+	return hashes
+}
+
+// nodeHashes is a convenience function that returns the hashes for all of the
+// passed indexes of the provided nodes.  It is used to construct expected hash
+// slices in the tests.
+func nodeHashes(nodes []*blockNode, indexes ...int) []chainhash.Hash {
+	hashes := make([]chainhash.Hash, 0, len(indexes))
+	for _, idx := range indexes {
+		hashes = append(hashes, nodes[idx].hash)
+	}
+	return hashes
+}
+
+// nodeHeaders is a convenience function that returns the headers for all of
+// the passed indexes of the provided nodes.  It is used to construct expected
+// located headers in the tests.
+func nodeHeaders(nodes []*blockNode, indexes ...int) []wire.BlockHeader {
+	headers := make([]wire.BlockHeader, 0, len(indexes))
+	for _, idx := range indexes {
+		headers = append(headers, nodes[idx].Header())
+	}
+	return headers
+}
+
+// TestLocateInventory ensures that locating inventory via the LocateHeaders and
+// LocateBlocks functions behaves as expected.
+func TestLocateInventory(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	// Create chain views for different branches of the overall chain to
+	// simulate a local and remote node on different parts of the chain.
+	localView := newChainView(tip(branch0Nodes))
+	remoteView := newChainView(tip(branch1Nodes))
+
+	// Create a chain view for a completely unrelated block chain to
+	// simulate a remote node on a totally different chain.
+	unrelatedBranchNodes := chainedFakeNodes(nil, 5)
+	unrelatedView := newChainView(tip(unrelatedBranchNodes))
+
+	tests := []struct {
+		name       string
+		locator    BlockLocator       // locator for requested inventory
+		hashStop   chainhash.Hash     // stop hash for locator
+		maxAllowed uint32             // max to locate, 0 = wire const
+		headers    []wire.BlockHeader // expected located headers
+		hashes     []chainhash.Hash   // expected located hashes
+	}{
+		{
+			// Empty block locators and unknown stop hash.  No
+			// inventory should be located.
+			name:     "no locators, no stop",
+			locator:  nil,
+			hashStop: chainhash.Hash{},
+			headers:  nil,
+			hashes:   nil,
+		},
+		{
+			// Empty block locators and stop hash in side chain.
+			// The expected result is the requested block.
+			name:     "no locators, stop in side",
+			locator:  nil,
+			hashStop: tip(branch1Nodes).hash,
+			headers:  nodeHeaders(branch1Nodes, 1),
+			hashes:   nodeHashes(branch1Nodes, 1),
+		},
+		{
+			// Empty block locators and stop hash in main chain.
+			// The expected result is the requested block.
+			name:     "no locators, stop in main",
+			locator:  nil,
+			hashStop: branch0Nodes[12].hash,
+			headers:  nodeHeaders(branch0Nodes, 12),
+			hashes:   nodeHashes(branch0Nodes, 12),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash local node doesn't know about.  The
+			// expected result is the blocks after the fork point in
+			// the main chain and the stop hash has no effect.
+			name:     "remote side chain, unknown stop",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: chainhash.Hash{0x01},
+			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash in side chain.  The expected result is the
+			// blocks after the fork point in the main chain and the
+			// stop hash has no effect.
+			name:     "remote side chain, stop in side",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: tip(branch1Nodes).hash,
+			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash in main chain, but before fork point.  The
+			// expected result is the blocks after the fork point in
+			// the main chain and the stop hash has no effect.
+			name:     "remote side chain, stop in main before",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: branch0Nodes[13].hash,
+			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash in main chain, but exactly at the fork
+			// point.  The expected result is the blocks after the
+			// fork point in the main chain and the stop hash has no
+			// effect.
+			name:     "remote side chain, stop in main exact",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: branch0Nodes[14].hash,
+			headers:  nodeHeaders(branch0Nodes, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash in main chain just after the fork point.
+			// The expected result is the blocks after the fork
+			// point in the main chain up to and including the stop
+			// hash.
+			name:     "remote side chain, stop in main after",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: branch0Nodes[15].hash,
+			headers:  nodeHeaders(branch0Nodes, 15),
+			hashes:   nodeHashes(branch0Nodes, 15),
+		},
+		{
+			// Locators based on remote being on side chain and a
+			// stop hash in main chain some time after the fork
+			// point.  The expected result is the blocks after the
+			// fork point in the main chain up to and including the
+			// stop hash.
+			name:     "remote side chain, stop in main after more",
+			locator:  remoteView.BlockLocator(nil),
+			hashStop: branch0Nodes[16].hash,
+			headers:  nodeHeaders(branch0Nodes, 15, 16),
+			hashes:   nodeHashes(branch0Nodes, 15, 16),
+		},
+		{
+			// Locators based on remote being on main chain in the
+			// past and a stop hash local node doesn't know about.
+			// The expected result is the blocks after the known
+			// point in the main chain and the stop hash has no
+			// effect.
+			name:     "remote main chain past, unknown stop",
+			locator:  localView.BlockLocator(branch0Nodes[12]),
+			hashStop: chainhash.Hash{0x01},
+			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on main chain in the
+			// past and a stop hash in a side chain.  The expected
+			// result is the blocks after the known point in the
+			// main chain and the stop hash has no effect.
+			name:     "remote main chain past, stop in side",
+			locator:  localView.BlockLocator(branch0Nodes[12]),
+			hashStop: tip(branch1Nodes).hash,
+			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on main chain in the
+			// past and a stop hash in the main chain before that
+			// point.  The expected result is the blocks after the
+			// known point in the main chain and the stop hash has
+			// no effect.
+			name:     "remote main chain past, stop in main before",
+			locator:  localView.BlockLocator(branch0Nodes[12]),
+			hashStop: branch0Nodes[11].hash,
+			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
+			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
+		},
+		{
+			// Locators based on remote being on main chain in the
+			// past and a stop hash in the main chain exactly at that
+			// point.  The expected result is the blocks after the
+			// known point in the main chain and the stop hash has
+			// no effect.
+			name:     "remote main chain past, stop in main exact",
+			locator:  localView.BlockLocator(branch0Nodes[12]),
 			hashStop: branch0Nodes[12].hash,
 			headers:  nodeHeaders(branch0Nodes, 13, 14, 15, 16, 17),
 			hashes:   nodeHashes(branch0Nodes, 13, 14, 15, 16, 17),
@@ -944,55 +1916,4995 @@ func TestLocateInventory(t *testing.T) {
 			hashes: nodeHashes(branch0Nodes, 0, 1, 2, 3, 4, 5, 6,
 				7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17),
 		},
-		{
-			// Poorly formed locator.
-			//
-			// Locator from remote that only includes multiple
-			// blocks on a side chain the local node knows however
-			// none in the main chain but includes a stop hash in
-			// the main chain.  The expected result is the blocks
-			// after the genesis block up to the stop hash since
-			// even though the blocks are known, they are all on a
-			// side chain and there are no more locators to find the
-			// fork point.
-			name:     "weak locator, multiple known side blocks, stop in main",
-			locator:  locatorHashes(branch1Nodes, 1),
-			hashStop: branch0Nodes[5].hash,
-			headers:  nodeHeaders(branch0Nodes, 0, 1, 2, 3, 4, 5),
-			hashes:   nodeHashes(branch0Nodes, 0, 1, 2, 3, 4, 5),
+		{
+			// Poorly formed locator.
+			//
+			// Locator from remote that only includes multiple
+			// blocks on a side chain the local node knows however
+			// none in the main chain but includes a stop hash in
+			// the main chain.  The expected result is the blocks
+			// after the genesis block up to the stop hash since
+			// even though the blocks are known, they are all on a
+			// side chain and there are no more locators to find the
+			// fork point.
+			name:     "weak locator, multiple known side blocks, stop in main",
+			locator:  locatorHashes(branch1Nodes, 1),
+			hashStop: branch0Nodes[5].hash,
+			headers:  nodeHeaders(branch0Nodes, 0, 1, 2, 3, 4, 5),
+			hashes:   nodeHashes(branch0Nodes, 0, 1, 2, 3, 4, 5),
+		},
+	}
+	for _, test := range tests {
+		// Ensure the expected headers are located.
+		var headers []wire.BlockHeader
+		if test.maxAllowed != 0 {
+			// Need to use the unexported function to override the
+			// max allowed for headers.
+			chain.chainLock.RLock()
+			headers = chain.locateHeaders(test.locator,
+				&test.hashStop, test.maxAllowed)
+			chain.chainLock.RUnlock()
+		} else {
+			headers = chain.LocateHeaders(test.locator,
+				&test.hashStop)
+		}
+		if !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf("%s: unxpected headers -- got %v, want %v",
+				test.name, headers, test.headers)
+			continue
+		}
+
+		// Ensure the expected block hashes are located.
+		maxAllowed := uint32(wire.MaxBlocksPerMsg)
+		if test.maxAllowed != 0 {
+			maxAllowed = test.maxAllowed
+		}
+		hashes := chain.LocateBlocks(test.locator, &test.hashStop,
+			maxAllowed)
+		if !reflect.DeepEqual(hashes, test.hashes) {
+			t.Errorf("%s: unxpected hashes -- got %v, want %v",
+				test.name, hashes, test.hashes)
+			continue
+		}
+	}
+}
+
+// TestFindCommonAncestor ensures finding the common ancestor of arbitrary
+// pairs of blocks in the block index works as expected.
+func TestFindCommonAncestor(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a -> 18a
+	// 	                                    \-> 17b
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 3)
+	branch2Nodes := chainedFakeNodes(branch1Nodes[0], 1)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch2Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	// Create a block that is not part of the block index as well as an
+	// unrelated chain that is added to it.
+	unknownNode := newFakeNode(nil, 0, 0, 0, time.Now())
+	unrelatedBranchNodes := chainedFakeNodes(nil, 2)
+	for _, node := range unrelatedBranchNodes {
+		chain.index.AddNode(node)
+	}
+
+	tests := []struct {
+		name       string
+		hash1      chainhash.Hash // first block
+		hash2      chainhash.Hash // second block
+		wantErr    bool           // whether an error is expected
+		wantHash   chainhash.Hash // expected common ancestor hash
+		wantHeight int64          // expected common ancestor height
+	}{{
+		name:       "two side chain tips",
+		hash1:      tip(branch1Nodes).hash,
+		hash2:      tip(branch2Nodes).hash,
+		wantHash:   branch1Nodes[0].hash,
+		wantHeight: 16,
+	}, {
+		name:       "side chain tip and main chain tip",
+		hash1:      tip(branch1Nodes).hash,
+		hash2:      tip(branch0Nodes).hash,
+		wantHash:   branch0Nodes[14].hash,
+		wantHeight: 15,
+	}, {
+		name:       "main chain tip and side chain tip",
+		hash1:      tip(branch0Nodes).hash,
+		hash2:      tip(branch2Nodes).hash,
+		wantHash:   branch0Nodes[14].hash,
+		wantHeight: 15,
+	}, {
+		name:       "ancestor of the other block",
+		hash1:      branch0Nodes[4].hash,
+		hash2:      tip(branch1Nodes).hash,
+		wantHash:   branch0Nodes[4].hash,
+		wantHeight: 5,
+	}, {
+		name:       "same block",
+		hash1:      tip(branch1Nodes).hash,
+		hash2:      tip(branch1Nodes).hash,
+		wantHash:   tip(branch1Nodes).hash,
+		wantHeight: 18,
+	}, {
+		name:    "first block unknown",
+		hash1:   unknownNode.hash,
+		hash2:   tip(branch0Nodes).hash,
+		wantErr: true,
+	}, {
+		name:    "second block unknown",
+		hash1:   tip(branch0Nodes).hash,
+		hash2:   unknownNode.hash,
+		wantErr: true,
+	}, {
+		name:    "no common ancestor",
+		hash1:   tip(unrelatedBranchNodes).hash,
+		hash2:   tip(branch1Nodes).hash,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		hash, height, err := chain.FindCommonAncestor(&test.hash1,
+			&test.hash2)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if *hash != test.wantHash || height != test.wantHeight {
+			t.Errorf("%s: unexpected common ancestor -- got (%v, %d), "+
+				"want (%v, %d)", test.name, hash, height,
+				test.wantHash, test.wantHeight)
+		}
+	}
+}
+
+// TestWorkBetween ensures calculating the cumulative work between an ancestor
+// and descendant block works as expected, including the error cases when the
+// ancestor relationship does not hold.
+func TestWorkBetween(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+	unknownNode := newFakeNode(nil, 0, 0, 0, time.Now())
+
+	// workOf returns the sum of the work of the provided nodes.
+	workOf := func(nodes ...*blockNode) *big.Int {
+		work := new(big.Int)
+		for _, node := range nodes {
+			work.Add(work, CalcWork(node.bits))
+		}
+		return work
+	}
+
+	tests := []struct {
+		name       string
+		ancestor   chainhash.Hash // ancestor block
+		descendant chainhash.Hash // descendant block
+		wantErr    bool           // whether an error is expected
+		wantWork   *big.Int       // expected work
+	}{{
+		name:       "main chain segment",
+		ancestor:   branch0Nodes[4].hash,
+		descendant: branch0Nodes[9].hash,
+		wantWork:   workOf(branch0Nodes[5:10]...),
+	}, {
+		name:       "genesis to side chain tip",
+		ancestor:   chain.bestChain.Genesis().hash,
+		descendant: tip(branch1Nodes).hash,
+		wantWork: workOf(append(branch0Nodes[:15:15],
+			branch1Nodes...)...),
+	}, {
+		name:       "same block",
+		ancestor:   branch0Nodes[9].hash,
+		descendant: branch0Nodes[9].hash,
+		wantWork:   new(big.Int),
+	}, {
+		name:       "reversed order",
+		ancestor:   branch0Nodes[9].hash,
+		descendant: branch0Nodes[4].hash,
+		wantErr:    true,
+	}, {
+		name:       "side chain block is not an ancestor",
+		ancestor:   branch1Nodes[0].hash,
+		descendant: tip(branch0Nodes).hash,
+		wantErr:    true,
+	}, {
+		name:       "ancestor unknown",
+		ancestor:   unknownNode.hash,
+		descendant: tip(branch0Nodes).hash,
+		wantErr:    true,
+	}, {
+		name:       "descendant unknown",
+		ancestor:   branch0Nodes[4].hash,
+		descendant: unknownNode.hash,
+		wantErr:    true,
+	}}
+
+	for _, test := range tests {
+		work, err := chain.WorkBetween(&test.ancestor, &test.descendant)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if work.Cmp(test.wantWork) != 0 {
+			t.Errorf("%s: unexpected work -- got %v, want %v", test.name,
+				work, test.wantWork)
+			continue
+		}
+
+		// Ensure modifying the returned value does not affect the work
+		// sums tracked by the block index.
+		descendant := chain.index.LookupNode(&test.descendant)
+		wantWorkSum := new(big.Int).Set(descendant.workSum)
+		work.Add(work, big.NewInt(1))
+		if descendant.workSum.Cmp(wantWorkSum) != 0 {
+			t.Errorf("%s: modifying result changed the block index",
+				test.name)
+		}
+	}
+}
+
+// TestBestValidatedTip ensures the most recent fully validated block in the
+// main chain is tracked correctly as blocks that were fully validated and
+// blocks that were only trusted to be valid are connected and disconnected.
+func TestBestValidatedTip(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "bestvalidatedtiptest")
+	defer teardownFunc()
+
+	// expectBestValidated ensures the best validated tip is the block
+	// associated with the provided name.
+	expectBestValidated := func(blockName string) {
+		t.Helper()
+
+		msgBlock := g.BlockByName(blockName)
+		wantHash := msgBlock.BlockHash()
+		wantHeight := int64(msgBlock.Header.Height)
+		hash, height := g.chain.BestValidatedTip()
+		if *hash != wantHash || height != wantHeight {
+			t.Fatalf("unexpected best validated tip -- got (%v, %d), "+
+				"want %q (%v, %d)", hash, height, blockName, wantHash,
+				wantHeight)
+		}
+	}
+
+	// fastAddTipBlock processes the current tip block with the fast add
+	// flag and ensures it is connected to the main chain.
+	fastAddTipBlock := func() {
+		t.Helper()
+
+		block := dcrutil.NewBlock(g.Tip())
+		_, _, err := g.chain.ProcessBlock(block, BFFastAdd)
+		if err != nil {
+			t.Fatalf("block %q was not accepted: %v", g.TipName(), err)
+		}
+		g.ExpectTip(g.TipName())
+	}
+
+	// Ensure blocks that are fully validated become the best validated tip.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	expectBestValidated("b1")
+
+	// Ensure neither fast added blocks nor blocks with scripts that are
+	// assumed valid become the best validated tip.
+	//
+	//   ... -> b1 -> b2 -> b3 -> b4
+	g.NextBlock("b2", nil, nil)
+	fastAddTipBlock()
+	g.NextBlock("b3", nil, nil)
+	fastAddTipBlock()
+	g.NextBlock("b4", nil, nil)
+	b4Hash := g.Tip().BlockHash()
+	g.chain.SetAssumeValid(&b4Hash)
+	g.AcceptTipBlock()
+	g.chain.SetAssumeValid(nil)
+	expectBestValidated("b1")
+
+	// Ensure a fully validated block after the trusted blocks becomes the
+	// best validated tip.
+	//
+	//   ... -> b4 -> b5
+	g.NextBlock("b5", nil, nil)
+	g.AcceptTipBlock()
+	expectBestValidated("b5")
+
+	// Ensure disconnecting the fully validated tip moves the best validated
+	// tip back past the trusted blocks.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("unexpected error disconnecting tip: %v", err)
+	}
+	expectBestValidated("b1")
+}
+
+// TestWorkToOvertake ensures the additional work a side chain requires in order
+// to cause a reorganize is calculated correctly for losing and winning side
+// chains.
+func TestWorkToOvertake(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure where every block has the same work.  Note
+	// that the winning side chain has more work than the main chain since
+	// the tip is set manually.
+	// 	genesis -> 1 -> 2  -> 3  -> 4  -> 5
+	// 	                \-> 3a
+	// 	                \-> 3b -> 4b -> 5b -> 6b
+	params := &chaincfg.MainNetParams
+	chain := newFakeChain(params)
+	chainNodes := func(parent *blockNode, numNodes int) []*blockNode {
+		nodes := make([]*blockNode, 0, numNodes)
+		for i := 0; i < numNodes; i++ {
+			blockTime := time.Unix(parent.timestamp, 0).Add(time.Second)
+			node := newFakeNode(parent, 1, 1, params.PowLimitBits, blockTime)
+			chain.index.AddNode(node)
+			nodes = append(nodes, node)
+			parent = node
+		}
+		return nodes
+	}
+	mainNodes := chainNodes(chain.bestChain.Genesis(), 5)
+	losingNodes := chainNodes(mainNodes[1], 1)
+	winningNodes := chainNodes(mainNodes[1], 4)
+	chain.bestChain.SetTip(branchTip(mainNodes))
+	unknownNode := newFakeNode(nil, 0, 0, 0, time.Now())
+	blockWork := CalcWork(params.PowLimitBits)
+	workOf := func(numBlocks int64) *big.Int {
+		return new(big.Int).Mul(blockWork, big.NewInt(numBlocks))
+	}
+
+	tests := []struct {
+		name       string
+		sideTip    chainhash.Hash // side chain tip to check
+		stickiness *big.Int       // reorganize stickiness work
+		wantErr    bool           // whether an error is expected
+		wantWork   *big.Int       // expected work
+	}{{
+		name:     "losing side chain",
+		sideTip:  branchTip(losingNodes).hash,
+		wantWork: new(big.Int).Add(workOf(2), bigOne),
+	}, {
+		name:       "losing side chain with stickiness",
+		sideTip:    branchTip(losingNodes).hash,
+		stickiness: blockWork,
+		wantWork:   new(big.Int).Add(workOf(3), bigOne),
+	}, {
+		name:     "winning side chain",
+		sideTip:  branchTip(winningNodes).hash,
+		wantWork: new(big.Int),
+	}, {
+		name:       "winning side chain with insufficient stickiness",
+		sideTip:    branchTip(winningNodes).hash,
+		stickiness: blockWork,
+		wantWork:   bigOne,
+	}, {
+		name:    "main chain block",
+		sideTip: mainNodes[2].hash,
+		wantErr: true,
+	}, {
+		name:    "unknown block",
+		sideTip: unknownNode.hash,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		chain.reorgStickinessWork = test.stickiness
+		work, err := chain.WorkToOvertake(&test.sideTip)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if work.Cmp(test.wantWork) != 0 {
+			t.Errorf("%s: unexpected work -- got %v, want %v", test.name,
+				work, test.wantWork)
+		}
+	}
+}
+
+// TestIsMainChainAt ensures checking whether a block is at a given height in
+// the main chain works as expected.
+func TestIsMainChainAt(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	tests := []struct {
+		name   string
+		height int64          // height to check
+		hash   chainhash.Hash // hash to check
+		want   bool           // expected result
+	}{{
+		name:   "genesis",
+		height: 0,
+		hash:   chain.bestChain.Genesis().hash,
+		want:   true,
+	}, {
+		name:   "matching main chain block",
+		height: 16,
+		hash:   branch0Nodes[15].hash,
+		want:   true,
+	}, {
+		name:   "main chain block at wrong height",
+		height: 15,
+		hash:   branch0Nodes[15].hash,
+		want:   false,
+	}, {
+		name:   "side chain block at its height",
+		height: 16,
+		hash:   branch1Nodes[0].hash,
+		want:   false,
+	}, {
+		name:   "height after tip",
+		height: 19,
+		hash:   tip(branch0Nodes).hash,
+		want:   false,
+	}, {
+		name:   "negative height",
+		height: -1,
+		hash:   chain.bestChain.Genesis().hash,
+		want:   false,
+	}}
+
+	for _, test := range tests {
+		got := chain.IsMainChainAt(test.height, &test.hash)
+		if got != test.want {
+			t.Errorf("%s: unexpected result -- got %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+}
+
+// TestForEachBlockHashInRange ensures iterating the main chain hashes within a
+// range of heights via a callback works as expected, including propagating
+// errors returned by the callback.
+func TestForEachBlockHashInRange(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	tests := []struct {
+		name        string
+		start       int64            // start height of the range
+		end         int64            // end height of the range
+		wantErr     bool             // whether an error is expected
+		wantHeights []int64          // expected heights
+		wantHashes  []chainhash.Hash // expected hashes
+	}{{
+		name:        "range in main chain",
+		start:       14,
+		end:         17,
+		wantHeights: []int64{14, 15, 16},
+		wantHashes:  nodeHashes(branch0Nodes, 13, 14, 15),
+	}, {
+		name:        "end clamped to tip",
+		start:       17,
+		end:         25,
+		wantHeights: []int64{17, 18},
+		wantHashes:  nodeHashes(branch0Nodes, 16, 17),
+	}, {
+		name:  "empty range",
+		start: 5,
+		end:   5,
+	}, {
+		name:  "start after tip",
+		start: 19,
+		end:   25,
+	}, {
+		name:    "negative start",
+		start:   -1,
+		end:     5,
+		wantErr: true,
+	}, {
+		name:    "end before start",
+		start:   5,
+		end:     4,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		var heights []int64
+		var hashes []chainhash.Hash
+		err := chain.ForEachBlockHashInRange(test.start, test.end,
+			func(height int64, hash chainhash.Hash) error {
+				heights = append(heights, height)
+				hashes = append(hashes, hash)
+				return nil
+			})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(heights, test.wantHeights) {
+			t.Errorf("%s: unexpected heights -- got %v, want %v",
+				test.name, heights, test.wantHeights)
+			continue
+		}
+		if !reflect.DeepEqual(hashes, test.wantHashes) {
+			t.Errorf("%s: unexpected hashes -- got %v, want %v",
+				test.name, hashes, test.wantHashes)
+			continue
+		}
+
+		// Ensure the results match those of HeightRange.
+		rangeHashes, err := chain.HeightRange(test.start, test.end)
+		if err != nil {
+			t.Errorf("%s: unexpected error from HeightRange: %v",
+				test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rangeHashes, hashes) {
+			t.Errorf("%s: mismatched HeightRange results -- got %v, "+
+				"want %v", test.name, rangeHashes, hashes)
+			continue
+		}
+	}
+
+	// Ensure an error returned by the callback stops the iteration and is
+	// returned to the caller.
+	errStop := errors.New("stop")
+	var numCalls int
+	err := chain.ForEachBlockHashInRange(1, 10,
+		func(height int64, hash chainhash.Hash) error {
+			numCalls++
+			if height == 3 {
+				return errStop
+			}
+			return nil
+		})
+	if err != errStop {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errStop)
+	}
+	if numCalls != 3 {
+		t.Fatalf("unexpected number of callbacks -- got %d, want 3",
+			numCalls)
+	}
+}
+
+// TestBlockHashRange ensures fetching a range of main chain block hashes paired
+// with their heights works as expected.
+func TestBlockHashRange(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	// hashHeights is a convenience function that returns the expected
+	// hash and height pairs for the passed indexes of the main chain nodes.
+	hashHeights := func(indexes ...int) []BlockHashHeight {
+		results := make([]BlockHashHeight, 0, len(indexes))
+		for _, idx := range indexes {
+			node := branch0Nodes[idx]
+			results = append(results, BlockHashHeight{node.hash,
+				node.height})
+		}
+		return results
+	}
+
+	tests := []struct {
+		name    string
+		start   int64             // start height of the range
+		end     int64             // end height of the range
+		wantErr bool              // whether an error is expected
+		want    []BlockHashHeight // expected results
+	}{{
+		name:  "range spanning fork point",
+		start: 14,
+		end:   17,
+		want:  hashHeights(13, 14, 15),
+	}, {
+		name:  "end is exclusive",
+		start: 16,
+		end:   17,
+		want:  hashHeights(15),
+	}, {
+		name:  "end clamped to tip",
+		start: 17,
+		end:   25,
+		want:  hashHeights(16, 17),
+	}, {
+		name:  "empty range",
+		start: 5,
+		end:   5,
+		want:  nil,
+	}, {
+		name:  "start after tip",
+		start: 19,
+		end:   25,
+		want:  nil,
+	}, {
+		name:    "negative start",
+		start:   -1,
+		end:     5,
+		wantErr: true,
+	}, {
+		name:    "end before start",
+		start:   5,
+		end:     4,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		results, err := chain.BlockHashRange(test.start, test.end)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(results, test.want) {
+			t.Errorf("%s: unexpected results -- got %v, want %v",
+				test.name, results, test.want)
+		}
+	}
+}
+
+// TestStakeVersionsInRange ensures fetching the stake versions for a range of
+// main chain heights works as expected and is consistent with the results of
+// GetStakeVersions.
+func TestStakeVersionsInRange(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> ... -> 15 -> 16  -> 17  -> 18
+	// 	                              \-> 16a -> 17a
+	tip := branchTip
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[14], 2)
+	for i, node := range branch0Nodes {
+		appendFakeVotes(node, uint16(i%5), uint32(i), 0x01)
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(tip(branch0Nodes))
+
+	tests := []struct {
+		name       string
+		start      int64 // start height of the range
+		end        int64 // end height of the range
+		wantErr    bool  // whether an error is expected
+		wantHeight int64 // expected height of the final result
+		wantCount  int   // expected number of results
+	}{{
+		name:       "range spanning fork point",
+		start:      10,
+		end:        17,
+		wantHeight: 16,
+		wantCount:  7,
+	}, {
+		name:       "from genesis",
+		start:      0,
+		end:        5,
+		wantHeight: 4,
+		wantCount:  5,
+	}, {
+		name:       "end clamped to tip",
+		start:      15,
+		end:        25,
+		wantHeight: 18,
+		wantCount:  4,
+	}, {
+		name:      "empty range",
+		start:     5,
+		end:       5,
+		wantCount: 0,
+	}, {
+		name:    "negative start",
+		start:   -1,
+		end:     5,
+		wantErr: true,
+	}, {
+		name:    "end before start",
+		start:   5,
+		end:     4,
+		wantErr: true,
+	}}
+
+	for _, test := range tests {
+		results, err := chain.StakeVersionsInRange(test.start, test.end)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if len(results) != test.wantCount {
+			t.Errorf("%s: unexpected number of results -- got %d, want %d",
+				test.name, len(results), test.wantCount)
+			continue
+		}
+		if test.wantCount == 0 {
+			continue
+		}
+
+		// Ensure the results match those returned by GetStakeVersions
+		// when starting from the final block and walking backwards.
+		endNode := chain.bestChain.NodeByHeight(test.wantHeight)
+		backward, err := chain.GetStakeVersions(&endNode.hash,
+			int32(test.wantCount))
+		if err != nil {
+			t.Errorf("%s: unexpected error from GetStakeVersions: %v",
+				test.name, err)
+			continue
+		}
+		for i := range results {
+			want := backward[len(backward)-i-1]
+			if !reflect.DeepEqual(results[i], want) {
+				t.Errorf("%s: mismatched result at index %d -- got %+v, "+
+					"want %+v", test.name, i, results[i], want)
+				break
+			}
+		}
+	}
+}
+
+// TestUtxoSetStats ensures the utxo set stats are kept consistent with the
+// utxo set as blocks are connected, disconnected, and reorganized.
+func TestUtxoSetStats(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "utxosetstatstest")
+	defer teardownFunc()
+
+	// checkStats ensures the utxo set stats reported by the chain match the
+	// ones calculated by scanning the entire utxo set and returns them.
+	type utxoStats struct {
+		count  int64
+		amount int64
+	}
+	checkStats := func() utxoStats {
+		t.Helper()
+
+		var want utxoStats
+		err := g.chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			want.count, want.amount, err = dbCalcUtxoSetStats(dbTx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to calculate utxo set stats: %v", err)
+		}
+		var got utxoStats
+		got.count, got.amount = g.chain.UtxoSetStats()
+		if got != want {
+			t.Fatalf("unexpected utxo set stats at %s -- got %+v, "+
+				"want %+v", g.TipName(), got, want)
+		}
+		return got
+	}
+	checkStats()
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	checkStats()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	if stats := checkStats(); stats.count == 0 || stats.amount == 0 {
+		t.Fatalf("unexpected empty utxo set stats %+v", stats)
+	}
+
+	// Create blocks that spend outputs and ensure the stats are updated.
+	//
+	//   ... -> bm# -> b1 -> b2
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b1", &outs[0], nil)
+	g.AcceptTipBlock()
+	checkStats()
+	outs = g.OldestCoinbaseOuts()
+	g.NextBlock("b2", &outs[0], nil)
+	g.AcceptTipBlock()
+	checkStats()
+
+	// Create a side chain that causes a reorganize and ensure the stats are
+	// updated accordingly.
+	//
+	//   ... -> bm# -> b1 -> b2
+	//                   \-> b2a -> b3a
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+	checkStats()
+
+	// Disconnect blocks back to the base and ensure the stats remain
+	// consistent with the utxo set.
+	for i := 0; i < 3; i++ {
+		if err := g.chain.DisconnectTip(); err != nil {
+			t.Fatalf("failed to disconnect tip: %v", err)
+		}
+		checkStats()
+	}
+
+	// Create a block that spends an output and is fast added followed by a
+	// block that is fully validated and ensure the stats are updated.
+	//
+	//   ... -> bm# -> b1f -> b2f
+	g.SetTip(fmt.Sprintf("bm%d", params.CoinbaseMaturity-1))
+	g.NextBlock("b1f", &outs[1], nil)
+	_, _, err := g.chain.ProcessBlock(dcrutil.NewBlock(g.Tip()), BFFastAdd)
+	if err != nil {
+		t.Fatalf("failed to process fast added block: %v", err)
+	}
+	g.ExpectTip("b1f")
+	checkStats()
+	g.NextBlock("b2f", nil, nil)
+	g.AcceptTipBlock()
+	checkStats()
+}
+
+// TestForEachUtxo ensures iterating the utxo set visits every unspent output
+// such that the results agree with the utxo set stats.
+func TestForEachUtxo(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "foreachutxotest")
+	defer teardownFunc()
+
+	// Generate a few blocks so there are unspent outputs in the utxo set.
+	//
+	//   genesis -> bp -> b0 -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 0; i < 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+
+	// Sum the amounts of all unspent outputs via the iterator and ensure
+	// they match the utxo set stats.
+	var count, amount int64
+	err := g.chain.ForEachUtxo(func(op wire.OutPoint, entry *UtxoEntry) error {
+		if entry.IsOutputSpent(op.Index) {
+			t.Fatalf("iterator visited spent output %v", op)
+		}
+		count++
+		amount += entry.AmountByIndex(op.Index)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error iterating utxo set: %v", err)
+	}
+	wantCount, wantAmount := g.chain.UtxoSetStats()
+	if count != wantCount || amount != wantAmount {
+		t.Fatalf("unexpected utxo set totals -- got count %d, amount %d, "+
+			"want count %d, amount %d", count, amount, wantCount,
+			wantAmount)
+	}
+
+	// Ensure iteration stops and returns the error from the callback.
+	errStop := errors.New("stop")
+	var visited int
+	err = g.chain.ForEachUtxo(func(op wire.OutPoint, entry *UtxoEntry) error {
+		visited++
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errStop)
+	}
+	if visited != 1 {
+		t.Fatalf("unexpected number of visited outputs -- got %d, want 1",
+			visited)
+	}
+}
+
+// TestUtxoViewAtHeight ensures the utxo view reconstructed for the block prior
+// to the current tip matches the utxo set as it was before the tip was
+// connected.
+func TestUtxoViewAtHeight(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "utxoviewatheighttest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with
+	// followed by a block that spends one of them.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm# -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b1", &outs[0], nil)
+	g.AcceptTipBlock()
+
+	// Create the next block, which connects the regular transactions of b1,
+	// and determine all of the transactions it creates and spends.
+	//
+	//   ... -> b1 -> b2
+	g.NextBlock("b2", nil, nil)
+	txHashes := make(map[chainhash.Hash]struct{})
+	addTxns := func(txns []*wire.MsgTx) {
+		for _, tx := range txns {
+			txHashes[tx.TxHash()] = struct{}{}
+			for _, txIn := range tx.TxIn {
+				txHashes[txIn.PreviousOutPoint.Hash] = struct{}{}
+			}
+		}
+	}
+	addTxns(g.BlockByName("b1").Transactions)
+	addTxns(g.Tip().Transactions)
+	addTxns(g.Tip().STransactions)
+
+	// Record the utxo entries for the transactions prior to connecting the
+	// block.
+	wantEntries := make(map[chainhash.Hash]*UtxoEntry, len(txHashes))
+	for txHash := range txHashes {
+		entry, err := g.chain.FetchUtxoEntry(&txHash)
+		if err != nil {
+			t.Fatalf("failed to fetch utxo entry for %s: %v", txHash, err)
+		}
+		wantEntries[txHash] = entry
+	}
+	g.AcceptTipBlock()
+
+	// sameEntry returns whether the provided entries represent the same
+	// unspent outputs.
+	sameEntry := func(a, b *UtxoEntry) bool {
+		aSpent := a == nil || a.IsFullySpent()
+		bSpent := b == nil || b.IsFullySpent()
+		if aSpent || bSpent {
+			return aSpent == bSpent
+		}
+		indexes := make(map[uint32]struct{})
+		for idx := range a.sparseOutputs {
+			indexes[idx] = struct{}{}
+		}
+		for idx := range b.sparseOutputs {
+			indexes[idx] = struct{}{}
+		}
+		for idx := range indexes {
+			if a.IsOutputSpent(idx) != b.IsOutputSpent(idx) {
+				return false
+			}
+			if a.IsOutputSpent(idx) {
+				continue
+			}
+			if a.AmountByIndex(idx) != b.AmountByIndex(idx) ||
+				!bytes.Equal(a.PkScriptByIndex(idx), b.PkScriptByIndex(idx)) {
+
+				return false
+			}
+		}
+		return true
+	}
+
+	// Reconstruct the view as of b1 and ensure it matches the entries prior
+	// to connecting b2.
+	b1Height := int64(g.BlockByName("b1").Header.Height)
+	view, err := g.chain.UtxoViewAtHeight(b1Height)
+	if err != nil {
+		t.Fatalf("failed to reconstruct utxo view: %v", err)
+	}
+	if *view.BestHash() != g.BlockByName("b1").BlockHash() {
+		t.Fatalf("unexpected view best hash -- got %v, want %v",
+			view.BestHash(), g.BlockByName("b1").BlockHash())
+	}
+	for txHash, wantEntry := range wantEntries {
+		entry := view.LookupEntry(&txHash)
+		if _, ok := view.Entries()[txHash]; !ok {
+			// Transactions that were not modified by b2 are the same
+			// as in the current utxo set.
+			entry, err = g.chain.FetchUtxoEntry(&txHash)
+			if err != nil {
+				t.Fatalf("failed to fetch utxo entry for %s: %v",
+					txHash, err)
+			}
+		}
+		if !sameEntry(entry, wantEntry) {
+			t.Fatalf("unexpected utxo entry for %s -- got %+v, want %+v",
+				txHash, entry, wantEntry)
+		}
+	}
+
+	// Ensure the output spent by b1 is unspent in the view while it remains
+	// spent in the current utxo set, which means it was not modified.
+	spentOut := outs[0].PrevOut()
+	if view.LookupEntry(&spentOut.Hash).IsOutputSpent(spentOut.Index) {
+		t.Fatalf("output %v spent by b1 is spent in the view", spentOut)
+	}
+	entry, err := g.chain.FetchUtxoEntry(&spentOut.Hash)
+	if err != nil {
+		t.Fatalf("failed to fetch utxo entry for %s: %v", spentOut.Hash,
+			err)
+	}
+	if entry != nil && !entry.IsOutputSpent(spentOut.Index) {
+		t.Fatalf("output %v spent by b1 is unspent in the utxo set",
+			spentOut)
+	}
+
+	// Ensure requesting a height after the tip fails.
+	g.ExpectTip("b2")
+	tipHeight := g.chain.BestSnapshot().Height
+	if _, err := g.chain.UtxoViewAtHeight(tipHeight + 1); err == nil {
+		t.Fatal("did not receive expected error for height after tip")
+	}
+}
+
+// TestBlockLocation ensures BlockLocation reports the expected location for
+// blocks in the main chain, on a side chain, in the orphan pool, and blocks
+// that are not known at all.
+func TestBlockLocation(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "blocklocationtest")
+	defer teardownFunc()
+
+	// Create a main chain block, an orphan that builds on an unprocessed
+	// block, and a side chain block.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                \-> b1a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.NextBlock("b3", nil, nil)
+	_, isOrphan, err := g.chain.ProcessBlock(dcrutil.NewBlock(g.Tip()), BFNone)
+	if err != nil {
+		t.Fatalf("failed to process orphan block: %v", err)
+	}
+	if !isOrphan {
+		t.Fatal("block b3 was not treated as an orphan")
+	}
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+
+	tests := []struct {
+		name string
+		hash chainhash.Hash
+		want BlockLocationKind
+	}{
+		{"genesis", *params.GenesisHash, BlockLocationMainChain},
+		{"b1", g.BlockByName("b1").BlockHash(), BlockLocationMainChain},
+		{"b1a", g.BlockByName("b1a").BlockHash(), BlockLocationSideChain},
+		{"b2", g.BlockByName("b2").BlockHash(), BlockLocationUnknown},
+		{"b3", g.BlockByName("b3").BlockHash(), BlockLocationOrphan},
+	}
+	for _, test := range tests {
+		got := g.chain.BlockLocation(&test.hash)
+		if got != test.want {
+			t.Errorf("%s: unexpected block location -- got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestOnBlockInvalid ensures the invalid block callback is invoked with the
+// expected rule error when a block fails validation and that it is invoked
+// without the chain lock held.
+func TestOnBlockInvalid(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "onblockinvalidtest")
+	defer teardownFunc()
+
+	var gotHashes []chainhash.Hash
+	var gotErrs []RuleError
+	g.chain.onBlockInvalid = func(hash *chainhash.Hash, err RuleError) {
+		// Call back into the chain instance to ensure the chain lock is
+		// not held.
+		g.chain.IsCurrent()
+
+		gotHashes = append(gotHashes, *hash)
+		gotErrs = append(gotErrs, err)
+	}
+
+	// Create a block that pays more than allowed in its coinbase and
+	// ensure the callback is invoked with the expected error.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil, func(b *wire.MsgBlock) {
+		b.Transactions[0].TxOut[2].Value++
+	})
+	g.RejectTipBlock(ErrBadCoinbaseValue)
+	if len(gotHashes) != 1 {
+		t.Fatalf("unexpected number of invalid block callbacks -- got %d, "+
+			"want 1", len(gotHashes))
+	}
+	if gotHashes[0] != g.Tip().BlockHash() {
+		t.Fatalf("unexpected invalid block hash -- got %v, want %v",
+			gotHashes[0], g.Tip().BlockHash())
+	}
+	if gotErrs[0].ErrorCode != ErrBadCoinbaseValue {
+		t.Fatalf("unexpected invalid block error code -- got %v, want %v",
+			gotErrs[0].ErrorCode, ErrBadCoinbaseValue)
+	}
+
+	// Ensure blocks that are accepted do not invoke the callback.
+	//
+	//   genesis -> bp -> b1a
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptTipBlock()
+	if len(gotHashes) != 1 {
+		t.Fatalf("unexpected number of invalid block callbacks -- got %d, "+
+			"want 1", len(gotHashes))
+	}
+}
+
+// countingDB wraps a database and counts the number of read-only transactions
+// that are created via View.
+type countingDB struct {
+	database.DB
+	views int
+}
+
+// View counts the call and then invokes the wrapped database's View.
+func (db *countingDB) View(fn func(tx database.Tx) error) error {
+	db.views++
+	return db.DB.View(fn)
+}
+
+// TestReadDB ensures queries are serviced by the read database when one is
+// configured and that they return the same results as the primary database.
+func TestReadDB(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "readdbtest")
+	defer teardownFunc()
+
+	// Accept a few blocks so there is data to query.
+	//
+	//   genesis -> bp -> b0 -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 0; i < 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+
+	// queryAll performs several queries and returns their results.
+	type queryResults struct {
+		genesisBlock []byte
+		premineBlock []byte
+		premineUtxo  *UtxoEntry
+		ancestors    [][]byte
+	}
+	queryAll := func() queryResults {
+		t.Helper()
+
+		var results queryResults
+		block, err := g.chain.BlockByHash(params.GenesisHash)
+		if err != nil {
+			t.Fatalf("failed to fetch genesis block: %v", err)
+		}
+		results.genesisBlock, _ = block.Bytes()
+		block, err = g.chain.BlockByHeight(1)
+		if err != nil {
+			t.Fatalf("failed to fetch premine block: %v", err)
+		}
+		results.premineBlock, _ = block.Bytes()
+		premineTxHash := g.BlockByName("bp").Transactions[0].TxHash()
+		results.premineUtxo, err = g.chain.FetchUtxoEntry(&premineTxHash)
+		if err != nil {
+			t.Fatalf("failed to fetch premine utxo: %v", err)
+		}
+		tipHash := g.Tip().BlockHash()
+		blocks, err := g.chain.BlockWithAncestors(&tipHash, 2)
+		if err != nil {
+			t.Fatalf("failed to fetch tip block with ancestors: %v", err)
+		}
+		for _, block := range blocks {
+			serialized, _ := block.Bytes()
+			results.ancestors = append(results.ancestors, serialized)
+		}
+		return results
+	}
+
+	// Query the primary database and then query again with a separate read
+	// database handle configured.
+	want := queryAll()
+	readDB := &countingDB{DB: g.chain.db}
+	g.chain.readDB = readDB
+	got := queryAll()
+
+	// Ensure the queries were serviced by the read database and that the
+	// results are identical.
+	if readDB.views == 0 {
+		t.Fatal("queries were not serviced by the read database")
+	}
+
+	// Ensure blocks that are not cached are loaded from the read database
+	// when fetching a block along with its ancestors.
+	g.chain.mainchainBlockCache = make(map[chainhash.Hash]*dcrutil.Block)
+	views := readDB.views
+	tipHash := g.Tip().BlockHash()
+	if _, err := g.chain.BlockWithAncestors(&tipHash, 2); err != nil {
+		t.Fatalf("failed to fetch tip block with ancestors: %v", err)
+	}
+	if readDB.views != views+3 {
+		t.Fatalf("unexpected read database views -- got %d, want %d",
+			readDB.views-views, 3)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("mismatched query results -- got %+v, want %+v", got,
+			want)
+	}
+}
+
+// TestLatestBlockLocatorCache ensures the cached block locator for the tip of
+// the main chain is invalidated when the tip changes.
+func TestLatestBlockLocatorCache(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "latestlocatortest")
+	defer teardownFunc()
+
+	// checkLocator ensures the latest block locator matches a freshly
+	// calculated locator for the current tip and starts with the tip.
+	checkLocator := func() {
+		t.Helper()
+
+		locator, err := g.chain.LatestBlockLocator()
+		if err != nil {
+			t.Fatalf("failed to get latest block locator: %v", err)
+		}
+		want := g.chain.bestChain.BlockLocator(nil)
+		if !reflect.DeepEqual(locator, want) {
+			t.Fatalf("unexpected locator -- got %v, want %v", locator,
+				want)
+		}
+		tipHash := g.chain.BestSnapshot().Hash
+		if *locator[0] != tipHash {
+			t.Fatalf("locator does not start with the tip -- got %v, "+
+				"want %v", locator[0], tipHash)
+		}
+	}
+
+	// Ensure the locator is updated as blocks are connected.
+	//
+	//   genesis -> bp -> b1
+	checkLocator()
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	checkLocator()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	checkLocator()
+
+	// Ensure repeated requests without a tip change return the cached
+	// locator.
+	locator1, _ := g.chain.LatestBlockLocator()
+	locator2, _ := g.chain.LatestBlockLocator()
+	if &locator1[0] != &locator2[0] {
+		t.Fatal("latest block locator was not cached")
+	}
+
+	// Ensure the locator is updated when the tip is disconnected.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	checkLocator()
+}
+
+// TestChainTipHeaders ensures the headers for all chain tips are returned on a
+// forked chain.
+func TestChainTipHeaders(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "chaintipheaderstest")
+	defer teardownFunc()
+
+	// Create a forked chain.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	// Ensure the headers for both tips are returned and match the tips
+	// reported by ChainTips.
+	headers := g.chain.ChainTipHeaders()
+	tips := g.chain.ChainTips()
+	if len(headers) != 2 || len(tips) != 2 {
+		t.Fatalf("unexpected number of chain tips -- got %d headers and "+
+			"%d tips, want 2", len(headers), len(tips))
+	}
+	for i := range headers {
+		if headers[i].BlockHash() != tips[i].Hash {
+			t.Fatalf("header %d does not match tip -- got %v, want %v",
+				i, headers[i].BlockHash(), tips[i].Hash)
+		}
+	}
+	for _, name := range []string{"b2", "b2a"} {
+		want := g.BlockByName(name).Header
+		var found bool
+		for _, header := range headers {
+			if reflect.DeepEqual(header, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("header for chain tip %q not found", name)
+		}
+	}
+}
+
+// TestReorgStickinessWork ensures a side chain must exceed the work of the
+// current best chain by more than the configured stickiness work in order to
+// cause a reorganize.
+func TestReorgStickinessWork(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reorgstickinesstest")
+	defer teardownFunc()
+
+	// Create a main chain.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+
+	// Require side chains to exceed the best chain by more than the work
+	// of a single block.
+	g.chain.reorgStickinessWork = CalcWork(g.Tip().Header.Bits)
+
+	// Create a side chain that has more work than the main chain by exactly
+	// the stickiness work and ensure it does not cause a reorganize.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a -> b3a
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	// Extend the side chain so it has more work than the main chain by
+	// more than the stickiness work and ensure it causes a reorganize.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a -> b3a -> b4a
+	g.NextBlock("b4a", nil, nil)
+	g.AcceptTipBlock()
+}
+
+// TestDeepForkDetectedNotification ensures the NTDeepForkDetected notification
+// is only sent when a side chain comes within the configured number of blocks
+// worth of work of overtaking the main chain.
+func TestDeepForkDetectedNotification(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "deepforktest")
+	defer teardownFunc()
+
+	// Create a main chain.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 4; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+
+	// Warn when a side chain is within a single block of overtaking the
+	// main chain.
+	var ntfns []*DeepForkDetectedNtfnsData
+	g.chain.splitWarnThreshold = 1
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTDeepForkDetected {
+			ntfns = append(ntfns, n.Data.(*DeepForkDetectedNtfnsData))
+		}
+	}
+
+	// Create a side chain that is more than a block behind the main chain
+	// and ensure no warning is sent.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	//                      \-> b2a
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b4")
+	if len(ntfns) != 0 {
+		t.Fatalf("unexpected warning for distant side chain: %+v", ntfns)
+	}
+
+	// Extend the side chain so it is within a block of the main chain and
+	// ensure the warning is sent.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	//                      \-> b2a -> b3a
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b4")
+	if len(ntfns) != 1 {
+		t.Fatalf("unexpected number of warnings -- got %d, want 1",
+			len(ntfns))
+	}
+	want := DeepForkDetectedNtfnsData{
+		MainTip:       g.BlockByName("b4").BlockHash(),
+		MainTipHeight: 5,
+		SideTip:       g.BlockByName("b3a").BlockHash(),
+		SideTipHeight: 4,
+		ForkHeight:    2,
+	}
+	if *ntfns[0] != want {
+		t.Fatalf("unexpected warning data -- got %+v, want %+v", ntfns[0],
+			want)
+	}
+
+	// Ensure no warning is sent when the notifications are disabled.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	//                      \-> b2a -> b3a -> b4a
+	g.chain.splitWarnThreshold = 0
+	g.NextBlock("b4a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b4")
+	if len(ntfns) != 1 {
+		t.Fatalf("unexpected number of warnings -- got %d, want 1",
+			len(ntfns))
+	}
+}
+
+// TestStakeDifficultyChangedNotification ensures the NTStakeDifficultyChanged
+// notification is sent exactly once for each block that changes the stake
+// difficulty required for the next block.
+func TestStakeDifficultyChangedNotification(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	// Use a small target ticket pool size so the stake difficulty rises
+	// quickly as tickets are purchased.
+	params := cloneParams(&chaincfg.RegNetParams)
+	params.TicketPoolSize = 4
+	g, teardownFunc := newChaingenHarness(t, params, "stakediffchangedtest")
+	defer teardownFunc()
+
+	// Record any stake difficulty changed notifications.
+	var ntfns []*StakeDifficultyChangedNtfnsData
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTStakeDifficultyChanged {
+			ntfns = append(ntfns,
+				n.Data.(*StakeDifficultyChangedNtfnsData))
+		}
+	}
+
+	// Advance to stake validation height and then continue purchasing
+	// tickets across the next stake difficulty retarget boundary.
+	//
+	//   ... -> bsv# -> bbm0 -> bbm1 -> ... -> bbm#
+	g.AdvanceToStakeValidationHeight()
+	for i := int64(0); i < params.StakeDiffWindowSize+2; i++ {
+		outs := g.OldestCoinbaseOuts()
+		g.NextBlock(fmt.Sprintf("bbm%d", i), nil, outs[1:])
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+
+	// Determine the blocks that changed the stake difficulty required for
+	// the next block.
+	var want []StakeDifficultyChangedNtfnsData
+	tipHeight := g.chain.bestChain.Tip().height
+	for height := int64(1); height <= tipHeight; height++ {
+		node := g.chain.bestChain.NodeByHeight(height)
+		oldDiff, err := g.chain.calcNextRequiredStakeDifficulty(node.parent)
+		if err != nil {
+			t.Fatalf("failed to calculate stake difficulty: %v", err)
+		}
+		newDiff, err := g.chain.calcNextRequiredStakeDifficulty(node)
+		if err != nil {
+			t.Fatalf("failed to calculate stake difficulty: %v", err)
+		}
+		if oldDiff != newDiff {
+			want = append(want, StakeDifficultyChangedNtfnsData{
+				Hash:         node.hash,
+				Height:       node.height,
+				OldStakeDiff: oldDiff,
+				NewStakeDiff: newDiff,
+			})
+		}
+	}
+	if len(want) == 0 {
+		t.Fatal("stake difficulty never changed")
+	}
+
+	// Ensure exactly one notification was sent for each change.
+	if len(ntfns) != len(want) {
+		t.Fatalf("unexpected number of notifications -- got %d, want %d",
+			len(ntfns), len(want))
+	}
+	for i, ntfn := range ntfns {
+		if *ntfn != want[i] {
+			t.Fatalf("unexpected notification %d -- got %+v, want %+v",
+				i, *ntfn, want[i])
+		}
+		if (ntfn.Height+1)%params.StakeDiffWindowSize != 0 {
+			t.Fatalf("stake difficulty changed at height %d which is "+
+				"not a retarget boundary", ntfn.Height)
+		}
+	}
+}
+
+// TestLiveTickets ensures the live tickets reported for the tip of the main
+// chain match the pool size, including when the stake node for the tip needs
+// to be loaded.
+func TestLiveTickets(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "liveticketstest")
+	defer teardownFunc()
+
+	// Advance past stake enabled height so there are live tickets.
+	g.AdvanceToStakeValidationHeight()
+
+	// checkLiveTickets ensures the number of live tickets matches the pool
+	// size in the best state.
+	checkLiveTickets := func() {
+		t.Helper()
+
+		tickets, err := g.chain.LiveTickets()
+		if err != nil {
+			t.Fatalf("failed to fetch live tickets: %v", err)
+		}
+		wantSize := g.chain.BestSnapshot().NextPoolSize
+		if uint32(len(tickets)) != wantSize || wantSize == 0 {
+			t.Fatalf("unexpected number of live tickets -- got %d, "+
+				"want %d", len(tickets), wantSize)
+		}
+	}
+	checkLiveTickets()
+
+	// Drop the stake node for the tip to simulate it being pruned and
+	// ensure the live tickets are still reported.
+	g.chain.bestChain.Tip().stakeNode = nil
+	checkLiveTickets()
+}
+
+// TestTicketStatus ensures the status reported for tickets that are live,
+// missed, and unknown is correct.
+func TestTicketStatus(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "ticketstatustest")
+	defer teardownFunc()
+
+	// Advance to stake validation height and then create a block that only
+	// includes the minimum number of votes so the remaining winning
+	// tickets become missed.
+	//
+	//   ... -> bsv# -> b0
+	g.AdvanceToStakeValidationHeight()
+	numVotes := params.TicketsPerBlock/2 + 1
+	g.NextBlock("b0", nil, nil, g.ReplaceWithNVotes(numVotes))
+	g.AcceptTipBlock()
+
+	liveTickets, err := g.chain.LiveTickets()
+	if err != nil {
+		t.Fatalf("failed to fetch live tickets: %v", err)
+	}
+	missedTickets, err := g.chain.MissedTickets()
+	if err != nil {
+		t.Fatalf("failed to fetch missed tickets: %v", err)
+	}
+	if len(liveTickets) == 0 || len(missedTickets) == 0 {
+		t.Fatalf("unexpected number of tickets -- got %d live and %d "+
+			"missed", len(liveTickets), len(missedTickets))
+	}
+
+	tests := []struct {
+		name   string
+		ticket chainhash.Hash
+		want   TicketStatus
+	}{
+		{"live", liveTickets[0], TicketStatusLive},
+		{"missed", missedTickets[0], TicketStatusMissed},
+		{"unknown", chainhash.Hash{0x01}, TicketStatusUnknown},
+	}
+	for _, test := range tests {
+		got, err := g.chain.TicketStatus(&test.ticket)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: unexpected ticket status -- got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
+
+// TestNewTicketsNotification ensures the details about the new tickets in the
+// NTNewTickets notification match the ticket purchases in the block the tickets
+// were purchased in.
+func TestNewTicketsNotification(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "newticketsntfntest")
+	defer teardownFunc()
+
+	// Record the new tickets notifications.
+	var ntfns []*TicketNotificationsData
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTNewTickets {
+			ntfns = append(ntfns, n.Data.(*TicketNotificationsData))
+		}
+	}
+
+	// Advance to stake validation height which involves purchasing tickets
+	// that mature along the way.
+	//
+	//   genesis -> bp -> ... -> bsv#
+	g.AdvanceToStakeValidationHeight()
+
+	var numTickets int
+	for _, ntfn := range ntfns {
+		if len(ntfn.NewTicketsInfo) != len(ntfn.TicketsNew) {
+			t.Fatalf("block %s: unexpected number of new ticket details "+
+				"-- got %d, want %d", ntfn.Hash, len(ntfn.NewTicketsInfo),
+				len(ntfn.TicketsNew))
+		}
+		if len(ntfn.TicketsNew) == 0 {
+			continue
+		}
+
+		// Ensure the details match the ticket purchases in the block the
+		// tickets were purchased in.
+		purchaseHeight := ntfn.Height - int64(params.TicketMaturity)
+		purchaseHash, err := g.chain.BlockHashByHeight(purchaseHeight)
+		if err != nil {
+			t.Fatalf("failed to fetch block at height %d: %v",
+				purchaseHeight, err)
+		}
+		purchaseBlock, err := g.chain.BlockByHash(purchaseHash)
+		if err != nil {
+			t.Fatalf("failed to fetch block %s: %v", purchaseHash, err)
+		}
+		var wantInfo []NewTicketInfo
+		for _, stx := range purchaseBlock.MsgBlock().STransactions {
+			if stake.IsSStx(stx) {
+				wantInfo = append(wantInfo, NewTicketInfo{
+					Hash:           stx.TxHash(),
+					Amount:         stx.TxOut[0].Value,
+					PurchaseBlock:  *purchaseHash,
+					PurchaseHeight: purchaseHeight,
+					ExpiryHeight: ntfn.Height +
+						int64(params.TicketExpiry),
+				})
+			}
+		}
+		if !reflect.DeepEqual(ntfn.NewTicketsInfo, wantInfo) {
+			t.Fatalf("block %s: unexpected new ticket details -- got "+
+				"%+v, want %+v", ntfn.Hash, ntfn.NewTicketsInfo,
+				wantInfo)
+		}
+		for i, info := range ntfn.NewTicketsInfo {
+			if info.Hash != ntfn.TicketsNew[i] {
+				t.Fatalf("block %s: new ticket %d details for %s do "+
+					"not match ticket %s", ntfn.Hash, i, info.Hash,
+					ntfn.TicketsNew[i])
+			}
+		}
+		numTickets += len(ntfn.TicketsNew)
+	}
+	if numTickets == 0 {
+		t.Fatal("no new tickets were notified")
+	}
+}
+
+// TestTicketEventsForBlock ensures the missed, revoked, and spent tickets
+// reported for blocks are correct for blocks that miss votes and revoke them as
+// well as prior to the stake enabled height.
+func TestTicketEventsForBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "ticketeventstest")
+	defer teardownFunc()
+
+	// Advance to stake validation height and then create a block that only
+	// includes the minimum number of votes so the remaining winning
+	// tickets become missed followed by a block that revokes them.
+	//
+	//   ... -> bsv# -> b0 -> b1
+	g.AdvanceToStakeValidationHeight()
+	winners := g.chain.BestSnapshot().NextWinningTickets
+	numVotes := params.TicketsPerBlock/2 + 1
+	g.NextBlock("b0", nil, nil, g.ReplaceWithNVotes(numVotes))
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+
+	// toSet converts the provided tickets to a set for comparison since
+	// their order is not significant.
+	toSet := func(tickets []chainhash.Hash) map[chainhash.Hash]struct{} {
+		set := make(map[chainhash.Hash]struct{}, len(tickets))
+		for _, ticket := range tickets {
+			set[ticket] = struct{}{}
+		}
+		return set
+	}
+
+	// votedTickets returns the tickets spent by the votes in the block
+	// with the provided name.
+	votedTickets := func(blockName string) []chainhash.Hash {
+		var tickets []chainhash.Hash
+		for _, stx := range g.BlockByName(blockName).STransactions {
+			if stake.IsSSGen(stx) {
+				ticket := stx.TxIn[1].PreviousOutPoint.Hash
+				tickets = append(tickets, ticket)
+			}
+		}
+		return tickets
+	}
+
+	// Determine the winning tickets that were not voted in b0.
+	b0Voted := toSet(votedTickets("b0"))
+	var b0Missed []chainhash.Hash
+	for _, ticket := range winners {
+		if _, ok := b0Voted[ticket]; !ok {
+			b0Missed = append(b0Missed, ticket)
+		}
+	}
+	if len(b0Missed) != int(params.TicketsPerBlock-numVotes) {
+		t.Fatalf("unexpected number of missed tickets -- got %d, want %d",
+			len(b0Missed), params.TicketsPerBlock-numVotes)
+	}
+
+	tests := []struct {
+		name        string
+		block       string           // block name
+		wantMissed  []chainhash.Hash // expected missed tickets
+		wantRevoked []chainhash.Hash // expected revoked tickets
+		wantSpent   []chainhash.Hash // expected spent tickets
+	}{{
+		name:  "prior to stake enabled height",
+		block: "bp",
+	}, {
+		name:       "block that misses votes",
+		block:      "b0",
+		wantMissed: b0Missed,
+		wantSpent:  votedTickets("b0"),
+	}, {
+		name:        "block that revokes missed votes",
+		block:       "b1",
+		wantRevoked: b0Missed,
+		wantSpent:   votedTickets("b1"),
+	}}
+	for _, test := range tests {
+		hash := g.BlockByName(test.block).BlockHash()
+		missed, revoked, spent, err := g.chain.TicketEventsForBlock(&hash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(toSet(missed), toSet(test.wantMissed)) {
+			t.Fatalf("%s: unexpected missed tickets -- got %v, want %v",
+				test.name, missed, test.wantMissed)
+		}
+		if !reflect.DeepEqual(toSet(revoked), toSet(test.wantRevoked)) {
+			t.Fatalf("%s: unexpected revoked tickets -- got %v, want %v",
+				test.name, revoked, test.wantRevoked)
+		}
+		if !reflect.DeepEqual(toSet(spent), toSet(test.wantSpent)) {
+			t.Fatalf("%s: unexpected spent tickets -- got %v, want %v",
+				test.name, spent, test.wantSpent)
+		}
+	}
+
+	// Ensure an unknown block is rejected.
+	unknownHash := chainhash.Hash{0x01}
+	_, _, _, err := g.chain.TicketEventsForBlock(&unknownHash)
+	if err == nil {
+		t.Fatal("did not receive expected error for unknown block")
+	}
+}
+
+// TestWinningTicketsForBlock ensures the winning tickets reported for blocks
+// are correct at the tip, for historical blocks, and prior to the stake enabled
+// height.
+func TestWinningTicketsForBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "winningticketstest")
+	defer teardownFunc()
+
+	// Advance to stake validation height and save the winners as of the
+	// tip at that point.
+	//
+	//   ... -> bsv# -> b0
+	g.AdvanceToStakeValidationHeight()
+	svhHash := g.Tip().BlockHash()
+	svhWinners := g.chain.BestSnapshot().NextWinningTickets
+	g.NextBlock("b0", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure the winners for the tip match the best state.
+	tipHash := g.Tip().BlockHash()
+	winners, err := g.chain.WinningTicketsForBlock(&tipHash)
+	if err != nil {
+		t.Fatalf("failed to fetch winners for tip: %v", err)
+	}
+	want := g.chain.BestSnapshot().NextWinningTickets
+	if len(want) == 0 || !reflect.DeepEqual(winners, want) {
+		t.Fatalf("unexpected winners for tip -- got %v, want %v", winners,
+			want)
+	}
+
+	// Ensure the winners for a historical block match the best state as of
+	// the time it was the tip.
+	winners, err = g.chain.WinningTicketsForBlock(&svhHash)
+	if err != nil {
+		t.Fatalf("failed to fetch winners for historical block: %v", err)
+	}
+	if !reflect.DeepEqual(winners, svhWinners) {
+		t.Fatalf("unexpected winners for historical block -- got %v, "+
+			"want %v", winners, svhWinners)
+	}
+
+	// Ensure blocks before the stake enabled height have no winners.
+	bpHash := g.BlockByName("bp").BlockHash()
+	winners, err = g.chain.WinningTicketsForBlock(&bpHash)
+	if err != nil {
+		t.Fatalf("failed to fetch winners for premine block: %v", err)
+	}
+	if winners == nil || len(winners) != 0 {
+		t.Fatalf("unexpected winners for premine block -- got %v",
+			winners)
+	}
+
+	// Ensure unknown blocks return an error.
+	if _, err := g.chain.WinningTicketsForBlock(&chainhash.Hash{}); err == nil {
+		t.Fatal("WinningTicketsForBlock did not fail for unknown block")
+	}
+}
+
+// TestRetainAllStakeNodes ensures the stake nodes of historical blocks are
+// kept in memory when the chain is configured to retain them, even prior to
+// the latest checkpoint where they are otherwise dropped immediately, so that
+// historical stake queries do not need to reload them.
+func TestRetainAllStakeNodes(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// using parameters with a checkpoint after all of the blocks created
+	// by the test so the stake nodes of parent blocks are dropped when they
+	// are not retained.
+	params := cloneParams(&chaincfg.RegNetParams)
+	params.Checkpoints = []chaincfg.Checkpoint{{
+		Height: 1000,
+		Hash:   &chainhash.Hash{0x01},
+	}}
+	g, teardownFunc := newChaingenHarness(t, params, "retainstakenodestest")
+	defer teardownFunc()
+	g.chain.retainAllStakeNodes = true
+
+	// Advance to stake validation height and save the winners as of the
+	// tip at that point.
+	//
+	//   ... -> bsv# -> b0
+	g.AdvanceToStakeValidationHeight()
+	svhHash := g.Tip().BlockHash()
+	svhWinners := g.chain.BestSnapshot().NextWinningTickets
+	g.NextBlock("b0", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure the stake node of the historical block was retained and is
+	// used to answer the query without being reloaded.
+	svhNode := g.chain.index.LookupNode(&svhHash)
+	stakeNode := svhNode.stakeNode
+	if stakeNode == nil {
+		t.Fatal("stake node for historical block was not retained")
+	}
+	winners, err := g.chain.WinningTicketsForBlock(&svhHash)
+	if err != nil {
+		t.Fatalf("failed to fetch winners for historical block: %v", err)
+	}
+	if !reflect.DeepEqual(winners, svhWinners) {
+		t.Fatalf("unexpected winners for historical block -- got %v, "+
+			"want %v", winners, svhWinners)
+	}
+	if svhNode.stakeNode != stakeNode {
+		t.Fatal("stake node for historical block was reloaded")
+	}
+
+	// Ensure pruning does not drop any stake nodes.
+	g.chain.pruneStakeNodes()
+	if svhNode.stakeNode != stakeNode {
+		t.Fatal("stake node for historical block was pruned")
+	}
+
+	// Ensure the stake node of the parent is dropped once retention is
+	// disabled.
+	//
+	//   ... -> b0 -> b1
+	g.chain.retainAllStakeNodes = false
+	b0Hash := g.Tip().BlockHash()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	if g.chain.index.LookupNode(&b0Hash).stakeNode != nil {
+		t.Fatal("stake node for parent block was not dropped")
+	}
+}
+
+// reorgIndexManagerEvent identifies an event recorded by mockIndexManager.
+type reorgIndexManagerEvent struct {
+	kind string
+	hash chainhash.Hash
+}
+
+// mockIndexManager is an index manager that records the calls made to it.  It
+// implements the optional ReorgIndexManager interface.
+type mockIndexManager struct {
+	events []reorgIndexManagerEvent
+}
+
+// Ensure mockIndexManager implements the ReorgIndexManager interface.
+var _ ReorgIndexManager = (*mockIndexManager)(nil)
+
+// Init is part of the IndexManager interface.
+func (m *mockIndexManager) Init(*BlockChain, <-chan struct{}) error {
+	return nil
+}
+
+// ConnectBlock records the connected block.  It is part of the IndexManager
+// interface.
+func (m *mockIndexManager) ConnectBlock(_ database.Tx, block, _ *dcrutil.Block, _ *UtxoViewpoint) error {
+	m.events = append(m.events, reorgIndexManagerEvent{"connect", *block.Hash()})
+	return nil
+}
+
+// DisconnectBlock records the disconnected block.  It is part of the
+// IndexManager interface.
+func (m *mockIndexManager) DisconnectBlock(_ database.Tx, block, _ *dcrutil.Block, _ *UtxoViewpoint) error {
+	m.events = append(m.events, reorgIndexManagerEvent{"disconnect", *block.Hash()})
+	return nil
+}
+
+// ReorgStarted records the start of a reorganization.  It is part of the
+// ReorgIndexManager interface.
+func (m *mockIndexManager) ReorgStarted(_, newBest *chainhash.Hash) {
+	m.events = append(m.events, reorgIndexManagerEvent{"started", *newBest})
+}
+
+// ReorgFinished records the end of a reorganization.  It is part of the
+// ReorgIndexManager interface.
+func (m *mockIndexManager) ReorgFinished() {
+	m.events = append(m.events, reorgIndexManagerEvent{kind: "finished"})
+}
+
+// TestReorgIndexManager ensures index managers that implement the optional
+// ReorgIndexManager interface are notified of the start and end of a
+// reorganization around the per-block calls.
+func TestReorgIndexManager(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reorgindexmgrtest")
+	defer teardownFunc()
+
+	// Create a main chain and a side chain with equal work.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	// Extend the side chain to cause a reorganize with the mock index
+	// manager in place.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a -> b3a
+	indexManager := &mockIndexManager{}
+	g.chain.indexManager = indexManager
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure the reorganize callbacks bracket the per-block calls.
+	hash := func(name string) chainhash.Hash {
+		return g.BlockByName(name).BlockHash()
+	}
+	want := []reorgIndexManagerEvent{
+		{"started", hash("b3a")},
+		{"disconnect", hash("b2")},
+		{"connect", hash("b2a")},
+		{"connect", hash("b3a")},
+		{kind: "finished"},
+	}
+	if !reflect.DeepEqual(indexManager.events, want) {
+		t.Fatalf("unexpected index manager events -- got %+v, want %+v",
+			indexManager.events, want)
+	}
+
+	// Ensure the reorganize callbacks are not invoked when simply extending
+	// the main chain.
+	//
+	//   genesis -> bp -> b1 -> b2a -> b3a -> b4a
+	indexManager.events = nil
+	g.NextBlock("b4a", nil, nil)
+	g.AcceptTipBlock()
+	want = []reorgIndexManagerEvent{{"connect", hash("b4a")}}
+	if !reflect.DeepEqual(indexManager.events, want) {
+		t.Fatalf("unexpected index manager events -- got %+v, want %+v",
+			indexManager.events, want)
+	}
+}
+
+// failingIndexManager is an index manager that fails to connect blocks and
+// counts the number of times it was invoked.
+type failingIndexManager struct {
+	mockIndexManager
+	connectCalls int
+}
+
+// errIndexFailure is the error returned by failingIndexManager.
+var errIndexFailure = errors.New("index failure")
+
+// ConnectBlock counts the call and returns an error.  It is part of the
+// IndexManager interface.
+func (m *failingIndexManager) ConnectBlock(database.Tx, *dcrutil.Block, *dcrutil.Block, *UtxoViewpoint) error {
+	m.connectCalls++
+	return errIndexFailure
+}
+
+// TestIndexErrorsFatal ensures blocks are still connected when the index
+// manager fails while index errors are not fatal and that the index manager is
+// disabled as a result, while the failure prevents the block from connecting
+// when index errors are fatal, which is the default.
+func TestIndexErrorsFatal(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "indexerrorstest")
+	defer teardownFunc()
+	if !g.chain.indexErrorsFatal {
+		t.Fatal("index errors are not fatal by default")
+	}
+
+	// Ensure blocks are connected despite the index manager failing when
+	// index errors are not fatal and that it is not invoked again once it
+	// has been disabled.
+	//
+	//   genesis -> bp -> b1
+	indexManager := &failingIndexManager{}
+	g.chain.indexManager = indexManager
+	g.chain.indexErrorsFatal = false
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	if !g.chain.indexManagerDisabled {
+		t.Fatal("index manager was not disabled")
+	}
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	if indexManager.connectCalls != 1 {
+		t.Fatalf("unexpected number of index manager calls -- got %d, "+
+			"want 1", indexManager.connectCalls)
+	}
+
+	// Ensure the failure prevents the block from connecting when index
+	// errors are fatal.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.chain.indexErrorsFatal = true
+	g.chain.indexManagerDisabled = false
+	g.NextBlock("b2", nil, nil)
+	_, _, err := g.chain.ProcessBlock(dcrutil.NewBlock(g.Tip()), BFNone)
+	if err != errIndexFailure {
+		t.Fatalf("unexpected error -- got %v, want %v", err,
+			errIndexFailure)
+	}
+	g.ExpectTip("b1")
+}
+
+// replayedInput houses the details about a spent output as seen through the
+// view provided for the block that spends it.
+type replayedInput struct {
+	height     int64
+	isCoinBase bool
+	amount     int64
+	pkScript   string
+}
+
+// spentInputsFromView returns the details about all of the outputs spent by the
+// transactions the block connects as seen through the provided view.
+func spentInputsFromView(block, parent *dcrutil.Block, view *UtxoViewpoint) map[wire.OutPoint]replayedInput {
+	var txns []*dcrutil.Tx
+	if parent != nil && headerApprovesParent(&block.MsgBlock().Header) {
+		txns = append(txns, parent.Transactions()...)
+	}
+	txns = append(txns, block.STransactions()...)
+
+	inputs := make(map[wire.OutPoint]replayedInput)
+	for _, tx := range txns {
+		msgTx := tx.MsgTx()
+		if IsCoinBaseTx(msgTx) {
+			continue
+		}
+		isVote := stake.IsSSGen(msgTx)
+		for txInIdx, txIn := range msgTx.TxIn {
+			if txInIdx == 0 && isVote {
+				continue
+			}
+			prevOut := txIn.PreviousOutPoint
+			entry := view.LookupEntry(&prevOut.Hash)
+			if entry == nil {
+				continue
+			}
+			inputs[prevOut] = replayedInput{
+				height:     entry.BlockHeight(),
+				isCoinBase: entry.IsCoinBase(),
+				amount:     entry.AmountByIndex(prevOut.Index),
+				pkScript:   string(entry.PkScriptByIndex(prevOut.Index)),
+			}
+		}
+	}
+	return inputs
+}
+
+// viewIndexManager is an index manager that records the details about the
+// outputs spent by each connected block as seen through the provided view.
+type viewIndexManager struct {
+	mockIndexManager
+	inputs map[chainhash.Hash]map[wire.OutPoint]replayedInput
+}
+
+// ConnectBlock records the outputs spent by the block.  It is part of the
+// IndexManager interface.
+func (m *viewIndexManager) ConnectBlock(_ database.Tx, block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+	m.inputs[*block.Hash()] = spentInputsFromView(block, parent, view)
+	return nil
+}
+
+// TestReplayBlocks ensures replaying main chain blocks provides views that
+// match the ones provided to the index manager when the blocks were connected
+// and that replaying does not modify the chain state.
+func TestReplayBlocks(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "replayblockstest")
+	defer teardownFunc()
+
+	indexManager := &viewIndexManager{
+		inputs: make(map[chainhash.Hash]map[wire.OutPoint]replayedInput),
+	}
+	g.chain.indexManager = indexManager
+
+	// Generate enough blocks to have mature coinbase outputs to work with
+	// and create blocks that spend them.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm# -> b0 -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	for i := 0; i < 4; i++ {
+		outs := g.OldestCoinbaseOuts()
+		g.NextBlock(fmt.Sprintf("b%d", i), &outs[0], nil)
+		g.AcceptTipBlock()
+	}
+
+	// Replay all of the blocks after the genesis block and ensure the views
+	// match the ones provided when the blocks were connected live.
+	origSnapshot := g.chain.BestSnapshot()
+	var replayed []chainhash.Hash
+	var numInputs int
+	err := g.chain.ReplayBlocks(1, origSnapshot.Height+1, func(block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+		replayed = append(replayed, *block.Hash())
+		got := spentInputsFromView(block, parent, view)
+		want := indexManager.inputs[*block.Hash()]
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("mismatched replayed view for block %s -- got %v, "+
+				"want %v", block.Hash(), got, want)
+		}
+		numInputs += len(got)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReplayBlocks: unexpected error: %v", err)
+	}
+	if int64(len(replayed)) != origSnapshot.Height {
+		t.Fatalf("unexpected number of replayed blocks -- got %d, want %d",
+			len(replayed), origSnapshot.Height)
+	}
+	if numInputs == 0 {
+		t.Fatal("replayed blocks did not spend any outputs")
+	}
+
+	// Ensure the chain state was not modified by replaying the blocks.
+	snapshot := g.chain.BestSnapshot()
+	if !reflect.DeepEqual(snapshot, origSnapshot) {
+		t.Fatalf("chain state modified by replay -- got %+v, want %+v",
+			snapshot, origSnapshot)
+	}
+
+	// Ensure a range past the tip does not invoke the callback and an error
+	// from the callback is returned.
+	err = g.chain.ReplayBlocks(origSnapshot.Height+1, origSnapshot.Height+5,
+		func(*dcrutil.Block, *dcrutil.Block, *UtxoViewpoint) error {
+			t.Fatal("callback invoked for range past the tip")
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("ReplayBlocks: unexpected error: %v", err)
+	}
+	errReplay := errors.New("replay failure")
+	err = g.chain.ReplayBlocks(1, 3, func(*dcrutil.Block, *dcrutil.Block, *UtxoViewpoint) error {
+		return errReplay
+	})
+	if err != errReplay {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errReplay)
+	}
+
+	// Create a side chain that forks from b1 and ensure replaying fails
+	// instead of mixing blocks from both chains when the main chain is
+	// reorganized to it while the blocks are being replayed.
+	//
+	//   ... -> b1 -> b2 -> b3
+	//            \-> b2a -> b3a -> b4a
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b4a", nil, nil)
+	b2Hash := g.BlockByName("b2").BlockHash()
+	var reorged bool
+	err = g.chain.ReplayBlocks(1, origSnapshot.Height+1, func(block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+		if *block.Hash() != b2Hash {
+			return nil
+		}
+		_, _, err := g.chain.ProcessBlock(dcrutil.NewBlock(g.Tip()), BFNone)
+		reorged = err == nil
+		return err
+	})
+	if !reorged {
+		t.Fatal("failed to reorganize the main chain while replaying")
+	}
+	if _, ok := err.(errNotInMainChain); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want errNotInMainChain",
+			err, err)
+	}
+	g.ExpectTip("b4a")
+
+	// Ensure replaying fails when the main chain becomes shorter than the
+	// requested range while the blocks are being replayed.
+	//
+	//   ... -> b1 -> b2a -> b3a
+	tipHeight := g.chain.BestSnapshot().Height
+	err = g.chain.ReplayBlocks(1, tipHeight+1, func(block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+		if block.Height() != 1 {
+			return nil
+		}
+		return g.chain.DisconnectTip()
+	})
+	if _, ok := err.(errNotInMainChain); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want errNotInMainChain",
+			err, err)
+	}
+	g.ExpectTip("b3a")
+}
+
+// TestReindexRange ensures rebuilding the entries of an index for a range of
+// blocks results in the same entries as rebuilding the entire index.
+func TestReindexRange(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reindexrangetest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with
+	// and create blocks that spend them.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm# -> b0 -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	for i := 0; i < 4; i++ {
+		outs := g.OldestCoinbaseOuts()
+		g.NextBlock(fmt.Sprintf("b%d", i), &outs[0], nil)
+		g.AcceptTipBlock()
+	}
+
+	// The mock index stores the number of outputs spent by each block along
+	// with their total amount keyed by the block hash.
+	bucketName := []byte("mockspendidx")
+	err := g.chain.db.Update(func(dbTx database.Tx) error {
+		_, err := dbTx.Metadata().CreateBucket(bucketName)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to create mock index bucket: %v", err)
+	}
+	rebuild := func(dbTx database.Tx, block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+		inputs := spentInputsFromView(block, parent, view)
+		var amount int64
+		for _, input := range inputs {
+			amount += input.amount
+		}
+		entry := make([]byte, 12)
+		dbnamespace.ByteOrder.PutUint32(entry[0:4], uint32(len(inputs)))
+		dbnamespace.ByteOrder.PutUint64(entry[4:12], uint64(amount))
+		bucket := dbTx.Metadata().Bucket(bucketName)
+		return bucket.Put(block.Hash()[:], entry)
+	}
+
+	// loadIndex returns the entries of the mock index.
+	loadIndex := func() map[string]string {
+		t.Helper()
+
+		entries := make(map[string]string)
+		err := g.chain.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(bucketName)
+			return bucket.ForEach(func(k, v []byte) error {
+				entries[string(k)] = string(v)
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("failed to load mock index: %v", err)
+		}
+		return entries
+	}
+
+	// Build the entire index.
+	tipHeight := g.chain.BestSnapshot().Height
+	if err := g.chain.ReindexRange(1, tipHeight+1, rebuild); err != nil {
+		t.Fatalf("failed to build full index: %v", err)
+	}
+	fullIndex := loadIndex()
+	if int64(len(fullIndex)) != tipHeight {
+		t.Fatalf("unexpected number of index entries -- got %d, want %d",
+			len(fullIndex), tipHeight)
+	}
+
+	// Corrupt the entries for the blocks that spend outputs by removing
+	// some of them and modifying the others.
+	corruptStart := tipHeight - 3
+	err = g.chain.db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(bucketName)
+		for height := corruptStart; height <= tipHeight; height++ {
+			hash := g.chain.bestChain.NodeByHeight(height).hash
+			var err error
+			if height%2 == 0 {
+				err = bucket.Delete(hash[:])
+			} else {
+				err = bucket.Put(hash[:], []byte{0x00})
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to corrupt mock index: %v", err)
+	}
+	if reflect.DeepEqual(loadIndex(), fullIndex) {
+		t.Fatal("corrupting the mock index did not modify it")
+	}
+
+	// Repair the corrupted range and ensure the index matches the full
+	// rebuild.
+	err = g.chain.ReindexRange(corruptStart, tipHeight+1, rebuild)
+	if err != nil {
+		t.Fatalf("failed to repair index: %v", err)
+	}
+	if got := loadIndex(); !reflect.DeepEqual(got, fullIndex) {
+		t.Fatalf("repaired index does not match full rebuild -- got %v, "+
+			"want %v", got, fullIndex)
+	}
+
+	// Ensure the tip can't be disconnected while the entries for a block are
+	// being rebuilt and that rebuilding fails without writing any entries
+	// for the remaining blocks once it is disconnected.
+	var disconnectResult chan error
+	var rebuilt []int64
+	err = g.chain.ReindexRange(corruptStart, tipHeight+1, func(dbTx database.Tx, block, parent *dcrutil.Block, view *UtxoViewpoint) error {
+		rebuilt = append(rebuilt, block.Height())
+		if disconnectResult != nil {
+			return nil
+		}
+		disconnectResult = make(chan error, 1)
+		go func() {
+			disconnectResult <- g.chain.DisconnectTip()
+		}()
+		select {
+		case err := <-disconnectResult:
+			t.Fatalf("tip disconnected while rebuilding entries (err %v)",
+				err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		return nil
+	})
+	if _, ok := err.(errNotInMainChain); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want errNotInMainChain",
+			err, err)
+	}
+	if err := <-disconnectResult; err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	if int64(len(rebuilt)) != tipHeight-corruptStart {
+		t.Fatalf("unexpected number of rebuilt blocks -- got %d, want %d",
+			len(rebuilt), tipHeight-corruptStart)
+	}
+}
+
+// TestBestStateSerialization ensures best states round trip through their
+// binary serialization and that malformed data is rejected.
+func TestBestStateSerialization(t *testing.T) {
+	t.Parallel()
+
+	hashA := chainhash.Hash{0x01}
+	hashB := chainhash.Hash{0x02}
+	hashC := chainhash.Hash{0x03}
+	tests := []struct {
+		name  string
+		state BestState
+	}{{
+		name:  "zero value",
+		state: BestState{MedianTime: time.Unix(0, 0)},
+	}, {
+		name: "empty ticket slices",
+		state: BestState{
+			Hash:               hashA,
+			PrevHash:           hashB,
+			Height:             12345,
+			Bits:               0x1b01ffff,
+			NextPoolSize:       40960,
+			NextStakeDiff:      2e10,
+			BlockSize:          1 << 20,
+			NumTxns:            12,
+			TotalTxns:          987654,
+			MedianTime:         time.Unix(1533614832, 0),
+			TotalSubsidy:       1e15,
+			NextWinningTickets: []chainhash.Hash{},
+			MissedTickets:      []chainhash.Hash{},
+			NextFinalState:     [6]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06},
+			NumUtxos:           54321,
+			UtxoAmount:         1e14,
+		},
+	}, {
+		name: "populated ticket slices",
+		state: BestState{
+			Hash:               hashA,
+			PrevHash:           hashB,
+			Height:             -1,
+			NextStakeDiff:      -1,
+			MedianTime:         time.Unix(1533614832, 0),
+			NextWinningTickets: []chainhash.Hash{hashA, hashB, hashC},
+			MissedTickets:      []chainhash.Hash{hashC},
+			NextFinalState:     [6]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		},
+	}}
+
+	for _, test := range tests {
+		serialized, err := test.state.MarshalBinary()
+		if err != nil {
+			t.Errorf("%q: unexpected marshal error: %v", test.name, err)
+			continue
+		}
+
+		var got BestState
+		if err := got.UnmarshalBinary(serialized); err != nil {
+			t.Errorf("%q: unexpected unmarshal error: %v", test.name, err)
+			continue
+		}
+
+		// Empty slices are decoded as nil.
+		want := test.state
+		if len(want.NextWinningTickets) == 0 {
+			want.NextWinningTickets = nil
+		}
+		if len(want.MissedTickets) == 0 {
+			want.MissedTickets = nil
+		}
+		if !got.MedianTime.Equal(want.MedianTime) {
+			t.Errorf("%q: mismatched median time -- got %v, want %v",
+				test.name, got.MedianTime, want.MedianTime)
+			continue
+		}
+		got.MedianTime, want.MedianTime = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: mismatched best state -- got %+v, want %+v",
+				test.name, got, want)
+			continue
+		}
+
+		// Ensure truncated data is rejected.
+		for i := 0; i < len(serialized); i++ {
+			var state BestState
+			err := state.UnmarshalBinary(serialized[:i])
+			if !isDeserializeErr(err) {
+				t.Errorf("%q: unexpected error for %d bytes -- got %v, "+
+					"want errDeserialize", test.name, i, err)
+				break
+			}
+		}
+
+		// Ensure trailing data and unknown versions are rejected.
+		var state BestState
+		err = state.UnmarshalBinary(append(serialized, 0x00))
+		if !isDeserializeErr(err) {
+			t.Errorf("%q: unexpected error for trailing data -- got %v, "+
+				"want errDeserialize", test.name, err)
+		}
+		serialized[0] = bestStateSerializeVersion + 1
+		err = state.UnmarshalBinary(serialized)
+		if !isDeserializeErr(err) {
+			t.Errorf("%q: unexpected error for unknown version -- got %v, "+
+				"want errDeserialize", test.name, err)
+		}
+	}
+}
+
+// TestBlocksUntil ensures the number of blocks until a target height and the
+// estimated duration are calculated relative to the current tip using the
+// target time per block of the chain parameters.
+func TestBlocksUntil(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure and a target time per block that differs
+	// from the default.
+	// 	genesis -> 1 -> 2 -> ... -> 18
+	params := cloneParams(&chaincfg.MainNetParams)
+	params.TargetTimePerBlock = time.Minute * 2
+	chain := newFakeChain(params)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 18)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(branchTip(branch0Nodes))
+
+	tests := []struct {
+		name         string
+		targetHeight int64
+		wantBlocks   int64
+		wantDuration time.Duration
+		wantErr      bool
+	}{{
+		name:         "above tip",
+		targetHeight: 28,
+		wantBlocks:   10,
+		wantDuration: time.Minute * 20,
+	}, {
+		name:         "one above tip",
+		targetHeight: 19,
+		wantBlocks:   1,
+		wantDuration: time.Minute * 2,
+	}, {
+		name:         "tip",
+		targetHeight: 18,
+		wantBlocks:   0,
+		wantDuration: 0,
+	}, {
+		name:         "below tip",
+		targetHeight: 15,
+		wantBlocks:   -3,
+		wantDuration: -time.Minute * 6,
+	}, {
+		name:         "genesis",
+		targetHeight: 0,
+		wantBlocks:   -18,
+		wantDuration: -time.Minute * 36,
+	}, {
+		name:         "negative target",
+		targetHeight: -1,
+		wantErr:      true,
+	}}
+	for _, test := range tests {
+		numBlocks, duration, err := chain.BlocksUntil(test.targetHeight)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%q: unexpected error -- got %v, want error %v",
+				test.name, err, test.wantErr)
+			continue
+		}
+		if numBlocks != test.wantBlocks {
+			t.Errorf("%q: unexpected number of blocks -- got %d, want %d",
+				test.name, numBlocks, test.wantBlocks)
+		}
+		if duration != test.wantDuration {
+			t.Errorf("%q: unexpected duration -- got %v, want %v",
+				test.name, duration, test.wantDuration)
+		}
+	}
+}
+
+// TestBlockByRef ensures blocks are looked up by both hash and height
+// references and that references to unknown blocks fail.
+func TestBlockByRef(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "blockbyreftest")
+	defer teardownFunc()
+
+	// Create a couple of main chain blocks and a side chain block.
+	//
+	//   genesis -> bp -> b1
+	//                \-> b1a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+
+	b1Hash := g.BlockByName("b1").BlockHash()
+	b1aHash := g.BlockByName("b1a").BlockHash()
+	tests := []struct {
+		name     string
+		ref      BlockRef
+		wantHash *chainhash.Hash
+	}{
+		{"genesis by hash", NewBlockRefFromHash(params.GenesisHash), params.GenesisHash},
+		{"genesis by height", NewBlockRefFromHeight(0), params.GenesisHash},
+		{"main chain by hash", NewBlockRefFromHash(&b1Hash), &b1Hash},
+		{"main chain by height", NewBlockRefFromHeight(2), &b1Hash},
+		{"side chain by hash", NewBlockRefFromHash(&b1aHash), &b1aHash},
+		{"unknown hash", NewBlockRefFromHash(&chainhash.Hash{}), nil},
+		{"height past tip", NewBlockRefFromHeight(3), nil},
+		{"negative height", NewBlockRefFromHeight(-1), nil},
+		{"unknown kind", BlockRef{Kind: BlockRefHeight + 1}, nil},
+	}
+	for _, test := range tests {
+		block, err := g.chain.Block(test.ref)
+		if test.wantHash == nil {
+			if err == nil {
+				t.Errorf("%q: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+		if *block.Hash() != *test.wantHash {
+			t.Errorf("%q: unexpected block -- got %v, want %v", test.name,
+				block.Hash(), test.wantHash)
+		}
+	}
+}
+
+// TestBlocksFromLocator ensures blocks located via a block locator are streamed
+// to the callback in order while respecting the stop hash, the max number of
+// blocks, and the special cases of locating inventory.
+func TestBlocksFromLocator(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "blocksfromlocatortest")
+	defer teardownFunc()
+
+	// Create a few main chain blocks and a side chain block.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b3", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+
+	hash := func(name string) *chainhash.Hash {
+		hash := g.BlockByName(name).BlockHash()
+		return &hash
+	}
+	tests := []struct {
+		name      string
+		locator   BlockLocator
+		hashStop  *chainhash.Hash
+		maxBlocks uint32
+		want      []string
+	}{{
+		name:      "after locator to tip",
+		locator:   BlockLocator{hash("b1")},
+		hashStop:  &chainhash.Hash{},
+		maxBlocks: 10,
+		want:      []string{"b2", "b3"},
+	}, {
+		name:      "after locator to stop hash",
+		locator:   BlockLocator{hash("bp")},
+		hashStop:  hash("b2"),
+		maxBlocks: 10,
+		want:      []string{"b1", "b2"},
+	}, {
+		name:      "limited by max blocks",
+		locator:   BlockLocator{hash("bp")},
+		hashStop:  &chainhash.Hash{},
+		maxBlocks: 1,
+		want:      []string{"b1"},
+	}, {
+		name:      "side chain locator falls back to fork point",
+		locator:   BlockLocator{hash("b2a"), hash("b1")},
+		hashStop:  &chainhash.Hash{},
+		maxBlocks: 10,
+		want:      []string{"b2", "b3"},
+	}, {
+		name:      "unknown locator starts after genesis",
+		locator:   BlockLocator{&chainhash.Hash{0x01}},
+		hashStop:  &chainhash.Hash{},
+		maxBlocks: 10,
+		want:      []string{"bp", "b1", "b2", "b3"},
+	}, {
+		name:      "no locator requests stop hash",
+		locator:   BlockLocator{},
+		hashStop:  hash("b2a"),
+		maxBlocks: 10,
+		want:      []string{"b2a"},
+	}, {
+		name:      "no locator with unknown stop hash",
+		locator:   BlockLocator{},
+		hashStop:  &chainhash.Hash{0x01},
+		maxBlocks: 10,
+		want:      nil,
+	}, {
+		name:      "locator at tip",
+		locator:   BlockLocator{hash("b3")},
+		hashStop:  &chainhash.Hash{},
+		maxBlocks: 10,
+		want:      nil,
+	}}
+	for _, test := range tests {
+		var got []chainhash.Hash
+		err := g.chain.BlocksFromLocator(test.locator, test.hashStop,
+			test.maxBlocks, func(block *dcrutil.Block) error {
+				got = append(got, *block.Hash())
+				return nil
+			})
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+		var want []chainhash.Hash
+		for _, name := range test.want {
+			want = append(want, *hash(name))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: unexpected blocks -- got %v, want %v", test.name,
+				got, want)
+		}
+	}
+
+	// Ensure streaming stops once the callback returns an error.
+	errStop := errors.New("stop")
+	var numCalls int
+	err := g.chain.BlocksFromLocator(BlockLocator{hash("bp")},
+		&chainhash.Hash{}, 10, func(*dcrutil.Block) error {
+			numCalls++
+			return errStop
+		})
+	if err != errStop {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errStop)
+	}
+	if numCalls != 1 {
+		t.Fatalf("unexpected number of callbacks -- got %d, want 1",
+			numCalls)
+	}
+}
+
+// TestPurgeBlockCache ensures purging the main chain block cache removes all
+// cached blocks and that the blocks are still available from the database
+// afterwards.
+func TestPurgeBlockCache(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "purgeblockcachetest")
+	defer teardownFunc()
+
+	// Create a few main chain blocks to populate the cache.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	if len(g.chain.mainchainBlockCache) == 0 {
+		t.Fatal("main chain block cache was not populated")
+	}
+
+	// Purge the cache and ensure it is empty.
+	g.chain.PurgeBlockCache()
+	if len(g.chain.mainchainBlockCache) != 0 {
+		t.Fatalf("main chain block cache has %d entries after purge",
+			len(g.chain.mainchainBlockCache))
+	}
+
+	// Ensure the blocks are still available by height now that they must
+	// be loaded from the database.
+	for _, name := range []string{"bp", "b1", "b2", "b3"} {
+		want := g.BlockByName(name)
+		block, err := g.chain.BlockByHeight(int64(want.Header.Height))
+		if err != nil {
+			t.Fatalf("failed to fetch block %s after purge: %v", name, err)
+		}
+		if *block.Hash() != want.BlockHash() {
+			t.Fatalf("unexpected block at height %d -- got %v, want %v",
+				want.Header.Height, block.Hash(), want.BlockHash())
+		}
+	}
+	if len(g.chain.mainchainBlockCache) != 0 {
+		t.Fatal("main chain block cache repopulated by lookups")
+	}
+}
+
+// TestReorgInterrupt ensures closing the interrupt channel stops a reorganize
+// without modifying the chain state before any blocks are disconnected and
+// that a reorganize which has started disconnecting blocks runs to completion.
+func TestReorgInterrupt(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reorginterrupttest")
+	defer teardownFunc()
+
+	// checkConsistent ensures the best state of the chain matches the tip
+	// of the best chain and that the utxo set stats match the utxo set.
+	checkConsistent := func(wantTip string) {
+		t.Helper()
+
+		g.ExpectTip(wantTip)
+		var count, amount int64
+		err := g.chain.db.View(func(dbTx database.Tx) error {
+			var err error
+			count, amount, err = dbCalcUtxoSetStats(dbTx)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to calculate utxo set stats: %v", err)
+		}
+		gotCount, gotAmount := g.chain.UtxoSetStats()
+		if gotCount != count || gotAmount != amount {
+			t.Fatalf("inconsistent utxo set stats -- got %d/%d, want "+
+				"%d/%d", gotCount, gotAmount, count, amount)
+		}
+	}
+
+	// Create a main chain and a side chain that has the same work.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b2a -> b3a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+
+	// Extend the side chain so it has more work with the interrupt channel
+	// already closed and ensure the reorganize stops before modifying the
+	// chain state.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b2a -> b3a -> b4a
+	interrupt := make(chan struct{})
+	close(interrupt)
+	g.chain.interrupt = interrupt
+	g.NextBlock("b4a", nil, nil)
+	_, _, err := g.chain.ProcessBlock(dcrutil.NewBlock(g.Tip()), BFNone)
+	if err != errInterruptRequested {
+		t.Fatalf("unexpected error -- got %v, want %v", err,
+			errInterruptRequested)
+	}
+	checkConsistent("b3")
+
+	// Close the interrupt channel once the first block has been
+	// disconnected while reorganizing to an extended side chain and ensure
+	// the reorganize is not stopped part way through.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b2a -> b3a -> b4a -> b5a
+	interrupt = make(chan struct{})
+	g.chain.interrupt = interrupt
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTBlockDisconnected {
+			select {
+			case <-interrupt:
+			default:
+				close(interrupt)
+			}
+		}
+	}
+	g.NextBlock("b5a", nil, nil)
+	g.AcceptTipBlock()
+	checkConsistent("b5a")
+}
+
+// TestBlockWithAncestors ensures a block is returned along with the requested
+// number of ancestors for both main and side chain blocks and that all of the
+// available blocks are returned when more ancestors are requested than exist.
+func TestBlockWithAncestors(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "blockancestorstest")
+	defer teardownFunc()
+
+	// Create a few main chain blocks and a side chain block.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	hash := func(name string) chainhash.Hash {
+		if name == "genesis" {
+			return *params.GenesisHash
+		}
+		return g.BlockByName(name).BlockHash()
+	}
+	tests := []struct {
+		name   string
+		block  string
+		n      int
+		want   []string
+		hasErr bool
+	}{
+		{"no ancestors", "b2", 0, []string{"b2"}, false},
+		{"some ancestors", "b2", 2, []string{"b2", "b1", "bp"}, false},
+		{"all ancestors", "b2", 3, []string{"b2", "b1", "bp", "genesis"}, false},
+		{"more than exist", "b2", 10, []string{"b2", "b1", "bp", "genesis"}, false},
+		{"side chain", "b1a", 10, []string{"b1a", "bp", "genesis"}, false},
+		{"genesis", "genesis", 5, []string{"genesis"}, false},
+		{"negative count", "b2", -1, nil, true},
+	}
+	for _, test := range tests {
+		blockHash := hash(test.block)
+		blocks, err := g.chain.BlockWithAncestors(&blockHash, test.n)
+		if (err != nil) != test.hasErr {
+			t.Errorf("%q: unexpected error -- got %v, want error %v",
+				test.name, err, test.hasErr)
+			continue
+		}
+		var got, want []chainhash.Hash
+		for _, block := range blocks {
+			got = append(got, *block.Hash())
+		}
+		for _, name := range test.want {
+			want = append(want, hash(name))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: unexpected blocks -- got %v, want %v", test.name,
+				got, want)
+		}
+	}
+
+	// Ensure unknown blocks return an error.
+	_, err := g.chain.BlockWithAncestors(&chainhash.Hash{}, 1)
+	if err == nil {
+		t.Fatal("BlockWithAncestors did not fail for unknown block")
+	}
+}
+
+// TestOnGenesisLoaded ensures the genesis loaded callback is invoked exactly
+// once when the database is first initialized and that an error returned by it
+// causes the creation of the chain instance to fail.
+func TestOnGenesisLoaded(t *testing.T) {
+	// Create a new database for the chain.
+	params := &chaincfg.RegNetParams
+	dbPath := filepath.Join(os.TempDir(), "ongenesisloadedtest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Ensure an error from the callback causes the chain creation to fail
+	// and leaves the database uninitialized.
+	errRejected := errors.New("genesis rejected")
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  NewMedianTime(),
+		OnGenesisLoaded: func(genesis *dcrutil.Block) error {
+			return errRejected
+		},
+	})
+	if err != errRejected {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errRejected)
+	}
+
+	// Ensure the callback is invoked with the genesis block when the chain
+	// is successfully created.
+	var loaded []chainhash.Hash
+	onGenesisLoaded := func(genesis *dcrutil.Block) error {
+		loaded = append(loaded, *genesis.Hash())
+		return nil
+	}
+	_, err = New(&Config{
+		DB:              db,
+		ChainParams:     params,
+		TimeSource:      NewMedianTime(),
+		OnGenesisLoaded: onGenesisLoaded,
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	want := []chainhash.Hash{*params.GenesisHash}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("unexpected genesis loaded callbacks -- got %v, want %v",
+			loaded, want)
+	}
+
+	// Ensure the callback is not invoked again once the database has been
+	// initialized.
+	_, err = New(&Config{
+		DB:              db,
+		ChainParams:     params,
+		TimeSource:      NewMedianTime(),
+		OnGenesisLoaded: onGenesisLoaded,
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, want) {
+		t.Fatalf("unexpected genesis loaded callbacks -- got %v, want %v",
+			loaded, want)
+	}
+}
+
+// fixedTimeSource provides an implementation of the MedianTimeSource interface
+// that always returns a fixed adjusted time.
+type fixedTimeSource struct {
+	now time.Time
+}
+
+// AdjustedTime returns the fixed time.  It is part of the MedianTimeSource
+// interface.
+func (s *fixedTimeSource) AdjustedTime() time.Time {
+	return s.now
+}
+
+// AddTimeSample is ignored.  It is part of the MedianTimeSource interface.
+func (s *fixedTimeSource) AddTimeSample(string, time.Time) {}
+
+// Offset always returns zero.  It is part of the MedianTimeSource interface.
+func (s *fixedTimeSource) Offset() time.Duration {
+	return 0
+}
+
+// TestExpectedTipWork ensures the expected work of the tip is based on the
+// time elapsed since the genesis block and grows as time passes.
+func TestExpectedTipWork(t *testing.T) {
+	params := &chaincfg.RegNetParams
+	chain := newFakeChain(params)
+	genesisTime := params.GenesisBlock.Header.Timestamp
+	timeSource := &fixedTimeSource{now: genesisTime}
+	chain.timeSource = timeSource
+	blockWork := CalcWork(chain.bestChain.Tip().bits)
+
+	tests := []struct {
+		name      string
+		elapsed   time.Duration
+		numBlocks int64
+	}{
+		{"before genesis", -time.Hour, 1},
+		{"at genesis", 0, 1},
+		{"partial interval", params.TargetTimePerBlock - 1, 1},
+		{"genesis+1", params.TargetTimePerBlock, 2},
+		{"genesis+100", params.TargetTimePerBlock * 100, 101},
+	}
+	var prevWork *big.Int
+	for _, test := range tests {
+		timeSource.now = genesisTime.Add(test.elapsed)
+		work := chain.ExpectedTipWork()
+		want := new(big.Int).Mul(blockWork, big.NewInt(test.numBlocks))
+		if work.Cmp(want) != 0 {
+			t.Errorf("%q: unexpected work -- got %v, want %v", test.name,
+				work, want)
+			continue
+		}
+		if work.Sign() <= 0 {
+			t.Errorf("%q: work is not positive -- got %v", test.name, work)
+		}
+		if prevWork != nil && work.Cmp(prevWork) < 0 {
+			t.Errorf("%q: work decreased -- got %v, previous %v",
+				test.name, work, prevWork)
+		}
+
+		// Ensure modifying the returned value does not affect later
+		// calls.
+		work.SetInt64(0)
+		prevWork = chain.ExpectedTipWork()
+	}
+}
+
+// TestMaxChainHeight ensures the tip of the main chain does not advance beyond
+// the configured maximum height while the blocks above it remain known.
+func TestMaxChainHeight(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "maxchainheighttest")
+	defer teardownFunc()
+	g.chain.maxChainHeight = 2
+
+	// Create blocks up to the maximum height.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure blocks above the maximum height are not connected, even when
+	// they would cause a reorganize, but remain known.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a -> b2a
+	rejectAboveMax := func(wantHeight int64) {
+		t.Helper()
+
+		block := g.Tip()
+		_, _, err := g.chain.ProcessBlock(dcrutil.NewBlock(block), BFNone)
+		want := MaxChainHeightError{wantHeight, 2}
+		if err != want {
+			t.Fatalf("unexpected error -- got %v, want %v", err, want)
+		}
+		blockHash := block.BlockHash()
+		if !g.chain.index.HaveBlock(&blockHash) {
+			t.Fatalf("block %s above the maximum height is not known",
+				g.TipName())
+		}
+		g.ExpectTip("b1")
+	}
+	g.NextBlock("b2", nil, nil)
+	rejectAboveMax(3)
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	rejectAboveMax(3)
+
+	// Ensure blocks above the maximum height are accepted to a side chain
+	// when they do not have enough work to become the main chain.
+	//
+	//   genesis -> bp -> b1
+	//                \-> b1a -> b2a -> b3a
+	g.chain.reorgStickinessWork = new(big.Int).Mul(
+		CalcWork(g.Tip().Header.Bits), big.NewInt(10))
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+}
+
+// TestDisableBlockCache ensures the chain works as expected, including when
+// reorganizing, with the main chain block cache disabled and that no blocks are
+// cached.
+func TestDisableBlockCache(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "disableblockcachetest")
+	defer teardownFunc()
+	g.chain.disableBlockCache = true
+	g.chain.PurgeBlockCache()
+
+	// Create a main chain and a side chain that has more work to force a
+	// reorganize.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a -> b2a -> b3a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure the blocks were never cached.
+	if len(g.chain.mainchainBlockCache) != 0 {
+		t.Fatalf("main chain block cache has %d entries while disabled",
+			len(g.chain.mainchainBlockCache))
+	}
+
+	// Ensure the main chain blocks are loaded from the database.
+	for _, name := range []string{"bp", "b1a", "b2a", "b3a"} {
+		want := g.BlockByName(name)
+		block, err := g.chain.BlockByHeight(int64(want.Header.Height))
+		if err != nil {
+			t.Fatalf("failed to fetch block %s: %v", name, err)
+		}
+		if *block.Hash() != want.BlockHash() {
+			t.Fatalf("unexpected block at height %d -- got %v, want %v",
+				want.Header.Height, block.Hash(), want.BlockHash())
+		}
+	}
+
+	// Ensure disconnecting the tip works as expected.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	g.ExpectTip("b2a")
+}
+
+// TestAllAgendas ensures the agendas and versions reported by the chain match
+// the deployments defined by the network parameters and that modifying the
+// returned agendas does not affect the parameters.
+func TestAllAgendas(t *testing.T) {
+	params := cloneParams(&chaincfg.MainNetParams)
+	bc := newFakeChain(params)
+
+	agendas := bc.AllAgendas()
+	if !reflect.DeepEqual(agendas, params.Deployments) {
+		t.Fatalf("mismatched agendas -- got %v, want %v", agendas,
+			params.Deployments)
+	}
+
+	versions := bc.AgendaVersions()
+	if len(versions) != len(params.Deployments) {
+		t.Fatalf("unexpected number of versions -- got %d, want %d",
+			len(versions), len(params.Deployments))
+	}
+	for i, version := range versions {
+		if _, ok := params.Deployments[version]; !ok {
+			t.Fatalf("version %d is not a defined deployment version",
+				version)
+		}
+		if i > 0 && versions[i-1] >= version {
+			t.Fatalf("versions are not in ascending order: %v", versions)
+		}
+	}
+
+	// Ensure modifying the returned agendas does not modify the params.
+	for version := range agendas {
+		agendas[version][0].Vote.Id = "modified"
+		delete(agendas, version)
+		if params.Deployments[version][0].Vote.Id == "modified" {
+			t.Fatalf("modifying returned agendas modified the params")
+		}
+	}
+	if len(bc.AllAgendas()) != len(params.Deployments) {
+		t.Fatal("deleting returned agendas modified the params")
+	}
+}
+
+// TestSetBlockCacheSize ensures the main chain block cache honors size changes
+// made at runtime and evicts blocks immediately when the size is reduced.
+func TestSetBlockCacheSize(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "setblockcachesizetest")
+	defer teardownFunc()
+
+	if err := g.chain.SetBlockCacheSize(-1); err == nil {
+		t.Fatal("SetBlockCacheSize accepted a negative size")
+	}
+
+	// Start with a small cache and create a few main chain blocks.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	if err := g.chain.SetBlockCacheSize(2); err != nil {
+		t.Fatalf("unexpected error setting cache size: %v", err)
+	}
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 4; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	if got := len(g.chain.mainchainBlockCache); got != 2 {
+		t.Fatalf("unexpected number of cached blocks -- got %d, want 2", got)
+	}
+
+	// Grow the cache and ensure additional blocks are retained.
+	//
+	//   ... -> b4 -> b5 -> b6 -> b7 -> b8
+	if err := g.chain.SetBlockCacheSize(10); err != nil {
+		t.Fatalf("unexpected error setting cache size: %v", err)
+	}
+	for i := 5; i <= 8; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	if got := len(g.chain.mainchainBlockCache); got != 6 {
+		t.Fatalf("unexpected number of cached blocks -- got %d, want 6", got)
+	}
+
+	// Shrink the cache and ensure only the most recent blocks remain.
+	if err := g.chain.SetBlockCacheSize(3); err != nil {
+		t.Fatalf("unexpected error setting cache size: %v", err)
+	}
+	if got := len(g.chain.mainchainBlockCache); got != 3 {
+		t.Fatalf("unexpected number of cached blocks -- got %d, want 3", got)
+	}
+	for _, name := range []string{"b6", "b7", "b8"} {
+		hash := g.BlockByName(name).BlockHash()
+		if _, ok := g.chain.mainchainBlockCache[hash]; !ok {
+			t.Fatalf("block %s was evicted from the cache", name)
+		}
+	}
+}
+
+// TestAddTimeSample ensures time samples added via the chain are forwarded to
+// the configured time source and thus influence whether or not the chain
+// believes it is current.
+func TestAddTimeSample(t *testing.T) {
+	params := &chaincfg.RegNetParams
+	chain := newFakeChain(params)
+	timeSource := NewMedianTime()
+	chain.timeSource = timeSource
+
+	// Create a tip with a timestamp that is just recent enough for the
+	// chain to be considered current without any time adjustment.
+	now := time.Now()
+	tipTime := now.Add(-24*time.Hour + 30*time.Minute)
+	tip := chain.bestChain.Tip()
+	node := newFakeNode(tip, 1, 0, tip.bits, tipTime)
+	chain.index.AddNode(node)
+	chain.bestChain.SetTip(node)
+	if !chain.IsCurrent() {
+		t.Fatal("chain is not current prior to adding time samples")
+	}
+
+	// Add enough samples that are skewed an hour into the future to
+	// adjust the median time and ensure the chain is no longer current.
+	for i := 0; i < 5; i++ {
+		chain.AddTimeSample(fmt.Sprintf("peer%d", i), now.Add(time.Hour))
+	}
+	if offset := timeSource.Offset(); offset < 59*time.Minute {
+		t.Fatalf("unexpected time offset -- got %v, want ~%v", offset,
+			time.Hour)
+	}
+	adjusted := timeSource.AdjustedTime()
+	if adjusted.Before(now.Add(59 * time.Minute)) {
+		t.Fatalf("adjusted time %v was not shifted forward from %v",
+			adjusted, now)
+	}
+	if chain.IsCurrent() {
+		t.Fatal("chain is current after adding skewed time samples")
+	}
+}
+
+// TestMinimumChainWork ensures the chain does not consider itself current
+// until the cumulative work of the tip exceeds the configured minimum chain
+// work even when the tip has a recent timestamp.
+func TestMinimumChainWork(t *testing.T) {
+	params := &chaincfg.RegNetParams
+	chain := newFakeChain(params)
+	chain.timeSource = NewMedianTime()
+
+	// Create a chain of nodes with recent timestamps.
+	tip := chain.bestChain.Tip()
+	nodes := make([]*blockNode, 0, 3)
+	for i := 0; i < 3; i++ {
+		tip = newFakeNode(tip, 1, 0, tip.bits, time.Now())
+		chain.index.AddNode(tip)
+		nodes = append(nodes, tip)
+	}
+	chain.bestChain.SetTip(nodes[0])
+	if !chain.IsCurrent() {
+		t.Fatal("chain is not current without a minimum chain work")
+	}
+
+	// Require more work than the second node has and ensure the chain is
+	// only current once the tip exceeds it.
+	chain.minimumChainWork = new(big.Int).Set(nodes[1].workSum)
+	for i, node := range nodes {
+		chain.bestChain.SetTip(node)
+		wantCurrent := i == 2
+		if chain.IsCurrent() != wantCurrent {
+			t.Fatalf("unexpected current state at height %d -- got %v, "+
+				"want %v", node.height, !wantCurrent, wantCurrent)
+		}
+	}
+}
+
+// TestBlocksAtHeight ensures all blocks at a given height across forks are
+// returned with the main chain block first.
+func TestBlocksAtHeight(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "blocksatheighttest")
+	defer teardownFunc()
+
+	// Create a forked chain.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b3", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b3")
+
+	hashOf := func(name string) chainhash.Hash {
+		return g.BlockByName(name).BlockHash()
+	}
+	tests := []struct {
+		height int64
+		want   []chainhash.Hash
+	}{
+		{0, []chainhash.Hash{*params.GenesisHash}},
+		{2, []chainhash.Hash{hashOf("b1")}},
+		{3, []chainhash.Hash{hashOf("b2"), hashOf("b2a")}},
+		{4, []chainhash.Hash{hashOf("b3")}},
+		{5, nil},
+	}
+	for _, test := range tests {
+		got := g.chain.BlocksAtHeight(test.height)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("unexpected blocks at height %d -- got %v, want %v",
+				test.height, got, test.want)
+		}
+	}
+}
+
+// TestCorruptDatabase ensures creating a chain instance with a database that
+// has a corrupt best chain state record returns a CorruptDatabaseError and
+// invokes the corruption callback which is able to repair the database.
+func TestCorruptDatabase(t *testing.T) {
+	// Create a new database for the chain and initialize it.
+	params := &chaincfg.RegNetParams
+	dbPath := filepath.Join(os.TempDir(), "corruptdatabasetest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+	_, err = New(&Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  NewMedianTime(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+
+	// Load the valid best chain state record and create a version of it
+	// that refers to a block that is not in the block index.
+	var origState []byte
+	err = db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(dbnamespace.ChainStateKeyName)
+		origState = append([]byte(nil), serialized...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to load best chain state: %v", err)
+	}
+	state, err := deserializeBestChainState(origState)
+	if err != nil {
+		t.Fatalf("failed to deserialize best chain state: %v", err)
+	}
+	state.hash = chainhash.Hash{0x01}
+	unknownTipState := serializeBestChainState(state)
+
+	putState := func(serialized []byte) error {
+		return db.Update(func(dbTx database.Tx) error {
+			return dbTx.Metadata().Put(dbnamespace.ChainStateKeyName,
+				serialized)
+		})
+	}
+
+	// Ensure the corrupt records are detected as such.
+	tests := []struct {
+		name  string
+		state []byte
+	}{
+		{"truncated", origState[:10]},
+		{"unknown tip", unknownTipState},
+	}
+	for _, test := range tests {
+		if err := putState(test.state); err != nil {
+			t.Fatalf("%q: failed to store best chain state: %v", test.name,
+				err)
+		}
+		_, err = New(&Config{
+			DB:          db,
+			ChainParams: params,
+			TimeSource:  NewMedianTime(),
+		})
+		if _, ok := err.(CorruptDatabaseError); !ok {
+			t.Fatalf("%q: unexpected error -- got %v (%T), want %T",
+				test.name, err, err, CorruptDatabaseError(""))
+		}
+	}
+
+	// Ensure an error from the corruption callback is returned.
+	errNoRepair := errors.New("no repair")
+	_, err = New(&Config{
+		DB:           db,
+		ChainParams:  params,
+		TimeSource:   NewMedianTime(),
+		OnCorruption: func() error { return errNoRepair },
+	})
+	if err != errNoRepair {
+		t.Fatalf("unexpected error -- got %v, want %v", err, errNoRepair)
+	}
+
+	// Ensure the chain state is loaded again after the corruption callback
+	// repairs the database.
+	var numCalls int
+	chain, err := New(&Config{
+		DB:          db,
+		ChainParams: params,
+		TimeSource:  NewMedianTime(),
+		OnCorruption: func() error {
+			numCalls++
+			return putState(origState)
 		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance after repair: %v", err)
+	}
+	if numCalls != 1 {
+		t.Fatalf("unexpected number of corruption callbacks -- got %d, "+
+			"want 1", numCalls)
+	}
+	if tip := chain.BestSnapshot().Hash; tip != *params.GenesisHash {
+		t.Fatalf("unexpected tip after repair -- got %v, want %v", tip,
+			params.GenesisHash)
+	}
+}
+
+// TestSubsidyCacheConfig ensures a subsidy cache provided via the config is
+// used by the chain instance instead of a new one and that a cache for
+// different chain parameters is rejected.
+func TestSubsidyCacheConfig(t *testing.T) {
+	// Create a new database for the chain.
+	params := &chaincfg.RegNetParams
+	dbPath := filepath.Join(os.TempDir(), "subsidycacheconfigtest")
+	_ = os.RemoveAll(dbPath)
+	db, err := database.Create("ffldb", dbPath, params.Net)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer os.RemoveAll(dbPath)
+	defer db.Close()
+
+	// Ensure a subsidy cache for different chain parameters is rejected.
+	_, err = New(&Config{
+		DB:           db,
+		ChainParams:  params,
+		TimeSource:   NewMedianTime(),
+		SubsidyCache: NewSubsidyCache(0, &chaincfg.MainNetParams),
+	})
+	if _, ok := err.(AssertError); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want %T", err, err,
+			AssertError(""))
+	}
+
+	// Create a subsidy cache with a sentinel value for the second subsidy
+	// reduction interval so it is possible to tell whether it is used.
+	const sentinel = 12345
+	subsidyCache := NewSubsidyCache(0, params)
+	subsidyCache.subsidyCache[2] = sentinel
+
+	// Ensure the provided cache is the one used by the chain instance.
+	chain, err := New(&Config{
+		DB:           db,
+		ChainParams:  params,
+		TimeSource:   NewMedianTime(),
+		SubsidyCache: subsidyCache,
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	if chain.FetchSubsidyCache() != subsidyCache {
+		t.Fatal("chain instance does not use the provided subsidy cache")
+	}
+	height := 2 * params.SubsidyReductionInterval
+	if got := chain.FetchSubsidyCache().CalcBlockSubsidy(height); got != sentinel {
+		t.Fatalf("unexpected block subsidy -- got %d, want %d", got,
+			sentinel)
+	}
+}
+
+// TestChainParams ensures the chain parameters returned by the chain instance
+// are the ones it was created with.
+func TestChainParams(t *testing.T) {
+	params := chaincfg.RegNetParams
+	chain := newFakeChain(&params)
+	if got := chain.ChainParams(); got != &params {
+		t.Fatalf("unexpected chain params -- got %p (%s), want %p (%s)",
+			got, got.Name, &params, params.Name)
+	}
+}
+
+// TestNextBlockTemplate ensures the values reported as required for the next
+// block match those carried by blocks that are subsequently connected.
+func TestNextBlockTemplate(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "nextblocktemplatetest")
+	defer teardownFunc()
+
+	// checkNextBlock ensures the values reported as required for the next
+	// block match the provided block.
+	checkNextBlock := func(info *NextBlockInfo, blockName string) {
+		t.Helper()
+
+		header := &g.BlockByName(blockName).Header
+		if info.PrevHash != header.PrevBlock {
+			t.Fatalf("unexpected prev hash -- got %v, want %v",
+				info.PrevHash, header.PrevBlock)
+		}
+		if info.Height != int64(header.Height) {
+			t.Fatalf("unexpected height -- got %d, want %d", info.Height,
+				header.Height)
+		}
+		if info.Bits != header.Bits {
+			t.Fatalf("unexpected bits -- got %08x, want %08x", info.Bits,
+				header.Bits)
+		}
+		if info.SBits != header.SBits {
+			t.Fatalf("unexpected stake difficulty -- got %d, want %d",
+				info.SBits, header.SBits)
+		}
+		if info.StakeVersion != header.StakeVersion {
+			t.Fatalf("unexpected stake version -- got %d, want %d",
+				info.StakeVersion, header.StakeVersion)
+		}
+		if !header.Timestamp.After(info.MedianTime) {
+			t.Fatalf("block timestamp %v is not after median time %v",
+				header.Timestamp, info.MedianTime)
+		}
+		if !info.Timestamp.After(info.MedianTime) {
+			t.Fatalf("template timestamp %v is not after median time %v",
+				info.Timestamp, info.MedianTime)
+		}
+	}
+
+	// Ensure the required values match for each block while advancing the
+	// chain beyond stake validation height and through a stake difficulty
+	// change.
+	g.AdvanceToStakeValidationHeight()
+	for i := int64(0); i < params.StakeDiffWindowSize+2; i++ {
+		info, err := g.chain.NextBlockTemplate()
+		if err != nil {
+			t.Fatalf("failed to get next block template: %v", err)
+		}
+		outs := g.OldestCoinbaseOuts()
+		blockName := fmt.Sprintf("bnbt%d", i)
+		g.NextBlock(blockName, nil, outs[1:])
+		checkNextBlock(info, blockName)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+}
+
+// TestCheckUtxoConsistency ensures the utxo set consistency check passes for a
+// consistent database and detects both a stored best block hash that does not
+// match the current best block and a utxo set that does not match the tracked
+// stats.
+func TestCheckUtxoConsistency(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "checkutxoconsistencytest")
+	defer teardownFunc()
+
+	// Create a few blocks and ensure the check passes.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	if err := g.chain.CheckUtxoConsistency(); err != nil {
+		t.Fatalf("unexpected consistency check error: %v", err)
+	}
+
+	// Modify the stored best block hash and ensure the check fails.
+	db := g.chain.db
+	var origState []byte
+	err := db.View(func(dbTx database.Tx) error {
+		serialized := dbTx.Metadata().Get(dbnamespace.ChainStateKeyName)
+		origState = append([]byte(nil), serialized...)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to load best chain state: %v", err)
+	}
+	state, err := deserializeBestChainState(origState)
+	if err != nil {
+		t.Fatalf("failed to deserialize best chain state: %v", err)
+	}
+	state.hash = g.BlockByName("b1").BlockHash()
+	putState := func(serialized []byte) {
+		t.Helper()
+		err := db.Update(func(dbTx database.Tx) error {
+			return dbTx.Metadata().Put(dbnamespace.ChainStateKeyName,
+				serialized)
+		})
+		if err != nil {
+			t.Fatalf("failed to store best chain state: %v", err)
+		}
+	}
+	putState(serializeBestChainState(state))
+	err = g.chain.CheckUtxoConsistency()
+	if _, ok := err.(CorruptDatabaseError); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want %T", err, err,
+			CorruptDatabaseError(""))
+	}
+
+	// Ensure the check passes again once the original state is restored.
+	putState(origState)
+	if err := g.chain.CheckUtxoConsistency(); err != nil {
+		t.Fatalf("unexpected consistency check error: %v", err)
+	}
+
+	// Remove the utxo entry for the coinbase of the parent of the tip block
+	// and ensure the check fails even though the stored stats still match.
+	coinbaseHash := g.BlockByName("b1").Transactions[0].TxHash()
+	err = db.Update(func(dbTx database.Tx) error {
+		bucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		return bucket.Delete(coinbaseHash[:])
+	})
+	if err != nil {
+		t.Fatalf("failed to remove utxo entry: %v", err)
+	}
+	err = g.chain.CheckUtxoConsistency()
+	if _, ok := err.(CorruptDatabaseError); !ok {
+		t.Fatalf("unexpected error -- got %v (%T), want %T", err, err,
+			CorruptDatabaseError(""))
+	}
+}
+
+// TestUtxoSetHash ensures the utxo set commitment is deterministic and returns
+// to the same value after connecting and disconnecting a block.
+func TestUtxoSetHash(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "utxosethashtest")
+	defer teardownFunc()
+
+	// utxoSetHash returns the current utxo set commitment.
+	utxoSetHash := func() chainhash.Hash {
+		t.Helper()
+		hash, err := g.chain.UtxoSetHash()
+		if err != nil {
+			t.Fatalf("failed to calculate utxo set hash: %v", err)
+		}
+		return hash
+	}
+
+	// Advance to stake validation height so the utxo set includes regular
+	// outputs as well as tickets and ensure the commitment is stable.
+	g.AdvanceToStakeValidationHeight()
+	origHash := utxoSetHash()
+	if hash := utxoSetHash(); hash != origHash {
+		t.Fatalf("unstable utxo set hash -- got %v, want %v", hash,
+			origHash)
+	}
+
+	// Connect a block that spends a regular output, votes with tickets,
+	// and purchases new tickets and ensure the commitment changes.
+	//
+	//   ... -> bsv# -> b0
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("b0", &outs[0], outs[1:])
+	g.AcceptTipBlock()
+	if hash := utxoSetHash(); hash == origHash {
+		t.Fatal("utxo set hash did not change after connecting a block")
+	}
+
+	// Disconnect the block and ensure the commitment returns to the
+	// original value.
+	if err := g.chain.DisconnectTip(); err != nil {
+		t.Fatalf("failed to disconnect tip: %v", err)
+	}
+	if hash := utxoSetHash(); hash != origHash {
+		t.Fatalf("unexpected utxo set hash after disconnect -- got %v, "+
+			"want %v", hash, origHash)
+	}
+}
+
+// TestUtxoSnapshot ensures writing a utxo snapshot and loading it to repair the
+// utxo set restores it with the expected commitment and that snapshots which do
+// not match the expected commitment or are not for the best chain tip, including
+// blocks only known by their header, are rejected without modifying the utxo
+// set.
+func TestUtxoSnapshot(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "utxosnapshottest")
+	defer teardownFunc()
+
+	// utxoSetHash returns the current utxo set commitment.
+	utxoSetHash := func() chainhash.Hash {
+		t.Helper()
+		hash, err := g.chain.UtxoSetHash()
+		if err != nil {
+			t.Fatalf("failed to calculate utxo set hash: %v", err)
+		}
+		return hash
+	}
+
+	// Create a few blocks and write a snapshot of the utxo set.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	var snapshot bytes.Buffer
+	snapHash, commitment, err := g.chain.WriteUtxoSnapshot(&snapshot)
+	if err != nil {
+		t.Fatalf("failed to write utxo snapshot: %v", err)
+	}
+	tipHash := g.Tip().BlockHash()
+	if snapHash != tipHash {
+		t.Fatalf("unexpected snapshot block -- got %v, want %v", snapHash,
+			tipHash)
+	}
+	if hash := utxoSetHash(); commitment != hash {
+		t.Fatalf("unexpected snapshot commitment -- got %v, want %v",
+			commitment, hash)
+	}
+	origState := g.chain.BestSnapshot()
+
+	// Remove an entry from the utxo set to simulate corruption.
+	err = g.chain.db.Update(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		cursor := utxoBucket.Cursor()
+		if !cursor.First() {
+			return errors.New("utxo set is empty")
+		}
+		return utxoBucket.Delete(cursor.Key())
+	})
+	if err != nil {
+		t.Fatalf("failed to remove utxo entry: %v", err)
+	}
+	corruptHash := utxoSetHash()
+	if corruptHash == commitment {
+		t.Fatal("utxo set hash did not change after removing an entry")
+	}
+
+	// Add the header of the next block to the block index so loading the
+	// snapshot at a block that is only known by its header can be tested.
+	//
+	//   ... -> b2 -> b3 (header only)
+	g.NextBlock("b3", nil, nil)
+	b3Hash := g.Tip().BlockHash()
+	_, err = g.chain.ProcessBlockHeaders([]*wire.BlockHeader{&g.Tip().Header})
+	if err != nil {
+		t.Fatalf("failed to process header: %v", err)
+	}
+
+	// Ensure snapshots that are invalid or do not match are rejected
+	// without modifying the utxo set.
+	serialized := snapshot.Bytes()
+	b1Hash := g.BlockByName("b1").BlockHash()
+	unknownHash := chainhash.Hash{0x01}
+	tests := []struct {
+		name     string
+		snapshot []byte
+		atHash   chainhash.Hash
+		expected chainhash.Hash
+	}{
+		{"wrong commitment", serialized, tipHash, corruptHash},
+		{"not the tip", serialized, b1Hash, commitment},
+		{"header only", serialized, b3Hash, commitment},
+		{"unknown block", serialized, unknownHash, commitment},
+		{"truncated", serialized[:len(serialized)-1], tipHash, commitment},
+	}
+	for _, test := range tests {
+		err := g.chain.LoadUtxoSnapshot(bytes.NewReader(test.snapshot),
+			&test.atHash, test.expected)
+		if err == nil {
+			t.Fatalf("%s: did not receive expected error", test.name)
+		}
+		if hash := utxoSetHash(); hash != corruptHash {
+			t.Fatalf("%s: utxo set modified by rejected snapshot",
+				test.name)
+		}
+	}
+
+	// Ensure repairing the utxo set from the snapshot restores the utxo set
+	// and its stats.
+	err = g.chain.LoadUtxoSnapshot(bytes.NewReader(serialized), &tipHash,
+		commitment)
+	if err != nil {
+		t.Fatalf("failed to load utxo snapshot: %v", err)
+	}
+	if hash := utxoSetHash(); hash != commitment {
+		t.Fatalf("unexpected utxo set hash after repair -- got "+
+			"%v, want %v", hash, commitment)
+	}
+	state := g.chain.BestSnapshot()
+	if state.NumUtxos != origState.NumUtxos ||
+		state.UtxoAmount != origState.UtxoAmount {
+
+		t.Fatalf("unexpected utxo set stats -- got (%d, %d), want (%d, %d)",
+			state.NumUtxos, state.UtxoAmount, origState.NumUtxos,
+			origState.UtxoAmount)
+	}
+	if err := g.chain.CheckUtxoConsistency(); err != nil {
+		t.Fatalf("unexpected consistency check error: %v", err)
+	}
+
+	// Ensure the chain continues to work with the repaired utxo set.
+	//
+	//   ... -> b2 -> b3
+	g.AcceptTipBlock()
+}
+
+// TestHeadersByHashes ensures the headers for a list of hashes are returned in
+// order and that an error identifying the first unknown hash is returned when
+// the list contains unknown hashes.
+func TestHeadersByHashes(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "headersbyhashestest")
+	defer teardownFunc()
+
+	// Create a forked chain.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	// Ensure the headers for both main and side chain blocks are returned
+	// in the requested order.
+	var hashes []*chainhash.Hash
+	var want []wire.BlockHeader
+	for _, name := range []string{"b2a", "bp", "b2", "b1"} {
+		block := g.BlockByName(name)
+		hash := block.BlockHash()
+		hashes = append(hashes, &hash)
+		want = append(want, block.Header)
+	}
+	headers, err := g.chain.HeadersByHashes(hashes)
+	if err != nil {
+		t.Fatalf("unexpected error fetching headers: %v", err)
+	}
+	if !reflect.DeepEqual(headers, want) {
+		t.Fatalf("unexpected headers -- got %v, want %v", headers, want)
+	}
+
+	// Ensure an error that identifies the first unknown hash is returned
+	// when known and unknown hashes are mixed.
+	unknown1, unknown2 := &chainhash.Hash{0x01}, &chainhash.Hash{0x02}
+	mixed := []*chainhash.Hash{hashes[0], unknown1, hashes[1], unknown2}
+	headers, err = g.chain.HeadersByHashes(mixed)
+	if err == nil {
+		t.Fatalf("did not receive error for unknown hash -- got headers %v",
+			headers)
+	}
+	if !strings.Contains(err.Error(), unknown1.String()) {
+		t.Fatalf("error does not identify first unknown hash %v: %v",
+			unknown1, err)
+	}
+}
+
+// TestSnapshotRestoreState ensures a chain instance restored from a snapshot
+// has the main chain rewound to the state when the snapshot was taken.
+func TestSnapshotRestoreState(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "snapshotrestoretest")
+	defer teardownFunc()
+
+	// Create a few blocks and take a snapshot.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	snap, err := g.chain.SnapshotState()
+	if err != nil {
+		t.Fatalf("failed to snapshot chain state: %v", err)
+	}
+	want := *g.chain.BestSnapshot()
+
+	// Mutate the chain by extending it.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	g.NextBlock("b3", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b4", nil, nil)
+	g.AcceptTipBlock()
+
+	// Restore the chain state from the snapshot and ensure the best state
+	// matches the one when the snapshot was taken.
+	chain, err := RestoreState(&Config{
+		ChainParams: g.chain.chainParams,
+		TimeSource:  NewMedianTime(),
+	}, snap)
+	if err != nil {
+		t.Fatalf("failed to restore chain state: %v", err)
+	}
+	g.chain = chain
+	g.ExpectTip("b2")
+	if got := *chain.BestSnapshot(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected best state after restore -- got %+v, want %+v",
+			got, want)
+	}
+
+	// Ensure the blocks created after the snapshot remain known on a side
+	// chain and the restored main chain can be extended again.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3a
+	//                            \-> b3 -> b4
+	for _, name := range []string{"b3", "b4"} {
+		hash := g.BlockByName(name).BlockHash()
+		if have, err := chain.HaveBlock(&hash); err != nil || !have {
+			t.Fatalf("block %s is not known after restore (err %v)", name,
+				err)
+		}
+		if chain.MainChainHasBlock(&hash) {
+			t.Fatalf("block %s is in the main chain after restore", name)
+		}
+	}
+	g.SetTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.AcceptTipBlock()
+
+	// Ensure restoring from a snapshot that refers to an unknown block fails
+	// and stops the background block index flushing of the chain instance
+	// that was created for it.
+	snap, err = chain.SnapshotState()
+	if err != nil {
+		t.Fatalf("failed to snapshot chain state: %v", err)
+	}
+	snap.nodes = append(snap.nodes, chainhash.Hash{0x01})
+	numGoroutines := runtime.NumGoroutine()
+	_, err = RestoreState(&Config{
+		ChainParams:        g.chain.chainParams,
+		TimeSource:         NewMedianTime(),
+		IndexFlushInterval: time.Hour,
+	}, snap)
+	if err == nil {
+		t.Fatal("restored chain state with an unknown block")
+	}
+	if got := runtime.NumGoroutine(); got > numGoroutines {
+		t.Fatalf("leaked goroutines after failed restore -- got %d, "+
+			"want %d", got, numGoroutines)
+	}
+}
+
+// TestIndexStats ensures the statistics about the shape of the block index
+// are reported as expected on a forked chain.
+func TestIndexStats(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3 -> 4 -> 5 -> 6
+	// 	                 \-> 3a -> 4a -> 5a
+	// 	                      \-> 4b
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 6)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[1], 3)
+	branch2Nodes := chainedFakeNodes(branch1Nodes[0], 1)
+	for _, node := range branch0Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch1Nodes {
+		chain.index.AddNode(node)
+	}
+	for _, node := range branch2Nodes {
+		chain.index.AddNode(node)
+	}
+	chain.bestChain.SetTip(branchTip(branch0Nodes))
+
+	// Mark the tip of the second side chain as invalid.
+	chain.index.SetStatusFlags(branchTip(branch2Nodes), statusValidateFailed)
+
+	want := IndexStats{
+		NumNodes:     11,
+		NumTips:      3,
+		MaxBranchLen: 3,
+		NumInvalid:   1,
+	}
+	if got := chain.IndexStats(); got != want {
+		t.Fatalf("unexpected index stats -- got %+v, want %+v", got, want)
+	}
+}
+
+// TestSideChainBlocks ensures all side chain blocks that descend from a main
+// chain block are returned in height order.
+func TestSideChainBlocks(t *testing.T) {
+	// Construct a synthetic block chain with a block index consisting of
+	// the following structure.
+	// 	genesis -> 1 -> 2 -> 3 -> 4 -> 5 -> 6
+	// 	            \     \-> 3a -> 4a -> 5a
+	// 	             \          \-> 4b
+	// 	              \-> 2c
+	chain := newFakeChain(&chaincfg.MainNetParams)
+	branch0Nodes := chainedFakeNodes(chain.bestChain.Genesis(), 6)
+	branch1Nodes := chainedFakeNodes(branch0Nodes[1], 3)
+	branch2Nodes := chainedFakeNodes(branch1Nodes[0], 1)
+	branch3Nodes := chainedFakeNodes(branch0Nodes[0], 1)
+	for _, nodes := range [][]*blockNode{branch0Nodes, branch1Nodes,
+		branch2Nodes, branch3Nodes} {
+
+		for _, node := range nodes {
+			chain.index.AddNode(node)
+		}
 	}
+	chain.bestChain.SetTip(branchTip(branch0Nodes))
+	unknownNode := newFakeNode(nil, 0, 0, 0, time.Now())
+
+	// hashesOf returns the hashes of the provided nodes sorted by height.
+	hashesOf := func(nodes ...*blockNode) []chainhash.Hash {
+		sort.Sort(nodeHeightSorter(nodes))
+		hashes := make([]chainhash.Hash, 0, len(nodes))
+		for _, node := range nodes {
+			hashes = append(hashes, node.hash)
+		}
+		return hashes
+	}
+
+	tests := []struct {
+		name    string
+		fork    chainhash.Hash   // fork point to query
+		wantErr bool             // whether an error is expected
+		want    []chainhash.Hash // expected side chain blocks
+	}{{
+		name: "fork with two side branches",
+		fork: branch0Nodes[1].hash,
+		want: hashesOf(branch1Nodes[0], branch1Nodes[1], branch2Nodes[0],
+			branch1Nodes[2]),
+	}, {
+		name: "earlier fork includes later branches",
+		fork: branch0Nodes[0].hash,
+		want: hashesOf(branch3Nodes[0], branch1Nodes[0], branch1Nodes[1],
+			branch2Nodes[0], branch1Nodes[2]),
+	}, {
+		name: "no side branches",
+		fork: branch0Nodes[2].hash,
+		want: hashesOf(),
+	}, {
+		name:    "side chain block",
+		fork:    branch1Nodes[0].hash,
+		wantErr: true,
+	}, {
+		name:    "unknown block",
+		fork:    unknownNode.hash,
+		wantErr: true,
+	}}
+
 	for _, test := range tests {
-		// Ensure the expected headers are located.
-		var headers []wire.BlockHeader
-		if test.maxAllowed != 0 {
-			// Need to use the unexported function to override the
-			// max allowed for headers.
-			chain.chainLock.RLock()
-			headers = chain.locateHeaders(test.locator,
-				&test.hashStop, test.maxAllowed)
-			chain.chainLock.RUnlock()
-		} else {
-			headers = chain.LocateHeaders(test.locator,
-				&test.hashStop)
+		got, err := chain.SideChainBlocks(&test.fork)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: did not receive expected error", test.name)
+			}
+			continue
 		}
-		if !reflect.DeepEqual(headers, test.headers) {
-			t.Errorf("%s: unxpected headers -- got %v, want %v",
-				test.name, headers, test.headers)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
 			continue
 		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: unexpected side chain blocks -- got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+}
 
-		// Ensure the expected block hashes are located.
-		maxAllowed := uint32(wire.MaxBlocksPerMsg)
-		if test.maxAllowed != 0 {
-			maxAllowed = test.maxAllowed
+// TestProcessBlockWithView ensures processing blocks with a provided utxo view
+// produces identical results to processing them without one.
+func TestProcessBlockWithView(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// along with a second chain instance that processes the same blocks
+	// without a provided view for comparison.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "processwithviewtest")
+	defer teardownFunc()
+	refChain, refTeardownFunc, err := chainSetup("processwithviewreftest",
+		params)
+	if err != nil {
+		t.Fatalf("failed to setup reference chain instance: %v", err)
+	}
+	defer refTeardownFunc()
+
+	// processRef processes the current tip block of the harness generator
+	// with the reference chain instance.
+	processRef := func() error {
+		block := dcrutil.NewBlock(g.Tip())
+		_, _, err := refChain.ProcessBlock(block, BFNone)
+		return err
+	}
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	if err := processRef(); err != nil {
+		t.Fatalf("failed to process block bp: %v", err)
+	}
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bm%d", i)
+		g.NextBlock(blockName, nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+		if err := processRef(); err != nil {
+			t.Fatalf("failed to process block %s: %v", blockName, err)
 		}
-		hashes := chain.LocateBlocks(test.locator, &test.hashStop,
-			maxAllowed)
-		if !reflect.DeepEqual(hashes, test.hashes) {
-			t.Errorf("%s: unxpected hashes -- got %v, want %v",
-				test.name, hashes, test.hashes)
-			continue
+	}
+
+	// viewForTip returns a view for the current main chain tip populated
+	// with all of the utxos referenced by the current tip block of the
+	// harness generator.
+	viewForTip := func() *UtxoViewpoint {
+		msgBlock := g.Tip()
+		txNeededSet := make(map[chainhash.Hash]struct{})
+		for _, tx := range msgBlock.Transactions[1:] {
+			for _, txIn := range tx.TxIn {
+				txNeededSet[txIn.PreviousOutPoint.Hash] = struct{}{}
+			}
+		}
+		view := NewUtxoViewpoint()
+		view.SetBestHash(&g.chain.BestSnapshot().Hash)
+		if err := view.fetchUtxosMain(g.chain.db, txNeededSet); err != nil {
+			t.Fatalf("failed to fetch utxos: %v", err)
+		}
+		if len(view.entries) == 0 {
+			t.Fatal("view does not contain any entries")
+		}
+		return view
+	}
+
+	// Create blocks that spend the mature coinbase outputs and process them
+	// with a view for the current tip as well as a view for a different
+	// block that must be ignored.
+	//
+	//   ... -> bm# -> b0 -> b1
+	tests := []struct {
+		name      string
+		blockName string
+		staleView bool
+	}{
+		{"view for tip", "b0", false},
+		{"view for other block", "b1", true},
+	}
+	var spentOuts []chaingen.SpendableOut
+	for _, test := range tests {
+		outs := g.OldestCoinbaseOuts()
+		spentOuts = append(spentOuts, outs[0])
+		g.NextBlock(test.blockName, &outs[0], nil)
+		view := viewForTip()
+		if test.staleView {
+			view.SetBestHash(&chainhash.Hash{0x01})
+		}
+		numEntries := len(view.entries)
+
+		block := dcrutil.NewBlock(g.Tip())
+		forkLen, isOrphan, err := g.chain.ProcessBlockWithView(block, view,
+			BFNone)
+		if err != nil {
+			t.Fatalf("%q: failed to process block: %v", test.name, err)
+		}
+		if forkLen != 0 || isOrphan {
+			t.Fatalf("%q: unexpected result -- got fork len %d, orphan %v",
+				test.name, forkLen, isOrphan)
+		}
+		g.ExpectTip(test.blockName)
+		if err := processRef(); err != nil {
+			t.Fatalf("%q: failed to process reference block: %v",
+				test.name, err)
+		}
+
+		// Ensure the provided view was not modified.
+		if len(view.entries) != numEntries {
+			t.Fatalf("%q: provided view modified -- got %d entries, want "+
+				"%d", test.name, len(view.entries), numEntries)
+		}
+		for txHash, entry := range view.entries {
+			if entry.modified || entry.IsFullySpent() {
+				t.Fatalf("%q: provided view entry %v modified", test.name,
+					txHash)
+			}
+		}
+
+		// Ensure the resulting chain state matches the reference.
+		got, want := g.chain.BestSnapshot(), refChain.BestSnapshot()
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%q: mismatched best state -- got %+v, want %+v",
+				test.name, got, want)
+		}
+		for txHash := range view.entries {
+			gotEntry, err := g.chain.FetchUtxoEntry(&txHash)
+			if err != nil {
+				t.Fatalf("%q: failed to fetch utxo: %v", test.name, err)
+			}
+			wantEntry, err := refChain.FetchUtxoEntry(&txHash)
+			if err != nil {
+				t.Fatalf("%q: failed to fetch utxo: %v", test.name, err)
+			}
+			if !reflect.DeepEqual(gotEntry, wantEntry) {
+				t.Fatalf("%q: mismatched utxo entry for %v -- got %+v, "+
+					"want %+v", test.name, txHash, gotEntry, wantEntry)
+			}
+		}
+	}
+
+	// Ensure a block that spends an output that is already spent is
+	// rejected identically with a view for the current tip.
+	//
+	//   ... -> b1 -> b2bad
+	g.NextBlock("b2bad", &spentOuts[0], nil)
+	view := viewForTip()
+	block := dcrutil.NewBlock(g.Tip())
+	_, _, err = g.chain.ProcessBlockWithView(block, view, BFNone)
+	refErr := processRef()
+	gotErr, ok := err.(RuleError)
+	if !ok {
+		t.Fatalf("unexpected error type -- got %v (%T), want RuleError",
+			err, err)
+	}
+	wantErr, ok := refErr.(RuleError)
+	if !ok || gotErr.ErrorCode != wantErr.ErrorCode {
+		t.Fatalf("mismatched rejection -- got %v, want %v", err, refErr)
+	}
+	g.ExpectTip("b1")
+}
+
+// TestFetchUtxoViewForTxns ensures the view returned for a set of transactions
+// contains exactly the entries referenced by their inputs.
+func TestFetchUtxoViewForTxns(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "fetchutxoviewtxnstest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+
+	// Create transactions that spend outputs from a couple of different
+	// coinbases along with one that spends an output that does not exist.
+	outs1 := g.OldestCoinbaseOuts()
+	outs2 := g.OldestCoinbaseOuts()
+	tx1 := g.CreateSpendTx(&outs1[0], 0)
+	tx2 := g.CreateSpendTx(&outs2[0], 0)
+	tx3 := g.CreateSpendTx(&outs1[1], 0)
+	unknownHash := chainhash.Hash{0x01}
+	tx3.TxIn[0].PreviousOutPoint.Hash = unknownHash
+	txns := []*dcrutil.Tx{dcrutil.NewTx(tx1), dcrutil.NewTx(tx2),
+		dcrutil.NewTx(tx3)}
+
+	view, err := g.chain.FetchUtxoViewForTxns(txns)
+	if err != nil {
+		t.Fatalf("unexpected error fetching view: %v", err)
+	}
+	if *view.BestHash() != g.chain.BestSnapshot().Hash {
+		t.Fatalf("unexpected view best hash -- got %v, want %v",
+			view.BestHash(), g.chain.BestSnapshot().Hash)
+	}
+
+	// Ensure the view only contains the referenced entries with the
+	// unknown one being nil.
+	outPoint1, outPoint2 := outs1[0].PrevOut(), outs2[0].PrevOut()
+	wantKnown := []chainhash.Hash{outPoint1.Hash, outPoint2.Hash}
+	if len(view.entries) != len(wantKnown)+1 {
+		t.Fatalf("unexpected number of view entries -- got %d, want %d",
+			len(view.entries), len(wantKnown)+1)
+	}
+	for _, txHash := range wantKnown {
+		entry := view.LookupEntry(&txHash)
+		if entry == nil {
+			t.Fatalf("view does not contain entry for %v", txHash)
+		}
+		if entry.IsFullySpent() {
+			t.Fatalf("view entry for %v is spent", txHash)
+		}
+	}
+	if entry, ok := view.entries[unknownHash]; !ok || entry != nil {
+		t.Fatalf("unexpected entry for unknown hash -- got %v (present %v)",
+			entry, ok)
+	}
+}
+
+// TestOutpointSpentAt ensures whether or not an outpoint was spent as of a
+// given main chain height, and by which transaction, is reported correctly.
+func TestOutpointSpentAt(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "outpointspentattest")
+	defer teardownFunc()
+
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := uint16(0); i < params.CoinbaseMaturity; i++ {
+		g.NextBlock(fmt.Sprintf("bm%d", i), nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+
+	// Create a block that spends an output of the first coinbase followed
+	// by a couple more blocks.
+	//
+	//   ... -> bm# -> bs -> b1 -> b2
+	outs := g.OldestCoinbaseOuts()
+	g.NextBlock("bs", &outs[0], nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+
+	// Determine the spending transaction.
+	op := outs[0].PrevOut()
+	spendBlock := dcrutil.NewBlock(g.BlockByName("bs"))
+	spendTx := spenderOfOutpoint(spendBlock.Transactions(), &op)
+	if spendTx == nil {
+		t.Fatal("unable to find spending transaction")
+	}
+
+	createHeight := int64(g.BlockByName("bm0").Header.Height)
+	spendHeight := int64(spendBlock.MsgBlock().Header.Height)
+	tipHeight := g.chain.BestSnapshot().Height
+	tests := []struct {
+		name      string
+		height    int64
+		wantSpent bool
+	}{
+		{"before creation", createHeight - 1, false},
+		{"at creation", createHeight, false},
+		{"before spend", spendHeight - 1, false},
+		{"at spend", spendHeight, true},
+		{"at tip", tipHeight, true},
+	}
+	for _, test := range tests {
+		spent, spender, err := g.chain.OutpointSpentAt(op, test.height)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", test.name, err)
+		}
+		if spent != test.wantSpent {
+			t.Fatalf("%q: unexpected spent status -- got %v, want %v",
+				test.name, spent, test.wantSpent)
+		}
+		if !test.wantSpent && spender != nil {
+			t.Fatalf("%q: unexpected spender %v", test.name, spender)
+		}
+		if test.wantSpent && (spender == nil || *spender != *spendTx) {
+			t.Fatalf("%q: unexpected spender -- got %v, want %v",
+				test.name, spender, spendTx)
+		}
+	}
+
+	// Ensure heights beyond the tip are rejected.
+	_, _, err := g.chain.OutpointSpentAt(op, tipHeight+1)
+	if !isNotInMainChainErr(err) {
+		t.Fatalf("unexpected error for height beyond tip -- got %v", err)
+	}
+}
+
+// TestIndexFlushInterval ensures block index changes are deferred when the
+// block index is flushed in the background and that they are persisted by
+// closing the chain instance.
+func TestIndexFlushInterval(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// and defer flushing the block index.  The interval is long enough that
+	// the background flush never happens during the test.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "indexflushtest")
+	defer teardownFunc()
+	g.chain.indexFlushInterval = time.Hour
+
+	// indexEntryStored returns whether or not the block index entry for the
+	// named block is stored in the database.
+	indexEntryStored := func(name string) bool {
+		t.Helper()
+		header := g.BlockByName(name).Header
+		hash := header.BlockHash()
+		key := blockIndexKey(&hash, header.Height)
+		var stored bool
+		err := g.chain.db.View(func(dbTx database.Tx) error {
+			bucket := dbTx.Metadata().Bucket(dbnamespace.BlockIndexBucketName)
+			stored = bucket.Get(key) != nil
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to query block index: %v", err)
+		}
+		return stored
+	}
+
+	// Create a chain with a side chain block that is never connected.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	// Ensure the entries for the connected blocks are stored along with the
+	// best state while the side chain block is still pending.
+	for _, name := range []string{"bp", "b1", "b2"} {
+		if !indexEntryStored(name) {
+			t.Fatalf("block index entry for connected block %s is not "+
+				"stored", name)
+		}
+	}
+	if indexEntryStored("b2a") {
+		t.Fatal("block index entry for side chain block was not deferred")
+	}
+	if len(g.chain.index.modified) == 0 {
+		t.Fatal("no pending block index changes")
+	}
+
+	// Ensure closing the chain instance persists the pending changes and
+	// that they are loaded by a new chain instance.
+	if err := g.chain.Close(); err != nil {
+		t.Fatalf("failed to close chain instance: %v", err)
+	}
+	if len(g.chain.index.modified) != 0 {
+		t.Fatalf("unexpected pending block index changes after close -- "+
+			"got %d", len(g.chain.index.modified))
+	}
+	if !indexEntryStored("b2a") {
+		t.Fatal("block index entry for side chain block was not stored")
+	}
+	chain, err := New(&Config{
+		DB:                 g.chain.db,
+		ChainParams:        g.chain.chainParams,
+		TimeSource:         NewMedianTime(),
+		IndexFlushInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("failed to create chain instance: %v", err)
+	}
+	defer chain.Close()
+	b2aHash := g.BlockByName("b2a").BlockHash()
+	b2aNode := chain.index.LookupNode(&b2aHash)
+	if b2aNode == nil {
+		t.Fatal("side chain block is not known after reload")
+	}
+	g.chain = chain
+	g.ExpectTip("b2")
+
+	// Ensure changes are flushed by the background flushing.
+	chain.index.SetStatusFlags(b2aNode, statusValid)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		chain.index.RLock()
+		numModified := len(chain.index.modified)
+		chain.index.RUnlock()
+		if numModified == 0 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timeout waiting for background block index flush")
+		}
+	}
+}
+
+// TestCountSpentOutputs ensures the number of outputs spent by a block is
+// counted as expected for blocks with votes and revocations and that the
+// regular transaction tree of the parent is only counted when it is approved.
+func TestCountSpentOutputs(t *testing.T) {
+	params := &chaincfg.RegNetParams
+	g, err := chaingen.MakeGenerator(params)
+	if err != nil {
+		t.Fatalf("failed to create generator: %v", err)
+	}
+
+	// newSpendTx returns a transaction with the given number of inputs that
+	// spend made up outputs.
+	newSpendTx := func(numInputs int) *wire.MsgTx {
+		tx := wire.NewMsgTx()
+		for i := 0; i < numInputs; i++ {
+			prevOut := wire.NewOutPoint(&chainhash.Hash{0x01}, uint32(i),
+				wire.TxTreeRegular)
+			tx.AddTxIn(wire.NewTxIn(prevOut, 1e10, nil))
+		}
+		tx.AddTxOut(wire.NewTxOut(1e10, []byte{txscript.OP_TRUE}))
+		return tx
+	}
+
+	// Create a parent block with a coinbase and regular transactions that
+	// spend three outputs in total.
+	parent := &wire.MsgBlock{
+		Header: wire.BlockHeader{Height: 1},
+		Transactions: []*wire.MsgTx{
+			g.CreateCoinbaseTx(1, 0),
+			newSpendTx(1),
+			newSpendTx(2),
+		},
+	}
+
+	// Create a ticket purchase along with a vote and revocation that spend
+	// it.  Each of them spends a single output.
+	fundTx := newSpendTx(1)
+	fundOut := chaingen.MakeSpendableOutForTx(fundTx, 1, 1, 0)
+	ticket := g.CreateTicketPurchaseTx(&fundOut, 1e8, 0)
+	vote := g.CreateVoteTx(parent, ticket, 1, 0)
+	revocation := g.CreateRevocationTx(ticket, 1, 0)
+	for _, test := range []struct {
+		tx   *wire.MsgTx
+		want stake.TxType
+	}{
+		{ticket, stake.TxTypeSStx},
+		{vote, stake.TxTypeSSGen},
+		{revocation, stake.TxTypeSSRtx},
+	} {
+		if txType := stake.DetermineTxType(test.tx); txType != test.want {
+			t.Fatalf("unexpected tx type -- got %v, want %v", txType,
+				test.want)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		voteBits uint16
+		stxns    []*wire.MsgTx
+		want     int
+	}{{
+		name:     "approved parent without stake txns",
+		voteBits: dcrutil.BlockValid,
+		want:     3,
+	}, {
+		name:     "approved parent with vote and revocation",
+		voteBits: dcrutil.BlockValid,
+		stxns:    []*wire.MsgTx{ticket, vote, revocation},
+		want:     6,
+	}, {
+		name:     "disapproved parent with vote and revocation",
+		voteBits: 0,
+		stxns:    []*wire.MsgTx{ticket, vote, revocation},
+		want:     3,
+	}, {
+		name:     "disapproved parent without stake txns",
+		voteBits: 0,
+		want:     0,
+	}}
+	for _, test := range tests {
+		block := &wire.MsgBlock{
+			Header: wire.BlockHeader{
+				Height:   2,
+				VoteBits: test.voteBits,
+			},
+			Transactions:  []*wire.MsgTx{g.CreateCoinbaseTx(2, 0)},
+			STransactions: test.stxns,
+		}
+		got := CountSpentOutputs(dcrutil.NewBlock(block),
+			dcrutil.NewBlock(parent))
+		if got != test.want {
+			t.Errorf("%q: unexpected number of spent outputs -- got %d, "+
+				"want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// TestGenesis ensures the genesis block returned by the chain matches the one
+// defined by the chain parameters.
+func TestGenesis(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "genesistest")
+	defer teardownFunc()
+
+	// Ensure the genesis block is still reported after extending the chain.
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	hash, block := g.chain.Genesis()
+	if *hash != *params.GenesisHash {
+		t.Fatalf("unexpected genesis hash -- got %v, want %v", hash,
+			params.GenesisHash)
+	}
+	if block == nil || *block.Hash() != *params.GenesisHash {
+		t.Fatalf("unexpected genesis block -- got %v, want %v", block,
+			params.GenesisHash)
+	}
+	if block.Height() != 0 {
+		t.Fatalf("unexpected genesis block height %d", block.Height())
+	}
+}
+
+// TestParentBlock ensures fetching the parent of a block works as expected for
+// both main chain and side chain blocks and that it fails for the genesis block
+// and unknown blocks.
+func TestParentBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "parentblocktest")
+	defer teardownFunc()
+
+	// Create a main chain and a side chain that forks from it.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                      \-> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.SetTip("b1")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+
+	tests := []struct {
+		name   string // block name
+		parent string // expected parent block name
+	}{
+		{name: "bp", parent: "genesis"},
+		{name: "b2", parent: "b1"},
+		{name: "b2a", parent: "b1"},
+	}
+	for _, test := range tests {
+		hash := g.BlockByName(test.name).BlockHash()
+		parent, err := g.chain.ParentBlock(&hash)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+		wantHash := *params.GenesisHash
+		if test.parent != "genesis" {
+			wantHash = g.BlockByName(test.parent).BlockHash()
+		}
+		if *parent.Hash() != wantHash {
+			t.Fatalf("%s: unexpected parent -- got %v, want %v",
+				test.name, parent.Hash(), wantHash)
+		}
+	}
+
+	// Ensure the genesis block and unknown blocks are rejected.
+	if _, err := g.chain.ParentBlock(params.GenesisHash); err == nil {
+		t.Fatal("did not receive expected error for genesis block")
+	}
+	unknownHash := chainhash.Hash{0x01}
+	if _, err := g.chain.ParentBlock(&unknownHash); err == nil {
+		t.Fatal("did not receive expected error for unknown block")
+	}
+}
+
+// TestPruneInvalidSubtrees ensures the blocks that descend from a block which
+// failed validation are pruned from the block index when the option is enabled
+// while resubmitting them, or blocks that build on them, is still rejected.
+func TestPruneInvalidSubtrees(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "pruneinvalidsubtreestest")
+	defer teardownFunc()
+	g.chain.pruneInvalidSubtrees = true
+
+	// Create a main chain along with a side chain that starts with a block
+	// that pays more than allowed in its coinbase and has several
+	// descendants.  The final block has more work than the main chain, so
+	// it causes a reorganize which fails when the invalid block is
+	// connected.
+	//
+	//   genesis -> bp -> b1 -> b2
+	//                \-> b1a -> b2a -> b3a
+	//                        \-> b2b
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil, func(b *wire.MsgBlock) {
+		b.Transactions[0].TxOut[2].Value++
+	})
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b2b", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.SetTip("b1a")
+	g.NextBlock("b2a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.RejectTipBlock(ErrBadCoinbaseValue)
+	g.ExpectTip("b2")
+
+	// Ensure the invalid block remains in the block index as a chain tip
+	// while all of its descendants were pruned.
+	hashOf := func(blockName string) chainhash.Hash {
+		return g.BlockByName(blockName).BlockHash()
+	}
+	b1aHash := hashOf("b1a")
+	b1aNode := g.chain.index.LookupNode(&b1aHash)
+	if b1aNode == nil || !b1aNode.status.KnownInvalid() {
+		t.Fatal("invalid block is not in the block index as invalid")
+	}
+	for _, blockName := range []string{"b2a", "b2b", "b3a"} {
+		hash := hashOf(blockName)
+		if g.chain.index.LookupNode(&hash) != nil {
+			t.Fatalf("block %s was not pruned from the block index",
+				blockName)
+		}
+
+		// Ensure the pruned block is still reported as known so that it
+		// is not requested again.
+		haveBlock, err := g.chain.HaveBlock(&hash)
+		if err != nil {
+			t.Fatalf("HaveBlock: unexpected error: %v", err)
+		}
+		if !haveBlock {
+			t.Fatalf("pruned block %s is not reported as known",
+				blockName)
+		}
+	}
+	var foundInvalidTip bool
+	for _, tip := range g.chain.ChainTips() {
+		switch tip.Hash {
+		case b1aHash:
+			foundInvalidTip = true
+		case hashOf("b2b"), hashOf("b3a"):
+			t.Fatalf("pruned block %v is still a chain tip", tip.Hash)
 		}
 	}
+	if !foundInvalidTip {
+		t.Fatal("invalid block is not a chain tip")
+	}
+
+	// Ensure resubmitting the pruned blocks and submitting a block that
+	// builds on one of them is rejected.
+	//
+	//   ... -> b3a -> b4a
+	g.RejectBlock("b2b", ErrKnownInvalidBlock)
+	g.RejectBlock("b3a", ErrKnownInvalidBlock)
+	g.NextBlock("b4a", nil, nil)
+	g.RejectTipBlock(ErrInvalidAncestorBlock)
+	g.ExpectTip("b2")
 }
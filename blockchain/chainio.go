@@ -18,6 +18,7 @@ import (
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/database"
 	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
 	"github.com/decred/dcrd/wire"
 )
 
@@ -501,6 +502,46 @@ type spentTxOut struct {
 	compressed   bool // Whether or not the script is compressed.
 }
 
+// SpentTxOut houses details about a transaction output that was spent by a
+// block as recorded in the spend journal.  The contextual information about the
+// transaction that contained the output, such as its version, is only
+// populated when TxFullySpent is set.
+type SpentTxOut struct {
+	Amount        int64        // The amount of the output.
+	PkScript      []byte       // The public key script for the output.
+	ScriptVersion uint16       // The version of the scripting language.
+	StakeExtra    []byte       // Extra information for the staking system.
+	TxType        stake.TxType // The stake type of the transaction.
+	Height        uint32       // Height of the the block containing the tx.
+	Index         uint32       // Index in the block of the transaction.
+	TxVersion     uint16       // The version of creating tx.
+	TxFullySpent  bool         // Whether or not the tx is fully spent.
+	IsCoinBase    bool         // Whether creating tx is a coinbase.
+	HasExpiry     bool         // The expiry of the creating tx.
+}
+
+// newSpentTxOut returns the exported form of the passed spent txout with its
+// public key script decompressed.
+func newSpentTxOut(stxo *spentTxOut) SpentTxOut {
+	pkScript := stxo.pkScript
+	if stxo.compressed {
+		pkScript = decompressScript(pkScript, currentCompressionVersion)
+	}
+	return SpentTxOut{
+		Amount:        stxo.amount,
+		PkScript:      pkScript,
+		ScriptVersion: stxo.scriptVersion,
+		StakeExtra:    stxo.stakeExtra,
+		TxType:        stxo.txType,
+		Height:        stxo.height,
+		Index:         stxo.index,
+		TxVersion:     stxo.txVersion,
+		TxFullySpent:  stxo.txFullySpent,
+		IsCoinBase:    stxo.isCoinBase,
+		HasExpiry:     stxo.hasExpiry,
+	}
+}
+
 // spentTxOutSerializeSize returns the number of bytes it would take to
 // serialize the passed stxo according to the format described above.
 // The amount is never encoded into spent transaction outputs in Decred
@@ -1208,6 +1249,186 @@ func dbPutUtxoView(dbTx database.Tx, view *UtxoViewpoint) error {
 	return nil
 }
 
+// utxoEntryStats returns the number of unspent outputs in the passed utxo entry
+// along with their total amount.
+func utxoEntryStats(entry *UtxoEntry) (int64, int64) {
+	if entry == nil {
+		return 0, 0
+	}
+
+	var numUtxos, amount int64
+	for _, output := range entry.sparseOutputs {
+		if output.spent {
+			continue
+		}
+		numUtxos++
+		amount += output.amount
+	}
+	return numUtxos, amount
+}
+
+// blockUtxoStatsDelta returns the change in the number of unspent outputs and
+// their total amount that results from connecting the passed block to the end
+// of the main chain given the outputs it spends as described by the provided
+// spent txouts.  The change from disconnecting the block is the negation of the
+// returned values.
+//
+// The outputs created by the block are those which are not provably
+// unspendable from the regular transaction tree of the parent when the block
+// approves it along with the stake transaction tree of the block, which matches
+// the outputs connectTransactions adds to the utxo set.  This relies on the
+// outputs of the regular transaction tree of a block never being stored in the
+// utxo set until a child that approves it is connected, and it allows the
+// change to be calculated without loading the existing utxo entries from the
+// database.
+func blockUtxoStatsDelta(block, parent *dcrutil.Block, stxos []spentTxOut) (int64, int64) {
+	var numUtxos, amount int64
+	addTxOuts := func(txns []*wire.MsgTx) {
+		for _, tx := range txns {
+			for _, txOut := range tx.TxOut {
+				if txscript.IsUnspendable(txOut.Value, txOut.PkScript) {
+					continue
+				}
+				numUtxos++
+				amount += txOut.Value
+			}
+		}
+	}
+	if parent != nil && block.Height() != 0 &&
+		headerApprovesParent(&block.MsgBlock().Header) {
+
+		addTxOuts(parent.MsgBlock().Transactions)
+	}
+	addTxOuts(block.MsgBlock().STransactions)
+
+	for i := range stxos {
+		numUtxos--
+		amount -= stxos[i].amount
+	}
+	return numUtxos, amount
+}
+
+// dbCalcUtxoSetStats uses an existing database transaction to calculate the
+// number of unspent outputs and their total amount by scanning the entire utxo
+// set.
+func dbCalcUtxoSetStats(dbTx database.Tx) (int64, int64, error) {
+	var numUtxos, amount int64
+	utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+	cursor := utxoBucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return 0, 0, err
+		}
+		entryNumUtxos, entryAmount := utxoEntryStats(entry)
+		numUtxos += entryNumUtxos
+		amount += entryAmount
+	}
+
+	return numUtxos, amount, nil
+}
+
+// serializeUtxoEntryCommitment returns a canonical serialization of the unspent
+// outputs of the provided utxo entry for the transaction with the given hash
+// for use in the utxo set commitment.  Unlike the serialization used to store
+// the entry in the database, it does not depend on how the entry is compressed.
+//
+// The serialized format is:
+//
+//   <tx hash><height><index><tx version><tx type><flags><stake extra len>
+//   <stake extra><num outputs>[<output index><amount><script version>
+//   <script len><script>,...]
+//
+// All integers are little endian.  The flags field has bit 0 set for coinbase
+// transactions and bit 1 set for transactions with an expiry.  The outputs
+// are ordered by their index and only include unspent outputs.
+func serializeUtxoEntryCommitment(txHash *chainhash.Hash, entry *UtxoEntry) []byte {
+	outputIndexes := make([]int, 0, len(entry.sparseOutputs))
+	for outputIndex, output := range entry.sparseOutputs {
+		if !output.spent {
+			outputIndexes = append(outputIndexes, int(outputIndex))
+		}
+	}
+	sort.Ints(outputIndexes)
+
+	var flags byte
+	if entry.isCoinBase {
+		flags |= 1 << 0
+	}
+	if entry.hasExpiry {
+		flags |= 1 << 1
+	}
+
+	// Calculate the size needed to serialize the entry.
+	size := chainhash.HashSize + 16 + len(entry.stakeExtra) + 4
+	for _, outputIndex := range outputIndexes {
+		pkScript := entry.PkScriptByIndex(uint32(outputIndex))
+		size += 18 + len(pkScript)
+	}
+
+	le := binary.LittleEndian
+	serialized := make([]byte, size)
+	offset := copy(serialized, txHash[:])
+	le.PutUint32(serialized[offset:], entry.height)
+	le.PutUint32(serialized[offset+4:], entry.index)
+	le.PutUint16(serialized[offset+8:], entry.txVersion)
+	serialized[offset+10] = byte(entry.txType)
+	serialized[offset+11] = flags
+	le.PutUint32(serialized[offset+12:], uint32(len(entry.stakeExtra)))
+	offset += 16
+	offset += copy(serialized[offset:], entry.stakeExtra)
+	le.PutUint32(serialized[offset:], uint32(len(outputIndexes)))
+	offset += 4
+	for _, outputIndex := range outputIndexes {
+		idx := uint32(outputIndex)
+		pkScript := entry.PkScriptByIndex(idx)
+		le.PutUint32(serialized[offset:], idx)
+		le.PutUint64(serialized[offset+4:], uint64(entry.AmountByIndex(idx)))
+		le.PutUint16(serialized[offset+12:], entry.ScriptVersionByIndex(idx))
+		le.PutUint32(serialized[offset+14:], uint32(len(pkScript)))
+		offset += 18
+		offset += copy(serialized[offset:], pkScript)
+	}
+	return serialized
+}
+
+// rollUtxoSetCommitment returns the result of rolling the provided utxo entry
+// for the transaction with the given hash into the passed utxo set commitment.
+// This is done by hashing the commitment together with the hash of the
+// canonical serialization of the entry.
+func rollUtxoSetCommitment(commitment *chainhash.Hash, txHash *chainhash.Hash, entry *UtxoEntry) chainhash.Hash {
+	var buf [chainhash.HashSize * 2]byte
+	entryHash := chainhash.HashH(serializeUtxoEntryCommitment(txHash, entry))
+	copy(buf[:], commitment[:])
+	copy(buf[chainhash.HashSize:], entryHash[:])
+	return chainhash.HashH(buf[:])
+}
+
+// dbCalcUtxoSetHash uses an existing database transaction to calculate a
+// commitment to the entire utxo set by iterating it in the order of the
+// transaction hashes.  The commitment starts with the zero hash and each entry
+// is rolled into it via rollUtxoSetCommitment, so it only depends on the
+// contents of the utxo set.
+func dbCalcUtxoSetHash(dbTx database.Tx) (chainhash.Hash, error) {
+	var commitment chainhash.Hash
+	utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+	cursor := utxoBucket.Cursor()
+	for ok := cursor.First(); ok; ok = cursor.Next() {
+		txHash, err := chainhash.NewHash(cursor.Key())
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+		entry, err := deserializeUtxoEntry(cursor.Value())
+		if err != nil {
+			return chainhash.Hash{}, err
+		}
+
+		commitment = rollUtxoSetCommitment(&commitment, txHash, entry)
+	}
+
+	return commitment, nil
+}
+
 // -----------------------------------------------------------------------------
 // The database information contains information about the version and date
 // of the blockchain database.
@@ -1334,6 +1555,7 @@ func dbFetchDatabaseInfo(dbTx database.Tx) (*databaseInfo, error) {
 // The serialized format is:
 //
 //   <block hash><block height><total txns><total subsidy><work sum length><work sum>
+//   [<num utxos><utxo amount>]
 //
 //   Field             Type             Size
 //   block hash        chainhash.Hash   chainhash.HashSize
@@ -1342,6 +1564,11 @@ func dbFetchDatabaseInfo(dbTx database.Tx) (*databaseInfo, error) {
 //   total subsidy     int64            8 bytes
 //   work sum length   uint32           4 bytes
 //   work sum          big.Int          work sum length
+//   num utxos         uint64           8 bytes
+//   utxo amount       int64            8 bytes
+//
+// The utxo set stats were added after the initial format, so they are optional
+// when deserializing in order to support existing databases.
 // -----------------------------------------------------------------------------
 
 // bestChainState represents the data to be stored the database for the current
@@ -1352,6 +1579,12 @@ type bestChainState struct {
 	totalTxns    uint64
 	totalSubsidy int64
 	workSum      *big.Int
+	numUtxos     uint64
+	utxoAmount   int64
+
+	// hasUtxoStats is set when deserializing a state that includes the utxo
+	// set stats.  It is not serialized.
+	hasUtxoStats bool
 }
 
 // serializeBestChainState returns the serialization of the passed block best
@@ -1360,7 +1593,7 @@ func serializeBestChainState(state bestChainState) []byte {
 	// Calculate the full size needed to serialize the chain state.
 	workSumBytes := state.workSum.Bytes()
 	workSumBytesLen := uint32(len(workSumBytes))
-	serializedLen := chainhash.HashSize + 4 + 8 + 8 + 4 + workSumBytesLen
+	serializedLen := chainhash.HashSize + 4 + 8 + 8 + 4 + workSumBytesLen + 8 + 8
 
 	// Serialize the chain state.
 	serializedData := make([]byte, serializedLen)
@@ -1376,6 +1609,11 @@ func serializeBestChainState(state bestChainState) []byte {
 	dbnamespace.ByteOrder.PutUint32(serializedData[offset:], workSumBytesLen)
 	offset += 4
 	copy(serializedData[offset:], workSumBytes)
+	offset += workSumBytesLen
+	dbnamespace.ByteOrder.PutUint64(serializedData[offset:], state.numUtxos)
+	offset += 8
+	dbnamespace.ByteOrder.PutUint64(serializedData[offset:],
+		uint64(state.utxoAmount))
 	return serializedData[:]
 }
 
@@ -1422,6 +1660,18 @@ func deserializeBestChainState(serializedData []byte) (bestChainState, error) {
 	}
 	workSumBytes := serializedData[offset : offset+workSumBytesLen]
 	state.workSum = new(big.Int).SetBytes(workSumBytes)
+	offset += workSumBytesLen
+
+	// Deserialize the utxo set stats when they are present.  States written
+	// prior to their introduction do not have them.
+	if len(serializedData[offset:]) >= 8+8 {
+		state.numUtxos = dbnamespace.ByteOrder.Uint64(
+			serializedData[offset : offset+8])
+		offset += 8
+		state.utxoAmount = int64(dbnamespace.ByteOrder.Uint64(
+			serializedData[offset : offset+8]))
+		state.hasUtxoStats = true
+	}
 
 	return state, nil
 }
@@ -1436,6 +1686,8 @@ func dbPutBestState(dbTx database.Tx, snapshot *BestState, workSum *big.Int) err
 		totalTxns:    snapshot.TotalTxns,
 		totalSubsidy: snapshot.TotalSubsidy,
 		workSum:      workSum,
+		numUtxos:     uint64(snapshot.NumUtxos),
+		utxoAmount:   snapshot.UtxoAmount,
 	})
 
 	// Store the current best chain state into the database.
@@ -1452,6 +1704,14 @@ func (b *BlockChain) createChainState() error {
 	node := newBlockNode(header, nil)
 	node.status = statusDataStored | statusValid
 
+	// Allow the caller to validate the genesis block before the database
+	// is initialized with it.
+	if b.onGenesisLoaded != nil {
+		if err := b.onGenesisLoaded(genesisBlock); err != nil {
+			return err
+		}
+	}
+
 	// Initialize the state related to the best block.  Since it is the
 	// genesis block, use its timestamp for the median time.
 	numTxns := uint64(len(genesisBlock.MsgBlock().Transactions))
@@ -1642,7 +1902,8 @@ func (b *BlockChain) initChainState() error {
 		log.Tracef("Serialized chain state: %x", serializedData)
 		state, err := deserializeBestChainState(serializedData)
 		if err != nil {
-			return err
+			return CorruptDatabaseError(fmt.Sprintf("initChainState: "+
+				"unable to load best chain state: %v", err))
 		}
 
 		log.Infof("Loading block index...")
@@ -1670,7 +1931,8 @@ func (b *BlockChain) initChainState() error {
 		for ok := cursor.First(); ok; ok = cursor.Next() {
 			entry, err := deserializeBlockIndexEntry(cursor.Value())
 			if err != nil {
-				return err
+				return CorruptDatabaseError(fmt.Sprintf("initChainState: "+
+					"unable to load block index entry: %v", err))
 			}
 			header := &entry.header
 
@@ -1681,17 +1943,19 @@ func (b *BlockChain) initChainState() error {
 			if lastNode == nil {
 				blockHash := header.BlockHash()
 				if blockHash != *b.chainParams.GenesisHash {
-					return AssertError(fmt.Sprintf("initChainState: expected "+
-						"first entry in block index to be genesis block, "+
-						"found %s", blockHash))
+					str := fmt.Sprintf("initChainState: expected first "+
+						"entry in block index to be genesis block, found %s",
+						blockHash)
+					return CorruptDatabaseError(str)
 				}
 			} else if header.PrevBlock == lastNode.hash {
 				parent = lastNode
 			} else {
 				parent = b.index.lookupNode(&header.PrevBlock)
 				if parent == nil {
-					return AssertError(fmt.Sprintf("initChainState: could "+
-						"not find parent for block %s", header.BlockHash()))
+					str := fmt.Sprintf("initChainState: could not find "+
+						"parent for block %s", header.BlockHash())
+					return CorruptDatabaseError(str)
 				}
 			}
 
@@ -1712,8 +1976,9 @@ func (b *BlockChain) initChainState() error {
 		// Set the best chain to the stored best state.
 		tip := b.index.lookupNode(&state.hash)
 		if tip == nil {
-			return AssertError(fmt.Sprintf("initChainState: cannot find "+
-				"chain tip %s in block index", state.hash))
+			str := fmt.Sprintf("initChainState: cannot find chain tip %s "+
+				"in block index", state.hash)
+			return CorruptDatabaseError(str)
 		}
 		b.bestChain.SetTip(tip)
 
@@ -1730,6 +1995,7 @@ func (b *BlockChain) initChainState() error {
 		for node := tip; node != nil; node = node.parent {
 			node.status |= statusValid
 		}
+		b.bestValidated = b.validatedAncestor(tip)
 
 		log.Debugf("Block index loaded in %v", time.Since(bidxStart))
 
@@ -1748,13 +2014,15 @@ func (b *BlockChain) initChainState() error {
 		// Load the best and parent blocks and cache them.
 		utilBlock, err := dbFetchBlockByNode(dbTx, tip)
 		if err != nil {
-			return err
+			return CorruptDatabaseError(fmt.Sprintf("initChainState: "+
+				"unable to load chain tip %s: %v", tip.hash, err))
 		}
 		b.mainchainBlockCache[tip.hash] = utilBlock
 		if tip.parent != nil {
 			parentBlock, err := dbFetchBlockByNode(dbTx, tip.parent)
 			if err != nil {
-				return err
+				return CorruptDatabaseError(fmt.Sprintf("initChainState: "+
+					"unable to load block %s: %v", tip.parent.hash, err))
 			}
 			b.mainchainBlockCache[tip.parent.hash] = parentBlock
 		}
@@ -1776,6 +2044,19 @@ func (b *BlockChain) initChainState() error {
 			nextStakeDiff, tip.stakeNode.Winners(),
 			tip.stakeNode.MissedTickets(), tip.stakeNode.FinalState())
 
+		// Load the utxo set stats.  They are calculated by scanning the
+		// utxo set when the stored state predates them.
+		numUtxos, utxoAmount := int64(state.numUtxos), state.utxoAmount
+		if !state.hasUtxoStats {
+			log.Infof("Calculating utxo set stats...")
+			numUtxos, utxoAmount, err = dbCalcUtxoSetStats(dbTx)
+			if err != nil {
+				return err
+			}
+		}
+		b.stateSnapshot.NumUtxos = numUtxos
+		b.stateSnapshot.UtxoAmount = utxoAmount
+
 		return nil
 	})
 	return err
@@ -1388,8 +1388,9 @@ func TestBestChainStateSerialization(t *testing.T) {
 					workSum.Add(workSum, CalcWork(486604799))
 					return new(big.Int).Set(workSum)
 				}(), // 0x0100010001
+				hasUtxoStats: true,
 			},
-			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d61900000000000000000001000000000000000000000000000000050000000100010001"),
+			serialized: hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000000000000100000000000000000000000000000005000000010001000100000000000000000000000000000000"),
 		},
 		{
 			name: "block 1",
@@ -1402,8 +1403,11 @@ func TestBestChainStateSerialization(t *testing.T) {
 					workSum.Add(workSum, CalcWork(486604799))
 					return new(big.Int).Set(workSum)
 				}(), // 0x0200020002,
+				numUtxos:     1,
+				utxoAmount:   123456789,
+				hasUtxoStats: true,
 			},
-			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a830000000001000000020000000000000015cd5b0700000000050000000200020002"),
+			serialized: hexToBytes("4860eb18bf1b1620e37e9490fc8a427514416fd75159ab86688e9a830000000001000000020000000000000015cd5b0700000000050000000200020002010000000000000015cd5b0700000000"),
 		},
 	}
 
@@ -1433,6 +1437,19 @@ func TestBestChainStateSerialization(t *testing.T) {
 
 		}
 	}
+
+	// Ensure states serialized prior to the addition of the utxo set stats
+	// are still decoded and reported as not having them.
+	legacy := hexToBytes("6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d61900000000000000000001000000000000000000000000000000050000000100010001")
+	state, err := deserializeBestChainState(legacy)
+	if err != nil {
+		t.Fatalf("deserializeBestChainState (legacy) unexpected error: %v",
+			err)
+	}
+	if state.hasUtxoStats || state.numUtxos != 0 || state.utxoAmount != 0 {
+		t.Fatalf("deserializeBestChainState (legacy) unexpected utxo "+
+			"stats - got %v", state)
+	}
 }
 
 // TestBestChainStateDeserializeErrors performs negative tests against
@@ -6,9 +6,11 @@ package blockchain
 
 import (
 	"bytes"
+	"fmt"
 	"sort"
 
 	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/wire"
 )
 
 // nodeHeightSorter implements sort.Interface to allow a slice of nodes to
@@ -73,9 +75,11 @@ type ChainTipInfo struct {
 	Status string
 }
 
-// ChainTips returns information, in JSON-RPC format, about all of the currently
-// known chain tips in the block index.
-func (b *BlockChain) ChainTips() []ChainTipInfo {
+// sortedChainTips returns all of the currently known chain tips in the block
+// index sorted by descending height.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) sortedChainTips() []*blockNode {
 	b.index.RLock()
 	var chainTips []*blockNode
 	for _, nodes := range b.index.chainTips {
@@ -83,8 +87,15 @@ func (b *BlockChain) ChainTips() []ChainTipInfo {
 	}
 	b.index.RUnlock()
 
-	// Generate the results sorted by descending height.
 	sort.Sort(sort.Reverse(nodeHeightSorter(chainTips)))
+	return chainTips
+}
+
+// ChainTips returns information, in JSON-RPC format, about all of the currently
+// known chain tips in the block index.
+func (b *BlockChain) ChainTips() []ChainTipInfo {
+	// Generate the results sorted by descending height.
+	chainTips := b.sortedChainTips()
 	results := make([]ChainTipInfo, len(chainTips))
 	bestTip := b.bestChain.Tip()
 	for i, tip := range chainTips {
@@ -129,3 +140,141 @@ func (b *BlockChain) ChainTips() []ChainTipInfo {
 	}
 	return results
 }
+
+// ChainTipHeaders returns the headers of all of the currently known chain tips
+// in the block index sorted by descending height.  This is useful for
+// correlating the chain tips with their timestamps and difficulty.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ChainTipHeaders() []wire.BlockHeader {
+	chainTips := b.sortedChainTips()
+	headers := make([]wire.BlockHeader, 0, len(chainTips))
+	for _, tip := range chainTips {
+		headers = append(headers, tip.Header())
+	}
+	return headers
+}
+
+// BlocksAtHeight returns the hashes of all known blocks at the provided height
+// across all forks in the block index.  The main chain block at the height, if
+// any, is always the first entry.  This is useful for analyzing forks since,
+// unlike BlockHashByHeight, it includes competing side chain blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) BlocksAtHeight(height int64) []chainhash.Hash {
+	// Every node in the block index is an ancestor of one of the chain tips
+	// (or a tip itself), so the nodes at the height are found by looking
+	// up the ancestor at the height of every tip that is at least as high.
+	var hashes []chainhash.Hash
+	seen := make(map[*blockNode]struct{})
+	if node := b.bestChain.NodeByHeight(height); node != nil {
+		hashes = append(hashes, node.hash)
+		seen[node] = struct{}{}
+	}
+	for _, tip := range b.sortedChainTips() {
+		if tip.height < height {
+			break
+		}
+		node := tip.Ancestor(height)
+		if node == nil {
+			continue
+		}
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		hashes = append(hashes, node.hash)
+	}
+	return hashes
+}
+
+// SideChainBlocks returns the hashes of all blocks in the block index that
+// descend from the provided main chain block but are not part of the main chain
+// sorted by ascending height.  This includes the blocks of side chains that
+// fork from the main chain after the provided block.  An error is returned when
+// the block is not known or is not part of the main chain.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) SideChainBlocks(forkHash *chainhash.Hash) ([]chainhash.Hash, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	fork := b.index.LookupNode(forkHash)
+	if fork == nil {
+		return nil, fmt.Errorf("block %s is not known", forkHash)
+	}
+	if !b.bestChain.Contains(fork) {
+		return nil, fmt.Errorf("block %s is not part of the main chain",
+			forkHash)
+	}
+
+	// The index does not track the children of nodes, so find the side
+	// chain nodes by walking back from every side chain tip to the point
+	// it forks from the main chain and only keep those that fork at or
+	// after the provided block.
+	var nodes []*blockNode
+	seen := make(map[*blockNode]struct{})
+	for _, tip := range b.sortedChainTips() {
+		if tip.height <= fork.height || b.bestChain.Contains(tip) {
+			continue
+		}
+		branchFork := b.bestChain.FindFork(tip)
+		if branchFork == nil || branchFork.height < fork.height {
+			continue
+		}
+		for n := tip; n != branchFork; n = n.parent {
+			if _, ok := seen[n]; ok {
+				break
+			}
+			seen[n] = struct{}{}
+			nodes = append(nodes, n)
+		}
+	}
+
+	sort.Sort(nodeHeightSorter(nodes))
+	hashes := make([]chainhash.Hash, 0, len(nodes))
+	for _, n := range nodes {
+		hashes = append(hashes, n.hash)
+	}
+	return hashes, nil
+}
+
+// IndexStats houses statistics about the shape of the block index which are
+// useful for diagnostics such as detecting a node being spammed with low-work
+// forks.
+type IndexStats struct {
+	NumNodes     int   // The total number of nodes in the block index.
+	NumTips      int   // The number of chain tips including the main chain.
+	MaxBranchLen int64 // The longest side chain length from its fork point.
+	NumInvalid   int   // The number of nodes known to be invalid.
+}
+
+// IndexStats returns statistics about the current shape of the block index.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) IndexStats() IndexStats {
+	var stats IndexStats
+	b.index.RLock()
+	stats.NumNodes = len(b.index.index)
+	for _, node := range b.index.index {
+		if node.status.KnownInvalid() {
+			stats.NumInvalid++
+		}
+	}
+	var chainTips []*blockNode
+	for _, nodes := range b.index.chainTips {
+		chainTips = append(chainTips, nodes...)
+	}
+	b.index.RUnlock()
+
+	// Determine the longest branch by walking each tip back to the point it
+	// forks from the main chain.
+	stats.NumTips = len(chainTips)
+	for _, tip := range chainTips {
+		branchLen := tip.height - b.bestChain.FindFork(tip).height
+		if branchLen > stats.MaxBranchLen {
+			stats.MaxBranchLen = branchLen
+		}
+	}
+	return stats
+}
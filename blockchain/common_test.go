@@ -10,13 +10,16 @@ import (
 	"io/ioutil"
 	mrand "math/rand"
 	"os"
+	"testing"
 	"time"
 
+	"github.com/decred/dcrd/blockchain/chaingen"
 	"github.com/decred/dcrd/blockchain/stake"
 	"github.com/decred/dcrd/chaincfg"
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/database"
 	_ "github.com/decred/dcrd/database/ffldb"
+	"github.com/decred/dcrd/dcrutil"
 	"github.com/decred/dcrd/txscript"
 	"github.com/decred/dcrd/wire"
 )
@@ -46,6 +49,13 @@ func isSupportedDbType(dbType string) bool {
 // block already inserted.  In addition to the new chain instance, it returns
 // a teardown function the caller should invoke when done testing to clean up.
 func chainSetup(dbName string, params *chaincfg.Params) (*BlockChain, func(), error) {
+	return chainSetupWithConfig(dbName, params, nil)
+}
+
+// chainSetupWithConfig is identical to chainSetup except it also invokes the
+// provided function, when it is not nil, to modify the chain configuration
+// before the chain instance is created.
+func chainSetupWithConfig(dbName string, params *chaincfg.Params, configFn func(*Config)) (*BlockChain, func(), error) {
 	if !isSupportedDbType(testDbType) {
 		return nil, nil, fmt.Errorf("unsupported db type %v", testDbType)
 	}
@@ -96,13 +106,16 @@ func chainSetup(dbName string, params *chaincfg.Params) (*BlockChain, func(), er
 	paramsCopy := *params
 
 	// Create the main chain instance.
-	chain, err := New(&Config{
+	config := Config{
 		DB:          db,
 		ChainParams: &paramsCopy,
 		TimeSource:  NewMedianTime(),
 		SigCache:    txscript.NewSigCache(1000),
-	})
-
+	}
+	if configFn != nil {
+		configFn(&config)
+	}
+	chain, err := New(&config)
 	if err != nil {
 		teardown()
 		err := fmt.Errorf("failed to create chain instance: %v", err)
@@ -202,3 +215,287 @@ func appendFakeVotes(node *blockNode, numVotes uint16, voteVersion uint32, voteB
 		})
 	}
 }
+
+// chaingenHarness provides a test harness which encapsulates a test instance, a
+// chaingen generator instance, and a block chain instance to provide all of the
+// functionality of the aforementioned types as well as several convenience
+// functions such as block acceptance and rejection and expected tip checking.
+//
+// The chaingen generator is embedded in the struct so callers can directly
+// access its methods the same as if they were directly working with the
+// underlying generator.
+//
+// Since chaingen involves creating fully valid and solved blocks, which is
+// relatively expensive, only tests which actually require that functionality
+// should make use of this harness.  In many cases, a much faster synthetic
+// chain instance created by newFakeChain will suffice.
+type chaingenHarness struct {
+	*chaingen.Generator
+
+	t     *testing.T
+	chain *BlockChain
+}
+
+// newChaingenHarness creates and returns a new instance of a chaingen harness
+// that encapsulates the provided test instance along with a teardown function
+// the caller should invoke when done testing to clean up.
+func newChaingenHarness(t *testing.T, params *chaincfg.Params, dbName string) (*chaingenHarness, func()) {
+	t.Helper()
+	return newChaingenHarnessWithConfig(t, params, dbName, nil)
+}
+
+// newChaingenHarnessWithConfig is identical to newChaingenHarness except it
+// also invokes the provided function, when it is not nil, to modify the
+// configuration used to create the chain instance.
+func newChaingenHarnessWithConfig(t *testing.T, params *chaincfg.Params, dbName string, configFn func(*Config)) (*chaingenHarness, func()) {
+	t.Helper()
+
+	// Create a test generator instance initialized with the genesis block as
+	// the tip.
+	g, err := chaingen.MakeGenerator(params)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	// Create a new database and chain instance to run tests against.
+	chain, teardownFunc, err := chainSetupWithConfig(dbName, params, configFn)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+
+	harness := chaingenHarness{
+		Generator: &g,
+		t:         t,
+		chain:     chain,
+	}
+	return &harness, teardownFunc
+}
+
+// AcceptBlock processes the block associated with the given name in the
+// harness generator and expects it to be accepted to the main chain.
+func (g *chaingenHarness) AcceptBlock(blockName string) {
+	g.t.Helper()
+
+	msgBlock := g.BlockByName(blockName)
+	blockHeight := msgBlock.Header.Height
+	block := dcrutil.NewBlock(msgBlock)
+	g.t.Logf("Testing block %s (hash %s, height %d)", blockName, block.Hash(),
+		blockHeight)
+
+	forkLen, isOrphan, err := g.chain.ProcessBlock(block, BFNone)
+	if err != nil {
+		g.t.Fatalf("block %q (hash %s, height %d) should have been "+
+			"accepted: %v", blockName, block.Hash(), blockHeight, err)
+	}
+
+	// Ensure the main chain and orphan flags match the values specified in the
+	// test.
+	isMainChain := !isOrphan && forkLen == 0
+	if !isMainChain {
+		g.t.Fatalf("block %q (hash %s, height %d) unexpected main chain "+
+			"flag -- got %v, want true", blockName, block.Hash(),
+			blockHeight, isMainChain)
+	}
+	if isOrphan {
+		g.t.Fatalf("block %q (hash %s, height %d) unexpected orphan flag -- "+
+			"got %v, want false", blockName, block.Hash(), blockHeight,
+			isOrphan)
+	}
+}
+
+// AcceptTipBlock processes the current tip block associated with the harness
+// generator and expects it to be accepted to the main chain.
+func (g *chaingenHarness) AcceptTipBlock() {
+	g.t.Helper()
+
+	g.AcceptBlock(g.TipName())
+}
+
+// RejectBlock expects the block associated with the given name in the harness
+// generator to be rejected with the provided error code.
+func (g *chaingenHarness) RejectBlock(blockName string, code ErrorCode) {
+	g.t.Helper()
+
+	msgBlock := g.BlockByName(blockName)
+	blockHeight := msgBlock.Header.Height
+	block := dcrutil.NewBlock(msgBlock)
+	g.t.Logf("Testing block %s (hash %s, height %d)", blockName, block.Hash(),
+		blockHeight)
+
+	_, _, err := g.chain.ProcessBlock(block, BFNone)
+	if err == nil {
+		g.t.Fatalf("block %q (hash %s, height %d) should not have been "+
+			"accepted", blockName, block.Hash(), blockHeight)
+	}
+
+	// Ensure the error code is of the expected type and the reject code matches
+	// the value specified in the test instance.
+	rerr, ok := err.(RuleError)
+	if !ok {
+		g.t.Fatalf("block %q (hash %s, height %d) returned unexpected error "+
+			"type -- got %T, want blockchain.RuleError", blockName,
+			block.Hash(), blockHeight, err)
+	}
+	if rerr.ErrorCode != code {
+		g.t.Fatalf("block %q (hash %s, height %d) does not have expected "+
+			"reject code -- got %v, want %v", blockName, block.Hash(),
+			blockHeight, rerr.ErrorCode, code)
+	}
+}
+
+// RejectTipBlock expects the current tip block associated with the harness
+// generator to be rejected with the provided error code.
+func (g *chaingenHarness) RejectTipBlock(code ErrorCode) {
+	g.t.Helper()
+
+	g.RejectBlock(g.TipName(), code)
+}
+
+// ExpectTip expects the provided block to be the current tip of the main chain
+// associated with the harness generator.
+func (g *chaingenHarness) ExpectTip(tipName string) {
+	g.t.Helper()
+
+	// Ensure hash and height match.
+	wantTip := g.BlockByName(tipName)
+	best := g.chain.BestSnapshot()
+	if best.Hash != wantTip.BlockHash() ||
+		best.Height != int64(wantTip.Header.Height) {
+		g.t.Fatalf("block %q (hash %s, height %d) should be the current tip "+
+			"-- got (hash %s, height %d)", tipName, wantTip.BlockHash(),
+			wantTip.Header.Height, best.Hash, best.Height)
+	}
+}
+
+// AcceptedToSideChainWithExpectedTip expects the tip block associated with the
+// generator to be accepted to a side chain, but the current best chain tip to
+// be the provided value.
+func (g *chaingenHarness) AcceptedToSideChainWithExpectedTip(tipName string) {
+	g.t.Helper()
+
+	msgBlock := g.Tip()
+	blockHeight := msgBlock.Header.Height
+	block := dcrutil.NewBlock(msgBlock)
+	g.t.Logf("Testing block %s (hash %s, height %d)", g.TipName(),
+		block.Hash(), blockHeight)
+
+	forkLen, isOrphan, err := g.chain.ProcessBlock(block, BFNone)
+	if err != nil {
+		g.t.Fatalf("block %q (hash %s, height %d) should have been "+
+			"accepted: %v", g.TipName(), block.Hash(), blockHeight, err)
+	}
+
+	// Ensure the main chain and orphan flags match the values specified in
+	// the test.
+	isMainChain := !isOrphan && forkLen == 0
+	if isMainChain {
+		g.t.Fatalf("block %q (hash %s, height %d) unexpected main chain "+
+			"flag -- got %v, want false", g.TipName(), block.Hash(),
+			blockHeight, isMainChain)
+	}
+	if isOrphan {
+		g.t.Fatalf("block %q (hash %s, height %d) unexpected orphan flag -- "+
+			"got %v, want false", g.TipName(), block.Hash(), blockHeight,
+			isOrphan)
+	}
+
+	g.ExpectTip(tipName)
+}
+
+// AdvanceToStakeValidationHeight generates and accepts enough blocks to the
+// chain instance associated with the harness to reach stake validation height.
+//
+// The function will fail with a fatal test error if it is not called with the
+// harness at the genesis block which is the case when it is first created.
+func (g *chaingenHarness) AdvanceToStakeValidationHeight() {
+	g.t.Helper()
+
+	// Only allow this to be called on a newly created harness.
+	if g.Tip().Header.Height != 0 {
+		g.t.Fatalf("chaingen harness instance must be at the genesis block " +
+			"to advance to stake validation height")
+	}
+
+	// Shorter versions of useful params for convenience.
+	params := g.Params()
+	ticketsPerBlock := params.TicketsPerBlock
+	coinbaseMaturity := params.CoinbaseMaturity
+	stakeEnabledHeight := params.StakeEnabledHeight
+	stakeValidationHeight := params.StakeValidationHeight
+
+	// ---------------------------------------------------------------------
+	// Block One.
+	// ---------------------------------------------------------------------
+
+	// Add the required first block.
+	//
+	//   genesis -> bp
+	g.CreatePremineBlock("bp", 0)
+	g.AssertTipHeight(1)
+	g.AcceptTipBlock()
+
+	// ---------------------------------------------------------------------
+	// Generate enough blocks to have mature coinbase outputs to work with.
+	//
+	//   genesis -> bp -> bm0 -> bm1 -> ... -> bm#
+	// ---------------------------------------------------------------------
+
+	for i := uint16(0); i < coinbaseMaturity; i++ {
+		blockName := fmt.Sprintf("bm%d", i)
+		g.NextBlock(blockName, nil, nil)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	g.AssertTipHeight(uint32(coinbaseMaturity) + 1)
+
+	// ---------------------------------------------------------------------
+	// Generate enough blocks to reach the stake enabled height while
+	// creating ticket purchases that spend from the coinbases matured
+	// above.  This will also populate the pool of immature tickets.
+	//
+	//   ... -> bm# ... -> bse0 -> bse1 -> ... -> bse#
+	// ---------------------------------------------------------------------
+
+	var ticketsPurchased int
+	for i := int64(0); int64(g.Tip().Header.Height) < stakeEnabledHeight; i++ {
+		outs := g.OldestCoinbaseOuts()
+		ticketOuts := outs[1:]
+		ticketsPurchased += len(ticketOuts)
+		blockName := fmt.Sprintf("bse%d", i)
+		g.NextBlock(blockName, nil, ticketOuts)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	g.AssertTipHeight(uint32(stakeEnabledHeight))
+
+	// ---------------------------------------------------------------------
+	// Generate enough blocks to reach the stake validation height while
+	// continuing to purchase tickets using the coinbases matured above and
+	// allowing the immature tickets to mature and thus become live.
+	//
+	//   ... -> bse# -> bsv0 -> bsv1 -> ... -> bsv#
+	// ---------------------------------------------------------------------
+
+	targetPoolSize := g.Params().TicketPoolSize * ticketsPerBlock
+	for i := int64(0); int64(g.Tip().Header.Height) < stakeValidationHeight; i++ {
+		// Only purchase tickets until the target ticket pool size is
+		// reached.
+		outs := g.OldestCoinbaseOuts()
+		ticketOuts := outs[1:]
+		if ticketsPurchased+len(ticketOuts) > int(targetPoolSize) {
+			ticketsNeeded := int(targetPoolSize) - ticketsPurchased
+			if ticketsNeeded > 0 {
+				ticketOuts = ticketOuts[1 : ticketsNeeded+1]
+			} else {
+				ticketOuts = nil
+			}
+		}
+		ticketsPurchased += len(ticketOuts)
+
+		blockName := fmt.Sprintf("bsv%d", i)
+		g.NextBlock(blockName, nil, ticketOuts)
+		g.SaveTipCoinbaseOuts()
+		g.AcceptTipBlock()
+	}
+	g.AssertTipHeight(uint32(stakeValidationHeight))
+}
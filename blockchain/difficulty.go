@@ -400,6 +400,96 @@ func (b *BlockChain) CalcNextRequiredDifficulty(timestamp time.Time) (uint32, er
 	return difficulty, err
 }
 
+// NextRetargetInfo returns the height of the next block at which the required
+// proof-of-work difficulty is recalculated along with the number of blocks
+// from the end of the current best chain until that block.  The number of
+// blocks is one when the next block is a retarget block.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NextRetargetInfo() (int64, int64, error) {
+	windowSize := b.chainParams.WorkDiffWindowSize
+	if windowSize <= 0 {
+		return 0, 0, fmt.Errorf("invalid work difficulty window size %d",
+			windowSize)
+	}
+
+	b.chainLock.RLock()
+	tipHeight := b.bestChain.Tip().height
+	b.chainLock.RUnlock()
+
+	// The difficulty is recalculated for blocks whose height is a multiple
+	// of the window size.
+	height := (tipHeight/windowSize + 1) * windowSize
+	return height, height - tipHeight, nil
+}
+
+// EstimateHashrate returns an estimate of the network hashrate, in hashes per
+// second, based on the work added by the provided number of most recent blocks
+// in the main chain and the time elapsed between the past median time of the
+// block prior to them and that of the current tip.  The number of blocks is
+// limited to the number of blocks after the genesis block.
+//
+// An error is returned when the number of blocks is not positive, when the
+// main chain only consists of the genesis block, or when no time elapsed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) EstimateHashrate(lookbackBlocks int64) (float64, error) {
+	if lookbackBlocks <= 0 {
+		return 0, fmt.Errorf("number of blocks to look back must be "+
+			"positive (got %d)", lookbackBlocks)
+	}
+
+	b.chainLock.RLock()
+	tip := b.bestChain.Tip()
+	if lookbackBlocks > tip.height {
+		lookbackBlocks = tip.height
+	}
+	startNode := tip.RelativeAncestor(lookbackBlocks)
+	b.chainLock.RUnlock()
+	if startNode == nil || startNode == tip {
+		return 0, fmt.Errorf("not enough blocks to estimate the hashrate")
+	}
+
+	elapsed := tip.CalcPastMedianTime().Sub(startNode.CalcPastMedianTime())
+	if elapsed <= 0 {
+		return 0, fmt.Errorf("no time elapsed between blocks %s and %s",
+			startNode.hash, tip.hash)
+	}
+
+	work := new(big.Int).Sub(tip.workSum, startNode.workSum)
+	hashrate, _ := new(big.Float).Quo(new(big.Float).SetInt(work),
+		big.NewFloat(elapsed.Seconds())).Float64()
+	return hashrate, nil
+}
+
+// DifficultyRatio returns the proof-of-work difficulty represented by the
+// passed compact bits as a multiple of the minimum difficulty allowed by the
+// active network, which is the familiar human-readable difficulty number.
+//
+// Zero is returned for bits that do not represent a positive target.
+func (b *BlockChain) DifficultyRatio(bits uint32) float64 {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return 0
+	}
+	ratio, _ := new(big.Rat).SetFrac(b.chainParams.PowLimit, target).Float64()
+	return ratio
+}
+
+// DifficultyRatioAtHeight returns the proof-of-work difficulty of the main
+// chain block at the given height as a multiple of the minimum difficulty
+// allowed by the active network.  See DifficultyRatio for more details.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) DifficultyRatioAtHeight(height int64) (float64, error) {
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		str := fmt.Sprintf("no block at height %d exists", height)
+		return 0, errNotInMainChain(str)
+	}
+	return b.DifficultyRatio(node.bits), nil
+}
+
 // mergeDifficulty takes an original stake difficulty and two new, scaled
 // stake difficulties, merges the new difficulties, and outputs a new
 // merged stake difficulty.
@@ -6,6 +6,7 @@
 package blockchain
 
 import (
+	"math"
 	"math/big"
 	"runtime"
 	"testing"
@@ -74,6 +75,51 @@ func TestCalcWork(t *testing.T) {
 	}
 }
 
+// TestDifficultyRatio ensures converting compact difficulty bits to the ratio
+// of the difficulty to the minimum difficulty works as expected.
+func TestDifficultyRatio(t *testing.T) {
+	t.Parallel()
+
+	params := &chaincfg.MainNetParams
+	chain := newFakeChain(params)
+	chain.bestChain.SetTip(branchTip(chainedFakeNodes(chain.bestChain.Genesis(),
+		2)))
+
+	tests := []struct {
+		name string
+		bits uint32
+		want float64
+	}{
+		{"minimum difficulty", params.PowLimitBits, 1},
+		{"256 times harder", 0x1c00ffff, 256},
+		{"65536 times harder", 0x1b00ffff, 65536},
+		{"zero target", 0x1d000000, 0},
+	}
+	for _, test := range tests {
+		got := chain.DifficultyRatio(test.bits)
+		if math.Abs(got-test.want) > test.want*1e-4 {
+			t.Errorf("%q: unexpected ratio -- got %v, want %v", test.name,
+				got, test.want)
+		}
+	}
+
+	// Ensure the ratio at a main chain height matches the bits of the block
+	// at that height and that heights outside of the main chain fail.
+	ratio, err := chain.DifficultyRatioAtHeight(1)
+	if err != nil {
+		t.Fatalf("DifficultyRatioAtHeight: unexpected error: %v", err)
+	}
+	want := chain.DifficultyRatio(chain.bestChain.NodeByHeight(1).bits)
+	if ratio != want {
+		t.Fatalf("unexpected ratio at height 1 -- got %v, want %v", ratio,
+			want)
+	}
+	if _, err := chain.DifficultyRatioAtHeight(3); !isNotInMainChainErr(err) {
+		t.Fatalf("unexpected error for height past tip -- got %v, want "+
+			"errNotInMainChain", err)
+	}
+}
+
 // TestEstimateSupply ensures the supply estimation function used in the stake
 // difficulty algorithm defined by DCP0001 works as expected.
 func TestEstimateSupply(t *testing.T) {
@@ -1210,3 +1256,127 @@ func TestMinDifficultyReduction(t *testing.T) {
 		}
 	}
 }
+
+// TestNextRetargetInfo ensures the next retarget height and the number of
+// blocks until it is reached are calculated correctly at various offsets from
+// a retarget boundary.
+func TestNextRetargetInfo(t *testing.T) {
+	params := chaincfg.RegNetParams
+	params.WorkDiffWindowSize = 8
+	bc := newFakeChain(&params)
+	node := bc.bestChain.Tip()
+	nodes := chainedFakeNodes(node, 20)
+	for _, n := range nodes {
+		bc.index.AddNode(n)
+	}
+
+	tests := []struct {
+		name        string
+		tipHeight   int64
+		wantHeight  int64
+		blocksUntil int64
+	}{
+		{"genesis", 0, 8, 8},
+		{"just after boundary", 1, 8, 7},
+		{"just before boundary", 7, 8, 1},
+		{"at boundary", 8, 16, 8},
+		{"mid window", 13, 16, 3},
+		{"one before second boundary", 15, 16, 1},
+		{"at second boundary", 16, 24, 8},
+	}
+
+	for _, test := range tests {
+		tip := node
+		if test.tipHeight > 0 {
+			tip = nodes[test.tipHeight-1]
+		}
+		bc.bestChain.SetTip(tip)
+
+		height, blocksUntil, err := bc.NextRetargetInfo()
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+		if height != test.wantHeight || blocksUntil != test.blocksUntil {
+			t.Errorf("%q: unexpected retarget info -- got (%d, %d), "+
+				"want (%d, %d)", test.name, height, blocksUntil,
+				test.wantHeight, test.blocksUntil)
+		}
+	}
+}
+
+// TestEstimateHashrate ensures the hashrate estimate is calculated correctly
+// for a synthetic chain with a known difficulty and block spacing.
+func TestEstimateHashrate(t *testing.T) {
+	// Construct a synthetic chain where every block has the same difficulty
+	// and is ten seconds after the previous one.
+	params := chaincfg.RegNetParams
+	bc := newFakeChain(&params)
+	genesis := bc.bestChain.Tip()
+	node := genesis
+	const numBlocks = 30
+	const spacing = 10 * time.Second
+	for i := 0; i < numBlocks; i++ {
+		blockTime := time.Unix(node.timestamp, 0).Add(spacing)
+		node = newFakeNode(node, 1, 1, params.PowLimitBits, blockTime)
+		bc.index.AddNode(node)
+	}
+	bc.bestChain.SetTip(node)
+	blockWork, _ := new(big.Float).SetInt(CalcWork(params.PowLimitBits)).Float64()
+
+	// The past median times of the tip and the genesis block differ by less
+	// than the time between them since the genesis block does not have
+	// enough ancestors to lag behind.
+	clampedSpan := node.CalcPastMedianTime().Sub(genesis.CalcPastMedianTime())
+
+	tests := []struct {
+		name     string
+		lookback int64
+		wantErr  bool
+		want     float64
+	}{{
+		name:     "single block",
+		lookback: 1,
+		want:     blockWork / spacing.Seconds(),
+	}, {
+		name:     "several blocks",
+		lookback: 10,
+		want:     blockWork * 10 / (spacing.Seconds() * 10),
+	}, {
+		name:     "clamped to available history",
+		lookback: numBlocks * 2,
+		want:     blockWork * numBlocks / clampedSpan.Seconds(),
+	}, {
+		name:     "zero blocks",
+		lookback: 0,
+		wantErr:  true,
+	}, {
+		name:     "negative blocks",
+		lookback: -1,
+		wantErr:  true,
+	}}
+
+	for _, test := range tests {
+		got, err := bc.EstimateHashrate(test.lookback)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: did not receive expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+			continue
+		}
+		if math.Abs(got-test.want) > test.want*1e-9 {
+			t.Errorf("%q: unexpected hashrate -- got %v, want %v",
+				test.name, got, test.want)
+		}
+	}
+
+	// Ensure a chain that only consists of the genesis block is rejected.
+	bc.bestChain.SetTip(genesis)
+	if _, err := bc.EstimateHashrate(1); err == nil {
+		t.Fatal("did not receive expected error for genesis tip")
+	}
+}
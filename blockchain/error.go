@@ -49,13 +49,49 @@ func (e AssertError) Error() string {
 	return "assertion failed: " + string(e)
 }
 
+// CorruptDatabaseError identifies an error that indicates the chain state
+// stored in the database is inconsistent or otherwise corrupt.  Unlike other
+// errors that might occur while loading the chain state, it is typically only
+// possible to recover from it by rebuilding the database.
+type CorruptDatabaseError string
+
+// Error returns the corrupt database error as a human-readable string and
+// satisfies the error interface.
+func (e CorruptDatabaseError) Error() string {
+	return "corrupt database: " + string(e)
+}
+
+// ProcessingPausedError identifies an error that indicates a block was not
+// processed because block processing is currently paused and the caller
+// requested that it not wait for processing to be resumed.  It is not a
+// RuleError since it does not say anything about the validity of the block.
+type ProcessingPausedError string
+
+// Error returns the processing paused error as a human-readable string and
+// satisfies the error interface.
+func (e ProcessingPausedError) Error() string {
+	return string(e)
+}
+
+// ProcessingBusyError identifies an error that indicates a block was not
+// processed because the configured maximum number of blocks are already being
+// processed concurrently.  It is not a RuleError since it does not say
+// anything about the validity of the block.
+type ProcessingBusyError string
+
+// Error returns the processing busy error as a human-readable string and
+// satisfies the error interface.
+func (e ProcessingBusyError) Error() string {
+	return string(e)
+}
+
 // ErrorCode identifies a kind of error.
 type ErrorCode int
 
 // These constants are used to identify a specific RuleError.
 const (
 	// ErrDuplicateBlock indicates a block with the same hash already
-	// exists.
+	// exists in the main chain or a side chain.
 	ErrDuplicateBlock ErrorCode = iota
 
 	// ErrMissingParent indicates that the block was an orphan.
@@ -473,6 +509,12 @@ const (
 	// block that is either not the current best chain tip or its parent.
 	ErrInvalidTemplateParent
 
+	// ErrDuplicateOrphan indicates a block with the same hash is already
+	// held in the orphan pool.  This is distinct from ErrDuplicateBlock
+	// which indicates the block is already in the main chain or a side
+	// chain.
+	ErrDuplicateOrphan
+
 	// numErrorCodes is the maximum error code number used in tests.
 	numErrorCodes
 )
@@ -579,6 +621,7 @@ var errorCodeStrings = map[ErrorCode]string{
 	ErrKnownInvalidBlock:      "ErrKnownInvalidBlock",
 	ErrInvalidAncestorBlock:   "ErrInvalidAncestorBlock",
 	ErrInvalidTemplateParent:  "ErrInvalidTemplateParent",
+	ErrDuplicateOrphan:        "ErrDuplicateOrphan",
 }
 
 // String returns the ErrorCode as a human-readable name.
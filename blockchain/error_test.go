@@ -115,6 +115,7 @@ func TestErrorCodeStringer(t *testing.T) {
 		{ErrKnownInvalidBlock, "ErrKnownInvalidBlock"},
 		{ErrInvalidAncestorBlock, "ErrInvalidAncestorBlock"},
 		{ErrInvalidTemplateParent, "ErrInvalidTemplateParent"},
+		{ErrDuplicateOrphan, "ErrDuplicateOrphan"},
 		{0xffff, "Unknown ErrorCode (65535)"},
 	}
 
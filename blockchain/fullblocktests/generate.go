@@ -1063,7 +1063,7 @@ func Generate(includeLargeReorg bool) (tests [][]TestInstance, err error) {
 	orphaned()
 
 	// Ensure duplicate orphan blocks are rejected.
-	rejected(blockchain.ErrDuplicateBlock)
+	rejected(blockchain.ErrDuplicateOrphan)
 
 	// ---------------------------------------------------------------------
 	// Coinbase script length limits tests.
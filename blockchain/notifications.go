@@ -7,14 +7,35 @@ package blockchain
 
 import (
 	"fmt"
+	"runtime/debug"
+	"time"
 
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/dcrutil"
 )
 
+// tipChangeNtfnBufferSize is the number of best states that are buffered for
+// each channel returned by TipChangeNotifications before the oldest ones are
+// dropped.
+const tipChangeNtfnBufferSize = 16
+
 // NotificationType represents the type of a notification message.
 type NotificationType int
 
+// NotificationTypeMask is a bitmask of notification types.  The mask for an
+// individual notification type is obtained via its Mask method and masks may be
+// combined with a bitwise or.
+type NotificationTypeMask uint64
+
+// NTMaskAll is a notification type mask that matches all notification types.
+const NTMaskAll = ^NotificationTypeMask(0)
+
+// Mask returns the notification type mask that only matches the notification
+// type.
+func (n NotificationType) Mask() NotificationTypeMask {
+	return 1 << uint(n)
+}
+
 // NotificationCallback is used for a caller to provide a callback for
 // notifications about various chain events.
 type NotificationCallback func(*Notification)
@@ -72,20 +93,48 @@ const (
 	// NTSpentAndMissedTickets indicates newly maturing tickets from a newly
 	// accepted block.
 	NTNewTickets
+
+	// NTOrphanConnected indicates a block that was previously held in the
+	// orphan pool was accepted into the block chain once its parent became
+	// available.  It is sent in addition to the usual notifications for the
+	// block.
+	NTOrphanConnected
+
+	// NTStakeDifficultyChanged indicates the stake difficulty required for
+	// the next block changed as a result of connecting a block to the main
+	// chain.
+	NTStakeDifficultyChanged
+
+	// NTDeepForkDetected indicates a side chain was extended such that its
+	// tip is within the configured number of blocks worth of work of
+	// overtaking the main chain.  It is intended as an early warning that
+	// a reorganize might be imminent.
+	NTDeepForkDetected
+
+	// NTOrphansResolved indicates one or more blocks that were previously
+	// held in the orphan pool were accepted into the block chain as a
+	// result of accepting a block they directly or indirectly depend on.
+	// It is sent once per accepted block after all of the NTOrphanConnected
+	// notifications for the individual orphans.
+	NTOrphansResolved
 )
 
 // notificationTypeStrings is a map of notification types back to their constant
 // names for pretty printing.
 var notificationTypeStrings = map[NotificationType]string{
-	NTNewTipBlockChecked:    "NTNewTipBlockChecked",
-	NTBlockAccepted:         "NTBlockAccepted",
-	NTBlockConnected:        "NTBlockConnected",
-	NTBlockDisconnected:     "NTBlockDisconnected",
-	NTChainReorgStarted:     "NTChainReorgStarted",
-	NTChainReorgDone:        "NTChainReorgDone",
-	NTReorganization:        "NTReorganization",
-	NTSpentAndMissedTickets: "NTSpentAndMissedTickets",
-	NTNewTickets:            "NTNewTickets",
+	NTNewTipBlockChecked:     "NTNewTipBlockChecked",
+	NTBlockAccepted:          "NTBlockAccepted",
+	NTBlockConnected:         "NTBlockConnected",
+	NTBlockDisconnected:      "NTBlockDisconnected",
+	NTChainReorgStarted:      "NTChainReorgStarted",
+	NTChainReorgDone:         "NTChainReorgDone",
+	NTReorganization:         "NTReorganization",
+	NTSpentAndMissedTickets:  "NTSpentAndMissedTickets",
+	NTNewTickets:             "NTNewTickets",
+	NTOrphanConnected:        "NTOrphanConnected",
+	NTStakeDifficultyChanged: "NTStakeDifficultyChanged",
+	NTDeepForkDetected:       "NTDeepForkDetected",
+	NTOrphansResolved:        "NTOrphansResolved",
 }
 
 // String returns the NotificationType in human-readable form.
@@ -136,35 +185,273 @@ type TicketNotificationsData struct {
 	TicketsSpent    []chainhash.Hash
 	TicketsMissed   []chainhash.Hash
 	TicketsNew      []chainhash.Hash
+
+	// NewTicketsInfo contains additional details about each of the tickets
+	// in TicketsNew in the same order.  It is only populated for the
+	// NTNewTickets notification.
+	NewTicketsInfo []NewTicketInfo
+}
+
+// NewTicketInfo houses details about a ticket that matured and was added to the
+// live ticket pool as of a block.
+type NewTicketInfo struct {
+	// Hash is the hash of the ticket purchase transaction.
+	Hash chainhash.Hash
+
+	// Amount is the amount paid for the ticket in atoms.
+	Amount int64
+
+	// PurchaseBlock and PurchaseHeight identify the block that contains
+	// the ticket purchase.
+	PurchaseBlock  chainhash.Hash
+	PurchaseHeight int64
+
+	// ExpiryHeight is the height of the block in which the ticket expires
+	// when it has not been selected to vote before then.
+	ExpiryHeight int64
+}
+
+// OrphanConnectedNtfnsData is the structure for data indicating information
+// about a block that was accepted into the chain after previously being held in
+// the orphan pool.
+type OrphanConnectedNtfnsData struct {
+	// Block is the previously orphaned block that was accepted.
+	Block *dcrutil.Block
+
+	// Wait is how long the block was held in the orphan pool waiting for
+	// its parent.
+	Wait time.Duration
+}
+
+// StakeDifficultyChangedNtfnsData is the structure for data indicating the
+// stake difficulty required for the next block changed as a result of
+// connecting a block to the main chain.
+type StakeDifficultyChangedNtfnsData struct {
+	// Hash and Height identify the connected block that caused the change.
+	Hash   chainhash.Hash
+	Height int64
+
+	// OldStakeDiff is the stake difficulty that was required for the
+	// connected block and NewStakeDiff is the one required for the block
+	// after it.
+	OldStakeDiff int64
+	NewStakeDiff int64
+}
+
+// DeepForkDetectedNtfnsData is the structure for data indicating a side chain
+// is close to overtaking the main chain.
+type DeepForkDetectedNtfnsData struct {
+	// MainTip and MainTipHeight identify the current tip of the main chain.
+	MainTip       chainhash.Hash
+	MainTipHeight int64
+
+	// SideTip and SideTipHeight identify the tip of the competing side
+	// chain.
+	SideTip       chainhash.Hash
+	SideTipHeight int64
+
+	// ForkHeight is the height of the last block the main chain and the
+	// side chain have in common.
+	ForkHeight int64
+}
+
+// OrphansResolvedNtfnsData is the structure for data indicating the orphan
+// blocks that were accepted into the chain as a result of accepting the block
+// they depend on.
+type OrphansResolvedNtfnsData struct {
+	// Parent is the hash of the accepted block that allowed the orphans to
+	// be accepted.
+	Parent chainhash.Hash
+
+	// NumOrphans is the number of orphans that were accepted.
+	NumOrphans int
+
+	// Orphans contains the hashes of the orphans that were accepted in the
+	// order they were accepted.
+	Orphans []chainhash.Hash
 }
 
 // Notification defines notification that is sent to the caller via the callback
 // function provided during the call to New and consists of a notification type
 // as well as associated data that depends on the type as follows:
-// 	- NTNewTipBlockChecked:    *dcrutil.Block
-// 	- NTBlockAccepted:         *BlockAcceptedNtfnsData
-// 	- NTBlockConnected:        []*dcrutil.Block of len 2
-// 	- NTBlockDisconnected:     []*dcrutil.Block of len 2
-// 	- NTChainReorgStarted:     nil
-// 	- NTChainReorgDone:        nil
-//  - NTReorganization:        *ReorganizationNtfnsData
-//  - NTSpentAndMissedTickets: *TicketNotificationsData
-//  - NTNewTickets:            *TicketNotificationsData
+// 	- NTNewTipBlockChecked:     *dcrutil.Block
+// 	- NTBlockAccepted:          *BlockAcceptedNtfnsData
+// 	- NTBlockConnected:         []*dcrutil.Block of len 2
+// 	- NTBlockDisconnected:      []*dcrutil.Block of len 2
+// 	- NTChainReorgStarted:      nil
+// 	- NTChainReorgDone:         nil
+// 	- NTReorganization:         *ReorganizationNtfnsData
+// 	- NTSpentAndMissedTickets:  *TicketNotificationsData
+// 	- NTNewTickets:             *TicketNotificationsData
+// 	- NTOrphanConnected:        *OrphanConnectedNtfnsData
+// 	- NTStakeDifficultyChanged: *StakeDifficultyChangedNtfnsData
+// 	- NTDeepForkDetected:       *DeepForkDetectedNtfnsData
+// 	- NTOrphansResolved:        *OrphansResolvedNtfnsData
 type Notification struct {
 	Type NotificationType
 	Data interface{}
 }
 
+// notificationSubscriber houses a callback registered via Subscribe along with
+// the types of notifications it is delivered.
+type notificationSubscriber struct {
+	callback NotificationCallback
+	types    NotificationTypeMask
+}
+
+// Subscribe registers the provided callback to be invoked with all future
+// notifications that have a type matching the provided notification type mask.
+// For example, NTBlockConnected.Mask()|NTBlockDisconnected.Mask() only delivers
+// notifications about blocks that are connected to and disconnected from the
+// main chain, while NTMaskAll delivers all notifications.
+//
+// The callback is invoked in addition to the callback provided in the call to
+// New, if any, and is subject to the same constraints.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Subscribe(callback NotificationCallback, types NotificationTypeMask) {
+	b.subscribersLock.Lock()
+	b.subscribers = append(b.subscribers, notificationSubscriber{
+		callback: callback,
+		types:    types,
+	})
+	b.subscribersLock.Unlock()
+}
+
+// invokeNotificationCallback invokes the provided callback with the passed
+// notification.  Any panic in the callback is recovered and logged when panic
+// recovery is enabled.
+func (b *BlockChain) invokeNotificationCallback(callback NotificationCallback, n *Notification) {
+	// Prevent a panicking callback from unwinding through the chain.
+	if b.recoverNtfnPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("Recovered from panic in %v notification "+
+					"callback: %v\n%s", n.Type, r, debug.Stack())
+			}
+		}()
+	}
+
+	callback(n)
+}
+
 // sendNotification sends a notification with the passed type and data if the
 // caller requested notifications by providing a callback function in the call
-// to New.
+// to New and to all subscribers registered via Subscribe that are interested
+// in the notification type.  Any panic in the callbacks is recovered and
+// logged when panic recovery is enabled.
 func (b *BlockChain) sendNotification(typ NotificationType, data interface{}) {
+	b.subscribersLock.RLock()
+	subscribers := b.subscribers
+	b.subscribersLock.RUnlock()
+
 	// Ignore it if the caller didn't request notifications.
-	if b.notifications == nil {
+	if b.notifications == nil && len(subscribers) == 0 {
 		return
 	}
 
 	// Generate and send the notification.
 	n := Notification{Type: typ, Data: data}
-	b.notifications(&n)
+	if b.notifications != nil {
+		b.invokeNotificationCallback(b.notifications, &n)
+	}
+	mask := typ.Mask()
+	for _, subscriber := range subscribers {
+		if subscriber.types&mask != 0 {
+			b.invokeNotificationCallback(subscriber.callback, &n)
+		}
+	}
+}
+
+// NotifyCurrentTip sends a single NTBlockConnected notification for the current
+// tip of the main chain.  This is intended to be used after processing a batch
+// of blocks with the BFSilent flag in order to notify subscribers of the final
+// state.  No notification is sent when the tip is the genesis block since it is
+// never connected.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) NotifyCurrentTip() error {
+	b.chainLock.RLock()
+	tip := b.bestChain.Tip()
+	if tip.parent == nil {
+		b.chainLock.RUnlock()
+		return nil
+	}
+	block, err := b.fetchMainChainBlockByNode(tip)
+	if err != nil {
+		b.chainLock.RUnlock()
+		return err
+	}
+	parent, err := b.fetchMainChainBlockByNode(tip.parent)
+	b.chainLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	b.sendNotification(NTBlockConnected, []*dcrutil.Block{block, parent})
+	return nil
+}
+
+// TipChangeNotifications returns a new receive-only channel that is delivered
+// the best chain state each time the tip of the main chain changes, whether
+// due to a block being connected or disconnected.  Each call returns an
+// independent channel that receives every tip change from the time it is
+// created.
+//
+// The channel is buffered and the chain never blocks waiting for a consumer
+// to receive from it.  Instead, when the buffer is full, the oldest buffered
+// state is dropped to make room for the new one.  This means consumers that
+// fall behind will miss intermediate states, but the most recent state is
+// always delivered.
+//
+// The returned function MUST be called once the caller is no longer interested
+// in the notifications in order to stop delivering them to the channel and
+// release its resources.  The channel is not closed and calling the function
+// more than once has no effect.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) TipChangeNotifications() (<-chan *BestState, func()) {
+	c := make(chan *BestState, tipChangeNtfnBufferSize)
+	b.tipChangeLock.Lock()
+	b.tipChangeChans = append(b.tipChangeChans, c)
+	b.tipChangeLock.Unlock()
+
+	unsubscribe := func() {
+		b.tipChangeLock.Lock()
+		for i, other := range b.tipChangeChans {
+			if other == c {
+				last := len(b.tipChangeChans) - 1
+				b.tipChangeChans[i] = b.tipChangeChans[last]
+				b.tipChangeChans[last] = nil
+				b.tipChangeChans = b.tipChangeChans[:last]
+				break
+			}
+		}
+		b.tipChangeLock.Unlock()
+	}
+	return c, unsubscribe
+}
+
+// sendTipChange delivers the passed best chain state to all of the channels
+// returned by TipChangeNotifications, dropping the oldest buffered state of
+// any channels that are full.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) sendTipChange(state *BestState) {
+	b.tipChangeLock.Lock()
+	for _, c := range b.tipChangeChans {
+		// Drop the oldest state to make room when the channel is full.
+		// The chain state lock ensures this is the only sender, so the
+		// send is guaranteed to succeed after making room.
+		select {
+		case c <- state:
+		default:
+			select {
+			case <-c:
+			default:
+			}
+			c <- state
+		}
+	}
+	b.tipChangeLock.Unlock()
 }
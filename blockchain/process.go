@@ -11,6 +11,7 @@ import (
 
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
 )
 
 // BehaviorFlags is a bitmask defining tweaks to the normal behavior when
@@ -21,7 +22,9 @@ const (
 	// BFFastAdd may be set to indicate that several checks can be avoided
 	// for the block since it is already known to fit into the chain due to
 	// already proving it correct links into the chain up to a known
-	// checkpoint.  This is primarily used for headers-first mode.
+	// checkpoint.  This is primarily used for headers-first mode.  The
+	// block is marked trusted in the block index when it is connected to
+	// the main chain since it was not fully validated.
 	BFFastAdd BehaviorFlags = 1 << iota
 
 	// BFNoPoWCheck may be set to indicate the proof of work check which
@@ -29,6 +32,42 @@ const (
 	// not be performed.
 	BFNoPoWCheck
 
+	// BFTrusted may be set to indicate that the block is trusted to be
+	// valid, such as when bootstrapping from a known-good snapshot, so the
+	// expensive transaction validation operations, including script
+	// validation, are skipped when it is connected to the main chain.  The
+	// block is then marked as fully validated and trusted in the block
+	// index so it is never validated again.
+	//
+	// WARNING: This is dangerous since it allows blocks that violate the
+	// consensus rules to become part of the main chain and permanently
+	// corrupt the chain state.  It must only be used for blocks that are
+	// already known to be valid by some other means.
+	BFTrusted
+
+	// BFSilent may be set to indicate that the notifications which are
+	// normally sent when blocks are connected to or disconnected from the
+	// main chain are suppressed.  This is primarily useful to reduce the
+	// overhead of notifying subscribers about every block when importing a
+	// large batch of blocks, such as during the initial chain sync, in
+	// which case NotifyCurrentTip may be used afterwards to notify
+	// subscribers of the final state.
+	BFSilent
+
+	// BFNoWaitPaused may be set to indicate that processing a block while
+	// block processing is paused must immediately fail with
+	// ProcessingPausedError instead of waiting for processing to be resumed.
+	BFNoWaitPaused
+
+	// BFReprocess may be set to indicate that processing a block which is
+	// already known must not fail because it is a duplicate.  A known
+	// orphan is replaced with the block in the orphan pool and a block that
+	// is already in the main chain or a side chain is validated again
+	// against the context-free and contextual rules without modifying the
+	// chain.  This is primarily useful for replay tools that intentionally
+	// feed the same blocks multiple times.
+	BFReprocess
+
 	// BFNone is a convenience value to specifically indicate no flags.
 	BFNone BehaviorFlags = 0
 )
@@ -48,6 +87,7 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 	// needing to grow the array in the common case.
 	processHashes := make([]*chainhash.Hash, 0, 10)
 	processHashes = append(processHashes, hash)
+	var resolved []chainhash.Hash
 	for len(processHashes) > 0 {
 		// Pop the first hash to process from the slice.
 		processHash := processHashes[0]
@@ -77,17 +117,46 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 			i--
 
 			// Potentially accept the block into the block chain.
-			_, err := b.maybeAcceptBlock(orphan.block, flags)
+			_, err := b.maybeAcceptBlock(orphan.block, nil, flags)
 			if err != nil {
 				return err
 			}
 
+			// Notify the caller that the orphan was accepted along
+			// with how long it was waiting for its parent.
+			//
+			// This notification is sent with the chain lock
+			// released for the same reasons as NTBlockAccepted.
+			b.chainLock.Unlock()
+			b.sendNotification(NTOrphanConnected,
+				&OrphanConnectedNtfnsData{
+					Block: orphan.block,
+					Wait:  time.Since(orphan.received),
+				})
+			b.chainLock.Lock()
+
 			// Add this block to the list of blocks to process so
 			// any orphan blocks that depend on this block are
 			// handled too.
 			processHashes = append(processHashes, orphanHash)
+			resolved = append(resolved, *orphanHash)
 		}
 	}
+
+	// Notify the caller of all orphans that were accepted as a result of
+	// accepting the passed block.
+	//
+	// This notification is sent with the chain lock released for the same
+	// reasons as NTBlockAccepted.
+	if len(resolved) > 0 {
+		b.chainLock.Unlock()
+		b.sendNotification(NTOrphansResolved, &OrphansResolvedNtfnsData{
+			Parent:     *hash,
+			NumOrphans: len(resolved),
+			Orphans:    resolved,
+		})
+		b.chainLock.Lock()
+	}
 	return nil
 }
 
@@ -106,9 +175,338 @@ func (b *BlockChain) processOrphans(hash *chainhash.Hash, flags BehaviorFlags) e
 //
 // This function is safe for concurrent access.
 func (b *BlockChain) ProcessBlock(block *dcrutil.Block, flags BehaviorFlags) (int64, bool, error) {
+	if err := b.acquireProcessSlot(); err != nil {
+		return 0, false, err
+	}
+	defer b.releaseProcessSlot()
+	defer b.deliverInvalidBlocks()
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	return b.processBlock(block, nil, flags)
+}
+
+// ProcessBlockWithTip is identical to ProcessBlock except it additionally
+// returns the best chain state produced by connecting the block to the main
+// chain.  The state is captured at the time the block itself is connected, so
+// it reflects the result of processing the block as opposed to calling
+// BestSnapshot afterwards, which might observe changes made by other callers
+// in the mean time or by connecting any orphans that descend from the block.
+//
+// When the block is not connected to the main chain, such as when it is an
+// orphan or is added to a side chain, the returned state is the best chain
+// state as of the end of processing and, since the chain lock is released
+// while notifications are sent, it might include changes made by other
+// callers.
+//
+// The best state is nil when an error is returned.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockWithTip(block *dcrutil.Block, flags BehaviorFlags) (*BestState, int64, bool, error) {
+	if err := b.acquireProcessSlot(); err != nil {
+		return nil, 0, false, err
+	}
+	defer b.releaseProcessSlot()
+	defer b.deliverInvalidBlocks()
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Register the block so the state produced by connecting it is
+	// captured.  The registration is skipped when another caller is already
+	// processing the same block since its entry would otherwise be removed
+	// out from under it.
+	blockHash := block.Hash()
+	if b.tipCaptures == nil {
+		b.tipCaptures = make(map[chainhash.Hash]*BestState)
+	}
+	_, registered := b.tipCaptures[*blockHash]
+	if !registered {
+		b.tipCaptures[*blockHash] = nil
+		defer delete(b.tipCaptures, *blockHash)
+	}
+
+	forkLen, isOrphan, err := b.processBlock(block, nil, flags)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if state := b.tipCaptures[*blockHash]; state != nil {
+		return state, forkLen, isOrphan, nil
+	}
+	return b.BestSnapshot(), forkLen, isOrphan, nil
+}
+
+// ProcessBlockWithView is identical to ProcessBlock except it additionally
+// accepts a utxo view that contains entries for the outputs the block spends,
+// such as one that was already populated while validating the transactions in
+// the block for the memory pool.  This allows the referenced utxos to be taken
+// from the view instead of loading them from the database again when the block
+// extends the main chain.
+//
+// The view must be for the current main chain tip, as indicated by its best
+// hash, and its entries must reflect the state of the utxo set as of that
+// tip.  The view is ignored, and the referenced utxos are loaded from the
+// database as usual, when it is for a different block.  Only entries that have
+// not been modified since they were loaded are used and the provided view
+// itself is not modified.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockWithView(block *dcrutil.Block, view *UtxoViewpoint, flags BehaviorFlags) (int64, bool, error) {
+	if err := b.acquireProcessSlot(); err != nil {
+		return 0, false, err
+	}
+	defer b.releaseProcessSlot()
+	defer b.deliverInvalidBlocks()
 	b.chainLock.Lock()
 	defer b.chainLock.Unlock()
 
+	return b.processBlock(block, view, flags)
+}
+
+// ProcessBlockHeaders validates the provided contiguous batch of block headers,
+// in order, in a single pass while holding the chain lock and adds each header
+// that passes validation to the block index as a header-only node.  The first
+// header must build on a block or header that is already in the block index
+// and each subsequent header must build on the header before it.  It returns
+// the number of headers that were accepted before the first one that failed
+// along with the error for the failed header.  None of the headers after a
+// failed header are validated or added since they build on an invalid header.
+//
+// Headers that are already known are not validated or added again, however
+// they are still counted as accepted unless they are known to be invalid.
+//
+// The headers are validated against the sanity checks, the proof-of-work
+// difficulty and median time rules, the height commitment, and the
+// checkpoints.  The stake difficulty and stake version rules are not checked
+// since they depend on the votes and tickets contained in the ancestor blocks
+// which are not available from the headers alone.
+//
+// The header-only nodes do not have the block data available, so they are
+// never connected to the main chain until their blocks are processed via
+// ProcessBlock.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ProcessBlockHeaders(headers []*wire.BlockHeader) (int, error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	numAccepted, err := b.processBlockHeaders(headers)
+
+	// Ensure the new block index entries are written to the database unless
+	// flushing is deferred to the background.
+	if numAccepted > 0 && b.indexFlushInterval == 0 {
+		if flushErr := b.flushBlockIndex(); flushErr != nil {
+			return numAccepted, flushErr
+		}
+	}
+	return numAccepted, err
+}
+
+// processBlockHeaders validates the provided contiguous batch of block headers
+// and adds those that pass validation to the block index.  See the
+// documentation for ProcessBlockHeaders for more details.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) processBlockHeaders(headers []*wire.BlockHeader) (int, error) {
+
+	var prevNode *blockNode
+	for i, header := range headers {
+		// Ensure the header builds on a known block when it is the first
+		// one in the batch and on the previous header otherwise.
+		if prevNode == nil {
+			prevNode = b.index.LookupNode(&header.PrevBlock)
+			if prevNode == nil {
+				str := fmt.Sprintf("previous block %s is not known",
+					header.PrevBlock)
+				return i, ruleError(ErrMissingParent, str)
+			}
+			if b.index.NodeStatus(prevNode).KnownInvalid() {
+				str := fmt.Sprintf("previous block %s is known to "+
+					"be invalid", header.PrevBlock)
+				return i, ruleError(ErrInvalidAncestorBlock, str)
+			}
+		} else if header.PrevBlock != prevNode.hash {
+			str := fmt.Sprintf("header %d builds on %s instead of the "+
+				"previous header %s", i, header.PrevBlock,
+				prevNode.hash)
+			return i, ruleError(ErrMissingParent, str)
+		}
+
+		// There is no need to validate headers that are already known.
+		hash := header.BlockHash()
+		if node := b.index.LookupNode(&hash); node != nil {
+			if b.index.NodeStatus(node).KnownInvalid() {
+				str := fmt.Sprintf("block %s is known to be invalid",
+					hash)
+				return i, ruleError(ErrKnownInvalidBlock, str)
+			}
+			prevNode = node
+			continue
+		}
+
+		// Perform the context-free sanity checks on the header.
+		err := checkBlockHeaderSanity(header, b.timeSource,
+			b.maxFutureBlockTime, BFNone, b.chainParams)
+		if err != nil {
+			return i, err
+		}
+
+		// Ensure the difficulty specified in the header matches the
+		// calculated difficulty and its timestamp is after the median
+		// time of the previous blocks.
+		expDiff, err := b.calcNextRequiredDifficulty(prevNode,
+			header.Timestamp)
+		if err != nil {
+			return i, err
+		}
+		if header.Bits != expDiff {
+			str := fmt.Sprintf("block difficulty of %d is not the "+
+				"expected value of %d", header.Bits, expDiff)
+			return i, ruleError(ErrUnexpectedDifficulty, str)
+		}
+		medianTime := prevNode.CalcPastMedianTime()
+		if !header.Timestamp.After(medianTime) {
+			str := fmt.Sprintf("block timestamp of %v is not after "+
+				"expected %v", header.Timestamp, medianTime)
+			return i, ruleError(ErrTimeTooOld, str)
+		}
+
+		// Perform the positional checks that do not depend on the
+		// contents of the ancestor blocks, such as the height commitment
+		// and checkpoints.
+		err = b.checkBlockHeaderContext(header, prevNode, BFFastAdd)
+		if err != nil {
+			return i, err
+		}
+
+		// Add the header to the block index.  The node does not have the
+		// block data available, so it is not marked as stored.
+		node := newBlockNode(header, prevNode)
+		b.index.AddNode(node)
+		prevNode = node
+	}
+
+	return len(headers), nil
+}
+
+// Pause pauses block processing until Resume is called.  Since the chain lock
+// is acquired, any blocks that are already being processed are completed
+// before it returns.  Blocks submitted while paused either wait until
+// processing is resumed or, when the BFNoWaitPaused flag is set, fail with
+// ProcessingPausedError.
+//
+// This is primarily useful for maintenance operations, such as backups, that
+// need the chain to temporarily stop accepting blocks.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Pause() {
+	b.chainLock.Lock()
+	b.paused = true
+	b.chainLock.Unlock()
+}
+
+// Resume resumes block processing that was previously paused via Pause and
+// wakes up all callers waiting for it to be resumed.  It has no effect when
+// processing is not paused.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) Resume() {
+	b.chainLock.Lock()
+	b.paused = false
+	b.pauseCond.Broadcast()
+	b.chainLock.Unlock()
+}
+
+// acquireProcessSlot reserves one of the slots for processing a block when the
+// number of blocks that may be processed concurrently is limited.  It returns
+// ProcessingBusyError without waiting when all of the slots are in use.  Every
+// successful call must be followed by a call to releaseProcessSlot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) acquireProcessSlot() error {
+	if b.processSem == nil {
+		return nil
+	}
+
+	select {
+	case b.processSem <- struct{}{}:
+		return nil
+	default:
+		str := fmt.Sprintf("the maximum number of blocks (%d) are already "+
+			"being processed", cap(b.processSem))
+		return ProcessingBusyError(str)
+	}
+}
+
+// releaseProcessSlot releases a slot previously reserved via
+// acquireProcessSlot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) releaseProcessSlot() {
+	if b.processSem != nil {
+		<-b.processSem
+	}
+}
+
+// waitUnpaused blocks until block processing is not paused.  It returns
+// ProcessingPausedError without waiting when processing is paused and the
+// BFNoWaitPaused flag is set.
+//
+// This function MUST be called with the chain state lock held (for writes).
+// The lock is released while waiting.
+func (b *BlockChain) waitUnpaused(flags BehaviorFlags) error {
+	for b.paused {
+		if flags&BFNoWaitPaused == BFNoWaitPaused {
+			return ProcessingPausedError("block processing is paused")
+		}
+		b.pauseCond.Wait()
+	}
+	return nil
+}
+
+// revalidateKnownBlock performs the context-free and contextual checks again on
+// the provided block which must already be in the block index.  It returns the
+// number of blocks the block is from the point it forks from the main chain,
+// which is zero for blocks in the main chain, in the same way as ProcessBlock.
+// The chain is not modified.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) revalidateKnownBlock(block *dcrutil.Block, flags BehaviorFlags) (int64, error) {
+	node := b.index.LookupNode(block.Hash())
+	if b.index.NodeStatus(node).KnownInvalid() {
+		str := fmt.Sprintf("block %v is known to be invalid", node.hash)
+		return 0, ruleError(ErrKnownInvalidBlock, str)
+	}
+
+	err := checkBlockSanity(block, b.timeSource, b.maxFutureBlockTime, flags,
+		b.chainParams)
+	if err != nil {
+		return 0, err
+	}
+	if node.parent != nil {
+		err = b.checkBlockContext(block, node.parent, flags)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if b.bestChain.Contains(node) {
+		return 0, nil
+	}
+	return node.height - b.bestChain.FindFork(node).height, nil
+}
+
+// processBlock is the internal implementation of ProcessBlock and
+// ProcessBlockWithView.  See their documentation for details.  The provided
+// utxo view may be nil.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) processBlock(block *dcrutil.Block, providedView *UtxoViewpoint, flags BehaviorFlags) (int64, bool, error) {
+	// Wait for block processing to be resumed when it is paused.
+	if err := b.waitUnpaused(flags); err != nil {
+		return 0, false, err
+	}
+
 	fastAdd := flags&BFFastAdd == BFFastAdd
 
 	blockHash := block.Hash()
@@ -120,20 +518,41 @@ func (b *BlockChain) ProcessBlock(block *dcrutil.Block, flags BehaviorFlags) (in
 			blockHash, block.Height(), elapsedTime)
 	}()
 
-	// The block must not already exist in the main chain or side chains.
+	// The block must not have been pruned from the block index due to
+	// having an invalid ancestor.
+	if b.index.IsPrunedInvalid(blockHash) {
+		str := fmt.Sprintf("block %v is known to have an invalid ancestor",
+			blockHash)
+		return 0, false, ruleError(ErrKnownInvalidBlock, str)
+	}
+
+	// The block must not already exist in the main chain or side chains
+	// unless it is being reprocessed.
+	reprocess := flags&BFReprocess == BFReprocess
 	if b.index.HaveBlock(blockHash) {
+		if reprocess {
+			forkLen, err := b.revalidateKnownBlock(block, flags)
+			return forkLen, false, err
+		}
 		str := fmt.Sprintf("already have block %v", blockHash)
 		return 0, false, ruleError(ErrDuplicateBlock, str)
 	}
 
-	// The block must not already exist as an orphan.
-	if _, exists := b.orphans[*blockHash]; exists {
-		str := fmt.Sprintf("already have block (orphan) %v", blockHash)
-		return 0, false, ruleError(ErrDuplicateBlock, str)
+	// The block must not already exist as an orphan unless it is being
+	// reprocessed, in which case the existing orphan is removed so it is
+	// replaced below.
+	if orphan, exists := b.orphans[*blockHash]; exists {
+		if !reprocess {
+			str := fmt.Sprintf("already have block (orphan) %v",
+				blockHash)
+			return 0, false, ruleError(ErrDuplicateOrphan, str)
+		}
+		b.removeOrphanBlock(orphan)
 	}
 
 	// Perform preliminary sanity checks on the block and its transactions.
-	err := checkBlockSanity(block, b.timeSource, flags, b.chainParams)
+	err := checkBlockSanity(block, b.timeSource, b.maxFutureBlockTime, flags,
+		b.chainParams)
 	if err != nil {
 		return 0, false, err
 	}
@@ -179,9 +598,26 @@ func (b *BlockChain) ProcessBlock(block *dcrutil.Block, flags BehaviorFlags) (in
 		}
 	}
 
-	// Handle orphan blocks.
+	// Reject blocks that build on a block that was pruned from the block
+	// index due to having an invalid ancestor since they would otherwise be
+	// treated as orphans.
 	prevHash := &blockHeader.PrevBlock
+	if b.index.IsPrunedInvalid(prevHash) {
+		str := fmt.Sprintf("previous block %s is known to have an invalid "+
+			"ancestor", prevHash)
+		return 0, false, ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	// Handle orphan blocks.
 	if !b.index.HaveBlock(prevHash) {
+		// Reject the block outright rather than adding it to the orphan
+		// pool when orphan handling is disabled.
+		if b.disableOrphans {
+			str := fmt.Sprintf("previous block %s of block %v is not "+
+				"known", prevHash, blockHash)
+			return 0, false, ruleError(ErrMissingParent, str)
+		}
+
 		log.Infof("Adding orphan block %v with parent %v", blockHash,
 			prevHash)
 		b.addOrphanBlock(block)
@@ -193,7 +629,7 @@ func (b *BlockChain) ProcessBlock(block *dcrutil.Block, flags BehaviorFlags) (in
 
 	// The block has passed all context independent checks and appears sane
 	// enough to potentially accept it into the block chain.
-	forkLen, err := b.maybeAcceptBlock(block, flags)
+	forkLen, err := b.maybeAcceptBlock(block, providedView, flags)
 	if err != nil {
 		return 0, false, err
 	}
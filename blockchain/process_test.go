@@ -0,0 +1,972 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/chaincfg"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/wire"
+)
+
+// TestDisableOrphans ensures blocks with an unknown parent are rejected instead
+// of being added to the orphan pool when orphan handling is disabled.
+func TestDisableOrphans(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "disableorphanstest")
+	defer teardownFunc()
+	g.chain.disableOrphans = true
+
+	// Create a couple of blocks and process them out of order to ensure
+	// the block with the unknown parent is rejected.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.NextBlock("b2", nil, nil)
+	g.RejectBlock("b2", ErrMissingParent)
+
+	// Ensure nothing was added to the orphan pool.
+	b2Hash := g.BlockByName("b2").BlockHash()
+	if g.chain.IsKnownOrphan(&b2Hash) {
+		t.Fatal("rejected block is unexpectedly a known orphan")
+	}
+	if root := g.chain.GetOrphanRoot(&b2Hash); *root != b2Hash {
+		t.Fatalf("unexpected orphan root -- got %v, want %v", root,
+			b2Hash)
+	}
+	if len(g.chain.orphans) != 0 || len(g.chain.prevOrphans) != 0 {
+		t.Fatalf("unexpected orphans -- got %d orphans, %d parents",
+			len(g.chain.orphans), len(g.chain.prevOrphans))
+	}
+
+	// Ensure the blocks are accepted when processed in order.
+	g.AcceptBlock("b1")
+	g.AcceptBlock("b2")
+	g.ExpectTip("b2")
+}
+
+// TestDuplicateBlock ensures resubmitting a block that is already known in
+// either the main chain or a side chain is rejected with ErrDuplicateBlock
+// while resubmitting a known orphan is rejected with ErrDuplicateOrphan.
+func TestDuplicateBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "duplicateblocktest")
+	defer teardownFunc()
+
+	// Create a main chain block, a side chain block that forks from the
+	// same parent, and a block that builds on an unknown parent.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                      \-> b1a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.NextBlock("b3", nil, nil)
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b1")
+
+	// Ensure resubmitting the main chain and side chain blocks is rejected
+	// as a duplicate block.
+	g.RejectBlock("b1", ErrDuplicateBlock)
+	g.RejectBlock("b1a", ErrDuplicateBlock)
+
+	// Submit b3 so it becomes an orphan and ensure resubmitting it is
+	// rejected as a duplicate orphan.
+	b3 := dcrutil.NewBlock(g.BlockByName("b3"))
+	_, isOrphan, err := g.chain.ProcessBlock(b3, BFNone)
+	if err != nil {
+		t.Fatalf("failed to process orphan block: %v", err)
+	}
+	if !isOrphan {
+		t.Fatal("block b3 was not treated as an orphan")
+	}
+	g.RejectBlock("b3", ErrDuplicateOrphan)
+
+	// Ensure the orphan is reported as a duplicate block once it has been
+	// connected.
+	g.AcceptBlock("b2")
+	g.ExpectTip("b3")
+	g.RejectBlock("b3", ErrDuplicateBlock)
+}
+
+// TestReprocessBlocks ensures resubmitting known orphans and known blocks with
+// the BFReprocess flag set does not result in an error.
+func TestReprocessBlocks(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reprocessblockstest")
+	defer teardownFunc()
+
+	// Create a main chain block and a block that builds on an unknown
+	// parent.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.NextBlock("b3", nil, nil)
+
+	// Submit b3 so it becomes an orphan and ensure resubmitting it with the
+	// reprocess flag replaces the orphan without an error.
+	b3 := dcrutil.NewBlock(g.BlockByName("b3"))
+	for i := 0; i < 2; i++ {
+		_, isOrphan, err := g.chain.ProcessBlock(b3, BFReprocess)
+		if err != nil {
+			t.Fatalf("failed to process orphan block (attempt %d): %v",
+				i, err)
+		}
+		if !isOrphan {
+			t.Fatalf("block b3 was not treated as an orphan (attempt %d)",
+				i)
+		}
+	}
+	if !g.chain.IsKnownOrphan(b3.Hash()) {
+		t.Fatal("block b3 is not a known orphan after reprocessing")
+	}
+
+	// Ensure resubmitting the orphan without the flag is still rejected.
+	g.RejectBlock("b3", ErrDuplicateOrphan)
+
+	// Ensure reprocessing a known main chain block succeeds without
+	// changing the tip.
+	b1 := dcrutil.NewBlock(g.BlockByName("b1"))
+	forkLen, isOrphan, err := g.chain.ProcessBlock(b1, BFReprocess)
+	if err != nil {
+		t.Fatalf("failed to reprocess block b1: %v", err)
+	}
+	if forkLen != 0 || isOrphan {
+		t.Fatalf("unexpected result reprocessing b1 -- forkLen %d, "+
+			"orphan %v", forkLen, isOrphan)
+	}
+	g.ExpectTip("b1")
+
+	// Ensure the orphan is connected once its parent is provided.
+	g.AcceptBlock("b2")
+	g.ExpectTip("b3")
+}
+
+// TestReprocessBlocksBeforeCheckpoint ensures known blocks prior to the latest
+// checkpoint may be reprocessed while new blocks that fork the main chain prior
+// to it are still rejected.
+func TestReprocessBlocksBeforeCheckpoint(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "reprocesscheckpointtest")
+	defer teardownFunc()
+
+	// Create a few main chain blocks.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+
+	// Use a checkpoint at b2 now that its hash is known.
+	b2 := g.BlockByName("b2")
+	b2Hash := b2.BlockHash()
+	g.chain.chainParams.Checkpoints = []chaincfg.Checkpoint{{
+		Height: int64(b2.Header.Height),
+		Hash:   &b2Hash,
+	}}
+
+	// Ensure reprocessing known main chain blocks before and at the
+	// checkpoint succeeds without changing the tip.
+	for _, blockName := range []string{"bp", "b1", "b2"} {
+		block := dcrutil.NewBlock(g.BlockByName(blockName))
+		forkLen, isOrphan, err := g.chain.ProcessBlock(block, BFReprocess)
+		if err != nil {
+			t.Fatalf("failed to reprocess block %s: %v", blockName, err)
+		}
+		if forkLen != 0 || isOrphan {
+			t.Fatalf("unexpected result reprocessing %s -- forkLen %d, "+
+				"orphan %v", blockName, forkLen, isOrphan)
+		}
+	}
+	g.ExpectTip("b3")
+
+	// Ensure a new block that forks the main chain before the checkpoint is
+	// still rejected.  Its timestamp is after the checkpoint so that it is
+	// not rejected for being older than the checkpoint instead.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	//                \-> b1a
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil, func(b *wire.MsgBlock) {
+		b.Header.Timestamp = b2.Header.Timestamp.Add(time.Second)
+	})
+	g.RejectTipBlock(ErrForkTooOld)
+	g.ExpectTip("b3")
+}
+
+// TestOrphanConnectedNotification ensures the NTOrphanConnected notification is
+// sent with a sensible wait duration when a block that was previously an orphan
+// is accepted once its parent is provided.
+func TestOrphanConnectedNotification(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "orphanconnectedtest")
+	defer teardownFunc()
+
+	// Record any orphan connected notifications.
+	var ntfns []*OrphanConnectedNtfnsData
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTOrphanConnected {
+			ntfns = append(ntfns, n.Data.(*OrphanConnectedNtfnsData))
+		}
+	}
+
+	// Create a couple of blocks and process the second one first so it
+	// becomes an orphan.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.NextBlock("b2", nil, nil)
+	b2 := dcrutil.NewBlock(g.BlockByName("b2"))
+	_, isOrphan, err := g.chain.ProcessBlock(b2, BFNone)
+	if err != nil {
+		t.Fatalf("failed to process orphan block: %v", err)
+	}
+	if !isOrphan {
+		t.Fatal("block b2 was not treated as an orphan")
+	}
+	if len(ntfns) != 0 {
+		t.Fatalf("unexpected notifications before parent -- got %d",
+			len(ntfns))
+	}
+
+	// Provide the parent after waiting a bit and ensure the notification
+	// fires for the orphan with a plausible wait duration.
+	const minWait = 10 * time.Millisecond
+	time.Sleep(minWait)
+	g.AcceptBlock("b1")
+	g.ExpectTip("b2")
+	if len(ntfns) != 1 {
+		t.Fatalf("unexpected number of notifications -- got %d, want 1",
+			len(ntfns))
+	}
+	if *ntfns[0].Block.Hash() != *b2.Hash() {
+		t.Fatalf("unexpected orphan block -- got %v, want %v",
+			ntfns[0].Block.Hash(), b2.Hash())
+	}
+	if ntfns[0].Wait < minWait || ntfns[0].Wait > time.Minute {
+		t.Fatalf("implausible orphan wait duration %v", ntfns[0].Wait)
+	}
+}
+
+// TestNotificationPanicRecovery ensures a panic in the notification callback is
+// only recovered when requested and that the chain continues processing
+// subsequent blocks when it is.
+func TestNotificationPanicRecovery(t *testing.T) {
+	// Ensure panics are not recovered by default.
+	params := &chaincfg.RegNetParams
+	chain, teardownFunc, err := chainSetup("ntfnpanicdefaulttest", params)
+	if err != nil {
+		t.Fatalf("failed to setup chain instance: %v", err)
+	}
+	teardownFunc()
+	if chain.recoverNtfnPanics {
+		t.Fatal("notification panics are recovered by default")
+	}
+
+	// Create a test harness initialized with the genesis block as the tip
+	// that recovers panics in the notification callback.
+	g, teardownFunc := newChaingenHarnessWithConfig(t, params,
+		"ntfnpanicrecoverytest", func(config *Config) {
+			config.RecoverNotificationPanics = true
+		})
+	defer teardownFunc()
+
+	// Panic every time a block is connected.
+	var numPanics int
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTBlockConnected {
+			numPanics++
+			panic("connected block notification panic")
+		}
+	}
+
+	// Ensure several blocks are processed despite the callback panicking
+	// for each one.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 3; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		g.AcceptTipBlock()
+	}
+	g.ExpectTip("b3")
+	if numPanics != 4 {
+		t.Fatalf("unexpected number of panicking notifications -- got %d, "+
+			"want 4", numPanics)
+	}
+}
+
+// TestOrphansResolvedNotification ensures the NTOrphansResolved notification
+// lists all of the orphans that were accepted as a result of providing the
+// block they depend on.
+func TestOrphansResolvedNotification(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "orphansresolvedtest")
+	defer teardownFunc()
+
+	// Record any orphans resolved notifications.
+	var ntfns []*OrphansResolvedNtfnsData
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTOrphansResolved {
+			ntfns = append(ntfns, n.Data.(*OrphansResolvedNtfnsData))
+		}
+	}
+
+	// Create a chain of blocks and process all of them except the first
+	// one so they become orphans.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.NextBlock("b2", nil, nil)
+	g.NextBlock("b3", nil, nil)
+	g.NextBlock("b4", nil, nil)
+	var wantOrphans []chainhash.Hash
+	for _, name := range []string{"b2", "b3", "b4"} {
+		block := dcrutil.NewBlock(g.BlockByName(name))
+		_, isOrphan, err := g.chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("failed to process orphan block %s: %v", name, err)
+		}
+		if !isOrphan {
+			t.Fatalf("block %s was not treated as an orphan", name)
+		}
+		wantOrphans = append(wantOrphans, *block.Hash())
+	}
+	if len(ntfns) != 0 {
+		t.Fatalf("unexpected notifications before parent -- got %d",
+			len(ntfns))
+	}
+
+	// Provide the root parent and ensure a single notification lists all
+	// of the orphans in the order they were accepted.
+	g.AcceptBlock("b1")
+	g.ExpectTip("b4")
+	if len(ntfns) != 1 {
+		t.Fatalf("unexpected number of notifications -- got %d, want 1",
+			len(ntfns))
+	}
+	want := OrphansResolvedNtfnsData{
+		Parent:     g.BlockByName("b1").BlockHash(),
+		NumOrphans: len(wantOrphans),
+		Orphans:    wantOrphans,
+	}
+	if !reflect.DeepEqual(*ntfns[0], want) {
+		t.Fatalf("unexpected notification data -- got %+v, want %+v",
+			*ntfns[0], want)
+	}
+}
+
+// TestOrphansAwaiting ensures the orphans waiting on a given parent block are
+// reported as expected.
+func TestOrphansAwaiting(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "orphansawaitingtest")
+	defer teardownFunc()
+
+	// Create several blocks that share the same parent along with a child
+	// of one of them and process all of them before the parent so they
+	// become orphans.
+	//
+	//   genesis -> bp -> b1 -> b2a -> b3a
+	//                      \-> b2b
+	//                      \-> b2c
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.NextBlock("b2a", nil, nil)
+	g.NextBlock("b3a", nil, nil)
+	g.SetTip("b1")
+	g.NextBlock("b2b", nil, nil)
+	g.SetTip("b1")
+	g.NextBlock("b2c", nil, nil)
+	for _, name := range []string{"b2a", "b3a", "b2b", "b2c"} {
+		block := dcrutil.NewBlock(g.BlockByName(name))
+		_, isOrphan, err := g.chain.ProcessBlock(block, BFNone)
+		if err != nil {
+			t.Fatalf("failed to process orphan block %q: %v", name, err)
+		}
+		if !isOrphan {
+			t.Fatalf("block %q was not treated as an orphan", name)
+		}
+	}
+
+	// Ensure all of the orphans that share the parent are listed while the
+	// child of one of them is listed separately.
+	want := make(map[chainhash.Hash]struct{})
+	for _, name := range []string{"b2a", "b2b", "b2c"} {
+		want[g.BlockByName(name).BlockHash()] = struct{}{}
+	}
+	b1Hash := g.BlockByName("b1").BlockHash()
+	got := g.chain.OrphansAwaiting(&b1Hash)
+	if len(got) != len(want) {
+		t.Fatalf("unexpected number of orphans -- got %d, want %d",
+			len(got), len(want))
+	}
+	for _, hash := range got {
+		if _, ok := want[hash]; !ok {
+			t.Fatalf("unexpected orphan %v", hash)
+		}
+	}
+	b2aHash := g.BlockByName("b2a").BlockHash()
+	got = g.chain.OrphansAwaiting(&b2aHash)
+	if len(got) != 1 || got[0] != g.BlockByName("b3a").BlockHash() {
+		t.Fatalf("unexpected orphans awaiting b2a -- got %v", got)
+	}
+
+	// Ensure there are no orphans awaiting a block without any.
+	bpHash := g.BlockByName("bp").BlockHash()
+	if got := g.chain.OrphansAwaiting(&bpHash); len(got) != 0 {
+		t.Fatalf("unexpected orphans awaiting bp -- got %v", got)
+	}
+
+	// Ensure providing the parent removes the orphans.
+	g.AcceptBlock("b1")
+	if got := g.chain.OrphansAwaiting(&b1Hash); len(got) != 0 {
+		t.Fatalf("unexpected orphans after accepting parent -- got %v",
+			got)
+	}
+}
+
+// TestProcessBlockWithTip ensures the best state returned when processing a
+// block reflects the result of processing it even when blocks are processed
+// concurrently.
+func TestProcessBlockWithTip(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "processblockwithtiptest")
+	defer teardownFunc()
+
+	// Ensure the returned tip is the processed block when it extends the
+	// main chain.
+	//
+	//   genesis -> bp
+	g.CreatePremineBlock("bp", 0)
+	tip, forkLen, isOrphan, err := g.chain.ProcessBlockWithTip(
+		dcrutil.NewBlock(g.Tip()), BFNone)
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	if isOrphan || forkLen != 0 {
+		t.Fatalf("unexpected result -- fork len %d, orphan %v", forkLen,
+			isOrphan)
+	}
+	if tip.Hash != g.Tip().BlockHash() {
+		t.Fatalf("unexpected tip -- got %v, want %v", tip.Hash,
+			g.Tip().BlockHash())
+	}
+
+	// Create several more blocks and process them concurrently in an
+	// arbitrary order.
+	//
+	//   genesis -> bp -> b0 -> b1 -> ... -> b#
+	const numBlocks = 10
+	blocks := make([]*dcrutil.Block, 0, numBlocks)
+	for i := 0; i < numBlocks; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+		blocks = append(blocks, dcrutil.NewBlock(g.Tip()))
+	}
+	type result struct {
+		block    *dcrutil.Block
+		tip      *BestState
+		isOrphan bool
+		err      error
+	}
+	results := make(chan result, numBlocks)
+	var wg sync.WaitGroup
+	for _, block := range blocks {
+		wg.Add(1)
+		go func(block *dcrutil.Block) {
+			defer wg.Done()
+			tip, _, isOrphan, err := g.chain.ProcessBlockWithTip(block,
+				BFNone)
+			results <- result{block, tip, isOrphan, err}
+		}(block)
+	}
+	wg.Wait()
+	close(results)
+
+	// Ensure every block that was not an orphan resulted in a tip that
+	// is the block itself.
+	for r := range results {
+		if r.err != nil {
+			t.Fatalf("failed to process block %v: %v", r.block.Hash(),
+				r.err)
+		}
+		if r.isOrphan {
+			continue
+		}
+		height := int64(r.block.MsgBlock().Header.Height)
+		if r.tip.Hash != *r.block.Hash() || r.tip.Height != height {
+			t.Fatalf("unexpected tip for block %v (height %d) -- got "+
+				"%v (height %d)", r.block.Hash(), height, r.tip.Hash,
+				r.tip.Height)
+		}
+	}
+	g.ExpectTip(fmt.Sprintf("b%d", numBlocks-1))
+}
+
+// TestSilentProcessing ensures blocks processed with the BFSilent flag do not
+// result in connected block notifications and that a single catch-up
+// notification for the final tip is sent by NotifyCurrentTip.
+func TestSilentProcessing(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "silentprocessingtest")
+	defer teardownFunc()
+
+	// Record any connected block notifications.
+	var connected [][]*dcrutil.Block
+	g.chain.notifications = func(n *Notification) {
+		if n.Type == NTBlockConnected {
+			connected = append(connected, n.Data.([]*dcrutil.Block))
+		}
+	}
+
+	// Create several blocks and process them silently.
+	//
+	//   genesis -> bp -> b1 -> ... -> b10
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	connected = nil
+	const numBlocks = 10
+	for i := 1; i <= numBlocks; i++ {
+		blockName := fmt.Sprintf("b%d", i)
+		g.NextBlock(blockName, nil, nil)
+		block := dcrutil.NewBlock(g.BlockByName(blockName))
+		forkLen, isOrphan, err := g.chain.ProcessBlock(block, BFSilent)
+		if err != nil {
+			t.Fatalf("failed to process block %s: %v", blockName, err)
+		}
+		if forkLen != 0 || isOrphan {
+			t.Fatalf("block %s was not connected to the main chain",
+				blockName)
+		}
+	}
+	g.ExpectTip(fmt.Sprintf("b%d", numBlocks))
+	if len(connected) != 0 {
+		t.Fatalf("unexpected connected notifications for silent blocks -- "+
+			"got %d", len(connected))
+	}
+
+	// Ensure exactly one catch-up notification for the current tip is sent.
+	if err := g.chain.NotifyCurrentTip(); err != nil {
+		t.Fatalf("failed to notify current tip: %v", err)
+	}
+	if len(connected) != 1 {
+		t.Fatalf("unexpected number of catch-up notifications -- got %d, "+
+			"want 1", len(connected))
+	}
+	tip, parent := g.Tip(), g.BlockByName(fmt.Sprintf("b%d", numBlocks-1))
+	if *connected[0][0].Hash() != tip.BlockHash() ||
+		*connected[0][1].Hash() != parent.BlockHash() {
+
+		t.Fatalf("unexpected catch-up notification blocks -- got %v and %v, "+
+			"want %v and %v", connected[0][0].Hash(), connected[0][1].Hash(),
+			tip.BlockHash(), parent.BlockHash())
+	}
+}
+
+// TestPauseProcessing ensures blocks submitted while block processing is
+// paused are only processed once it is resumed and that requesting not to wait
+// while paused fails with ProcessingPausedError.
+func TestPauseProcessing(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "pauseprocessingtest")
+	defer teardownFunc()
+
+	// Create a premine block and a block that builds on it.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	b1 := dcrutil.NewBlock(g.BlockByName("b1"))
+
+	// Ensure processing the block while paused without waiting fails with
+	// the expected error.
+	g.chain.Pause()
+	_, _, err := g.chain.ProcessBlock(b1, BFNoWaitPaused)
+	if _, ok := err.(ProcessingPausedError); !ok {
+		t.Fatalf("unexpected error processing block while paused -- got "+
+			"%v (%T), want %T", err, err, ProcessingPausedError(""))
+	}
+
+	// Submit the block while paused and ensure it is not processed until
+	// processing is resumed.
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := g.chain.ProcessBlock(b1, BFNone)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		t.Fatalf("block processed while paused (err: %v)", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	g.ExpectTip("bp")
+
+	g.chain.Resume()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("failed to process block after resume: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("block was not processed after resume")
+	}
+	g.ExpectTip("b1")
+}
+
+// TestMaxConcurrentBlocks ensures attempting to process more blocks than the
+// configured maximum concurrently fails with ProcessingBusyError and that the
+// limit no longer applies once the blocks being processed are done.
+func TestMaxConcurrentBlocks(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// that only allows a single block to be processed at a time.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarnessWithConfig(t, params,
+		"maxconcurrentblockstest", func(config *Config) {
+			config.MaxConcurrentBlocks = 1
+		})
+	defer teardownFunc()
+
+	// Create a premine block and a couple of blocks that build on it.
+	//
+	//   genesis -> bp -> b1 -> b2
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.NextBlock("b2", nil, nil)
+	b1 := dcrutil.NewBlock(g.BlockByName("b1"))
+
+	// Saturate the limit by pausing processing and submitting a block that
+	// waits for processing to be resumed.
+	g.chain.Pause()
+	result := make(chan error, 1)
+	go func() {
+		_, _, err := g.chain.ProcessBlock(b1, BFNone)
+		result <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(g.chain.processSem) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("block processing did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Ensure processing another block while the limit is saturated fails
+	// with the expected error.
+	b2 := dcrutil.NewBlock(g.BlockByName("b2"))
+	_, _, err := g.chain.ProcessBlock(b2, BFNone)
+	if _, ok := err.(ProcessingBusyError); !ok {
+		t.Fatalf("unexpected error processing block while busy -- got %v "+
+			"(%T), want %T", err, err, ProcessingBusyError(""))
+	}
+
+	// Resume processing and ensure the waiting block is processed and the
+	// limit no longer applies.
+	g.chain.Resume()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("failed to process block after resume: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("block was not processed after resume")
+	}
+	g.AcceptBlock("b2")
+	g.ExpectTip("b2")
+}
+
+// TestFastAddStillChecksMerkle ensures blocks processed with the BFFastAdd flag
+// are always rejected when they commit to an invalid merkle root of either
+// transaction tree and that they are only rejected when they commit to an
+// invalid ticket pool size or final lottery state when the chain instance is
+// configured to still check the header commitments.
+func TestFastAddStillChecksMerkle(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "fastaddcheckstest")
+	defer teardownFunc()
+
+	// processFastAdd processes the current tip block of the generator with
+	// the fast add flag and ensures the result matches the expectation.
+	processFastAdd := func(wantErr bool, wantCode ErrorCode) {
+		t.Helper()
+
+		block := dcrutil.NewBlock(g.Tip())
+		_, _, err := g.chain.ProcessBlock(block, BFFastAdd)
+		if !wantErr {
+			if err != nil {
+				t.Fatalf("block %q was not accepted: %v", g.TipName(),
+					err)
+			}
+			return
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != wantCode {
+			t.Fatalf("unexpected error for block %q -- got %v, want %v",
+				g.TipName(), err, wantCode)
+		}
+	}
+
+	// Advance to stake validation height so the final state of the ticket
+	// lottery is committed to and save the tip as the parent of the test
+	// blocks.
+	//
+	//   genesis -> bp -> ... -> bsv#
+	g.AdvanceToStakeValidationHeight()
+	parentName := g.TipName()
+
+	// Mungers that modify the commitments in the block header.
+	badMerkleRoot := func(b *wire.MsgBlock) {
+		b.Header.MerkleRoot = chainhash.Hash{}
+	}
+	badStakeRoot := func(b *wire.MsgBlock) {
+		b.Header.StakeRoot = chainhash.Hash{0x01}
+	}
+	badPoolSize := func(b *wire.MsgBlock) {
+		b.Header.PoolSize++
+	}
+	badFinalState := func(b *wire.MsgBlock) {
+		b.Header.FinalState[0] ^= 0xff
+	}
+
+	tests := []struct {
+		name    string               // block name
+		munge   func(*wire.MsgBlock) // modifies the block header
+		enabled bool                 // whether commitments are checked
+		wantErr bool                 // whether block is rejected
+		code    ErrorCode            // expected error code when rejected
+	}{{
+		name:    "bad merkle root, disabled",
+		munge:   badMerkleRoot,
+		enabled: false,
+		wantErr: true,
+		code:    ErrBadMerkleRoot,
+	}, {
+		name:    "bad merkle root, enabled",
+		munge:   badMerkleRoot,
+		enabled: true,
+		wantErr: true,
+		code:    ErrBadMerkleRoot,
+	}, {
+		name:    "bad stake root, disabled",
+		munge:   badStakeRoot,
+		enabled: false,
+		wantErr: true,
+		code:    ErrBadMerkleRoot,
+	}, {
+		name:    "bad stake root, enabled",
+		munge:   badStakeRoot,
+		enabled: true,
+		wantErr: true,
+		code:    ErrBadMerkleRoot,
+	}, {
+		name:    "bad pool size, enabled",
+		munge:   badPoolSize,
+		enabled: true,
+		wantErr: true,
+		code:    ErrPoolSize,
+	}, {
+		name:    "bad final state, enabled",
+		munge:   badFinalState,
+		enabled: true,
+		wantErr: true,
+		code:    ErrInvalidFinalState,
+	}, {
+		name:    "bad pool size, disabled",
+		munge:   badPoolSize,
+		enabled: false,
+		wantErr: false,
+	}, {
+		name:    "bad final state, disabled",
+		munge:   badFinalState,
+		enabled: false,
+		wantErr: false,
+	}}
+
+	// Create each block as a child of the same parent and ensure it is
+	// accepted or rejected as expected.
+	//
+	//   ... -> bsv# -> block
+	for _, test := range tests {
+		g.chain.fastAddStillChecksMerkle = test.enabled
+		g.SetTip(parentName)
+		outs := g.OldestCoinbaseOuts()
+		g.NextBlock(test.name, nil, outs[1:], test.munge)
+		processFastAdd(test.wantErr, test.code)
+	}
+}
+
+// TestProcessBlockHeaders ensures processing batches of block headers adds the
+// valid headers to the block index as header-only nodes, allows a batch to
+// build on the headers added by a previous batch, and rejects the tail of a
+// batch that contains a bad header mid-sequence.
+func TestProcessBlockHeaders(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "processheaderstest")
+	defer teardownFunc()
+
+	// Create a chain of blocks without processing them aside from the
+	// premine block along with a branch that contains a block that commits
+	// to the wrong height.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4 -> b5
+	//                                 \-> b3a -> b4abad -> b5a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	for i := 1; i <= 5; i++ {
+		g.NextBlock(fmt.Sprintf("b%d", i), nil, nil)
+	}
+	g.SetTip("b2")
+	g.NextBlock("b3a", nil, nil)
+	g.NextBlock("b4abad", nil, nil, func(b *wire.MsgBlock) {
+		b.Header.Height++
+	})
+	g.NextBlock("b5a", nil, nil)
+
+	headers := func(blockNames ...string) []*wire.BlockHeader {
+		result := make([]*wire.BlockHeader, 0, len(blockNames))
+		for _, blockName := range blockNames {
+			result = append(result, &g.BlockByName(blockName).Header)
+		}
+		return result
+	}
+
+	// The tests are run in order since each batch builds on the headers
+	// added by the previous ones.
+	tests := []struct {
+		name      string
+		headers   []*wire.BlockHeader
+		wantCount int
+		wantErr   bool
+		wantCode  ErrorCode
+	}{{
+		name:      "valid batch",
+		headers:   headers("b1", "b2"),
+		wantCount: 2,
+	}, {
+		name:      "builds on headers from previous batch",
+		headers:   headers("b3", "b4", "b5"),
+		wantCount: 3,
+	}, {
+		name:      "already known headers",
+		headers:   headers("b4", "b5"),
+		wantCount: 2,
+	}, {
+		name:      "bad header mid-sequence",
+		headers:   headers("b3a", "b4abad", "b5a"),
+		wantCount: 1,
+		wantErr:   true,
+		wantCode:  ErrBadBlockHeight,
+	}, {
+		name:      "builds on rejected header",
+		headers:   headers("b5a"),
+		wantCount: 0,
+		wantErr:   true,
+		wantCode:  ErrMissingParent,
+	}, {
+		name:      "not contiguous",
+		headers:   headers("b1", "b3"),
+		wantCount: 1,
+		wantErr:   true,
+		wantCode:  ErrMissingParent,
+	}}
+
+	for _, test := range tests {
+		count, err := g.chain.ProcessBlockHeaders(test.headers)
+		if count != test.wantCount {
+			t.Fatalf("%s: unexpected accepted count -- got %d, want %d",
+				test.name, count, test.wantCount)
+		}
+		if !test.wantErr {
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", test.name, err)
+			}
+			continue
+		}
+		rerr, ok := err.(RuleError)
+		if !ok || rerr.ErrorCode != test.wantCode {
+			t.Fatalf("%s: unexpected error -- got %v, want %v",
+				test.name, err, test.wantCode)
+		}
+	}
+
+	// Ensure the accepted headers are in the block index without their
+	// block data and the headers after the bad header are not.
+	for _, blockName := range []string{"b1", "b2", "b3", "b4", "b5", "b3a"} {
+		hash := g.BlockByName(blockName).BlockHash()
+		node := g.chain.index.LookupNode(&hash)
+		if node == nil {
+			t.Fatalf("header for block %s is not in the block index",
+				blockName)
+		}
+		if g.chain.index.NodeStatus(node).HaveData() {
+			t.Fatalf("header-only node for block %s has block data",
+				blockName)
+		}
+		if g.chain.index.HaveBlock(&hash) {
+			t.Fatalf("block %s is reported as available", blockName)
+		}
+	}
+	for _, blockName := range []string{"b4abad", "b5a"} {
+		hash := g.BlockByName(blockName).BlockHash()
+		if g.chain.index.LookupNode(&hash) != nil {
+			t.Fatalf("header for rejected block %s is in the block index",
+				blockName)
+		}
+	}
+
+	// Ensure the chain is unchanged and the blocks can still be processed
+	// with the header-only nodes being updated to have their block data.
+	g.ExpectTip("bp")
+	g.SetTip("bp")
+	for i := 1; i <= 5; i++ {
+		blockName := fmt.Sprintf("b%d", i)
+		g.AcceptBlock(blockName)
+
+		hash := g.BlockByName(blockName).BlockHash()
+		node := g.chain.index.LookupNode(&hash)
+		if !g.chain.index.NodeStatus(node).HaveData() {
+			t.Fatalf("node for processed block %s does not have block "+
+				"data", blockName)
+		}
+	}
+	g.ExpectTip("b5")
+}
@@ -116,6 +116,19 @@ func (sn *Node) ExpiredByBlock() []chainhash.Hash {
 	return expired
 }
 
+// RevokedByBlock returns the tickets that were revoked in this block.  Note
+// that these tickets also appear in the output of MissedByBlock for this block.
+func (sn *Node) RevokedByBlock() []chainhash.Hash {
+	var revoked []chainhash.Hash
+	for _, undo := range sn.databaseUndoUpdate {
+		if undo.Revoked {
+			revoked = append(revoked, undo.TicketHash)
+		}
+	}
+
+	return revoked
+}
+
 // ExistsLiveTicket returns whether or not a ticket exists in the live ticket
 // treap for this stake node.
 func (sn *Node) ExistsLiveTicket(ticket chainhash.Hash) bool {
@@ -80,13 +80,62 @@ func (b *BlockChain) LotteryDataForBlock(hash *chainhash.Hash) ([]chainhash.Hash
 	return winningTickets, poolSize, finalState, err
 }
 
-// LiveTickets returns all currently live tickets from the stake database.
+// TicketEventsForBlock returns the tickets that were missed, revoked, and spent
+// by votes in the block with the given hash, including side chain blocks.  The
+// missed tickets are those that became missed in the block, which includes
+// winning tickets that were not voted and tickets that expired, and they do not
+// include the tickets that were revoked in the block.  No tickets are returned
+// for blocks prior to the height at which stake is enabled.
 //
-// This function is NOT safe for concurrent access.
+// This function is safe for concurrent access.
+func (b *BlockChain) TicketEventsForBlock(hash *chainhash.Hash) (missed, revoked, spent []chainhash.Hash, err error) {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, nil, nil, fmt.Errorf("block %s is not known", hash)
+	}
+	if node.height < b.chainParams.StakeEnabledHeight {
+		return nil, nil, nil, nil
+	}
+
+	// The stake node might have been pruned, so ensure it is loaded.
+	stakeNode, err := b.fetchStakeNode(node)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Exclude the revoked tickets from the missed tickets since they were
+	// missed in an earlier block.
+	revoked = stakeNode.RevokedByBlock()
+	revokedSet := make(map[chainhash.Hash]struct{}, len(revoked))
+	for _, ticket := range revoked {
+		revokedSet[ticket] = struct{}{}
+	}
+	for _, ticket := range stakeNode.MissedByBlock() {
+		if _, ok := revokedSet[ticket]; !ok {
+			missed = append(missed, ticket)
+		}
+	}
+
+	return missed, revoked, stakeNode.SpentByBlock(), nil
+}
+
+// LiveTickets returns all currently live tickets as of the end of the main
+// chain.  Note that the live ticket pool can be very large, so this should be
+// used sparingly.
+//
+// This function is safe for concurrent access.
 func (b *BlockChain) LiveTickets() ([]chainhash.Hash, error) {
-	b.chainLock.RLock()
-	sn := b.bestChain.Tip().stakeNode
-	b.chainLock.RUnlock()
+	// The stake node for the tip might have been pruned, so ensure it is
+	// loaded.
+	b.chainLock.Lock()
+	sn, err := b.fetchStakeNode(b.bestChain.Tip())
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
 	return sn.LiveTickets(), nil
 }
@@ -242,3 +291,107 @@ func (b *BlockChain) TicketPoolValue() (dcrutil.Amount, error) {
 	}
 	return dcrutil.Amount(amt), nil
 }
+
+// TicketStatus identifies the status of a ticket from the point of view of the
+// end of the main chain.
+type TicketStatus int
+
+// These constants are used to identify the status of a ticket.
+const (
+	// TicketStatusUnknown indicates the ticket is not known to be live,
+	// missed, expired, or revoked.  This is the case for tickets that are
+	// still immature or have already voted as well as hashes that do not
+	// refer to a ticket at all.
+	TicketStatusUnknown TicketStatus = iota
+
+	// TicketStatusLive indicates the ticket is in the live ticket pool and
+	// is therefore eligible to be selected to vote.
+	TicketStatusLive
+
+	// TicketStatusMissed indicates the ticket was selected to vote but
+	// failed to do so and has not been revoked.
+	TicketStatusMissed
+
+	// TicketStatusExpired indicates the ticket expired without being
+	// selected to vote and has not been revoked.
+	TicketStatusExpired
+
+	// TicketStatusRevoked indicates the ticket was missed or expired and
+	// has since been revoked.
+	TicketStatusRevoked
+)
+
+// ticketStatusStrings is a map of TicketStatus values back to their constant
+// names for pretty printing.
+var ticketStatusStrings = map[TicketStatus]string{
+	TicketStatusUnknown: "TicketStatusUnknown",
+	TicketStatusLive:    "TicketStatusLive",
+	TicketStatusMissed:  "TicketStatusMissed",
+	TicketStatusExpired: "TicketStatusExpired",
+	TicketStatusRevoked: "TicketStatusRevoked",
+}
+
+// String returns the TicketStatus as a human-readable name.
+func (s TicketStatus) String() string {
+	if str := ticketStatusStrings[s]; str != "" {
+		return str
+	}
+	return fmt.Sprintf("Unknown TicketStatus (%d)", int(s))
+}
+
+// TicketStatus returns the status of the provided ticket as of the end of the
+// main chain.  This is much more efficient than enumerating the live or missed
+// tickets when only a single ticket is of interest.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) TicketStatus(ticket *chainhash.Hash) (TicketStatus, error) {
+	// The stake node for the tip might have been pruned, so ensure it is
+	// loaded.
+	b.chainLock.Lock()
+	sn, err := b.fetchStakeNode(b.bestChain.Tip())
+	b.chainLock.Unlock()
+	if err != nil {
+		return TicketStatusUnknown, err
+	}
+
+	switch {
+	case sn.ExistsLiveTicket(*ticket):
+		return TicketStatusLive, nil
+	case sn.ExistsRevokedTicket(*ticket):
+		return TicketStatusRevoked, nil
+	case sn.ExistsMissedTicket(*ticket):
+		// Expired tickets are tracked along with missed tickets until
+		// they are revoked.
+		if sn.ExistsExpiredTicket(*ticket) {
+			return TicketStatusExpired, nil
+		}
+		return TicketStatusMissed, nil
+	}
+
+	return TicketStatusUnknown, nil
+}
+
+// WinningTicketsForBlock returns the tickets that were selected as winners as
+// of the provided block, which are the tickets eligible to vote on the block
+// after it.  An empty slice is returned for blocks prior to the stake enabled
+// height since there are no winning tickets before that point.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) WinningTicketsForBlock(hash *chainhash.Hash) ([]chainhash.Hash, error) {
+	node := b.index.LookupNode(hash)
+	if node == nil {
+		return nil, fmt.Errorf("block %s is not known", hash)
+	}
+	if node.height < b.chainParams.StakeEnabledHeight {
+		return []chainhash.Hash{}, nil
+	}
+
+	b.chainLock.Lock()
+	sn, err := b.fetchStakeNode(node)
+	b.chainLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return sn.Winners(), nil
+}
@@ -56,6 +56,47 @@ func (b *BlockChain) maybeFetchNewTickets(node *blockNode) error {
 	return nil
 }
 
+// fetchNewTicketsInfo returns details about the tickets that matured and were
+// added to the live ticket pool as of the provided block node in the same
+// order as the node's new tickets.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) fetchNewTicketsInfo(node *blockNode) ([]NewTicketInfo, error) {
+	// No tickets in the live ticket pool are possible before stake enabled
+	// height.
+	if node.height < b.chainParams.StakeEnabledHeight {
+		return []NewTicketInfo{}, nil
+	}
+
+	// Load the block the new tickets were purchased in.
+	matureNode := node.RelativeAncestor(int64(b.chainParams.TicketMaturity))
+	if matureNode == nil {
+		return nil, fmt.Errorf("unable to obtain ancestor %d blocks prior "+
+			"to %s (height %d)", b.chainParams.TicketMaturity, node.hash,
+			node.height)
+	}
+	matureBlock, err := b.fetchBlockByNode(matureNode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tickets expire the configured number of blocks after they mature.
+	expiryHeight := node.height + int64(b.chainParams.TicketExpiry)
+	tickets := []NewTicketInfo{}
+	for _, stx := range matureBlock.MsgBlock().STransactions {
+		if stake.IsSStx(stx) {
+			tickets = append(tickets, NewTicketInfo{
+				Hash:           stx.TxHash(),
+				Amount:         stx.TxOut[0].Value,
+				PurchaseBlock:  matureNode.hash,
+				PurchaseHeight: matureNode.height,
+				ExpiryHeight:   expiryHeight,
+			})
+		}
+	}
+	return tickets, nil
+}
+
 // maybeFetchTicketInfo loads and populates prunable ticket information in the
 // provided block node if needed.
 //
@@ -567,6 +567,60 @@ func (b *BlockChain) StateLastChangedHeight(hash *chainhash.Hash, version uint32
 	return height, nil
 }
 
+// AgendaActivationHeight returns the height of the first main chain block for
+// which the provided consensus deployment agenda is active along with true
+// when the agenda is active as of the current best chain tip.  Zero and false
+// are returned when the agenda is not active.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) AgendaActivationHeight(version uint32, agendaID string) (int64, bool, error) {
+	// Fetch the treshold state cache for the provided deployment id as well as
+	// the condition checker.
+	var cache *thresholdStateCache
+	var checker thresholdConditionChecker
+	for k := range b.chainParams.Deployments[version] {
+		if b.chainParams.Deployments[version][k].Vote.Id == agendaID {
+			checker = deploymentChecker{
+				deployment: &b.chainParams.Deployments[version][k],
+				chain:      b,
+			}
+			cache = &b.deploymentCaches[version][k]
+			break
+		}
+	}
+	if cache == nil {
+		return 0, false, DeploymentError(agendaID)
+	}
+
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// Nothing more to do when the agenda is not active as of the current
+	// tip.  Notice that nextThresholdState always calculates the state for
+	// the block after the provided one, so use the parent to get the state
+	// for the tip itself.
+	tip := b.bestChain.Tip()
+	state, err := b.nextThresholdState(version, tip.parent, checker, cache)
+	if err != nil {
+		return 0, false, err
+	}
+	if state.State != ThresholdActive {
+		return 0, false, nil
+	}
+
+	// Since the active state is terminal, the state last changed when the
+	// agenda became active.
+	stateNode, err := b.stateLastChanged(version, tip, checker, cache)
+	if err != nil {
+		return 0, false, err
+	}
+	if stateNode == nil {
+		return 0, false, AssertError(fmt.Sprintf("agenda %s is active "+
+			"without a state change", agendaID))
+	}
+	return stateNode.height, true, nil
+}
+
 // NextThresholdState returns the current rule change threshold state of the
 // given deployment ID for the block AFTER the provided block hash.
 //
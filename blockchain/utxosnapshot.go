@@ -0,0 +1,240 @@
+// Copyright (c) 2018 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/decred/dcrd/blockchain/internal/dbnamespace"
+	"github.com/decred/dcrd/chaincfg/chainhash"
+	"github.com/decred/dcrd/database"
+	"github.com/decred/dcrd/wire"
+)
+
+// -----------------------------------------------------------------------------
+// A utxo snapshot contains the entire utxo set as of a specific block.
+//
+// The serialized format is:
+//
+//   <block hash><num entries>[<tx hash><entry len><serialized utxo entry>,...]
+//
+//   Field                  Type             Size
+//   block hash             chainhash.Hash   chainhash.HashSize
+//   num entries            uint64           8 bytes
+//   tx hash                chainhash.Hash   chainhash.HashSize
+//   entry len              uint32           4 bytes
+//   serialized utxo entry  []byte           variable
+//
+// All integers are little endian.  The entries are ordered by their
+// transaction hash and use the same serialization as the utxo set in the
+// database.  See the utxo set serialization comments in chainio.go for details.
+// -----------------------------------------------------------------------------
+
+// maxUtxoSnapshotEntrySize is the maximum size of a serialized utxo entry that
+// is accepted from a utxo snapshot.  It is used to avoid allocating large
+// amounts of memory for malformed snapshots.
+const maxUtxoSnapshotEntrySize = wire.MaxBlockPayload
+
+// WriteUtxoSnapshot writes a snapshot of the entire utxo set as of the current
+// best chain tip to the provided writer.  It returns the hash of the block the
+// snapshot is for along with the commitment to the utxo set, which is the same
+// value returned by UtxoSetHash.  The snapshot may later be loaded via
+// LoadUtxoSnapshot.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) WriteUtxoSnapshot(w io.Writer) (chainhash.Hash, chainhash.Hash, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	tipHash := b.bestChain.Tip().hash
+	var commitment chainhash.Hash
+	err := b.db.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+
+		// Count the entries so the number is known up front.
+		var numEntries uint64
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			numEntries++
+		}
+
+		var header [chainhash.HashSize + 8]byte
+		copy(header[:], tipHash[:])
+		binary.LittleEndian.PutUint64(header[chainhash.HashSize:], numEntries)
+		if _, err := w.Write(header[:]); err != nil {
+			return err
+		}
+
+		cursor = utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			txHash, err := chainhash.NewHash(cursor.Key())
+			if err != nil {
+				return err
+			}
+			serialized := cursor.Value()
+			entry, err := deserializeUtxoEntry(serialized)
+			if err != nil {
+				return err
+			}
+			commitment = rollUtxoSetCommitment(&commitment, txHash, entry)
+
+			var entryHeader [chainhash.HashSize + 4]byte
+			copy(entryHeader[:], txHash[:])
+			binary.LittleEndian.PutUint32(entryHeader[chainhash.HashSize:],
+				uint32(len(serialized)))
+			if _, err := w.Write(entryHeader[:]); err != nil {
+				return err
+			}
+			if _, err := w.Write(serialized); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return chainhash.Hash{}, chainhash.Hash{}, err
+	}
+
+	return tipHash, commitment, nil
+}
+
+// LoadUtxoSnapshot replaces the utxo set of the current best chain tip with the
+// snapshot read from the provided reader, as produced by WriteUtxoSnapshot,
+// after verifying that the snapshot is for the block with the given hash and
+// that the commitment to the utxo set it contains matches the expected
+// commitment.  The utxo set stats of the best chain state are updated
+// accordingly.  The database is not modified when any of the checks fail.
+//
+// NOTE: The block must be the current best chain tip.  Seeding the chain at
+// any other block, such as one only known by its header, is not supported
+// since connecting the blocks that follow it also requires the ticket
+// database, the stake nodes, and the spend journal as of that block, none of
+// which can be derived from the utxo set.  In other words, this is not a way to
+// bootstrap a chain from a snapshot.  It is only suitable for replacing a utxo
+// set that is suspected to be corrupt with one from a trusted source.
+//
+// NOTE: The entire utxo set is replaced within a single database transaction so
+// that it is never left partially replaced.  Since the database buffers all of
+// the writes of a transaction in memory until it is committed, this requires
+// memory proportional to the size of the entire utxo set.
+//
+// WARNING: The snapshot is trusted to be the correct utxo set for the block, so
+// it must only be loaded from a trusted source with a commitment that is known
+// to be correct by some other means.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) LoadUtxoSnapshot(r io.Reader, atHash *chainhash.Hash, expectedHash chainhash.Hash) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	tip := b.bestChain.Tip()
+	if tip.hash != *atHash {
+		if b.index.LookupNode(atHash) == nil {
+			return fmt.Errorf("block %s is not known", atHash)
+		}
+		return fmt.Errorf("utxo snapshots may only be loaded for the "+
+			"current best chain tip %s (requested %s)", tip.hash, atHash)
+	}
+
+	// Ensure the snapshot is for the requested block.
+	var header [chainhash.HashSize + 8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return fmt.Errorf("unable to read utxo snapshot header: %v", err)
+	}
+	if !bytes.Equal(header[:chainhash.HashSize], atHash[:]) {
+		var snapHash chainhash.Hash
+		copy(snapHash[:], header[:chainhash.HashSize])
+		return fmt.Errorf("utxo snapshot is for block %s instead of %s",
+			snapHash, atHash)
+	}
+	numEntries := binary.LittleEndian.Uint64(header[chainhash.HashSize:])
+
+	// Replace the utxo set with the entries from the snapshot while
+	// calculating the commitment to the new utxo set along with its stats.
+	// The database transaction is rolled back when the snapshot is invalid
+	// or its commitment does not match the expected commitment.
+	b.stateLock.RLock()
+	state := *b.stateSnapshot
+	b.stateLock.RUnlock()
+	err := b.db.Update(func(dbTx database.Tx) error {
+		meta := dbTx.Metadata()
+		if err := meta.DeleteBucket(dbnamespace.UtxoSetBucketName); err != nil {
+			return err
+		}
+		utxoBucket, err := meta.CreateBucket(dbnamespace.UtxoSetBucketName)
+		if err != nil {
+			return err
+		}
+
+		var commitment, prevTxHash chainhash.Hash
+		var numUtxos, utxoAmount int64
+		for i := uint64(0); i < numEntries; i++ {
+			var entryHeader [chainhash.HashSize + 4]byte
+			if _, err := io.ReadFull(r, entryHeader[:]); err != nil {
+				return fmt.Errorf("unable to read utxo snapshot "+
+					"entry %d: %v", i, err)
+			}
+			var txHash chainhash.Hash
+			copy(txHash[:], entryHeader[:chainhash.HashSize])
+			entryLen := binary.LittleEndian.Uint32(
+				entryHeader[chainhash.HashSize:])
+			if entryLen == 0 || entryLen > maxUtxoSnapshotEntrySize {
+				return fmt.Errorf("utxo snapshot entry %d has "+
+					"invalid size %d", i, entryLen)
+			}
+
+			// The entries must be ordered by their transaction hash
+			// to match the order the commitment is calculated in.
+			if i > 0 && bytes.Compare(txHash[:], prevTxHash[:]) <= 0 {
+				return fmt.Errorf("utxo snapshot entry %d for %s is "+
+					"out of order", i, txHash)
+			}
+			prevTxHash = txHash
+
+			serialized := make([]byte, entryLen)
+			if _, err := io.ReadFull(r, serialized); err != nil {
+				return fmt.Errorf("unable to read utxo snapshot "+
+					"entry %d: %v", i, err)
+			}
+			entry, err := deserializeUtxoEntry(serialized)
+			if err != nil {
+				return fmt.Errorf("unable to deserialize utxo "+
+					"snapshot entry %d: %v", i, err)
+			}
+			if entry.IsFullySpent() {
+				return fmt.Errorf("utxo snapshot entry %d for %s is "+
+					"fully spent", i, txHash)
+			}
+
+			commitment = rollUtxoSetCommitment(&commitment, &txHash, entry)
+			entryNumUtxos, entryAmount := utxoEntryStats(entry)
+			numUtxos += entryNumUtxos
+			utxoAmount += entryAmount
+			if err := utxoBucket.Put(txHash[:], serialized); err != nil {
+				return err
+			}
+		}
+		if commitment != expectedHash {
+			return fmt.Errorf("utxo snapshot commitment %s does not "+
+				"match the expected commitment %s", commitment,
+				expectedHash)
+		}
+
+		state.NumUtxos = numUtxos
+		state.UtxoAmount = utxoAmount
+		return dbPutBestState(dbTx, &state, tip.workSum)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.stateLock.Lock()
+	b.stateSnapshot = &state
+	b.stateLock.Unlock()
+	return nil
+}
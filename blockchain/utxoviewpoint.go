@@ -7,12 +7,15 @@ package blockchain
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/decred/dcrd/blockchain/internal/dbnamespace"
 	"github.com/decred/dcrd/blockchain/stake"
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/database"
 	"github.com/decred/dcrd/dcrutil"
 	"github.com/decred/dcrd/txscript"
+	"github.com/decred/dcrd/wire"
 )
 
 // StakeViewpoint is the viewpoint of the blockchain depending on stake
@@ -717,6 +720,132 @@ func (b *BlockChain) disconnectTransactions(view *UtxoViewpoint, block *dcrutil.
 	return nil
 }
 
+// replayUtxoView reconstructs the view a block was connected with from the
+// spend journal and the block data alone.  The outputs spent by the block are
+// seeded into a new view using the spend journal entries, and the transactions
+// the block connects are then applied to it, so the result contains the spent
+// outputs along with the outputs created by the block just as the view passed
+// to the index manager does when the block is connected live.
+//
+// Transaction level details such as the height of the transaction that created
+// a spent output are only recorded by the spend journal when the transaction
+// was fully spent, so they are loaded from the current utxo set otherwise and
+// left zeroed when they are no longer available there.  The amounts and
+// scripts of the spent outputs are always exact.
+//
+// The passed database transaction is only used for reading.
+func replayUtxoView(dbTx database.Tx, block, parent *dcrutil.Block) (*UtxoViewpoint, error) {
+	view := NewUtxoViewpoint()
+	if parent == nil || block.Height() == 0 {
+		view.SetBestHash(block.Hash())
+		return view, nil
+	}
+
+	stxos, err := dbFetchSpendJournalEntry(dbTx, block, parent)
+	if err != nil {
+		return nil, err
+	}
+	if len(stxos) != countSpentOutputs(block, parent) {
+		return nil, AssertError(fmt.Sprintf("replayUtxoView called with "+
+			"bad spent transaction out information (len stxos %v, "+
+			"count is %v)", len(stxos), countSpentOutputs(block, parent)))
+	}
+
+	// Determine the transactions connected by the block in the same order
+	// the spend journal records their inputs.
+	regularTxTreeValid := headerApprovesParent(&block.MsgBlock().Header)
+	var connected []*dcrutil.Tx
+	if regularTxTreeValid {
+		connected = append(connected, parent.Transactions()...)
+	}
+	connected = append(connected, block.STransactions()...)
+	created := make(map[chainhash.Hash]struct{}, len(connected))
+	for _, tx := range connected {
+		created[*tx.Hash()] = struct{}{}
+	}
+
+	// Seed the view with the outputs spent by the block.  Outputs created
+	// by the block itself are skipped since they are added when the
+	// transaction that creates them is connected below.
+	stxoIdx := 0
+	for _, tx := range connected {
+		msgTx := tx.MsgTx()
+		if IsCoinBaseTx(msgTx) {
+			continue
+		}
+		tt := stake.DetermineTxType(msgTx)
+		for txInIdx, txIn := range msgTx.TxIn {
+			if txInIdx == 0 && tt == stake.TxTypeSSGen {
+				continue
+			}
+			stxo := &stxos[stxoIdx]
+			stxoIdx++
+
+			originHash := &txIn.PreviousOutPoint.Hash
+			if _, ok := created[*originHash]; ok {
+				continue
+			}
+			entry := view.LookupEntry(originHash)
+			if entry == nil {
+				if stxo.txFullySpent {
+					entry = newUtxoEntry(stxo.txVersion, stxo.height,
+						stxo.index, stxo.isCoinBase, stxo.hasExpiry,
+						stxo.txType)
+					if stxo.txType == stake.TxTypeSStx {
+						entry.stakeExtra = stxo.stakeExtra
+					}
+				} else {
+					dbEntry, err := dbFetchUtxoEntry(dbTx, originHash)
+					if err != nil {
+						return nil, err
+					}
+					if dbEntry != nil {
+						entry = newUtxoEntry(dbEntry.txVersion,
+							dbEntry.height, dbEntry.index,
+							dbEntry.isCoinBase, dbEntry.hasExpiry,
+							dbEntry.txType)
+						entry.stakeExtra = dbEntry.stakeExtra
+					} else {
+						entry = newUtxoEntry(0, 0, 0, false, false,
+							stxo.txType)
+					}
+				}
+				view.entries[*originHash] = entry
+			}
+			entry.sparseOutputs[txIn.PreviousOutPoint.Index] = &utxoOutput{
+				compressed:    stxo.compressed,
+				amount:        txIn.ValueIn,
+				scriptVersion: stxo.scriptVersion,
+				pkScript:      stxo.pkScript,
+			}
+		}
+	}
+
+	// Connect the transactions of the block to the view in the same order
+	// they are connected live.
+	if regularTxTreeValid {
+		view.SetStakeViewpoint(ViewpointPrevValidInitial)
+		for i, tx := range parent.Transactions() {
+			err := view.connectTransaction(tx, parent.Height(), uint32(i), nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	view.SetStakeViewpoint(ViewpointPrevInvalidStake)
+	if regularTxTreeValid {
+		view.SetStakeViewpoint(ViewpointPrevValidStake)
+	}
+	for i, stx := range block.STransactions() {
+		err := view.connectTransaction(stx, block.Height(), uint32(i), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	view.SetBestHash(block.Hash())
+	return view, nil
+}
+
 // disconnectTransactionSlice updates the view by removing all of the transactions
 // created by the passed slice of transactions, restoring all utxos the
 // transactions spent by using the provided spent txo information, and setting
@@ -728,9 +857,6 @@ func (view *UtxoViewpoint) disconnectTransactionSlice(transactions []*dcrutil.Tx
 
 	stxos := *stxosPtr
 	stxoIdx := len(stxos) - 1
-	if stxoIdx == -1 {
-		return 0, nil
-	}
 	for txIdx := len(transactions) - 1; txIdx > -1; txIdx-- {
 		tx := transactions[txIdx]
 		msgTx := tx.MsgTx()
@@ -902,6 +1028,22 @@ func (view *UtxoViewpoint) fetchUtxos(db database.DB, txSet map[chainhash.Hash]s
 	return view.fetchUtxosMain(db, txNeededSet)
 }
 
+// addUnmodifiedEntries adds copies of all of the entries in the provided view
+// that have not been modified since they were loaded and are not already in
+// the view.  Modified entries are skipped since they might not reflect the
+// state of the utxo set as of the best hash of the view.
+func (view *UtxoViewpoint) addUnmodifiedEntries(other *UtxoViewpoint) {
+	for txHash, entry := range other.entries {
+		if entry == nil || entry.modified {
+			continue
+		}
+		if _, ok := view.entries[txHash]; ok {
+			continue
+		}
+		view.entries[txHash] = entry.Clone()
+	}
+}
+
 // fetchInputUtxos loads utxo details about the input transactions referenced
 // by the transactions in the given block into the view from the database as
 // needed.  In particular, referenced entries that are earlier in the block are
@@ -1139,6 +1281,48 @@ func (b *BlockChain) FetchUtxoView(tx *dcrutil.Tx, treeValid bool) (*UtxoViewpoi
 	return view, err
 }
 
+// FetchUtxoViewForTxns loads utxo details about the input transactions
+// referenced by all of the passed transactions from the point of view of the
+// end of the main chain.  Unlike FetchUtxoView, the view only contains entries
+// for the referenced transactions.  Referenced transactions that do not exist
+// in the utxo set have nil entries.
+//
+// Note that the regular transaction tree of the current tip is not considered
+// since it has not been approved yet.  This is the same view of the utxo set
+// FetchUtxoView provides when treeValid is false.
+//
+// This function is safe for concurrent access however the returned view is NOT.
+func (b *BlockChain) FetchUtxoViewForTxns(txs []*dcrutil.Tx) (*UtxoViewpoint, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	// Create a set of needed transactions based on those referenced by the
+	// inputs of the passed transactions.
+	txNeededSet := make(map[chainhash.Hash]struct{})
+	for _, tx := range txs {
+		msgTx := tx.MsgTx()
+		if IsCoinBaseTx(msgTx) {
+			continue
+		}
+		isSSGen := stake.IsSSGen(msgTx)
+		for i, txIn := range msgTx.TxIn {
+			// Ignore stakebases.
+			if isSSGen && i == 0 {
+				continue
+			}
+			txNeededSet[txIn.PreviousOutPoint.Hash] = struct{}{}
+		}
+	}
+
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&b.bestChain.Tip().hash)
+	err := view.fetchUtxosMain(b.db, txNeededSet)
+	if err != nil {
+		return nil, err
+	}
+	return view, nil
+}
+
 // FetchUtxoEntry loads and returns the unspent transaction output entry for the
 // passed hash from the point of view of the end of the main chain.
 //
@@ -1154,7 +1338,7 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 	defer b.chainLock.RUnlock()
 
 	var entry *UtxoEntry
-	err := b.db.View(func(dbTx database.Tx) error {
+	err := b.readDB.View(func(dbTx database.Tx) error {
 		var err error
 		entry, err = dbFetchUtxoEntry(dbTx, txHash)
 		return err
@@ -1165,3 +1349,98 @@ func (b *BlockChain) FetchUtxoEntry(txHash *chainhash.Hash) (*UtxoEntry, error)
 
 	return entry, nil
 }
+
+// UtxoViewAtHeight returns a utxo viewpoint from the point of view of the main
+// chain block at the provided height, as it was immediately after the block was
+// connected.  The view is constructed by undoing the transactions of all of the
+// main chain blocks after the target block using the spend journal, so it only
+// contains entries for the transactions those blocks created or spent.  The
+// state of all other transactions is the same as in the current utxo set.
+//
+// The chain state is not modified.  However, keep in mind that this requires
+// loading every block after the target block along with its spend journal
+// entry, so it becomes increasingly expensive the deeper the target block is
+// buried.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) UtxoViewAtHeight(height int64) (*UtxoViewpoint, error) {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	node := b.bestChain.NodeByHeight(height)
+	if node == nil {
+		return nil, fmt.Errorf("no main chain block at height %d (tip "+
+			"height %d)", height, b.bestChain.Tip().height)
+	}
+
+	return b.mainChainViewForNode(node)
+}
+
+// ForEachUtxo invokes the provided function with the outpoint and containing
+// utxo entry of every unspent transaction output in the utxo set as of the end
+// of the main chain.  The outputs of each entry are visited in order of their
+// output index.  Iteration stops and the error is returned when the function
+// returns an error.
+//
+// The entire utxo set is read from a single database transaction so that it
+// reflects a consistent point in time.  Note that this can be very expensive
+// since it visits every unspent output in the utxo set.
+//
+// The provided function must not call any other chain functions since the
+// chain state lock is held (for reads) while it is invoked.  The passed entry
+// must also not be retained or modified.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) ForEachUtxo(fn func(op wire.OutPoint, entry *UtxoEntry) error) error {
+	b.chainLock.RLock()
+	defer b.chainLock.RUnlock()
+
+	return b.readDB.View(func(dbTx database.Tx) error {
+		utxoBucket := dbTx.Metadata().Bucket(dbnamespace.UtxoSetBucketName)
+		cursor := utxoBucket.Cursor()
+		for ok := cursor.First(); ok; ok = cursor.Next() {
+			var txHash chainhash.Hash
+			copy(txHash[:], cursor.Key())
+			entry, err := deserializeUtxoEntry(cursor.Value())
+			if err != nil {
+				// Ensure any deserialization errors are returned as
+				// database corruption errors.
+				if isDeserializeErr(err) {
+					return database.Error{
+						ErrorCode: database.ErrCorruption,
+						Description: fmt.Sprintf("corrupt utxo "+
+							"entry for %v: %v", txHash, err),
+					}
+				}
+
+				return err
+			}
+
+			tree := wire.TxTreeRegular
+			if entry.txType != stake.TxTypeRegular {
+				tree = wire.TxTreeStake
+			}
+
+			outputIndexes := make([]int, 0, len(entry.sparseOutputs))
+			for outputIndex, output := range entry.sparseOutputs {
+				if !output.spent {
+					outputIndexes = append(outputIndexes,
+						int(outputIndex))
+				}
+			}
+			sort.Ints(outputIndexes)
+			for _, outputIndex := range outputIndexes {
+				op := wire.OutPoint{
+					Hash:  txHash,
+					Index: uint32(outputIndex),
+					Tree:  tree,
+				}
+				if err := fn(op, entry); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -485,9 +485,12 @@ func CheckProofOfWork(header *wire.BlockHeader, powLimit *big.Int) error {
 // ensure it is sane before continuing with processing.  These checks are
 // context free.
 //
+// The maximum future block time specifies how far ahead of the adjusted time
+// provided by the time source the block timestamp is allowed to be.
+//
 // The flags do not modify the behavior of this function directly, however they
 // are needed to pass along to checkProofOfWork.
-func checkBlockHeaderSanity(header *wire.BlockHeader, timeSource MedianTimeSource, flags BehaviorFlags, chainParams *chaincfg.Params) error {
+func checkBlockHeaderSanity(header *wire.BlockHeader, timeSource MedianTimeSource, maxFutureBlockTime time.Duration, flags BehaviorFlags, chainParams *chaincfg.Params) error {
 	// The stake validation height should always be at least stake enabled
 	// height, so assert it because the code below relies on that assumption.
 	stakeValidationHeight := uint32(chainParams.StakeValidationHeight)
@@ -518,8 +521,7 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, timeSource MedianTimeSourc
 	}
 
 	// Ensure the block time is not too far in the future.
-	maxTimestamp := timeSource.AdjustedTime().Add(time.Second *
-		MaxTimeOffsetSeconds)
+	maxTimestamp := timeSource.AdjustedTime().Add(maxFutureBlockTime)
 	if header.Timestamp.After(maxTimestamp) {
 		str := fmt.Sprintf("block timestamp of %v is too far in the "+
 			"future", header.Timestamp)
@@ -601,12 +603,14 @@ func checkBlockHeaderSanity(header *wire.BlockHeader, timeSource MedianTimeSourc
 // sane before continuing with block processing.  These checks are context
 // free.
 //
-// The flags do not modify the behavior of this function directly, however they
-// are needed to pass along to checkBlockHeaderSanity.
-func checkBlockSanity(block *dcrutil.Block, timeSource MedianTimeSource, flags BehaviorFlags, chainParams *chaincfg.Params) error {
+// The maximum future block time and flags do not modify the behavior of this
+// function directly, however they are needed to pass along to
+// checkBlockHeaderSanity.
+func checkBlockSanity(block *dcrutil.Block, timeSource MedianTimeSource, maxFutureBlockTime time.Duration, flags BehaviorFlags, chainParams *chaincfg.Params) error {
 	msgBlock := block.MsgBlock()
 	header := &msgBlock.Header
-	err := checkBlockHeaderSanity(header, timeSource, flags, chainParams)
+	err := checkBlockHeaderSanity(header, timeSource, maxFutureBlockTime,
+		flags, chainParams)
 	if err != nil {
 		return err
 	}
@@ -899,7 +903,8 @@ func checkBlockSanity(block *dcrutil.Block, timeSource MedianTimeSource, flags B
 // sane before continuing with block processing.  These checks are context
 // free.
 func CheckBlockSanity(block *dcrutil.Block, timeSource MedianTimeSource, chainParams *chaincfg.Params) error {
-	return checkBlockSanity(block, timeSource, BFNone, chainParams)
+	return checkBlockSanity(block, timeSource,
+		time.Second*MaxTimeOffsetSeconds, BFNone, chainParams)
 }
 
 // checkBlockHeaderContext peforms several validation checks on the block
@@ -983,11 +988,15 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 	// chain before it.  This prevents storage of new, otherwise valid,
 	// blocks which build off of old blocks that are likely at a much easier
 	// difficulty and therefore could be used to waste cache and disk space.
+	// Blocks that are already in the block index are not new, so they are
+	// excluded in order to allow them to be revalidated.
 	checkpointNode, err := b.findPreviousCheckpoint()
 	if err != nil {
 		return err
 	}
-	if checkpointNode != nil && blockHeight < checkpointNode.height {
+	if checkpointNode != nil && blockHeight < checkpointNode.height &&
+		b.index.LookupNode(&blockHash) == nil {
+
 		str := fmt.Sprintf("block at height %d forks the main chain "+
 			"before the previous checkpoint at height %d",
 			blockHeight, checkpointNode.height)
@@ -1059,30 +1068,45 @@ func (b *BlockChain) checkBlockHeaderContext(header *wire.BlockHeader, prevNode
 			}
 		}
 
-		// Ensure the header commits to the correct pool size based on
-		// its position within the chain.
-		parentStakeNode, err := b.fetchStakeNode(prevNode)
+		// Ensure the header commits to the correct ticket pool size and
+		// final state of the ticket lottery.
+		err := b.checkHeaderTicketCommitments(header, prevNode)
 		if err != nil {
 			return err
 		}
-		calcPoolSize := uint32(parentStakeNode.PoolSize())
-		if header.PoolSize != calcPoolSize {
-			errStr := fmt.Sprintf("block header commitment to "+
-				"pool size %d does not match expected size %d",
-				header.PoolSize, calcPoolSize)
-			return ruleError(ErrPoolSize, errStr)
-		}
+	}
 
-		// Ensure the header commits to the correct final state of the
-		// ticket lottery.
-		calcFinalState := parentStakeNode.FinalState()
-		if header.FinalState != calcFinalState {
-			errStr := fmt.Sprintf("block header commitment to "+
-				"final state of the ticket lottery %x does not "+
-				"match expected value %x", header.FinalState,
-				calcFinalState)
-			return ruleError(ErrInvalidFinalState, errStr)
-		}
+	return nil
+}
+
+// checkHeaderTicketCommitments ensures the provided block header commits to the
+// correct ticket pool size and final state of the ticket lottery based on its
+// position within the block chain.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) checkHeaderTicketCommitments(header *wire.BlockHeader, prevNode *blockNode) error {
+	// Ensure the header commits to the correct pool size based on its
+	// position within the chain.
+	parentStakeNode, err := b.fetchStakeNode(prevNode)
+	if err != nil {
+		return err
+	}
+	calcPoolSize := uint32(parentStakeNode.PoolSize())
+	if header.PoolSize != calcPoolSize {
+		errStr := fmt.Sprintf("block header commitment to pool size %d "+
+			"does not match expected size %d", header.PoolSize,
+			calcPoolSize)
+		return ruleError(ErrPoolSize, errStr)
+	}
+
+	// Ensure the header commits to the correct final state of the ticket
+	// lottery.
+	calcFinalState := parentStakeNode.FinalState()
+	if header.FinalState != calcFinalState {
+		errStr := fmt.Sprintf("block header commitment to final state of "+
+			"the ticket lottery %x does not match expected value %x",
+			header.FinalState, calcFinalState)
+		return ruleError(ErrInvalidFinalState, errStr)
 	}
 
 	return nil
@@ -1202,6 +1226,9 @@ func (b *BlockChain) checkAllowedRevocations(parentStakeNode *stake.Node, block
 // The flags modify the behavior of this function as follows:
 //  - BFFastAdd: The transactions are not checked to see if they are finalized
 //    and the somewhat expensive duplication transaction check is not performed.
+//    The header commitments to the ticket pool size and final state of the
+//    ticket lottery are still checked when the chain instance was configured
+//    to do so via FastAddStillChecksMerkle.
 //
 // The flags are also passed to checkBlockHeaderContext.  See its documentation
 // for how the flags modify its behavior.
@@ -1219,6 +1246,12 @@ func (b *BlockChain) checkBlockContext(block *dcrutil.Block, prevNode *blockNode
 	}
 
 	fastAdd := flags&BFFastAdd == BFFastAdd
+	if fastAdd && b.fastAddStillChecksMerkle {
+		err := b.checkHeaderTicketCommitments(header, prevNode)
+		if err != nil {
+			return err
+		}
+	}
 	if !fastAdd {
 		// A block must not exceed the maximum allowed size as defined
 		// by the network parameters and the current status of any hard
@@ -2706,11 +2739,15 @@ func (b *BlockChain) consensusScriptVerifyFlags(node *blockNode) (txscript.Scrip
 // signature operations per block, invalid values in relation to the expected
 // block subsidy, or fail transaction script validation.
 //
+// Script validation is skipped when the assume valid flag is set, which must
+// only be the case for blocks that are being connected to the main chain and
+// are assumed to be valid per assumedValid.
+//
 // The CheckConnectBlockTemplate function makes use of this function to perform
 // the bulk of its work.
 //
 // This function MUST be called with the chain state lock held (for writes).
-func (b *BlockChain) checkConnectBlock(node *blockNode, block, parent *dcrutil.Block, utxoView *UtxoViewpoint, stxos *[]spentTxOut) error {
+func (b *BlockChain) checkConnectBlock(node *blockNode, block, parent *dcrutil.Block, utxoView *UtxoViewpoint, stxos *[]spentTxOut, assumeValid bool) error {
 	// If the side chain blocks end up in the database, a call to
 	// CheckBlockSanity should be done here in case a previous version
 	// allowed a block that is no longer valid.  However, since the
@@ -2743,6 +2780,11 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block, parent *dcrutil.B
 	if checkpoint != nil && node.height <= checkpoint.Height {
 		runScripts = false
 	}
+
+	// Likewise, don't run scripts if the block is assumed to be valid.
+	if assumeValid {
+		runScripts = false
+	}
 	var scriptFlags txscript.ScriptFlags
 	if runScripts {
 		var err error
@@ -2906,7 +2948,7 @@ func (b *BlockChain) checkConnectBlock(node *blockNode, block, parent *dcrutil.B
 
 	// Rollback the final tx tree regular so that we don't write it to
 	// database.
-	if node.height > 1 && stxos != nil {
+	if stxos != nil {
 		idx, err := utxoView.disconnectTransactionSlice(block.Transactions(),
 			node.height, stxos)
 		if err != nil {
@@ -2969,7 +3011,8 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *dcrutil.Block) error {
 	}
 
 	// Perform context-free sanity checks on the block and its transactions.
-	err := checkBlockSanity(block, b.timeSource, flags, b.chainParams)
+	err := checkBlockSanity(block, b.timeSource, b.maxFutureBlockTime, flags,
+		b.chainParams)
 	if err != nil {
 		return err
 	}
@@ -2995,7 +3038,7 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *dcrutil.Block) error {
 
 		view := NewUtxoViewpoint()
 		view.SetBestHash(&tip.hash)
-		return b.checkConnectBlock(newNode, block, parent, view, nil)
+		return b.checkConnectBlock(newNode, block, parent, view, nil, false)
 	}
 
 	// At this point, the block template must be building on the parent of the
@@ -3034,5 +3077,156 @@ func (b *BlockChain) CheckConnectBlockTemplate(block *dcrutil.Block) error {
 	// The view is now from the point of view of the parent of the current tip
 	// block.  Ensure the block template can be connected without violating any
 	// rules.
-	return b.checkConnectBlock(newNode, block, parent, view, nil)
+	return b.checkConnectBlock(newNode, block, parent, view, nil, false)
+}
+
+// mainChainViewForNode returns a utxo viewpoint from the point of view of the
+// provided main chain node.  The view is constructed by undoing the
+// transactions of all of the main chain blocks after the node using the spend
+// journal.
+//
+// No state is modified.
+//
+// This function MUST be called with the chain state lock held (for reads).
+func (b *BlockChain) mainChainViewForNode(node *blockNode) (*UtxoViewpoint, error) {
+	tip := b.bestChain.Tip()
+	view := NewUtxoViewpoint()
+	view.SetBestHash(&tip.hash)
+	view.SetStakeViewpoint(ViewpointPrevValidInitial)
+
+	var nextBlockToDetach *dcrutil.Block
+	for n := tip; n != nil && n != node; n = n.parent {
+		block := nextBlockToDetach
+		if block == nil {
+			var err error
+			block, err = b.fetchMainChainBlockByNode(n)
+			if err != nil {
+				return nil, err
+			}
+		}
+		parent, err := b.fetchMainChainBlockByNode(n.parent)
+		if err != nil {
+			return nil, err
+		}
+		nextBlockToDetach = parent
+
+		var stxos []spentTxOut
+		err = b.db.View(func(dbTx database.Tx) error {
+			stxos, err = dbFetchSpendJournalEntry(dbTx, block, parent)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = b.disconnectTransactions(view, block, parent, stxos)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return view, nil
+}
+
+// dryRunViewForNode returns a utxo viewpoint from the point of view of the
+// provided node along with the block associated with the node.  The view is
+// constructed by undoing the transactions of any main chain blocks after the
+// point the node forks from the main chain and then applying the transactions
+// of any side chain blocks leading up to the node.  Side chain blocks that are
+// not already known to be valid are fully validated along the way.
+//
+// Neither the chain state nor the validation state of nodes in the block index
+// are modified.
+//
+// This function MUST be called with the chain state lock held (for writes).
+func (b *BlockChain) dryRunViewForNode(node *blockNode) (*UtxoViewpoint, *dcrutil.Block, error) {
+	// Undo the transactions and spend information for all of the main chain
+	// blocks back to the fork point.
+	forkNode := b.bestChain.FindFork(node)
+	view, err := b.mainChainViewForNode(forkNode)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Apply the transactions of all of the side chain blocks from the fork
+	// point up to and including the node.
+	var attachNodes []*blockNode
+	for n := node; n != nil && n != forkNode; n = n.parent {
+		attachNodes = append(attachNodes, n)
+	}
+	parent, err := b.fetchMainChainBlockByNode(forkNode)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(attachNodes) - 1; i >= 0; i-- {
+		n := attachNodes[i]
+		block, err := b.fetchBlockByNode(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.index.NodeStatus(n).KnownValid() {
+			err = b.connectTransactions(view, block, parent, nil)
+		} else {
+			err = b.checkConnectBlock(n, block, parent, view, nil, false)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		parent = block
+	}
+
+	return view, parent, nil
+}
+
+// CheckBlock fully validates that the passed block would be accepted when
+// connected to its parent without actually adding it to the block index or
+// otherwise modifying the chain state.  The parent of the block must be known,
+// however, it may be on a side chain.  This is useful for verifying candidate
+// blocks prior to broadcasting them.
+//
+// The flags modify the behavior of this function as follows:
+//  - BFNoPoWCheck: The check to ensure the block hash is less than the target
+//    difficulty is not performed.
+//
+// This function is safe for concurrent access.
+func (b *BlockChain) CheckBlock(block *dcrutil.Block, flags BehaviorFlags) error {
+	b.chainLock.Lock()
+	defer b.chainLock.Unlock()
+
+	// The parent of the block must be known and must not be known to be
+	// invalid.
+	parentHash := &block.MsgBlock().Header.PrevBlock
+	prevNode := b.index.LookupNode(parentHash)
+	if prevNode == nil {
+		str := fmt.Sprintf("previous block %s is not known", parentHash)
+		return ruleError(ErrMissingParent, str)
+	}
+	if b.index.NodeStatus(prevNode).KnownInvalid() {
+		str := fmt.Sprintf("previous block %s is known to be invalid",
+			parentHash)
+		return ruleError(ErrInvalidAncestorBlock, str)
+	}
+
+	// Perform context-free sanity checks on the block and its transactions.
+	err := checkBlockSanity(block, b.timeSource, b.maxFutureBlockTime, flags,
+		b.chainParams)
+	if err != nil {
+		return err
+	}
+
+	// The block must pass all of the validation rules which depend on the
+	// position of the block within the block chain.
+	err = b.checkBlockContext(block, prevNode, flags)
+	if err != nil {
+		return err
+	}
+
+	// Ensure the block can be connected to its parent without violating
+	// any rules.
+	view, parent, err := b.dryRunViewForNode(prevNode)
+	if err != nil {
+		return err
+	}
+	newNode := newBlockNode(&block.MsgBlock().Header, prevNode)
+	newNode.populateTicketInfo(stake.FindSpentTicketsInBlock(block.MsgBlock()))
+	return b.checkConnectBlock(newNode, block, parent, view, nil, false)
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/decred/dcrd/chaincfg/chainhash"
 	"github.com/decred/dcrd/database"
 	"github.com/decred/dcrd/dcrutil"
+	"github.com/decred/dcrd/txscript"
 	"github.com/decred/dcrd/wire"
 )
 
@@ -240,6 +241,57 @@ func TestCheckBlockSanity(t *testing.T) {
 	}
 }
 
+// TestMaxFutureBlockTime ensures the maximum amount of time a block timestamp is
+// allowed to be ahead of the adjusted time is configurable and that it may not
+// be overridden on the main network.
+func TestMaxFutureBlockTime(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip
+	// and configured with a tightened allowed future block time.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarnessWithConfig(t, params,
+		"maxfutureblocktimetest", func(config *Config) {
+			config.MaxFutureBlockTime = time.Minute
+		})
+	defer teardownFunc()
+
+	// Create a block with a timestamp further in the future than allowed
+	// by the tightened limit, but well within the consensus limit, and
+	// ensure it is rejected.
+	//
+	//   genesis -> bp -> b1
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil, func(b *wire.MsgBlock) {
+		b.Header.Timestamp = time.Unix(time.Now().Add(10*time.Minute).Unix(),
+			0)
+	})
+	g.RejectTipBlock(ErrTimeTooNew)
+
+	// Ensure the same blocks are accepted by a chain instance created with
+	// the default configuration, which uses the consensus limit.
+	defaultChain, teardownDefault, err := chainSetup(
+		"maxfutureblocktimedefaulttest", params)
+	if err != nil {
+		t.Fatalf("Failed to setup chain instance: %v", err)
+	}
+	defer teardownDefault()
+	g.chain = defaultChain
+	g.AcceptBlock("bp")
+	g.AcceptTipBlock()
+
+	// Ensure the limit may not be overridden on the main network.
+	_, err = New(&Config{
+		DB:                 g.chain.db,
+		ChainParams:        &chaincfg.MainNetParams,
+		TimeSource:         NewMedianTime(),
+		MaxFutureBlockTime: time.Minute,
+	})
+	if err == nil {
+		t.Fatal("overriding the max future block time on the main " +
+			"network did not fail")
+	}
+}
+
 // TestCheckBlockHeaderContext tests that genesis block passes context headers
 // because its parent is nil.
 func TestCheckBlockHeaderContext(t *testing.T) {
@@ -866,3 +918,75 @@ func TestCheckConnectBlockTemplate(t *testing.T) {
 	g.NextBlock("b4ct", outs[3], ticketOuts[3], changeNonce)
 	acceptedBlockTemplate()
 }
+
+// TestCheckBlock ensures that checking whether or not a block would be accepted
+// reports the expected results for valid and invalid blocks without modifying
+// the chain state.
+func TestCheckBlock(t *testing.T) {
+	// Create a test harness initialized with the genesis block as the tip.
+	params := &chaincfg.RegNetParams
+	g, teardownFunc := newChaingenHarness(t, params, "checkblocktest")
+	defer teardownFunc()
+
+	// Create a main chain and a side chain along with candidate blocks that
+	// build on them, a candidate block with a transaction that spends an
+	// output that does not exist, and a block with an unknown parent.
+	//
+	//   genesis -> bp -> b1 -> b2 -> b3 -> b4
+	//                 |           \-> b3bad
+	//                  \-> b1a -> b2a
+	g.CreatePremineBlock("bp", 0)
+	g.AcceptTipBlock()
+	g.NextBlock("b1", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b2", nil, nil)
+	g.AcceptTipBlock()
+	g.NextBlock("b3", nil, nil)
+	g.NextBlock("b4", nil, nil)
+	g.SetTip("b2")
+	g.NextBlock("b3bad", nil, nil, func(b *wire.MsgBlock) {
+		missingOut := wire.NewOutPoint(&chainhash.Hash{0x01}, 0,
+			wire.TxTreeRegular)
+		tx := wire.NewMsgTx()
+		tx.AddTxIn(wire.NewTxIn(missingOut, 1, nil))
+		tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_TRUE}))
+		b.AddTransaction(tx)
+	})
+	g.SetTip("bp")
+	g.NextBlock("b1a", nil, nil)
+	g.AcceptedToSideChainWithExpectedTip("b2")
+	g.NextBlock("b2a", nil, nil)
+
+	tests := []struct {
+		name     string
+		block    string
+		wantCode ErrorCode
+		wantErr  bool
+	}{
+		{"valid extending main chain", "b3", 0, false},
+		{"valid extending side chain", "b2a", 0, false},
+		{"spends missing output", "b3bad", ErrMissingTxOut, true},
+		{"unknown parent", "b4", ErrMissingParent, true},
+	}
+	for _, test := range tests {
+		block := dcrutil.NewBlock(g.BlockByName(test.block))
+		err := g.chain.CheckBlock(block, BFNone)
+		if !test.wantErr {
+			if err != nil {
+				t.Fatalf("%q: unexpected error: %v", test.name, err)
+			}
+		} else {
+			rerr, ok := err.(RuleError)
+			if !ok || rerr.ErrorCode != test.wantCode {
+				t.Fatalf("%q: unexpected error -- got %v, want %v",
+					test.name, err, test.wantCode)
+			}
+		}
+
+		// Ensure the block was not added and the chain was not modified.
+		if g.chain.index.LookupNode(block.Hash()) != nil {
+			t.Fatalf("%q: block was added to the block index", test.name)
+		}
+		g.ExpectTip("b2")
+	}
+}
@@ -74,7 +74,7 @@ func extractRejectCode(err error) (wire.RejectCode, bool) {
 		var code wire.RejectCode
 		switch err.ErrorCode {
 		// Rejected due to duplicate.
-		case blockchain.ErrDuplicateBlock:
+		case blockchain.ErrDuplicateBlock, blockchain.ErrDuplicateOrphan:
 			code = wire.RejectDuplicate
 
 		// Rejected due to obsolete version.
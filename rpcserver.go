@@ -2818,7 +2818,7 @@ func chainErrToGBTErrString(err error) string {
 	}
 
 	switch ruleErr.ErrorCode {
-	case blockchain.ErrDuplicateBlock:
+	case blockchain.ErrDuplicateBlock, blockchain.ErrDuplicateOrphan:
 		return "duplicate"
 	case blockchain.ErrBlockTooBig:
 		return "bad-block-size"